@@ -4,6 +4,7 @@ import (
 	"log"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
@@ -29,6 +30,116 @@ type EnvVar struct {
 	DefaultDomain       string `env:"DEFAULT_DOMAIN" envDefault:"localhost"`
 	ResendFromEmail     string `env:"RESEND_FROM_EMAIL"`
 	ResendFromName      string `env:"RESEND_FROM_NAME" envDefault:"Neploy"`
+
+	// Gateway access log
+	AccessLogOutput        string        `env:"ACCESS_LOG_OUTPUT" envDefault:"stdout"`
+	AccessLogFormat        string        `env:"ACCESS_LOG_FORMAT" envDefault:"json"`
+	AccessLogMaxSizeMB     int           `env:"ACCESS_LOG_MAX_SIZE_MB" envDefault:"100"`
+	AccessLogRotateEach    time.Duration `env:"ACCESS_LOG_ROTATE_EACH" envDefault:"24h"`
+	AccessLogMaxBackups    int           `env:"ACCESS_LOG_MAX_BACKUPS" envDefault:"7"`
+	AccessLogFields        []string      `env:"ACCESS_LOG_FIELDS" envSeparator:","`
+	AccessLogSampleRate    float64       `env:"ACCESS_LOG_SAMPLE_RATE" envDefault:"1"`
+	AccessLogCaptureBody   bool          `env:"ACCESS_LOG_CAPTURE_BODY" envDefault:"false"`
+	AccessLogMaxBodyBytes  int           `env:"ACCESS_LOG_MAX_BODY_BYTES" envDefault:"10000"`
+	AccessLogRedactHeaders []string      `env:"ACCESS_LOG_REDACT_HEADERS" envSeparator:","`
+	AccessLogRedactQuery   []string      `env:"ACCESS_LOG_REDACT_QUERY" envSeparator:","`
+	AccessLogRedactFields  []string      `env:"ACCESS_LOG_REDACT_FIELDS" envSeparator:","`
+
+	// Visitor trace ingestion. Traces are queued and written in batches, when
+	// the queue is full they are dropped or, with "block", the request waits.
+	// Sessions are tracked in memory, so they are only exact with a single
+	// instance.
+	VisitorTraceQueueSize  int           `env:"VISITOR_TRACE_QUEUE_SIZE" envDefault:"10000"`
+	VisitorTraceBatchSize  int           `env:"VISITOR_TRACE_BATCH_SIZE" envDefault:"500"`
+	VisitorTraceFlushEach  time.Duration `env:"VISITOR_TRACE_FLUSH_EACH" envDefault:"2s"`
+	VisitorTraceOnOverflow string        `env:"VISITOR_TRACE_ON_OVERFLOW" envDefault:"drop"`
+	VisitorSessionTimeout  time.Duration `env:"VISITOR_SESSION_TIMEOUT" envDefault:"30m"`
+
+	// GeoIP databases in MaxMind format (.mmdb), a City or Country one and an
+	// optional ASN one. Visitors are not located when empty.
+	GeoIPDatabase    string `env:"GEOIP_DATABASE"`
+	GeoIPASNDatabase string `env:"GEOIP_ASN_DATABASE"`
+
+	// Data retention, run every RetentionRunEach. Hourly stats are rolled up
+	// into daily ones and those into monthly ones once older than their
+	// retention, visitor traces are aggregated per day and then deleted.
+	// A zero retention keeps the rows forever.
+	RetentionRunEach       time.Duration `env:"RETENTION_RUN_EACH" envDefault:"1h"`
+	StatsHourlyRetention   time.Duration `env:"STATS_HOURLY_RETENTION" envDefault:"168h"`
+	StatsDailyRetention    time.Duration `env:"STATS_DAILY_RETENTION" envDefault:"2160h"`
+	StatsMonthlyRetention  time.Duration `env:"STATS_MONTHLY_RETENTION" envDefault:"0"`
+	VisitorTracesRetention time.Duration `env:"VISITOR_TRACES_RETENTION" envDefault:"720h"`
+	TracesRetention        time.Duration `env:"TRACES_RETENTION" envDefault:"2160h"`
+	HealthChecksRetention  time.Duration `env:"HEALTH_CHECKS_RETENTION" envDefault:"2232h"`
+	MirrorSamplesRetention time.Duration `env:"MIRROR_SAMPLES_RETENTION" envDefault:"336h"`
+
+	// Outgoing email. EmailProvider is resend or smtp. SMTPTLS is starttls,
+	// tls (implicit, usually port 465) or none for local relays like MailHog,
+	// the SMTP credentials are optional. EmailFrom and EmailFromName fall
+	// back to RESEND_FROM_EMAIL and RESEND_FROM_NAME.
+	EmailProvider string `env:"EMAIL_PROVIDER" envDefault:"resend"`
+	EmailFrom     string `env:"EMAIL_FROM"`
+	EmailFromName string `env:"EMAIL_FROM_NAME"`
+	SMTPHost      string `env:"SMTP_HOST" envDefault:"localhost"`
+	SMTPPort      string `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername  string `env:"SMTP_USERNAME"`
+	SMTPPassword  string `env:"SMTP_PASSWORD"`
+	SMTPTLS       string `env:"SMTP_TLS" envDefault:"starttls"`
+
+	// The gateway keeps its config and version table in memory, reloaded on
+	// every change notified by Postgres and every GatewaySnapshotRefreshEach
+	// in case a notification was missed
+	GatewaySnapshotRefreshEach time.Duration `env:"GATEWAY_SNAPSHOT_REFRESH_EACH" envDefault:"1m"`
+
+	// Gateways are health checked every HealthCheckInterval unless they set
+	// their own interval
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"30s"`
+
+	// The router table and the containers are reconciled with the gateways
+	// and versions at startup and every ReconcileEach, zero keeps only the
+	// startup pass. Without ReconcileContainers container drift is only
+	// reported.
+	ReconcileEach       time.Duration `env:"RECONCILE_EACH" envDefault:"30s"`
+	ReconcileContainers bool          `env:"RECONCILE_CONTAINERS" envDefault:"true"`
+
+	// Traffic mirroring to candidate versions. At most MirrorMaxInFlight
+	// mirrored requests wait on candidates, each for up to MirrorTimeout, and
+	// requests with bodies over MirrorMaxBodyBytes are not mirrored.
+	MirrorMaxInFlight  int           `env:"MIRROR_MAX_IN_FLIGHT" envDefault:"100"`
+	MirrorTimeout      time.Duration `env:"MIRROR_TIMEOUT" envDefault:"10s"`
+	MirrorMaxBodyBytes int64         `env:"MIRROR_MAX_BODY_BYTES" envDefault:"1048576"`
+
+	// Requests to deprecated versions are counted per consumer, the value of
+	// GatewayConsumerHeader or the client IP without it
+	GatewayConsumerHeader string `env:"GATEWAY_CONSUMER_HEADER" envDefault:"X-Consumer-ID"`
+
+	// Comma separated IPs and CIDRs of the proxies in front of neploy. Their
+	// X-Forwarded-For and X-Real-IP headers name the client, everyone else's
+	// are dropped and the connection address is used.
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+
+	// TLS connections on L4SNIAddr are forwarded by the server name they ask
+	// for to the L4 routes with that SNI host, empty disables SNI routes
+	L4SNIAddr string `env:"L4_SNI_ADDR"`
+
+	// Uptime percentage the monthly SLA reports are measured against
+	SLATarget float64 `env:"SLA_TARGET" envDefault:"99.9"`
+
+	// Alert rules are evaluated every AlertsEvaluateEach
+	AlertsEvaluateEach time.Duration `env:"ALERTS_EVALUATE_EACH" envDefault:"30s"`
+
+	// Prometheus metrics. With MetricsAddr set they are served on a separate
+	// admin listener, otherwise on /metrics of the main one behind MetricsToken.
+	MetricsAddr       string        `env:"METRICS_ADDR"`
+	MetricsToken      string        `env:"METRICS_TOKEN"`
+	MetricsSampleEach time.Duration `env:"METRICS_CONTAINER_SAMPLE_EACH" envDefault:"30s"`
+
+	// OpenTelemetry tracing, exported over OTLP/HTTP
+	OtelEnabled     bool    `env:"OTEL_ENABLED" envDefault:"false"`
+	OtelEndpoint    string  `env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" envDefault:"http://localhost:4318/v1/traces"`
+	OtelInsecure    bool    `env:"OTEL_EXPORTER_OTLP_INSECURE" envDefault:"true"`
+	OtelServiceName string  `env:"OTEL_SERVICE_NAME" envDefault:"neploy"`
+	OtelSampleRatio float64 `env:"OTEL_SAMPLE_RATIO" envDefault:"1"`
 }
 
 var Env EnvVar
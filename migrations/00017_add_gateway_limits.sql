@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE gateway_config
+    ADD COLUMN IF NOT EXISTS read_timeout        INTEGER NOT NULL DEFAULT 30,
+    ADD COLUMN IF NOT EXISTS read_header_timeout INTEGER NOT NULL DEFAULT 10,
+    ADD COLUMN IF NOT EXISTS write_timeout       INTEGER NOT NULL DEFAULT 60,
+    ADD COLUMN IF NOT EXISTS idle_timeout        INTEGER NOT NULL DEFAULT 120,
+    ADD COLUMN IF NOT EXISTS max_header_bytes    INTEGER NOT NULL DEFAULT 1048576,
+    ADD COLUMN IF NOT EXISTS max_body_bytes      BIGINT  NOT NULL DEFAULT 10485760,
+    ADD COLUMN IF NOT EXISTS max_conns_per_ip    INTEGER NOT NULL DEFAULT 100;
+
+-- 0 means "use the gateway_config default"
+ALTER TABLE gateways
+    ADD COLUMN IF NOT EXISTS max_body_bytes BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE gateways
+    DROP COLUMN IF EXISTS max_body_bytes;
+
+ALTER TABLE gateway_config
+    DROP COLUMN IF EXISTS read_timeout,
+    DROP COLUMN IF EXISTS read_header_timeout,
+    DROP COLUMN IF EXISTS write_timeout,
+    DROP COLUMN IF EXISTS idle_timeout,
+    DROP COLUMN IF EXISTS max_header_bytes,
+    DROP COLUMN IF EXISTS max_body_bytes,
+    DROP COLUMN IF EXISTS max_conns_per_ip;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE visitor_traces
+    ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS trace_id   TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE traces
+    ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_visitor_traces_request_id ON visitor_traces (request_id);
+CREATE INDEX IF NOT EXISTS idx_traces_request_id ON traces (request_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_traces_request_id;
+DROP INDEX IF EXISTS idx_visitor_traces_request_id;
+
+ALTER TABLE traces
+    DROP COLUMN IF EXISTS request_id;
+
+ALTER TABLE visitor_traces
+    DROP COLUMN IF EXISTS request_id,
+    DROP COLUMN IF EXISTS trace_id;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE application_stats ADD COLUMN IF NOT EXISTS version TEXT NOT NULL DEFAULT '';
+
+-- Rows were written as repeated snapshots of the same hour, keep the
+-- largest count in one row per app, version and hour
+WITH totals AS (
+    SELECT
+        application_id,
+        version,
+        date,
+        MAX(requests) AS requests,
+        MAX(errors) AS errors,
+        (ARRAY_AGG(id ORDER BY created_at DESC, id DESC))[1] AS keep_id
+    FROM application_stats
+    GROUP BY application_id, version, date
+    HAVING COUNT(*) > 1
+)
+UPDATE application_stats s
+SET requests = t.requests, errors = t.errors
+FROM totals t
+WHERE s.id = t.keep_id;
+
+WITH duplicates AS (
+    SELECT
+        id,
+        ROW_NUMBER() OVER (
+            PARTITION BY application_id, version, date
+            ORDER BY created_at DESC, id DESC
+        ) as rn
+    FROM application_stats
+)
+DELETE FROM application_stats
+WHERE id IN (
+    SELECT id FROM duplicates WHERE rn > 1
+);
+
+ALTER TABLE application_stats
+ADD CONSTRAINT unique_app_stat_hour UNIQUE (application_id, version, date);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE application_stats DROP CONSTRAINT IF EXISTS unique_app_stat_hour;
+ALTER TABLE application_stats DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE application_stats
+    ADD COLUMN IF NOT EXISTS bytes_in  BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS bytes_out BIGINT NOT NULL DEFAULT 0;
+
+-- Latency sketch buckets, see metrics.LatencySketch
+CREATE TABLE IF NOT EXISTS application_stat_latencies (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    bucket         INTEGER NOT NULL,
+    count          BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_latency UNIQUE (application_id, version, date, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS application_stat_status_codes (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    method         TEXT NOT NULL,
+    status         INTEGER NOT NULL,
+    count          BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_status UNIQUE (application_id, version, date, method, status)
+);
+
+CREATE INDEX IF NOT EXISTS idx_application_stat_latencies_date ON application_stat_latencies (date);
+CREATE INDEX IF NOT EXISTS idx_application_stat_status_codes_date ON application_stat_status_codes (date);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS application_stat_status_codes;
+DROP TABLE IF EXISTS application_stat_latencies;
+
+ALTER TABLE application_stats
+    DROP COLUMN IF EXISTS bytes_in,
+    DROP COLUMN IF EXISTS bytes_out;
+-- +goose StatementEnd
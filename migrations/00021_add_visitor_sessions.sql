@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- visit_duration always held the proxy latency of a single request
+ALTER TABLE visitor_traces RENAME COLUMN visit_duration TO latency_ms;
+
+ALTER TABLE visitor_traces
+    ADD COLUMN IF NOT EXISTS version    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS visitor_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS session_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS referrer   TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_visitor_traces_app_timestamp ON visitor_traces (application_id, visit_timestamp);
+CREATE INDEX IF NOT EXISTS idx_visitor_traces_session ON visitor_traces (session_id, visit_timestamp);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_visitor_traces_session;
+DROP INDEX IF EXISTS idx_visitor_traces_app_timestamp;
+
+ALTER TABLE visitor_traces
+    DROP COLUMN IF EXISTS version,
+    DROP COLUMN IF EXISTS visitor_id,
+    DROP COLUMN IF EXISTS session_id,
+    DROP COLUMN IF EXISTS referrer;
+
+ALTER TABLE visitor_traces RENAME COLUMN latency_ms TO visit_duration;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE visitor_traces
+    ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS region  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS city    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS asn     BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS as_org  TEXT NOT NULL DEFAULT '';
+
+-- Country access rules, geo_countries holds comma separated ISO codes
+ALTER TABLE gateways
+    ADD COLUMN IF NOT EXISTS geo_mode      TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS geo_countries TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE gateways
+    ADD CONSTRAINT check_geo_mode CHECK (geo_mode IN ('', 'allow', 'block'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE gateways DROP CONSTRAINT IF EXISTS check_geo_mode;
+
+ALTER TABLE gateways
+    DROP COLUMN IF EXISTS geo_mode,
+    DROP COLUMN IF EXISTS geo_countries;
+
+ALTER TABLE visitor_traces
+    DROP COLUMN IF EXISTS country,
+    DROP COLUMN IF EXISTS region,
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS asn,
+    DROP COLUMN IF EXISTS as_org;
+-- +goose StatementEnd
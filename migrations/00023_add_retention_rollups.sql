@@ -0,0 +1,105 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Hourly stats are rolled up into days and then into months by the retention
+-- job, date holds the start of the day or month in UTC
+CREATE TABLE IF NOT EXISTS application_stats_daily (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    requests       BIGINT NOT NULL DEFAULT 0,
+    errors         BIGINT NOT NULL DEFAULT 0,
+    bytes_in       BIGINT NOT NULL DEFAULT 0,
+    bytes_out      BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_day UNIQUE (application_id, version, date)
+);
+
+CREATE TABLE IF NOT EXISTS application_stats_monthly (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    requests       BIGINT NOT NULL DEFAULT 0,
+    errors         BIGINT NOT NULL DEFAULT 0,
+    bytes_in       BIGINT NOT NULL DEFAULT 0,
+    bytes_out      BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_month UNIQUE (application_id, version, date)
+);
+
+CREATE TABLE IF NOT EXISTS application_stat_latencies_daily (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    bucket         INTEGER NOT NULL,
+    count          BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_latency_day UNIQUE (application_id, version, date, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS application_stat_latencies_monthly (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    bucket         INTEGER NOT NULL,
+    count          BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_latency_month UNIQUE (application_id, version, date, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS application_stat_status_codes_daily (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    method         TEXT NOT NULL,
+    status         INTEGER NOT NULL,
+    count          BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_status_day UNIQUE (application_id, version, date, method, status)
+);
+
+CREATE TABLE IF NOT EXISTS application_stat_status_codes_monthly (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           TIMESTAMP WITH TIME ZONE NOT NULL,
+    method         TEXT NOT NULL,
+    status         INTEGER NOT NULL,
+    count          BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_app_stat_status_month UNIQUE (application_id, version, date, method, status)
+);
+
+-- Daily visitor aggregates kept once raw visitor traces are purged
+CREATE TABLE IF NOT EXISTS visitor_stats_daily (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           DATE NOT NULL,
+    page_views     BIGINT NOT NULL DEFAULT 0,
+    visitors       BIGINT NOT NULL DEFAULT 0,
+    sessions       BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_visitor_stat_day UNIQUE (application_id, version, date)
+);
+
+CREATE TABLE IF NOT EXISTS visitor_pages_daily (
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL DEFAULT '',
+    date           DATE NOT NULL,
+    page           TEXT NOT NULL,
+    views          BIGINT NOT NULL DEFAULT 0,
+    visitors       BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT unique_visitor_page_day UNIQUE (application_id, version, date, page)
+);
+
+CREATE INDEX IF NOT EXISTS idx_application_stats_date ON application_stats (date);
+CREATE INDEX IF NOT EXISTS idx_traces_created_at ON traces (created_at);
+CREATE INDEX IF NOT EXISTS idx_visitor_traces_timestamp ON visitor_traces (visit_timestamp);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_visitor_traces_timestamp;
+DROP INDEX IF EXISTS idx_traces_created_at;
+DROP INDEX IF EXISTS idx_application_stats_date;
+
+DROP TABLE IF EXISTS visitor_pages_daily;
+DROP TABLE IF EXISTS visitor_stats_daily;
+DROP TABLE IF EXISTS application_stat_status_codes_monthly;
+DROP TABLE IF EXISTS application_stat_status_codes_daily;
+DROP TABLE IF EXISTS application_stat_latencies_monthly;
+DROP TABLE IF EXISTS application_stat_latencies_daily;
+DROP TABLE IF EXISTS application_stats_monthly;
+DROP TABLE IF EXISTS application_stats_daily;
+-- +goose StatementEnd
@@ -0,0 +1,60 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A rule fires when its metric stays above threshold for for_seconds.
+-- targets holds comma separated notification targets.
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    name           TEXT NOT NULL,
+    metric         TEXT NOT NULL,
+    threshold      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    window_seconds INTEGER NOT NULL DEFAULT 300,
+    for_seconds    INTEGER NOT NULL DEFAULT 0,
+    severity       TEXT NOT NULL DEFAULT 'warning',
+    targets        TEXT NOT NULL DEFAULT '',
+    enabled        BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_alert_metric CHECK (metric IN ('error_rate', 'latency_p95', 'container_down', 'cpu', 'memory', 'health_check')),
+    CONSTRAINT check_alert_severity CHECK (severity IN ('info', 'warning', 'critical')),
+    CONSTRAINT check_alert_window CHECK (window_seconds > 0 AND for_seconds >= 0)
+);
+
+CREATE TRIGGER update_alert_rules_updated_at BEFORE
+UPDATE ON alert_rules FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Alert history, a row per time a rule started matching
+CREATE TABLE IF NOT EXISTS alerts (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rule_id           UUID NOT NULL REFERENCES alert_rules (id) ON DELETE CASCADE,
+    application_id    UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    status            TEXT NOT NULL,
+    severity          TEXT NOT NULL,
+    value             DOUBLE PRECISION NOT NULL DEFAULT 0,
+    message           TEXT NOT NULL DEFAULT '',
+    started_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+    fired_at          TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    resolved_at       TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    last_evaluated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at        TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at        TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at        TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_alert_status CHECK (status IN ('pending', 'firing', 'resolved'))
+);
+
+CREATE TRIGGER update_alerts_updated_at BEFORE
+UPDATE ON alerts FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- A rule has at most one open alert, repeated matches update it
+CREATE UNIQUE INDEX IF NOT EXISTS unique_open_alert ON alerts (rule_id) WHERE status IN ('pending', 'firing');
+CREATE INDEX IF NOT EXISTS idx_alerts_app_started ON alerts (application_id, started_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS alert_rules;
+-- +goose StatementEnd
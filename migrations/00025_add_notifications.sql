@@ -0,0 +1,58 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An outbound channel. webhook and slack post to url, email sends to the
+-- comma separated recipients. events holds the comma separated event types
+-- routed to the channel, empty routes all of them.
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       TEXT NOT NULL,
+    type       TEXT NOT NULL,
+    url        TEXT NOT NULL DEFAULT '',
+    secret     TEXT NOT NULL DEFAULT '',
+    recipients TEXT NOT NULL DEFAULT '',
+    events     TEXT NOT NULL DEFAULT '',
+    enabled    BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_notification_channel_type CHECK (type IN ('webhook', 'slack', 'email'))
+);
+
+CREATE TRIGGER update_notification_channels_updated_at BEFORE
+UPDATE ON notification_channels FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE UNIQUE INDEX IF NOT EXISTS unique_notification_channel_name ON notification_channels (name) WHERE deleted_at IS NULL;
+
+-- Delivery log, a row per event sent to a channel. Pending rows are retried
+-- at next_attempt_at until they are delivered or run out of attempts.
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    channel_id      UUID NOT NULL REFERENCES notification_channels (id) ON DELETE CASCADE,
+    event           TEXT NOT NULL,
+    payload         JSONB NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    delivered_at    TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at      TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_notification_delivery_status CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+CREATE TRIGGER update_notification_deliveries_updated_at BEFORE
+UPDATE ON notification_deliveries FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_due ON notification_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_channel ON notification_deliveries (channel_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS notification_channels;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Emails waiting to be sent. A failed send is retried at next_attempt_at
+-- until it goes through or runs out of attempts, html is cleared once the
+-- email is sent or given up on since it may hold invitation or reset links.
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    from_address    TEXT NOT NULL,
+    recipients      TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    html            TEXT NOT NULL DEFAULT '',
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    sent_at         TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at      TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_email_outbox_status CHECK (status IN ('pending', 'sent', 'failed'))
+);
+
+CREATE TRIGGER update_email_outbox_updated_at BEFORE
+UPDATE ON email_outbox FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox (next_attempt_at) WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS email_outbox;
+-- +goose StatementEnd
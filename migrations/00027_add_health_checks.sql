@@ -0,0 +1,56 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Health check settings, zero values use the defaults: GET /health, any
+-- 2xx, no body check, HEALTH_CHECK_INTERVAL, a 5s timeout, 2 passes to be
+-- healthy and 3 failures to be unhealthy
+ALTER TABLE gateways
+    ADD COLUMN IF NOT EXISTS health_path            TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS health_method          TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS health_expected_status INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS health_expected_body   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS health_interval        INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS health_timeout         INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS healthy_threshold      INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS unhealthy_threshold    INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS health_status          TEXT NOT NULL DEFAULT 'unknown';
+
+ALTER TABLE gateways
+    ADD CONSTRAINT check_health_status CHECK (health_status IN ('unknown', 'healthy', 'unhealthy'));
+
+-- A row per probe, the source of uptime percentages
+CREATE TABLE IF NOT EXISTS health_checks (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    gateway_id     UUID NOT NULL REFERENCES gateways (id) ON DELETE CASCADE,
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    healthy        BOOLEAN NOT NULL,
+    status_code    INTEGER NOT NULL DEFAULT 0,
+    latency_ms     BIGINT NOT NULL DEFAULT 0,
+    error          TEXT NOT NULL DEFAULT '',
+    checked_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_health_checks_gateway_checked ON health_checks (gateway_id, checked_at);
+CREATE INDEX IF NOT EXISTS idx_health_checks_app_checked ON health_checks (application_id, checked_at);
+CREATE INDEX IF NOT EXISTS idx_health_checks_checked ON health_checks (checked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS health_checks;
+
+ALTER TABLE gateways DROP CONSTRAINT IF EXISTS check_health_status;
+
+ALTER TABLE gateways
+    DROP COLUMN IF EXISTS health_path,
+    DROP COLUMN IF EXISTS health_method,
+    DROP COLUMN IF EXISTS health_expected_status,
+    DROP COLUMN IF EXISTS health_expected_body,
+    DROP COLUMN IF EXISTS health_interval,
+    DROP COLUMN IF EXISTS health_timeout,
+    DROP COLUMN IF EXISTS healthy_threshold,
+    DROP COLUMN IF EXISTS unhealthy_threshold,
+    DROP COLUMN IF EXISTS health_status;
+-- +goose StatementEnd
@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Applications shown on the public status page, in position order.
+-- display_name replaces the application name when set.
+CREATE TABLE IF NOT EXISTS status_page_applications (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    display_name   TEXT NOT NULL DEFAULT '',
+    position       INTEGER NOT NULL DEFAULT 0,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS unique_status_page_application ON status_page_applications (application_id);
+
+-- Incidents posted by admins, of one application or of the whole platform
+-- when application_id is NULL. impact is minor (degraded) or major (outage).
+CREATE TABLE IF NOT EXISTS incidents (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id UUID DEFAULT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    title          TEXT NOT NULL,
+    impact         TEXT NOT NULL,
+    status         TEXT NOT NULL DEFAULT 'investigating',
+    started_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+    resolved_at    TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_incident_impact CHECK (impact IN ('minor', 'major')),
+    CONSTRAINT check_incident_status CHECK (status IN ('investigating', 'identified', 'monitoring', 'resolved'))
+);
+
+CREATE TRIGGER update_incidents_updated_at BEFORE
+UPDATE ON incidents FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX IF NOT EXISTS idx_incidents_started ON incidents (started_at);
+CREATE INDEX IF NOT EXISTS idx_incidents_app_started ON incidents (application_id, started_at);
+
+-- The notes of an incident, each one moves it to its status
+CREATE TABLE IF NOT EXISTS incident_updates (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    incident_id UUID NOT NULL REFERENCES incidents (id) ON DELETE CASCADE,
+    status      TEXT NOT NULL,
+    message     TEXT NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at  TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_incident_update_status CHECK (status IN ('investigating', 'identified', 'monitoring', 'resolved'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_updates_incident ON incident_updates (incident_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS incident_updates;
+DROP TABLE IF EXISTS incidents;
+DROP TABLE IF EXISTS status_page_applications;
+-- +goose StatementEnd
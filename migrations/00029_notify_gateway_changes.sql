@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every instance keeps the gateway config, gateways and versions in memory
+-- and reloads them when one of these tables changes, on any instance
+CREATE OR REPLACE FUNCTION notify_gateway_change () RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('neploy_gateway', TG_TABLE_NAME);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER notify_gateway_config_change AFTER INSERT OR UPDATE OR DELETE ON gateway_config
+FOR EACH STATEMENT EXECUTE FUNCTION notify_gateway_change ();
+
+CREATE TRIGGER notify_gateways_change AFTER INSERT OR UPDATE OR DELETE ON gateways
+FOR EACH STATEMENT EXECUTE FUNCTION notify_gateway_change ();
+
+CREATE TRIGGER notify_application_versions_change AFTER INSERT OR UPDATE OR DELETE ON application_versions
+FOR EACH STATEMENT EXECUTE FUNCTION notify_gateway_change ();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS notify_application_versions_change ON application_versions;
+DROP TRIGGER IF EXISTS notify_gateways_change ON gateways;
+DROP TRIGGER IF EXISTS notify_gateway_config_change ON gateway_config;
+DROP FUNCTION IF EXISTS notify_gateway_change ();
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Protocol to the container, '' proxies HTTP/1.1, h2c and grpc HTTP/2
+-- without TLS
+ALTER TABLE gateways
+    ADD COLUMN IF NOT EXISTS protocol TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE gateways
+    ADD CONSTRAINT check_protocol CHECK (protocol IN ('', 'h2c', 'grpc'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE gateways DROP CONSTRAINT IF EXISTS check_protocol;
+
+ALTER TABLE gateways
+    DROP COLUMN IF EXISTS protocol;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Raw TCP and UDP forwarding to a container port. A route listens on
+-- listen_port, or takes the TLS connections of the SNI listener asking for
+-- sni_host. allow_cidrs and deny_cidrs hold comma separated CIDRs.
+CREATE TABLE IF NOT EXISTS l4_routes (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    protocol       TEXT NOT NULL DEFAULT 'tcp',
+    listen_port    INTEGER NOT NULL DEFAULT 0,
+    sni_host       TEXT NOT NULL DEFAULT '',
+    target_port    TEXT NOT NULL,
+    max_conns      INTEGER NOT NULL DEFAULT 0,
+    idle_timeout   INTEGER NOT NULL DEFAULT 0,
+    allow_cidrs    TEXT NOT NULL DEFAULT '',
+    deny_cidrs     TEXT NOT NULL DEFAULT '',
+    enabled        BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_l4_protocol CHECK (protocol IN ('tcp', 'udp')),
+    CONSTRAINT check_l4_listen CHECK (
+        (sni_host = '' AND listen_port BETWEEN 1 AND 65535)
+        OR (sni_host <> '' AND listen_port = 0 AND protocol = 'tcp')
+    ),
+    CONSTRAINT check_l4_limits CHECK (max_conns >= 0 AND idle_timeout >= 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_l4_routes_listen ON l4_routes (protocol, listen_port)
+    WHERE deleted_at IS NULL AND sni_host = '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_l4_routes_sni_host ON l4_routes (LOWER(sni_host))
+    WHERE deleted_at IS NULL AND sni_host <> '';
+
+CREATE TRIGGER update_l4_routes_updated_at BEFORE
+UPDATE ON l4_routes FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS l4_routes;
+-- +goose StatementEnd
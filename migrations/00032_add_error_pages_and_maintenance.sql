@@ -0,0 +1,56 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Templates the gateway answers with instead of its default error pages,
+-- html for browsers and json for everyone else, an empty one keeps the
+-- default for that format
+CREATE TABLE IF NOT EXISTS application_error_pages (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    status         INTEGER NOT NULL,
+    html           TEXT NOT NULL DEFAULT '',
+    json           TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_error_page_status CHECK (status IN (404, 429, 502, 503, 504)),
+    CONSTRAINT unique_error_page UNIQUE (application_id, status)
+);
+
+CREATE TRIGGER update_application_error_pages_updated_at BEFORE
+UPDATE ON application_error_pages FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- While enabled the gateway answers 503 with Retry-After and the 503 page,
+-- except to allow_ips (comma separated CIDRs) and requests carrying
+-- bypass_token in the X-Maintenance-Bypass header
+CREATE TABLE IF NOT EXISTS application_maintenance (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id UUID NOT NULL UNIQUE REFERENCES applications (id) ON DELETE CASCADE,
+    enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+    message        TEXT NOT NULL DEFAULT '',
+    retry_after    INTEGER NOT NULL DEFAULT 0,
+    allow_ips      TEXT NOT NULL DEFAULT '',
+    bypass_token   TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    CONSTRAINT check_maintenance_retry_after CHECK (retry_after >= 0)
+);
+
+CREATE TRIGGER update_application_maintenance_updated_at BEFORE
+UPDATE ON application_maintenance FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Both are part of the gateway snapshot, see migration 00029
+CREATE TRIGGER notify_application_error_pages_change AFTER INSERT OR UPDATE OR DELETE ON application_error_pages
+FOR EACH STATEMENT EXECUTE FUNCTION notify_gateway_change ();
+
+CREATE TRIGGER notify_application_maintenance_change AFTER INSERT OR UPDATE OR DELETE ON application_maintenance
+FOR EACH STATEMENT EXECUTE FUNCTION notify_gateway_change ();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS application_maintenance;
+DROP TABLE IF EXISTS application_error_pages;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A gateway can mirror mirror_percent of its requests to the candidate
+-- version mirror_version, '' mirrors nothing
+ALTER TABLE gateways
+    ADD COLUMN IF NOT EXISTS mirror_version TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS mirror_percent DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+ALTER TABLE gateways
+    ADD CONSTRAINT check_mirror_percent CHECK (mirror_percent >= 0 AND mirror_percent <= 100);
+
+-- A mirrored request with the answer of the version that served it and of
+-- the candidate side by side. mirror_status is 0 when the candidate could
+-- not be reached, mirror_error says why.
+CREATE TABLE IF NOT EXISTS mirror_samples (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id     UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version            TEXT NOT NULL,
+    primary_version    TEXT NOT NULL DEFAULT '',
+    method             TEXT NOT NULL,
+    path               TEXT NOT NULL,
+    primary_status     INTEGER NOT NULL,
+    primary_latency_ms DOUBLE PRECISION NOT NULL,
+    mirror_status      INTEGER NOT NULL DEFAULT 0,
+    mirror_latency_ms  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    mirror_error       TEXT NOT NULL DEFAULT '',
+    sampled_at         TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at         TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at         TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at         TIMESTAMP WITH TIME ZONE DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_mirror_samples_app_version_sampled ON mirror_samples (application_id, version, sampled_at);
+CREATE INDEX IF NOT EXISTS idx_mirror_samples_sampled ON mirror_samples (sampled_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS mirror_samples;
+
+ALTER TABLE gateways DROP CONSTRAINT IF EXISTS check_mirror_percent;
+
+ALTER TABLE gateways
+    DROP COLUMN IF EXISTS mirror_version,
+    DROP COLUMN IF EXISTS mirror_percent;
+-- +goose StatementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deprecation lifecycle of a version. From deprecated_at the gateway sends
+-- Deprecation, Sunset and Link headers. From sunset_at it answers 410, or
+-- with sunset_action 'redirect' sends clients to the newest version.
+ALTER TABLE application_versions
+    ADD COLUMN IF NOT EXISTS deprecated_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS sunset_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS migration_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS sunset_action TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE application_versions
+    ADD CONSTRAINT check_sunset_action CHECK (sunset_action IN ('', 'redirect')),
+    ADD CONSTRAINT check_sunset_after_deprecation CHECK (
+        sunset_at IS NULL OR (deprecated_at IS NOT NULL AND sunset_at >= deprecated_at)
+    );
+
+-- Requests to deprecated versions per consumer and day. The consumer is the
+-- value of the consumer header, or the client IP without it.
+CREATE TABLE IF NOT EXISTS deprecated_version_usage (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    application_id UUID NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+    version        TEXT NOT NULL,
+    consumer       TEXT NOT NULL,
+    day            DATE NOT NULL,
+    requests       BIGINT NOT NULL DEFAULT 0,
+    last_seen_at   TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at     TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    UNIQUE (application_id, version, consumer, day)
+);
+
+CREATE TRIGGER update_deprecated_version_usage_updated_at BEFORE
+UPDATE ON deprecated_version_usage FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS deprecated_version_usage;
+
+ALTER TABLE application_versions
+    DROP CONSTRAINT IF EXISTS check_sunset_after_deprecation,
+    DROP CONSTRAINT IF EXISTS check_sunset_action;
+
+ALTER TABLE application_versions
+    DROP COLUMN IF EXISTS deprecated_at,
+    DROP COLUMN IF EXISTS sunset_at,
+    DROP COLUMN IF EXISTS migration_url,
+    DROP COLUMN IF EXISTS sunset_action;
+-- +goose StatementEnd
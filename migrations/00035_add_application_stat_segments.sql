@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Metrics WAL segments whose counts were added to application_stats, in the
+-- same transaction, so a segment replayed after a crash is never counted twice
+CREATE TABLE IF NOT EXISTS application_stat_segments (
+    id         TEXT PRIMARY KEY,
+    applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_application_stat_segments_applied_at ON application_stat_segments (applied_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS application_stat_segments;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A delivery is claimed by the instance sending it until locked_until, so
+-- two instances polling at once never send it twice
+ALTER TABLE notification_deliveries ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE notification_deliveries DROP COLUMN IF EXISTS locked_until;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An email is claimed by the instance sending it until locked_until, so two
+-- instances polling at once never send it twice
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS locked_until;
+-- +goose StatementEnd
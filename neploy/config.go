@@ -1,30 +1,48 @@
 package neploy
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"neploy.dev/config"
 	neployware "neploy.dev/neploy/middleware"
+	"neploy.dev/pkg/email"
 	neployway "neploy.dev/pkg/gateway"
+	"neploy.dev/pkg/geoip"
 	"neploy.dev/pkg/logger"
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/notify"
 	"neploy.dev/pkg/repository"
 	"neploy.dev/pkg/service"
 	"neploy.dev/pkg/store"
+	"neploy.dev/pkg/telemetry"
 	"neploy.dev/pkg/websocket"
 
 	_ "neploy.dev/neploy/docs"
 )
 
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 15 * time.Second
+
 type Neploy struct {
 	DB           store.Queryable
 	Port         string
 	Services     service.Services
 	Repositories repository.Repositories
 	Router       *neployway.Router
+	Forwarder    *neployway.Forwarder
 }
 
 func Start(npy Neploy) {
@@ -36,24 +54,75 @@ func Start(npy Neploy) {
 
 	e := echo.New()
 
+	trustedProxies, err := neployway.ParseCIDRs(config.Env.TrustedProxies)
+	if err != nil {
+		logger.Error("Invalid TRUSTED_PROXIES: %v", err)
+		return
+	}
+	// The client IP is resolved once in ClientIPMiddleware, echo reads it
+	// from there rather than trusting forwarding headers on its own
+	e.IPExtractor = neployway.ClientIP
+
+	// Stopped by SIGINT or SIGTERM, see the end of Start for the order
+	// everything is shut down in
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize repositories
 	repos := NewRepositories(npy)
 	npy.Repositories = repos
 
+	// Tracing
+	shutdownTracing, err := telemetry.Setup(context.Background(), config.Env)
+	if err != nil {
+		logger.Error("Failed to initialize tracing: %v", err)
+		return
+	}
+	defer shutdownTracing(context.Background())
+
+	geo, err := geoip.Open(config.Env.GeoIPDatabase, config.Env.GeoIPASNDatabase)
+	if err != nil {
+		logger.Error("Failed to load GeoIP databases, visitors will not be located: %v", err)
+	}
+	defer geo.Close()
+
 	// Initialize router
+	accessLog, err := NewAccessLogger()
+	if err != nil {
+		logger.Error("Failed to initialize access log: %v", err)
+		return
+	}
+
+	snapshots := neployway.NewSnapshots(npy.Repositories.GatewayConfig, npy.Repositories.Gateway, npy.Repositories.ApplicationVersion, npy.Repositories.ErrorPage, npy.Repositories.Maintenance)
+	if err := snapshots.Load(context.Background()); err != nil {
+		logger.Error("Failed to load gateway snapshot: %v", err)
+	}
+	snapshots.Start(context.Background(), store.DSN(config.Env), config.Env.GatewaySnapshotRefreshEach)
+
 	router := neployway.NewRouter(
 		npy.Repositories.ApplicationStat,
-		npy.Repositories.ApplicationVersion,
-		npy.Repositories.GatewayConfig,
-		npy.Repositories.VisitorTrace,
+		snapshots,
+		NewTraceIngester(npy.Repositories.VisitorTrace, geo),
+		accessLog,
+		geo,
+		neployway.NewMirrorer(npy.Repositories.MirrorSample, neployway.MirrorConfig{
+			MaxInFlight:  config.Env.MirrorMaxInFlight,
+			Timeout:      config.Env.MirrorTimeout,
+			MaxBodyBytes: config.Env.MirrorMaxBodyBytes,
+		}),
+		neployway.NewDeprecationUsage(npy.Repositories.DeprecatedVersionUsage, config.Env.GatewayConsumerHeader),
 	)
 	npy.Router = router
 
+	forwarder := neployway.NewForwarder(config.Env.L4SNIAddr)
+	npy.Forwarder = forwarder
+
 	// Initialize services
 	services := NewServices(npy)
 	npy.Services = services
 
 	// Middleware
+	e.Use(echo.WrapMiddleware(neployway.TracingMiddleware))
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Format: "[${remote_ip}]:${port} ${status} - ${method} ${path} ${latency}\n",
 	}))
@@ -74,6 +143,50 @@ func Start(npy Neploy) {
 	// Swagger
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
+	// Background jobs
+	services.EmailOutbox.Start(context.Background())
+	services.Notification.Start(context.Background())
+	services.ContainerMetrics.Start(context.Background())
+	services.HealthChecker.Start(context.Background())
+	services.Retention.Start(context.Background())
+	services.Alert.Start(context.Background())
+
+	// Runs once the servers are down. The router goes first, its last
+	// metrics flush and trace drain still find the jobs and the database
+	// up; the forwarder last, it records into the router until then.
+	defer func() {
+		router.Close()
+		services.Retention.Stop()
+		services.Alert.Stop()
+		services.Notification.Stop()
+		services.EmailOutbox.Stop()
+		services.HealthChecker.Stop()
+		services.ContainerMetrics.Stop()
+		services.Reconciler.Stop()
+		snapshots.Stop()
+		forwarder.Close()
+	}()
+
+	// Prometheus metrics
+	if config.Env.MetricsAddr != "" {
+		metricsServer := neploymetrics.NewServer(config.Env.MetricsAddr, config.Env.MetricsToken)
+		go func() {
+			logger.Info("Serving metrics on %s/metrics", config.Env.MetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Metrics listener stopped: %v", err)
+			}
+		}()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			metricsServer.Shutdown(ctx)
+		}()
+	} else if config.Env.MetricsToken != "" {
+		e.GET("/metrics", echo.WrapHandler(neploymetrics.Handler(config.Env.MetricsToken)))
+	} else {
+		logger.Warn("Metrics endpoint disabled, set METRICS_ADDR or METRICS_TOKEN to enable it")
+	}
+
 	e.Use(neployware.OnboardingMiddleware(services.Onboard))
 
 	// Validator
@@ -83,6 +196,10 @@ func Start(npy Neploy) {
 	// Routes
 	RegisterRoutes(e, i, npy)
 
+	// Fills the router table from the gateways ensured above and the L4
+	// forwarder, then keeps them and the containers in sync with the database
+	services.Reconciler.Start(context.Background())
+
 	// Static files
 	e.GET("/build/assets/:filename", func(c echo.Context) error {
 		filename := c.Param("filename")
@@ -97,37 +214,144 @@ func Start(npy Neploy) {
 	})
 	e.Static("/assets", "resources/assets")
 
-	e.Start(":" + npy.Port)
+	// Server limits are read once at startup, changing them requires a restart
+	conf, err := npy.Repositories.GatewayConfig.Get(context.Background())
+	if err != nil {
+		logger.Error("Failed to load gateway config, using default server limits: %v", err)
+	}
+
+	server := neployway.NewServer(":"+npy.Port, conf)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		logger.Error("Failed to listen on %s: %v", server.Addr, err)
+		return
+	}
+	maxConns := conf.MaxConnsPerIP
+	if maxConns <= 0 {
+		maxConns = model.DefaultMaxConnsPerIP
+	}
+	e.Listener = neployway.NewConnLimitListener(listener, maxConns, neployway.TrustedProxies(trustedProxies))
+
+	// Served without e.StartServer, it would replace the h2c handler that
+	// lets gRPC clients reach the gateway over plain HTTP/2
+	e.Server = server
+	server.Handler = neployway.ClientIPMiddleware(neployway.TrustedProxies(trustedProxies))(neployway.WriteTimeoutHandler(neployway.H2CHandler(e, server), conf))
+	server.ErrorLog = e.StdLogger
+	logger.Info("Listening on %s", e.Listener.Addr())
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(e.Listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutting down")
+	case err := <-serveErr:
+		logger.Error("Server stopped: %v", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Failed to drain connections: %v", err)
+	}
+}
+
+func NewAccessLogger() (*neployway.AccessLogger, error) {
+	return neployway.NewAccessLogger(neployway.AccessLogConfig{
+		Output:        config.Env.AccessLogOutput,
+		Format:        config.Env.AccessLogFormat,
+		MaxSizeMB:     config.Env.AccessLogMaxSizeMB,
+		RotateEach:    config.Env.AccessLogRotateEach,
+		MaxBackups:    config.Env.AccessLogMaxBackups,
+		Fields:        config.Env.AccessLogFields,
+		SampleRate:    config.Env.AccessLogSampleRate,
+		CaptureBody:   config.Env.AccessLogCaptureBody,
+		MaxBodyBytes:  config.Env.AccessLogMaxBodyBytes,
+		RedactHeaders: config.Env.AccessLogRedactHeaders,
+		RedactQuery:   config.Env.AccessLogRedactQuery,
+		RedactFields:  config.Env.AccessLogRedactFields,
+	})
+}
+
+func NewTraceIngester(repo *repository.VisitorTrace, geo *geoip.DB) *neployway.TraceIngester {
+	return neployway.NewTraceIngester(repo, neployway.TraceIngesterConfig{
+		QueueSize:      config.Env.VisitorTraceQueueSize,
+		BatchSize:      config.Env.VisitorTraceBatchSize,
+		FlushInterval:  config.Env.VisitorTraceFlushEach,
+		OnOverflow:     config.Env.VisitorTraceOnOverflow,
+		SessionTimeout: config.Env.VisitorSessionTimeout,
+		GeoIP:          geo,
+	})
 }
 
 func NewServices(npy Neploy) service.Services {
-	application := service.NewApplication(npy.Repositories, npy.Router)
+	emailSender := email.NewSender()
+	emailOutbox := service.NewEmailOutbox(npy.Repositories, emailSender)
+	mail := email.NewEmail(emailSender, emailOutbox)
+	notification := service.NewNotification(npy.Repositories, notify.NewSenders(mail))
+	// The reconciler owns the router table, services that write gateways
+	// trigger it
+	reconciler := service.NewReconciler(npy.Repositories, npy.Router, npy.Forwarder, notification, config.Env.ReconcileEach, config.Env.ReconcileContainers)
+	application := service.NewApplication(npy.Repositories, reconciler, notification)
 	metadata := service.NewMetadata(npy.Repositories.Metadata)
-	user := service.NewUser(npy.Repositories)
+	user := service.NewUser(npy.Repositories, mail)
 	role := service.NewRole(npy.Repositories.Role, npy.Repositories.UserRole)
 	onboard := service.NewOnboard(user, role, metadata)
-	gateway := service.NewGateway(npy.Repositories)
+	gateway := service.NewGateway(npy.Repositories, npy.Router, reconciler)
 	techStack := service.NewTechStack(npy.Repositories.TechStack, npy.Repositories.Application)
-	trace := service.NewTrace(npy.Repositories.Trace, npy.Repositories.User)
+	trace := service.NewTrace(npy.Repositories.Trace)
 	visitor := service.NewVisitor(npy.Repositories.VisitorTrace)
-	healthChecker := service.NewHealthChecker(npy.Repositories.Gateway, npy.Repositories.Application, time.Minute*5)
+	containerMetrics := service.NewContainerMetrics(npy.Repositories, notification, config.Env.MetricsSampleEach)
+	alert := service.NewAlert(npy.Repositories, npy.Router, containerMetrics, notification, config.Env.AlertsEvaluateEach)
+	retention := service.NewRetention(npy.Repositories, service.RetentionPolicy{
+		StatsHourly:   config.Env.StatsHourlyRetention,
+		StatsDaily:    config.Env.StatsDailyRetention,
+		StatsMonthly:  config.Env.StatsMonthlyRetention,
+		VisitorTraces: config.Env.VisitorTracesRetention,
+		Traces:        config.Env.TracesRetention,
+		HealthChecks:  config.Env.HealthChecksRetention,
+		MirrorSamples: config.Env.MirrorSamplesRetention,
+	}, config.Env.RetentionRunEach)
+	healthChecker := service.NewHealthChecker(npy.Repositories, notification, config.Env.HealthCheckInterval)
+	statusPage := service.NewStatusPage(npy.Repositories, config.Env.SLATarget)
+	l4Route := service.NewL4Route(npy.Repositories, npy.Forwarder)
+	errorPage := service.NewErrorPage(npy.Repositories, npy.Router)
+	mirror := service.NewMirror(npy.Repositories)
+	deprecation := service.NewDeprecation(npy.Repositories, npy.Router)
 
 	return service.Services{
-		Application:   application,
-		Gateway:       gateway,
-		HealthChecker: healthChecker,
-		Metadata:      metadata,
-		Onboard:       onboard,
-		Role:          role,
-		TechStack:     techStack,
-		Trace:         trace,
-		User:          user,
-		Visitor:       visitor,
+		Alert:            alert,
+		Application:      application,
+		ContainerMetrics: containerMetrics,
+		Deprecation:      deprecation,
+		EmailOutbox:      emailOutbox,
+		ErrorPage:        errorPage,
+		Gateway:          gateway,
+		HealthChecker:    healthChecker,
+		L4Route:          l4Route,
+		Metadata:         metadata,
+		Mirror:           mirror,
+		Notification:     notification,
+		Onboard:          onboard,
+		Reconciler:       reconciler,
+		Retention:        retention,
+		Role:             role,
+		StatusPage:       statusPage,
+		TechStack:        techStack,
+		Trace:            trace,
+		User:             user,
+		Visitor:          visitor,
 	}
 }
 
 func NewRepositories(npy Neploy) repository.Repositories {
+	alert := repository.NewAlert(npy.DB)
+	alertRule := repository.NewAlertRule(npy.DB)
 	metadata := repository.NewMetadata(npy.DB)
+	notificationChannel := repository.NewNotificationChannel(npy.DB)
+	notificationDelivery := repository.NewNotificationDelivery(npy.DB)
 	role := repository.NewRole(npy.DB)
 	user := repository.NewUser(npy.DB)
 	// userOauth removed as part of OAuth refactoring
@@ -135,27 +359,51 @@ func NewRepositories(npy Neploy) repository.Repositories {
 	application := repository.NewApplication(npy.DB)
 	applicationStat := repository.NewApplicationStat(npy.DB)
 	appVersion := repository.NewApplicationVersion(npy.DB)
+	deprecatedVersionUsage := repository.NewDeprecatedVersionUsage(npy.DB)
+	emailOutbox := repository.NewEmailOutbox(npy.DB)
+	errorPage := repository.NewErrorPage(npy.DB)
+	maintenance := repository.NewMaintenance(npy.DB)
 	userTechStack := repository.NewUserTechStack(npy.DB)
 	visitorTrace := repository.NewVisitorTrace(npy.DB)
 	techStack := repository.NewTechStack(npy.DB)
 	gateway := repository.NewGateway(npy.DB)
 	gatewayConf := repository.NewGatewayConfig(npy.DB)
+	healthCheck := repository.NewHealthCheck(npy.DB)
+	incident := repository.NewIncident(npy.DB)
+	incidentUpdate := repository.NewIncidentUpdate(npy.DB)
+	l4Route := repository.NewL4Route(npy.DB)
+	mirrorSample := repository.NewMirrorSample(npy.DB)
+	statusPageApplication := repository.NewStatusPageApplication(npy.DB)
 	trace := repository.NewTrace(npy.DB)
 
 	return repository.Repositories{
-		Application:        application,
-		ApplicationStat:    applicationStat,
-		ApplicationVersion: appVersion,
-		Gateway:            gateway,
-		GatewayConfig:      gatewayConf,
-		Metadata:           metadata,
-		Role:               role,
-		TechStack:          techStack,
-		Trace:              trace,
-		User:               user,
+		Alert:                  alert,
+		AlertRule:              alertRule,
+		Application:            application,
+		ApplicationStat:        applicationStat,
+		ApplicationVersion:     appVersion,
+		DeprecatedVersionUsage: deprecatedVersionUsage,
+		EmailOutbox:            emailOutbox,
+		ErrorPage:              errorPage,
+		Gateway:                gateway,
+		GatewayConfig:          gatewayConf,
+		HealthCheck:            healthCheck,
+		Incident:               incident,
+		IncidentUpdate:         incidentUpdate,
+		L4Route:                l4Route,
+		Maintenance:            maintenance,
+		Metadata:               metadata,
+		MirrorSample:           mirrorSample,
+		NotificationChannel:    notificationChannel,
+		NotificationDelivery:   notificationDelivery,
+		Role:                   role,
+		StatusPageApplication:  statusPageApplication,
+		TechStack:              techStack,
+		Trace:                  trace,
+		User:                   user,
 		// UserOauth removed as part of OAuth refactoring
-		UserRole:           userRole,
-		UserTechStack:      userTechStack,
-		VisitorTrace:       visitorTrace,
+		UserRole:      userRole,
+		UserTechStack: userTechStack,
+		VisitorTrace:  visitorTrace,
 	}
 }
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/service"
+)
+
+type Alert struct {
+	alertService service.Alert
+}
+
+func NewAlert(alertService service.Alert) *Alert {
+	return &Alert{alertService: alertService}
+}
+
+func (h *Alert) RegisterRoutes(r *echo.Group) {
+	r.Use(administratorOnly)
+	r.GET("/rules", h.ListRules)
+	r.POST("/rules", h.CreateRule)
+	r.PUT("/rules/:id", h.UpdateRule)
+	r.DELETE("/rules/:id", h.DeleteRule)
+	r.GET("/history", h.History)
+}
+
+// ListRules godoc
+// @Summary List alert rules
+// @Description List the alert rules, optionally of one application
+// @Tags Alert
+// @Produce json
+// @Param application query string false "Application ID"
+// @Success 200 {object} []model.AlertRule
+// @Failure 500 {object} map[string]interface{}
+// @Router /alerts/rules [get]
+func (h *Alert) ListRules(c echo.Context) error {
+	rules, err := h.alertService.GetRules(c.Request().Context(), c.QueryParam("application"))
+	if err != nil {
+		logger.Error("error getting alert rules: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule godoc
+// @Summary Create an alert rule
+// @Description Create an alert rule over an application metric
+// @Tags Alert
+// @Accept json
+// @Produce json
+// @Param request body model.AlertRuleRequest true "Alert rule"
+// @Success 201 {object} model.AlertRule
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /alerts/rules [post]
+func (h *Alert) CreateRule(c echo.Context) error {
+	var req model.AlertRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	rule, err := h.alertService.CreateRule(c.Request().Context(), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule godoc
+// @Summary Update an alert rule
+// @Description Update an alert rule, its open alert is kept
+// @Tags Alert
+// @Accept json
+// @Produce json
+// @Param id path string true "Alert rule ID"
+// @Param request body model.AlertRuleRequest true "Alert rule"
+// @Success 200 {object} model.AlertRule
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /alerts/rules/{id} [put]
+func (h *Alert) UpdateRule(c echo.Context) error {
+	var req model.AlertRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	rule, err := h.alertService.UpdateRule(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule godoc
+// @Summary Delete an alert rule
+// @Description Delete an alert rule, an alert it has firing is resolved on the next evaluation
+// @Tags Alert
+// @Param id path string true "Alert rule ID"
+// @Success 204
+// @Failure 500 {object} map[string]interface{}
+// @Router /alerts/rules/{id} [delete]
+func (h *Alert) DeleteRule(c echo.Context) error {
+	if err := h.alertService.DeleteRule(c.Request().Context(), c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// History godoc
+// @Summary Alert history
+// @Description Alerts newest first, pending, firing and resolved
+// @Tags Alert
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param application query string false "Application ID"
+// @Param rule query string false "Alert rule ID"
+// @Param status query string false "pending, firing or resolved"
+// @Success 200 {object} []model.Alert
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /alerts/history [get]
+func (h *Alert) History(c echo.Context) error {
+	stats, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	filter := model.AlertFilter{
+		ApplicationID: stats.ApplicationID,
+		RuleID:        c.QueryParam("rule"),
+		Status:        model.AlertStatus(c.QueryParam("status")),
+		From:          stats.From,
+		To:            stats.To,
+	}
+
+	alerts, err := h.alertService.GetHistory(c.Request().Context(), filter)
+	if err != nil {
+		logger.Error("error getting alert history: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, alerts)
+}
+
+// administratorOnly rejects users without the administrator role
+func administratorOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims, ok := c.Get("claims").(model.JWTClaims)
+		if !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+		}
+
+		if !slices.Contains(claims.RolesLower, "administrator") {
+			return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+		}
+
+		return next(c)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"slices"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
@@ -37,6 +38,8 @@ func (d *Dashboard) RegisterRoutes(r *echo.Group) {
 	r.GET("/gateways", d.Gateways)
 	r.GET("/settings", d.Config)
 	r.GET("/report", d.ReportStats)
+	r.GET("/report/visitors", d.VisitorReport)
+	r.GET("/report/retention", d.RetentionReport)
 }
 
 func (d *Dashboard) Index(c echo.Context) error {
@@ -444,13 +447,124 @@ func (d *Dashboard) ReportStats(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	filter, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	report, err := d.services.Application.GetReport(c.Request().Context(), filter)
+	if err != nil {
+		logger.Error("error getting report: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	visitorReport, err := d.services.Visitor.GetReport(c.Request().Context(), filter)
+	if err != nil {
+		logger.Error("error getting visitor report: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
 	return d.i.Render(c.Response(), c.Request(), "Dashboard/Index", inertia.Props{
-		"user":      user,
-		"teamName":  metadata.TeamName,
-		"logoUrl":   metadata.LogoURL,
-		"stats":     stats,
-		"requests":  requestData,
-		"techStack": techStats,
-		"visitors":  visitors,
+		"user":          user,
+		"teamName":      metadata.TeamName,
+		"logoUrl":       metadata.LogoURL,
+		"stats":         stats,
+		"requests":      requestData,
+		"techStack":     techStats,
+		"visitors":      visitors,
+		"report":        report,
+		"visitorReport": visitorReport,
+		"filters": map[string]string{
+			"from":        c.QueryParam("from"),
+			"to":          c.QueryParam("to"),
+			"application": filter.ApplicationID,
+		},
 	})
 }
+
+// VisitorReport godoc
+// @Summary Visitor analytics
+// @Description Unique visitors per day, sessions, top, entry and exit pages, referrers and locations of each application
+// @Tags Dashboard
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param application query string false "Application ID"
+// @Success 200 {object} model.VisitorReport
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /dashboard/report/visitors [get]
+func (d *Dashboard) VisitorReport(c echo.Context) error {
+	claims, ok := c.Get("claims").(model.JWTClaims)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+
+	if !slices.Contains(claims.RolesLower, "administrator") {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	filter, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	report, err := d.services.Visitor.GetReport(c.Request().Context(), filter)
+	if err != nil {
+		logger.Error("error getting visitor report: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// RetentionReport godoc
+// @Summary Last retention run
+// @Description Rows rolled up or deleted per table by the last run of the data retention jobs
+// @Tags Dashboard
+// @Produce json
+// @Success 200 {object} model.RetentionReport
+// @Failure 404 {object} map[string]interface{}
+// @Router /dashboard/report/retention [get]
+func (d *Dashboard) RetentionReport(c echo.Context) error {
+	claims, ok := c.Get("claims").(model.JWTClaims)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+
+	if !slices.Contains(claims.RolesLower, "administrator") {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	report, ok := d.services.Retention.LastReport()
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "Retention jobs have not run yet")
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// parseStatsFilter reads the from and to dates (YYYY-MM-DD, both inclusive)
+// and the application id of the report query string
+func parseStatsFilter(c echo.Context) (model.StatsFilter, error) {
+	filter := model.StatsFilter{ApplicationID: c.QueryParam("application")}
+
+	if from := c.QueryParam("from"); from != "" {
+		t, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date: %s", from)
+		}
+		filter.From = &t
+	}
+
+	if to := c.QueryParam("to"); to != "" {
+		t, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date: %s", to)
+		}
+		end := t.Add(24*time.Hour - time.Nanosecond)
+		filter.To = &end
+	}
+
+	return filter, nil
+}
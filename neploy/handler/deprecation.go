@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/service"
+)
+
+type Deprecation struct {
+	deprecationService service.Deprecation
+}
+
+func NewDeprecation(deprecationService service.Deprecation) *Deprecation {
+	return &Deprecation{deprecationService: deprecationService}
+}
+
+func (h *Deprecation) RegisterRoutes(r *echo.Group) {
+	r.PUT("/:id/versions/:versionID/deprecation", h.SaveDeprecation, administratorOnly)
+	r.GET("/:id/deprecations/usage", h.Usage)
+}
+
+// SaveDeprecation godoc
+// @Summary Deprecate a version
+// @Description Set the deprecation date, sunset date, migration link and sunset action of a version. From the deprecation the gateway sends Deprecation, Sunset and Link headers for it, from the sunset it answers 410, or with the redirect action 308 to the newest version. Without deprecatedAt the version is no longer deprecated.
+// @Tags Deprecation
+// @Accept json
+// @Produce json
+// @Param id path string true "Application ID"
+// @Param versionID path string true "Version ID"
+// @Param request body model.VersionDeprecationRequest true "Deprecation"
+// @Success 200 {object} model.ApplicationVersion
+// @Failure 400 {object} map[string]interface{}
+// @Router /applications/{id}/versions/{versionID}/deprecation [put]
+func (h *Deprecation) SaveDeprecation(c echo.Context) error {
+	var req model.VersionDeprecationRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	version, err := h.deprecationService.SaveDeprecation(c.Request().Context(), c.Param("id"), c.Param("versionID"), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, version)
+}
+
+// Usage godoc
+// @Summary Usage of deprecated versions
+// @Description Requests to each deprecated version of an application per consumer, identified by the consumer header or the client IP, with the days they were first and last seen
+// @Tags Deprecation
+// @Produce json
+// @Param id path string true "Application ID"
+// @Param from query string false "From date (YYYY-MM-DD)"
+// @Param to query string false "To date (YYYY-MM-DD)"
+// @Success 200 {array} model.DeprecatedVersionReport
+// @Failure 400 {object} map[string]interface{}
+// @Router /applications/{id}/deprecations/usage [get]
+func (h *Deprecation) Usage(c echo.Context) error {
+	filter, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	reports, err := h.deprecationService.Usage(c.Request().Context(), c.Param("id"), filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, reports)
+}
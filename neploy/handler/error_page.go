@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/service"
+)
+
+type ErrorPage struct {
+	errorPageService service.ErrorPage
+}
+
+func NewErrorPage(errorPageService service.ErrorPage) *ErrorPage {
+	return &ErrorPage{errorPageService: errorPageService}
+}
+
+func (h *ErrorPage) RegisterRoutes(r *echo.Group) {
+	r.GET("/:id/error-pages", h.GetPages, administratorOnly)
+	r.PUT("/:id/error-pages/:status", h.SavePage, administratorOnly)
+	r.DELETE("/:id/error-pages/:status", h.DeletePage, administratorOnly)
+	r.GET("/:id/maintenance", h.GetMaintenance, administratorOnly)
+	r.PUT("/:id/maintenance", h.SaveMaintenance, administratorOnly)
+}
+
+// GetPages godoc
+// @Summary List error pages
+// @Description List the error pages an application replaces the gateway ones with
+// @Tags ErrorPage
+// @Produce json
+// @Param id path string true "Application ID"
+// @Success 200 {object} []model.ErrorPage
+// @Failure 500 {object} map[string]interface{}
+// @Router /applications/{id}/error-pages [get]
+func (h *ErrorPage) GetPages(c echo.Context) error {
+	pages, err := h.errorPageService.GetPages(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		logger.Error("error getting error pages: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, pages)
+}
+
+// SavePage godoc
+// @Summary Save an error page
+// @Description Set the page for 404, 429, 502, 503 or 504. HTML is sent to browsers and JSON to everyone else, both are Go templates run with Status, StatusText, Message, RequestID, Path, Maintenance and RetryAfter
+// @Tags ErrorPage
+// @Accept json
+// @Produce json
+// @Param id path string true "Application ID"
+// @Param status path int true "HTTP status"
+// @Param request body model.ErrorPageRequest true "Error page templates"
+// @Success 200 {object} model.ErrorPage
+// @Failure 400 {object} map[string]interface{}
+// @Router /applications/{id}/error-pages/{status} [put]
+func (h *ErrorPage) SavePage(c echo.Context) error {
+	status, err := strconv.Atoi(c.Param("status"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+	}
+
+	var req model.ErrorPageRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	page, err := h.errorPageService.SavePage(c.Request().Context(), c.Param("id"), status, req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// DeletePage godoc
+// @Summary Delete an error page
+// @Description Delete an error page, the gateway goes back to its default one for the status
+// @Tags ErrorPage
+// @Param id path string true "Application ID"
+// @Param status path int true "HTTP status"
+// @Success 204
+// @Failure 500 {object} map[string]interface{}
+// @Router /applications/{id}/error-pages/{status} [delete]
+func (h *ErrorPage) DeletePage(c echo.Context) error {
+	status, err := strconv.Atoi(c.Param("status"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+	}
+
+	if err := h.errorPageService.DeletePage(c.Request().Context(), c.Param("id"), status); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetMaintenance godoc
+// @Summary Get maintenance mode
+// @Description Get the maintenance mode of an application
+// @Tags ErrorPage
+// @Produce json
+// @Param id path string true "Application ID"
+// @Success 200 {object} model.Maintenance
+// @Failure 500 {object} map[string]interface{}
+// @Router /applications/{id}/maintenance [get]
+func (h *ErrorPage) GetMaintenance(c echo.Context) error {
+	maintenance, err := h.errorPageService.GetMaintenance(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, maintenance)
+}
+
+// SaveMaintenance godoc
+// @Summary Set maintenance mode
+// @Description Turn the maintenance mode of an application on or off. While on, the gateway answers 503 with Retry-After and the 503 page, except to the allowed IPs and requests carrying the bypass token in X-Maintenance-Bypass. The token is returned only by the first save and when rotated
+// @Tags ErrorPage
+// @Accept json
+// @Produce json
+// @Param id path string true "Application ID"
+// @Param request body model.MaintenanceRequest true "Maintenance mode"
+// @Success 200 {object} model.MaintenanceResponse
+// @Failure 400 {object} map[string]interface{}
+// @Router /applications/{id}/maintenance [put]
+func (h *ErrorPage) SaveMaintenance(c echo.Context) error {
+	var req model.MaintenanceRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	maintenance, err := h.errorPageService.SaveMaintenance(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, maintenance)
+}
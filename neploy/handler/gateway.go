@@ -29,9 +29,13 @@ func (h *Gateway) RegisterRoutes(r *echo.Group) {
 	r.POST("", h.Create)
 	r.PUT("/:id", h.Update)
 	r.DELETE("/:id", h.Delete)
+	r.GET("/uptime", h.GetUptime)
+	r.GET("/routes", h.LiveRoutes, administratorOnly)
+	r.POST("/routes/trace", h.TraceMatch, administratorOnly)
 	r.GET("/:id", h.Get)
 	r.GET("/app/:appId", h.ListByApp)
 	r.GET("/:id/health", h.CheckHealth)
+	r.GET("/:id/health/history", h.GetHealthHistory)
 	r.POST("/config", h.SaveConfig)
 	r.GET("/config", h.GetConfig)
 }
@@ -152,14 +156,14 @@ func (h *Gateway) ListByApp(c echo.Context) error {
 
 // CheckHealth godoc
 // @Summary Check the health of a gateway
-// @Description Check the health of a gateway
+// @Description Probes the gateway once with its health check settings, the result is not recorded
 // @Tags Gateway
 // @Accept json
 // @Produce json
 // @Param id path string true "Gateway ID"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]interface{}
+// @Success 200 {object} model.HealthCheck
 // @Failure 500 {object} map[string]interface{}
+// @Failure 503 {object} model.HealthCheck
 // @Router /gateways/{id}/health [get]
 func (h *Gateway) CheckHealth(c echo.Context) error {
 	id := c.Param("id")
@@ -168,17 +172,108 @@ func (h *Gateway) CheckHealth(c echo.Context) error {
 		return echo.NewHTTPError(echo.ErrInternalServerError.Code, err.Error())
 	}
 
-	if err := h.healthChecker.CheckGatewayHealth(c.Request().Context(), gateway); err != nil {
-		return echo.NewHTTPError(http.StatusServiceUnavailable, map[string]string{
-			"status":  "unhealthy",
-			"message": err.Error(),
-		})
+	check := h.healthChecker.CheckGatewayHealth(c.Request().Context(), gateway)
+	if !check.Healthy {
+		return c.JSON(http.StatusServiceUnavailable, check)
+	}
+
+	return c.JSON(http.StatusOK, check)
+}
+
+// GetHealthHistory godoc
+// @Summary Health check history of a gateway
+// @Description Lists the recorded health checks of a gateway, newest first
+// @Tags Gateway
+// @Produce json
+// @Param id path string true "Gateway ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD)"
+// @Success 200 {array} model.HealthCheck
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /gateways/{id}/health/history [get]
+func (h *Gateway) GetHealthHistory(c echo.Context) error {
+	filter, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	checks, err := h.healthChecker.GetHistory(c.Request().Context(), c.Param("id"), filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, checks)
+}
+
+// GetUptime godoc
+// @Summary Uptime of the gateways
+// @Description Uptime percentage per day and over the whole range, of one application or all of them
+// @Tags Gateway
+// @Produce json
+// @Param application query string false "Application ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD)"
+// @Success 200 {object} model.UptimeReport
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /gateways/uptime [get]
+func (h *Gateway) GetUptime(c echo.Context) error {
+	filter, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	report, err := h.healthChecker.GetUptime(c.Request().Context(), filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// LiveRoutes godoc
+// @Summary Live routes
+// @Description Routes loaded in the gateway router right now, with their backend, policies and gateway health
+// @Tags Gateway
+// @Produce json
+// @Success 200 {object} []model.LiveRoute
+// @Failure 500 {object} map[string]interface{}
+// @Router /gateways/routes [get]
+func (h *Gateway) LiveRoutes(c echo.Context) error {
+	routes, err := h.gatewayService.LiveRoutes(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, routes)
+}
+
+// TraceMatch godoc
+// @Summary Trace a route match
+// @Description Explain which route and version the gateway would pick for a URL and headers, step by step, without sending the request
+// @Tags Gateway
+// @Accept json
+// @Produce json
+// @Param request body model.TraceMatchRequest true "Request to trace"
+// @Success 200 {object} model.RouteMatch
+// @Failure 400 {object} map[string]interface{}
+// @Router /gateways/routes/trace [post]
+func (h *Gateway) TraceMatch(c echo.Context) error {
+	var req model.TraceMatchRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	match, err := h.gatewayService.TraceMatch(c.Request().Context(), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"status":  "healthy",
-		"message": "Gateway is healthy",
-	})
+	return c.JSON(http.StatusOK, match)
 }
 
 // SaveConfig godoc
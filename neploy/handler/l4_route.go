@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/service"
+)
+
+type L4Route struct {
+	l4RouteService service.L4Route
+}
+
+func NewL4Route(l4RouteService service.L4Route) *L4Route {
+	return &L4Route{l4RouteService: l4RouteService}
+}
+
+func (h *L4Route) RegisterRoutes(r *echo.Group) {
+	r.Use(administratorOnly)
+	r.GET("", h.List)
+	r.POST("", h.Create)
+	r.PUT("/:id", h.Update)
+	r.DELETE("/:id", h.Delete)
+}
+
+// List godoc
+// @Summary List L4 routes
+// @Description List the TCP and UDP routes, optionally of one application, with their connection and byte counters
+// @Tags L4Route
+// @Produce json
+// @Param application query string false "Application ID"
+// @Success 200 {object} []model.L4RouteStatus
+// @Failure 500 {object} map[string]interface{}
+// @Router /l4-routes [get]
+func (h *L4Route) List(c echo.Context) error {
+	routes, err := h.l4RouteService.List(c.Request().Context(), c.QueryParam("application"))
+	if err != nil {
+		logger.Error("error getting L4 routes: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, routes)
+}
+
+// Create godoc
+// @Summary Create an L4 route
+// @Description Forward a host port, or TLS connections by SNI host, to an application container
+// @Tags L4Route
+// @Accept json
+// @Produce json
+// @Param request body model.L4RouteRequest true "L4 route"
+// @Success 201 {object} model.L4Route
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /l4-routes [post]
+func (h *L4Route) Create(c echo.Context) error {
+	var req model.L4RouteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	route, err := h.l4RouteService.Create(c.Request().Context(), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, route)
+}
+
+// Update godoc
+// @Summary Update an L4 route
+// @Description Update an L4 route, open connections keep the settings they were accepted with
+// @Tags L4Route
+// @Accept json
+// @Produce json
+// @Param id path string true "L4 route ID"
+// @Param request body model.L4RouteRequest true "L4 route"
+// @Success 200 {object} model.L4Route
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /l4-routes/{id} [put]
+func (h *L4Route) Update(c echo.Context) error {
+	var req model.L4RouteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	route, err := h.l4RouteService.Update(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, route)
+}
+
+// Delete godoc
+// @Summary Delete an L4 route
+// @Description Delete an L4 route and close its listener, open connections are served until they close or go idle
+// @Tags L4Route
+// @Param id path string true "L4 route ID"
+// @Success 204
+// @Failure 500 {object} map[string]interface{}
+// @Router /l4-routes/{id} [delete]
+func (h *L4Route) Delete(c echo.Context) error {
+	if err := h.l4RouteService.Delete(c.Request().Context(), c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
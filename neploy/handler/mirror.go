@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/service"
+)
+
+type Mirror struct {
+	mirrorService service.Mirror
+}
+
+func NewMirror(mirrorService service.Mirror) *Mirror {
+	return &Mirror{mirrorService: mirrorService}
+}
+
+func (h *Mirror) RegisterRoutes(r *echo.Group) {
+	r.GET("/:id/versions/:versionID/mirror", h.Compare)
+}
+
+// Compare godoc
+// @Summary Compare a version with the traffic mirrored to it
+// @Description Status and latency of the requests mirrored to a candidate version next to those of the version that served them, with the status pairs they answered and the last mirrored requests
+// @Tags Mirror
+// @Produce json
+// @Param id path string true "Application ID"
+// @Param versionID path string true "Version ID"
+// @Param from query string false "From date (YYYY-MM-DD)"
+// @Param to query string false "To date (YYYY-MM-DD)"
+// @Success 200 {object} model.MirrorComparison
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /applications/{id}/versions/{versionID}/mirror [get]
+func (h *Mirror) Compare(c echo.Context) error {
+	filter, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	comparison, err := h.mirrorService.Compare(c.Request().Context(), c.Param("id"), c.Param("versionID"), filter)
+	if err != nil {
+		logger.Error("error comparing mirrored requests: %v", err)
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, comparison)
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/service"
+)
+
+type Notification struct {
+	notificationService service.Notification
+}
+
+func NewNotification(notificationService service.Notification) *Notification {
+	return &Notification{notificationService: notificationService}
+}
+
+func (h *Notification) RegisterRoutes(r *echo.Group) {
+	r.Use(administratorOnly)
+	r.GET("/channels", h.ListChannels)
+	r.POST("/channels", h.CreateChannel)
+	r.PUT("/channels/:id", h.UpdateChannel)
+	r.DELETE("/channels/:id", h.DeleteChannel)
+	r.POST("/channels/:id/test", h.TestChannel)
+	r.GET("/deliveries", h.Deliveries)
+}
+
+// ListChannels godoc
+// @Summary List notification channels
+// @Description List the webhook, Slack and email channels, secrets are never returned
+// @Tags Notification
+// @Produce json
+// @Success 200 {object} []model.NotificationChannel
+// @Failure 500 {object} map[string]interface{}
+// @Router /notifications/channels [get]
+func (h *Notification) ListChannels(c echo.Context) error {
+	channels, err := h.notificationService.GetChannels(c.Request().Context())
+	if err != nil {
+		logger.Error("error getting notification channels: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, channels)
+}
+
+// CreateChannel godoc
+// @Summary Create a notification channel
+// @Description Create a channel, events lists the event types routed to it: alert, deploy, gateway_health and container_stopped, all of them when empty
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Param request body model.NotificationChannelRequest true "Notification channel"
+// @Success 201 {object} model.NotificationChannel
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /notifications/channels [post]
+func (h *Notification) CreateChannel(c echo.Context) error {
+	var req model.NotificationChannelRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	channel, err := h.notificationService.CreateChannel(c.Request().Context(), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, channel)
+}
+
+// UpdateChannel godoc
+// @Summary Update a notification channel
+// @Description Update a channel, an empty secret keeps the current one
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Param id path string true "Notification channel ID"
+// @Param request body model.NotificationChannelRequest true "Notification channel"
+// @Success 200 {object} model.NotificationChannel
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /notifications/channels/{id} [put]
+func (h *Notification) UpdateChannel(c echo.Context) error {
+	var req model.NotificationChannelRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	channel, err := h.notificationService.UpdateChannel(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, channel)
+}
+
+// DeleteChannel godoc
+// @Summary Delete a notification channel
+// @Description Delete a channel, its pending deliveries are dropped
+// @Tags Notification
+// @Param id path string true "Notification channel ID"
+// @Success 204
+// @Failure 500 {object} map[string]interface{}
+// @Router /notifications/channels/{id} [delete]
+func (h *Notification) DeleteChannel(c echo.Context) error {
+	if err := h.notificationService.DeleteChannel(c.Request().Context(), c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// TestChannel godoc
+// @Summary Send a test notification
+// @Description Send a test event to a channel right away and log the delivery, it is not retried
+// @Tags Notification
+// @Produce json
+// @Param id path string true "Notification channel ID"
+// @Success 200 {object} model.NotificationDelivery
+// @Failure 500 {object} map[string]interface{}
+// @Router /notifications/channels/{id}/test [post]
+func (h *Notification) TestChannel(c echo.Context) error {
+	delivery, err := h.notificationService.TestChannel(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// Deliveries godoc
+// @Summary Notification delivery log
+// @Description Deliveries newest first, pending ones are still being retried
+// @Tags Notification
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param channel query string false "Notification channel ID"
+// @Param status query string false "pending, delivered or failed"
+// @Success 200 {object} []model.NotificationDelivery
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /notifications/deliveries [get]
+func (h *Notification) Deliveries(c echo.Context) error {
+	stats, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	filter := model.NotificationDeliveryFilter{
+		ChannelID: c.QueryParam("channel"),
+		Status:    model.NotificationDeliveryStatus(c.QueryParam("status")),
+		From:      stats.From,
+		To:        stats.To,
+	}
+
+	deliveries, err := h.notificationService.GetDeliveries(c.Request().Context(), filter)
+	if err != nil {
+		logger.Error("error getting notification deliveries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"neploy.dev/pkg/service"
+)
+
+type Reconciler struct {
+	reconciler service.Reconciler
+}
+
+func NewReconciler(reconciler service.Reconciler) *Reconciler {
+	return &Reconciler{reconciler: reconciler}
+}
+
+func (h *Reconciler) RegisterRoutes(r *echo.Group) {
+	r.Use(administratorOnly)
+	r.GET("", h.LastReport)
+	r.POST("/run", h.Run)
+}
+
+// LastReport godoc
+// @Summary Last reconcile report
+// @Description Drift the last reconcile run found between the gateways and versions and the router table and containers, and what it did about it
+// @Tags Reconciler
+// @Produce json
+// @Success 200 {object} model.ReconcileReport
+// @Failure 404 {object} map[string]interface{}
+// @Router /reconciler [get]
+func (h *Reconciler) LastReport(c echo.Context) error {
+	report, ok := h.reconciler.LastReport()
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "The reconciler has not run yet")
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// Run godoc
+// @Summary Reconcile now
+// @Description Reconcile the router table and containers right away, with dry_run the drift is only reported
+// @Tags Reconciler
+// @Produce json
+// @Param dry_run query bool false "Only report the drift"
+// @Success 200 {object} model.ReconcileReport
+// @Failure 400 {object} map[string]interface{}
+// @Router /reconciler/run [post]
+func (h *Reconciler) Run(c echo.Context) error {
+	dryRun := false
+	if value := c.QueryParam("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "dry_run must be true or false")
+		}
+		dryRun = parsed
+	}
+
+	return c.JSON(http.StatusOK, h.reconciler.RunOnce(c.Request().Context(), dryRun))
+}
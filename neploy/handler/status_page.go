@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	inertia "github.com/romsar/gonertia"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/service"
+)
+
+type StatusPage struct {
+	statusPageService service.StatusPage
+	i                 *inertia.Inertia
+}
+
+func NewStatusPage(statusPageService service.StatusPage, i *inertia.Inertia) *StatusPage {
+	return &StatusPage{statusPageService: statusPageService, i: i}
+}
+
+// RegisterPublicRoutes registers the status page, it needs no session
+func (h *StatusPage) RegisterPublicRoutes(r *echo.Group) {
+	r.GET("", h.Page)
+	r.GET("/json", h.Summary)
+}
+
+func (h *StatusPage) RegisterRoutes(r *echo.Group) {
+	r.Use(administratorOnly)
+	r.GET("/applications", h.GetApplications)
+	r.PUT("/applications", h.SetApplications)
+	r.GET("/incidents", h.ListIncidents)
+	r.POST("/incidents", h.CreateIncident)
+	r.POST("/incidents/:id/updates", h.AddIncidentUpdate)
+	r.DELETE("/incidents/:id", h.DeleteIncident)
+	r.GET("/sla", h.SLAReport)
+}
+
+func (h *StatusPage) Page(c echo.Context) error {
+	page, err := h.statusPageService.GetPage(c.Request().Context())
+	if err != nil {
+		logger.Error("error building status page: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "status page unavailable")
+	}
+
+	return h.i.Render(c.Response(), c.Request(), "Status/Index", inertia.Props{"page": page})
+}
+
+// Summary godoc
+// @Summary Public status
+// @Description Current status, 90-day uptime of the listed applications and recent incidents, no session needed
+// @Tags StatusPage
+// @Produce json
+// @Success 200 {object} model.StatusPage
+// @Failure 500 {object} map[string]interface{}
+// @Router /status/json [get]
+func (h *StatusPage) Summary(c echo.Context) error {
+	page, err := h.statusPageService.GetPage(c.Request().Context())
+	if err != nil {
+		logger.Error("error building status page: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "status page unavailable")
+	}
+
+	c.Response().Header().Set("Cache-Control", "public, max-age=30")
+	return c.JSON(http.StatusOK, page)
+}
+
+// GetApplications godoc
+// @Summary Status page applications
+// @Description List the applications shown on the status page, in order
+// @Tags StatusPage
+// @Produce json
+// @Success 200 {object} []model.StatusPageApplication
+// @Failure 500 {object} map[string]interface{}
+// @Router /status-page/applications [get]
+func (h *StatusPage) GetApplications(c echo.Context) error {
+	apps, err := h.statusPageService.GetApplications(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, apps)
+}
+
+// SetApplications godoc
+// @Summary Set the status page applications
+// @Description Replace the applications shown on the status page, they are shown in the order sent
+// @Tags StatusPage
+// @Accept json
+// @Produce json
+// @Param request body model.StatusPageRequest true "Applications"
+// @Success 200 {object} []model.StatusPageApplication
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /status-page/applications [put]
+func (h *StatusPage) SetApplications(c echo.Context) error {
+	var req model.StatusPageRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	apps, err := h.statusPageService.SetApplications(c.Request().Context(), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, apps)
+}
+
+// ListIncidents godoc
+// @Summary List incidents
+// @Description List the incidents with their updates, the last 90 days by default
+// @Tags StatusPage
+// @Produce json
+// @Param application query string false "Application ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD)"
+// @Success 200 {object} []model.Incident
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /status-page/incidents [get]
+func (h *StatusPage) ListIncidents(c echo.Context) error {
+	filter, err := parseStatsFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	incidents, err := h.statusPageService.GetIncidents(c.Request().Context(), filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, incidents)
+}
+
+// CreateIncident godoc
+// @Summary Post an incident
+// @Description Post an incident of an application, or of the whole platform without one, message is its first update
+// @Tags StatusPage
+// @Accept json
+// @Produce json
+// @Param request body model.IncidentRequest true "Incident"
+// @Success 201 {object} model.Incident
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /status-page/incidents [post]
+func (h *StatusPage) CreateIncident(c echo.Context) error {
+	var req model.IncidentRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	incident, err := h.statusPageService.CreateIncident(c.Request().Context(), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, incident)
+}
+
+// AddIncidentUpdate godoc
+// @Summary Post an incident update
+// @Description Add a note to an incident and move it to the note's status, resolved closes it
+// @Tags StatusPage
+// @Accept json
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param request body model.IncidentUpdateRequest true "Update"
+// @Success 201 {object} model.Incident
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /status-page/incidents/{id}/updates [post]
+func (h *StatusPage) AddIncidentUpdate(c echo.Context) error {
+	var req model.IncidentUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	incident, err := h.statusPageService.AddIncidentUpdate(c.Request().Context(), c.Param("id"), req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, incident)
+}
+
+// DeleteIncident godoc
+// @Summary Delete an incident
+// @Description Remove an incident from the status page and the SLA reports
+// @Tags StatusPage
+// @Param id path string true "Incident ID"
+// @Success 204
+// @Failure 500 {object} map[string]interface{}
+// @Router /status-page/incidents/{id} [delete]
+func (h *StatusPage) DeleteIncident(c echo.Context) error {
+	if err := h.statusPageService.DeleteIncident(c.Request().Context(), c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SLAReport godoc
+// @Summary Monthly SLA report
+// @Description Uptime of an application over a calendar month (UTC) against the SLA target, as JSON or as a CSV download
+// @Tags StatusPage
+// @Produce json
+// @Produce text/csv
+// @Param application query string true "Application ID"
+// @Param month query string false "Month (YYYY-MM), the current one by default"
+// @Param format query string false "json or csv"
+// @Success 200 {object} model.SLAReport
+// @Failure 400 {object} map[string]interface{}
+// @Router /status-page/sla [get]
+func (h *StatusPage) SLAReport(c echo.Context) error {
+	applicationID := c.QueryParam("application")
+	if applicationID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "application is required")
+	}
+
+	month := time.Now().UTC()
+	if value := c.QueryParam("month"); value != "" {
+		t, err := time.Parse("2006-01", value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid month: %s", value))
+		}
+		month = t
+	}
+
+	report, err := h.statusPageService.GetSLAReport(c.Request().Context(), applicationID, month)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	switch c.QueryParam("format") {
+	case "", "json":
+		return c.JSON(http.StatusOK, report)
+	case "csv":
+		return writeSLACSV(c, report)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be json or csv")
+	}
+}
+
+// writeSLACSV writes a row per day and a last total row
+func writeSLACSV(c echo.Context, report model.SLAReport) error {
+	filename := fmt.Sprintf("sla-%s-%s.csv", report.ApplicationName, report.Month)
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	percent := func(value float64) string { return strconv.FormatFloat(value, 'f', 3, 64) }
+
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"application", "date", "checks", "healthy", "uptime", "target", "met", "downtime_minutes", "incidents"})
+	for _, day := range report.Days {
+		w.Write([]string{
+			report.ApplicationName,
+			day.Date.Format(time.DateOnly),
+			strconv.FormatInt(day.Checks, 10),
+			strconv.FormatInt(day.Healthy, 10),
+			percent(day.Uptime),
+			"", "", "", "",
+		})
+	}
+	w.Write([]string{
+		report.ApplicationName,
+		report.Month,
+		strconv.FormatInt(report.Checks, 10),
+		strconv.FormatInt(report.Healthy, 10),
+		percent(report.Uptime),
+		percent(report.Target),
+		strconv.FormatBool(report.Met),
+		strconv.FormatFloat(report.DowntimeMinutes, 'f', 1, 64),
+		strconv.Itoa(len(report.Incidents)),
+	})
+	w.Flush()
+	return w.Error()
+}
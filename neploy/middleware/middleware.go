@@ -8,6 +8,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"neploy.dev/config"
 	"neploy.dev/pkg/common"
+	neployway "neploy.dev/pkg/gateway"
 	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/service"
@@ -97,6 +98,7 @@ func TraceMiddleware(traceService service.Trace) echo.MiddlewareFunc {
 				Type:            "panel", // o dinámico según ruta
 				Action:          c.Request().Method + " " + c.Path(),
 				ActionTimestamp: model.NewDateNow(),
+				RequestID:       c.Request().Header.Get(neployway.RequestIDHeader),
 			}
 
 			// Inyectar en contexto
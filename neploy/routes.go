@@ -2,16 +2,12 @@ package neploy
 
 import (
 	"context"
-	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"neploy.dev/neploy/handler"
 	"neploy.dev/neploy/middleware"
-	neployway "neploy.dev/pkg/gateway"
 	"neploy.dev/pkg/logger"
-	"neploy.dev/pkg/repository/filters"
 
 	inertia "github.com/romsar/gonertia"
 )
@@ -38,7 +34,14 @@ func userRoutes(e *echo.Echo, i *inertia.Inertia, npy Neploy) {
 
 func applicationRoutes(e *echo.Echo, i *inertia.Inertia, npy Neploy) {
 	application := handler.NewApplication(npy.Services.Application, i)
-	application.RegisterRoutes(e.Group("/applications", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace)))
+	errorPage := handler.NewErrorPage(npy.Services.ErrorPage)
+	mirror := handler.NewMirror(npy.Services.Mirror)
+	deprecation := handler.NewDeprecation(npy.Services.Deprecation)
+	applications := e.Group("/applications", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace))
+	application.RegisterRoutes(applications)
+	errorPage.RegisterRoutes(applications)
+	mirror.RegisterRoutes(applications)
+	deprecation.RegisterRoutes(applications)
 }
 
 func roleRoutes(e *echo.Echo, i *inertia.Inertia, npy Neploy) {
@@ -61,6 +64,32 @@ func gatewayRoutes(e *echo.Echo, i *inertia.Inertia, npy Neploy) {
 	gateway.RegisterRoutes(e.Group("/gateways", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace)))
 }
 
+func alertRoutes(e *echo.Echo, npy Neploy) {
+	alert := handler.NewAlert(npy.Services.Alert)
+	alert.RegisterRoutes(e.Group("/alerts", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace)))
+}
+
+func notificationRoutes(e *echo.Echo, npy Neploy) {
+	notification := handler.NewNotification(npy.Services.Notification)
+	notification.RegisterRoutes(e.Group("/notifications", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace)))
+}
+
+func statusPageRoutes(e *echo.Echo, i *inertia.Inertia, npy Neploy) {
+	statusPage := handler.NewStatusPage(npy.Services.StatusPage, i)
+	statusPage.RegisterPublicRoutes(e.Group("/status"))
+	statusPage.RegisterRoutes(e.Group("/status-page", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace)))
+}
+
+func reconcilerRoutes(e *echo.Echo, npy Neploy) {
+	reconciler := handler.NewReconciler(npy.Services.Reconciler)
+	reconciler.RegisterRoutes(e.Group("/reconciler", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace)))
+}
+
+func l4RouteRoutes(e *echo.Echo, npy Neploy) {
+	l4Route := handler.NewL4Route(npy.Services.L4Route)
+	l4Route.RegisterRoutes(e.Group("/l4-routes", middleware.JWTMiddleware(), middleware.TraceMiddleware(npy.Services.Trace)))
+}
+
 func RegisterRoutes(e *echo.Echo, i *inertia.Inertia, npy Neploy) {
 	loginRoutes(e, i, npy)
 	onboardRoutes(e, i, npy)
@@ -71,61 +100,17 @@ func RegisterRoutes(e *echo.Echo, i *inertia.Inertia, npy Neploy) {
 	metadataRoutes(e, i, npy)
 	techStackRoutes(e, i, npy)
 	gatewayRoutes(e, i, npy)
+	l4RouteRoutes(e, npy)
+	alertRoutes(e, npy)
+	notificationRoutes(e, npy)
+	statusPageRoutes(e, i, npy)
+	reconcilerRoutes(e, npy)
 
+	// The router table is filled by the reconciler, from these gateways
 	if err := npy.Services.Application.EnsureDefaultGateways(context.Background()); err != nil {
 		logger.Error("Failed to ensure default gateways: %v", err)
 	}
 
-	gateways, _ := npy.Services.Gateway.GetAll(context.Background())
-
-	for _, gateway := range gateways {
-		// 🔄 Traer todas las versiones de esta app
-		versions, err := npy.Repositories.ApplicationVersion.GetAll(context.Background(), filters.IsSelectFilter("application_id", gateway.ApplicationID))
-		if err != nil {
-			logger.Error("Failed to get versions for app %s: %v", gateway.ApplicationID, err)
-			continue
-		}
-
-		for _, v := range versions {
-			// Ruta con versión incluida: /vX.Y.Z/app
-			versionedPath := fmt.Sprintf("/%s%s", v.VersionTag, gateway.Path)
-
-			port, err := strconv.Atoi(gateway.Port)
-			if err != nil {
-				logger.Error("Invalid port for gateway %s: %v", gateway.ApplicationID, err)
-				continue
-			}
-
-			route := neployway.Route{
-				AppID:  gateway.ApplicationID,
-				Port:   strconv.Itoa(port),
-				Domain: gateway.Domain,
-				Path:   versionedPath,
-			}
-			port++
-
-			println("Registering default route:", route.Path, route.Port)
-
-			if err := npy.Router.AddRoute(route); err != nil {
-				logger.Error("Failed to add route: %v", err)
-			}
-		}
-
-		// ➕ Registrar ruta sin versión para la versión por defecto
-		route := neployway.Route{
-			AppID:  gateway.ApplicationID,
-			Port:   gateway.Port,
-			Domain: gateway.Domain,
-			Path:   gateway.Path, // sin versión
-		}
-
-		println("Registering default route:", route.Path)
-
-		if err := npy.Router.AddRoute(route); err != nil {
-			logger.Error("Failed to add default route: %v", err)
-		}
-	}
-
 	// Use the router as a fallback handler for unmatched routes
 	e.Any("/*", echo.WrapHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		npy.Router.ServeHTTP(w, r)
@@ -19,7 +19,8 @@ func AcceptedRoutesForOnboarding(path string) bool {
 	return strings.HasPrefix(path, "/build/assets/") ||
 		strings.HasPrefix(path, "/assets/") ||
 		strings.HasPrefix(path, "/auth") ||
-		path == "/manual"
+		path == "/manual" ||
+		path == "/metrics"
 }
 
 func InjectTrace(ctx context.Context, trace *model.Trace) context.Context {
@@ -9,7 +9,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/resend/resend-go/v2"
 	"neploy.dev/config"
 )
 
@@ -17,12 +16,35 @@ import (
 var emailTmpl embed.FS
 
 type Email struct {
-	client *resend.Client
+	sender EmailSender
+	outbox Outbox
 }
 
-func NewEmail() *Email {
-	client := resend.NewClient(config.Env.ResendAPIKey)
-	return &Email{client: client}
+// NewEmail renders emails and sends them with sender. With an outbox,
+// invitations and password resets are queued there instead so a failed
+// send is retried rather than lost.
+func NewEmail(sender EmailSender, outbox Outbox) *Email {
+	return &Email{sender: sender, outbox: outbox}
+}
+
+// fromAddress is the configured sender, RESEND_FROM_* are still honoured
+// for setups from before EMAIL_FROM_*
+func fromAddress() string {
+	name, address := config.Env.EmailFromName, config.Env.EmailFrom
+	if name == "" {
+		name = config.Env.ResendFromName
+	}
+	if address == "" {
+		address = config.Env.ResendFromEmail
+	}
+	return fmt.Sprintf("%s <%s>", name, address)
+}
+
+func (e *Email) deliver(ctx context.Context, msg Message) error {
+	if e.outbox != nil {
+		return e.outbox.Enqueue(ctx, msg)
+	}
+	return e.sender.Send(ctx, msg)
 }
 
 func (e *Email) SendInvitation(ctx context.Context, to, teamName, role, inviteLink string, language string) error {
@@ -62,18 +84,15 @@ func (e *Email) SendInvitation(ctx context.Context, to, teamName, role, inviteLi
 	}
 
 	// Create and send the email
-	params := &resend.SendEmailRequest{
-		From:    fmt.Sprintf("%s <%s>", config.Env.ResendFromName, config.Env.ResendFromEmail),
+	return e.deliver(ctx, Message{
+		From:    fromAddress(),
 		To:      []string{to},
 		Subject: data.Translations.Title + " " + teamName,
-		Html:    htmlBody.String(),
-	}
-
-	_, err = e.client.Emails.Send(params)
-	return err
+		HTML:    htmlBody.String(),
+	})
 }
 
-func (e *Email) SendPasswordReset(to string, data PasswordResetData) error {
+func (e *Email) SendPasswordReset(ctx context.Context, to string, data PasswordResetData) error {
 	tmpl, err := template.ParseFS(emailTmpl, "templates/password_reset_email.gohtml")
 	if err != nil {
 		return fmt.Errorf("parsing template: %w", err)
@@ -84,13 +103,41 @@ func (e *Email) SendPasswordReset(to string, data PasswordResetData) error {
 		return fmt.Errorf("executing template: %w", err)
 	}
 
-	params := &resend.SendEmailRequest{
-		From:    fmt.Sprintf("%s <%s>", config.Env.ResendFromName, config.Env.ResendFromEmail),
+	return e.deliver(ctx, Message{
+		From:    fromAddress(),
 		To:      []string{to},
 		Subject: data.Translations.Title,
-		Html:    htmlBody.String(),
+		HTML:    htmlBody.String(),
+	})
+}
+
+// SendNotification sends right away, skipping the outbox, since notification
+// deliveries are retried and logged by themselves
+func (e *Email) SendNotification(ctx context.Context, to []string, data NotificationData) error {
+	if data.CompanyName == "" {
+		data.CompanyName = "Neploy"
+	}
+	if data.LogoURL == "" {
+		data.LogoURL = "https://lh3.googleusercontent.com/d/1McJEcUM6u69CasiERZNpf2sIh1jEg7Zz"
+	}
+	if data.CurrentYear == 0 {
+		data.CurrentYear = time.Now().Year()
+	}
+
+	tmpl, err := template.ParseFS(emailTmpl, "templates/notification_email.gohtml")
+	if err != nil {
+		return fmt.Errorf("parsing notification template: %w", err)
+	}
+
+	var htmlBody bytes.Buffer
+	if err := tmpl.Execute(&htmlBody, data); err != nil {
+		return fmt.Errorf("executing notification template: %w", err)
 	}
 
-	_, err = e.client.Emails.Send(params)
-	return err
+	return e.sender.Send(ctx, Message{
+		From:    fromAddress(),
+		To:      to,
+		Subject: fmt.Sprintf("[%s] %s", data.CompanyName, data.Title),
+		HTML:    htmlBody.String(),
+	})
 }
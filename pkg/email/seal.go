@@ -0,0 +1,69 @@
+package email
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// sealedPrefix marks a body sealed by SealBody, bodies without it were
+// queued before sealing and are read as they are
+const sealedPrefix = "sealed:v1:"
+
+// SealBody encrypts a queued body with a key derived from secret, so the
+// reset and invitation links it holds are of no use to whoever reads the
+// database without the secret
+func SealBody(body, secret string) (string, error) {
+	aead, err := bodyCipher(secret)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(body), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenBody decrypts a body sealed by SealBody with the same secret
+func OpenBody(body, secret string) (string, error) {
+	encoded, ok := strings.CutPrefix(body, sealedPrefix)
+	if !ok {
+		return body, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	aead, err := bodyCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("sealed body is too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func bodyCipher(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("neploy email outbox:" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,66 @@
+package email
+
+import (
+	"context"
+
+	"github.com/resend/resend-go/v2"
+	"neploy.dev/config"
+)
+
+// Email providers, picked with EMAIL_PROVIDER
+const (
+	ProviderResend = "resend"
+	ProviderSMTP   = "smtp"
+)
+
+// Message is a rendered email ready to be sent
+type Message struct {
+	From    string // "Name <address>"
+	To      []string
+	Subject string
+	HTML    string
+}
+
+// EmailSender hands a message to an email provider
+type EmailSender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Outbox stores a message to be sent later, retrying until it goes through
+type Outbox interface {
+	Enqueue(ctx context.Context, msg Message) error
+}
+
+// NewSender returns the sender of the configured provider
+func NewSender() EmailSender {
+	if config.Env.EmailProvider == ProviderSMTP {
+		return NewSMTPSender(SMTPConfig{
+			Host:     config.Env.SMTPHost,
+			Port:     config.Env.SMTPPort,
+			Username: config.Env.SMTPUsername,
+			Password: config.Env.SMTPPassword,
+			TLS:      config.Env.SMTPTLS,
+		})
+	}
+	return NewResendSender(config.Env.ResendAPIKey)
+}
+
+type ResendSender struct {
+	client *resend.Client
+}
+
+func NewResendSender(apiKey string) *ResendSender {
+	return &ResendSender{client: resend.NewClient(apiKey)}
+}
+
+func (r *ResendSender) Send(ctx context.Context, msg Message) error {
+	params := &resend.SendEmailRequest{
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		Html:    msg.HTML,
+	}
+
+	_, err := r.client.Emails.SendWithContext(ctx, params)
+	return err
+}
@@ -0,0 +1,196 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP connection security, picked with SMTP_TLS
+const (
+	SMTPStartTLS    = "starttls" // upgrade a plain connection, usually port 587
+	SMTPImplicitTLS = "tls"      // TLS from the start, usually port 465
+	SMTPNoTLS       = "none"     // local relays and test servers like MailHog
+)
+
+const smtpTimeout = 30 * time.Second
+
+type SMTPConfig struct {
+	Host string
+	Port string
+	// Username and Password are optional, without them no AUTH is sent.
+	// Credentials are never sent in the clear except to localhost.
+	Username string
+	Password string
+	TLS      string
+}
+
+type SMTPSender struct {
+	config SMTPConfig
+	// rootCAs verifies the server certificate, the system pool when nil
+	rootCAs *x509.CertPool
+}
+
+func NewSMTPSender(config SMTPConfig) *SMTPSender {
+	return &SMTPSender{config: config}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", msg.From, err)
+	}
+	to := make([]*mail.Address, 0, len(msg.To))
+	for _, recipient := range msg.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		to = append(to, address)
+	}
+	if len(to) == 0 {
+		return errors.New("email has no recipients")
+	}
+
+	body, err := buildMessage(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.config.TLS == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(s.tlsConfig()); err != nil {
+			return fmt.Errorf("starting tls: %w", err)
+		}
+	}
+
+	if s.config.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+	for _, address := range to {
+		if err := client.Rcpt(address.Address); err != nil {
+			return fmt.Errorf("adding recipient %s: %w", address.Address, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("starting data: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("writing data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending data: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the server, the connection gives up at the context
+// deadline or after smtpTimeout, whichever comes first
+func (s *SMTPSender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.config.Host, s.config.Port)
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if s.config.TLS == SMTPImplicitTLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig()}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+
+	deadline := time.Now().Add(smtpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("greeting %s: %w", addr, err)
+	}
+	return client, nil
+}
+
+func (s *SMTPSender) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: s.config.Host, RootCAs: s.rootCAs, MinVersion: tls.VersionTLS12}
+}
+
+// buildMessage writes the headers and the quoted-printable HTML body
+func buildMessage(from *mail.Address, to []*mail.Address, msg Message) ([]byte, error) {
+	recipients := make([]string, 0, len(to))
+	for _, address := range to {
+		recipients = append(recipients, address.String())
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", strings.Join(recipients, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/html; charset=UTF-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], header[1])
+	}
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(msg.HTML)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,306 @@
+package email
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpServer is a minimal SMTP server for the sender tests. It offers
+// STARTTLS, then AUTH PLAIN over TLS only, and keeps the messages it gets.
+type smtpServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	username string
+	password string
+	startTLS bool
+
+	mu       sync.Mutex
+	messages []string
+	authed   bool
+}
+
+func newSMTPServer(t *testing.T, startTLS bool) (*smtpServer, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{
+		listener: listener,
+		tls:      &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		username: "neploy",
+		password: "s3cret",
+		startTLS: startTLS,
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s, pool
+}
+
+func (s *smtpServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	secure := false
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			extensions := []string{"localhost"}
+			if s.startTLS && !secure {
+				extensions = append(extensions, "STARTTLS")
+			}
+			if secure {
+				extensions = append(extensions, "AUTH PLAIN")
+			}
+			for i, extension := range extensions {
+				separator := "-"
+				if i == len(extensions)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, extension)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			credentials, _ := strings.CutPrefix(arg, "PLAIN ")
+			decoded, _ := base64.StdEncoding.DecodeString(credentials)
+			parts := strings.Split(string(decoded), "\x00")
+			if len(parts) != 3 || parts[1] != s.username || parts[2] != s.password {
+				text.PrintfLine("535 Authentication failed")
+				continue
+			}
+			s.mu.Lock()
+			s.authed = true
+			s.mu.Unlock()
+			text.PrintfLine("235 Authenticated")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			text.PrintfLine("250 Queued")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) received() ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...), s.authed
+}
+
+func TestSMTPSenderStartTLSAuthAndQuotedPrintable(t *testing.T) {
+	server, pool := newSMTPServer(t, true)
+	sender := NewSMTPSender(SMTPConfig{
+		Host:     "localhost",
+		Port:     server.port(),
+		Username: "neploy",
+		Password: "s3cret",
+		TLS:      SMTPStartTLS,
+	})
+	sender.rootCAs = pool
+
+	// Long lines, non ASCII text and "=" all need quoted-printable escaping
+	html := `<p>Hola Íñigo, restablece tu contraseña aquí: <a href="https://neploy.dev/password/change?token=abc.def&lang=es">` +
+		strings.Repeat("enlace ", 20) + `</a></p>`
+	err := sender.Send(context.Background(), Message{
+		From:    "Neploy <no-reply@neploy.dev>",
+		To:      []string{"Íñigo <inigo@example.com>"},
+		Subject: "Restablecer contraseña",
+		HTML:    html,
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages, authed := server.received()
+	if !authed {
+		t.Error("the sender did not authenticate")
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+		t.Errorf("Content-Transfer-Encoding = %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Restablecer contraseña" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+
+	raw, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The dot reader turns CRLF into LF and DATA always ends on a new line
+	for _, line := range strings.Split(string(raw), "\n") {
+		if len(line) > 76 {
+			t.Errorf("encoded line of %d characters, quoted-printable allows 76", len(line))
+		}
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(string(raw))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSuffix(string(body), "\n") != html {
+		t.Errorf("decoded body = %q, want %q", body, html)
+	}
+}
+
+func TestSMTPSenderRejectsWrongPassword(t *testing.T) {
+	server, pool := newSMTPServer(t, true)
+	sender := NewSMTPSender(SMTPConfig{
+		Host:     "localhost",
+		Port:     server.port(),
+		Username: "neploy",
+		Password: "wrong",
+		TLS:      SMTPStartTLS,
+	})
+	sender.rootCAs = pool
+
+	err := sender.Send(context.Background(), Message{
+		From:    "no-reply@neploy.dev",
+		To:      []string{"user@example.com"},
+		Subject: "Hi",
+		HTML:    "<p>Hi</p>",
+	})
+	if err == nil || !strings.Contains(err.Error(), "authenticating") {
+		t.Fatalf("Send = %v, want an authentication error", err)
+	}
+	if messages, _ := server.received(); len(messages) != 0 {
+		t.Errorf("got %d messages, want none", len(messages))
+	}
+}
+
+func TestSMTPSenderRequiresStartTLS(t *testing.T) {
+	server, pool := newSMTPServer(t, false)
+	sender := NewSMTPSender(SMTPConfig{
+		Host: "localhost",
+		Port: server.port(),
+		TLS:  SMTPStartTLS,
+	})
+	sender.rootCAs = pool
+
+	err := sender.Send(context.Background(), Message{
+		From:    "no-reply@neploy.dev",
+		To:      []string{"user@example.com"},
+		Subject: "Hi",
+		HTML:    "<p>Hi</p>",
+	})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Send = %v, want a STARTTLS error", err)
+	}
+}
+
+func TestSealBody(t *testing.T) {
+	html := `<a href="https://neploy.dev/password/change?token=abc">reset</a>`
+
+	sealed, err := SealBody(html, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "token=abc") {
+		t.Fatal("sealed body still holds the link")
+	}
+
+	opened, err := OpenBody(sealed, "secret")
+	if err != nil || opened != html {
+		t.Fatalf("OpenBody = %q, %v", opened, err)
+	}
+	if _, err := OpenBody(sealed, "other"); err == nil {
+		t.Error("OpenBody with another secret succeeded")
+	}
+	if opened, err := OpenBody(html, "secret"); err != nil || opened != html {
+		t.Errorf("OpenBody of an unsealed body = %q, %v, want it unchanged", opened, err)
+	}
+}
@@ -1,5 +1,7 @@
 package email
 
+import "time"
+
 // TranslationSet contains all translated strings for a specific language
 type TranslationSet struct {
 	Title            string
@@ -217,3 +219,16 @@ func GetInvitationTranslations(lang string) InvitationTranslationSet {
 
 	return translations[lang]
 }
+
+// NotificationData contains all the data needed for the notification email template
+type NotificationData struct {
+	Title       string
+	Message     string
+	Severity    string
+	Color       string // of the severity badge
+	Fields      map[string]string
+	OccurredAt  time.Time
+	CompanyName string
+	LogoURL     string
+	CurrentYear int
+}
@@ -0,0 +1,369 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"neploy.dev/pkg/logger"
+)
+
+const (
+	AccessLogFormatJSON = "json"
+	AccessLogFormatCLF  = "clf"
+
+	redacted = "[REDACTED]"
+)
+
+// Fields available in the JSON access log
+const (
+	FieldTimestamp    = "timestamp"
+	FieldRequestID    = "request_id"
+	FieldTraceID      = "trace_id"
+	FieldAppID        = "app_id"
+	FieldHost         = "host"
+	FieldMethod       = "method"
+	FieldPath         = "path"
+	FieldQuery        = "query"
+	FieldStatus       = "status"
+	FieldSize         = "size"
+	FieldDuration     = "duration"
+	FieldRemoteAddr   = "remote_addr"
+	FieldUserAgent    = "user_agent"
+	FieldReferer      = "referer"
+	FieldHeaders      = "headers"
+	FieldRequestBody  = "request_body"
+	FieldResponseBody = "response_body"
+)
+
+var (
+	DefaultAccessLogFields = []string{
+		FieldTimestamp, FieldRequestID, FieldTraceID, FieldAppID, FieldMethod, FieldPath, FieldQuery, FieldStatus,
+		FieldSize, FieldDuration, FieldRemoteAddr, FieldUserAgent,
+	}
+	DefaultRedactHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token",
+	}
+	DefaultRedactQuery = []string{
+		"token", "access_token", "refresh_token", "api_key", "apikey", "password", "secret", "code",
+	}
+	DefaultRedactFields = []string{
+		"password", "currentPassword", "newPassword", "confirmPassword",
+		"token", "access_token", "refresh_token", "secret", "client_secret", "api_key",
+	}
+)
+
+type AccessLogConfig struct {
+	// Output is "stdout", "stderr" or a file path
+	Output     string
+	Format     string
+	MaxSizeMB  int
+	RotateEach time.Duration
+	MaxBackups int
+	Fields     []string
+	// SampleRate is the fraction (0-1] of non-error requests written, 5xx are always written
+	SampleRate    float64
+	CaptureBody   bool
+	MaxBodyBytes  int
+	RedactHeaders []string
+	RedactQuery   []string
+	RedactFields  []string
+}
+
+// AccessLogger writes one line per gateway request in JSON or Common Log
+// Format, redacting sensitive headers, query params and JSON body fields.
+type AccessLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	closer io.Closer
+	conf   AccessLogConfig
+	fields map[string]bool
+	// lowercased lookups for redaction
+	headers map[string]bool
+	query   map[string]bool
+	body    map[string]bool
+	// failing is set while writes fail, so a full disk logs once and not
+	// once per request
+	failing bool
+}
+
+type AccessLogEntry struct {
+	Start        time.Time
+	AppID        string
+	RequestID    string
+	TraceID      string
+	Request      *http.Request
+	Status       int
+	Size         int64
+	Duration     time.Duration
+	RequestBody  []byte
+	ResponseBody []byte
+}
+
+func NewAccessLogger(conf AccessLogConfig) (*AccessLogger, error) {
+	if conf.Format == "" {
+		conf.Format = AccessLogFormatJSON
+	}
+	if conf.Format != AccessLogFormatJSON && conf.Format != AccessLogFormatCLF {
+		return nil, fmt.Errorf("unknown access log format %q", conf.Format)
+	}
+	if len(conf.Fields) == 0 {
+		conf.Fields = DefaultAccessLogFields
+	}
+	if conf.SampleRate <= 0 || conf.SampleRate > 1 {
+		conf.SampleRate = 1
+	}
+	if conf.MaxBodyBytes <= 0 {
+		conf.MaxBodyBytes = 10000
+	}
+
+	l := &AccessLogger{
+		conf:    conf,
+		fields:  toSet(conf.Fields, false),
+		headers: toSet(append(slices.Clone(DefaultRedactHeaders), conf.RedactHeaders...), true),
+		query:   toSet(append(slices.Clone(DefaultRedactQuery), conf.RedactQuery...), true),
+		body:    toSet(append(slices.Clone(DefaultRedactFields), conf.RedactFields...), true),
+	}
+
+	switch conf.Output {
+	case "", "stdout":
+		l.out = os.Stdout
+	case "stderr":
+		l.out = os.Stderr
+	default:
+		file, err := NewRotatingFile(conf.Output, int64(conf.MaxSizeMB)*1024*1024, conf.RotateEach, conf.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		l.out = file
+		l.closer = file
+	}
+
+	return l, nil
+}
+
+// CaptureBody reports whether request and response bodies should be captured
+func (l *AccessLogger) CaptureBody() bool {
+	return l != nil && l.conf.CaptureBody
+}
+
+// MaxBodyBytes is the most bytes of a body kept for the log
+func (l *AccessLogger) MaxBodyBytes() int {
+	return l.conf.MaxBodyBytes
+}
+
+func (l *AccessLogger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+func (l *AccessLogger) Log(entry AccessLogEntry) {
+	if l == nil {
+		return
+	}
+	if entry.Status < 500 && l.conf.SampleRate < 1 && rand.Float64() >= l.conf.SampleRate {
+		return
+	}
+
+	var line []byte
+	if l.conf.Format == AccessLogFormatCLF {
+		line = l.formatCLF(entry)
+	} else {
+		var err error
+		if line, err = l.formatJSON(entry); err != nil {
+			log.Printf("ERROR: Failed to format access log entry (request id %s): %v", entry.RequestID, err)
+			return
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		if !l.failing {
+			log.Printf("ERROR: Failed to write access log, dropping entries until it recovers: %v", err)
+		}
+		l.failing = true
+		return
+	}
+	if l.failing {
+		logger.Info("Access log writes recovered")
+		l.failing = false
+	}
+}
+
+func (l *AccessLogger) formatJSON(entry AccessLogEntry) ([]byte, error) {
+	r := entry.Request
+	record := make(map[string]any, len(l.fields))
+	set := func(field string, value any) {
+		if l.fields[field] {
+			record[field] = value
+		}
+	}
+
+	set(FieldTimestamp, entry.Start.Format(time.RFC3339))
+	set(FieldRequestID, entry.RequestID)
+	set(FieldTraceID, entry.TraceID)
+	set(FieldAppID, entry.AppID)
+	set(FieldHost, r.Host)
+	set(FieldMethod, r.Method)
+	set(FieldPath, r.URL.Path)
+	set(FieldQuery, l.redactQuery(r.URL.RawQuery))
+	set(FieldStatus, entry.Status)
+	set(FieldSize, entry.Size)
+	set(FieldDuration, entry.Duration.String())
+	set(FieldRemoteAddr, ClientIP(r))
+	set(FieldUserAgent, r.UserAgent())
+	set(FieldReferer, r.Referer())
+	if l.fields[FieldHeaders] {
+		record[FieldHeaders] = l.redactHeaders(r.Header)
+	}
+	if l.conf.CaptureBody {
+		if len(entry.RequestBody) > 0 {
+			set(FieldRequestBody, l.redactBody(entry.RequestBody))
+		}
+		if len(entry.ResponseBody) > 0 {
+			set(FieldResponseBody, l.redactBody(entry.ResponseBody))
+		}
+	}
+
+	return json.Marshal(record)
+}
+
+// formatCLF writes host ident authuser [date] "request" status bytes
+func (l *AccessLogger) formatCLF(entry AccessLogEntry) []byte {
+	r := entry.Request
+	host := ClientIP(r)
+
+	uri := r.URL.Path
+	if q := l.redactQuery(r.URL.RawQuery); q != "" {
+		uri += "?" + q
+	}
+
+	size := "-"
+	if entry.Size > 0 {
+		size = fmt.Sprintf("%d", entry.Size)
+	}
+
+	return []byte(fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s`,
+		host, entry.Start.Format("02/Jan/2006:15:04:05 -0700"), r.Method, uri, r.Proto, entry.Status, size))
+}
+
+func (l *AccessLogger) redactHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for k, v := range header {
+		if len(v) == 0 {
+			continue
+		}
+		if l.headers[strings.ToLower(k)] {
+			headers[k] = redacted
+			continue
+		}
+		headers[k] = v[0]
+	}
+	return headers
+}
+
+func (l *AccessLogger) redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+
+	changed := false
+	for k := range values {
+		if l.query[strings.ToLower(k)] {
+			values[k] = []string{redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+// redactBody masks sensitive fields in JSON bodies. Bodies that are not JSON
+// are logged as is, truncated bodies can't be parsed and are dropped.
+func (l *AccessLogger) redactBody(body []byte) any {
+	var parsed any
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		if looksLikeJSON(body) {
+			return "[UNPARSEABLE]"
+		}
+		return string(body)
+	}
+	return l.redactValue(parsed)
+}
+
+func (l *AccessLogger) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, inner := range v {
+			if l.body[strings.ToLower(k)] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = l.redactValue(inner)
+		}
+		return v
+	case []any:
+		for i, inner := range v {
+			v[i] = l.redactValue(inner)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+func toSet(values []string, lower bool) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if lower {
+			v = strings.ToLower(v)
+		}
+		if v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type flakyWriter struct {
+	fail  bool
+	lines int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errors.New("no space left on device")
+	}
+	w.lines++
+	return len(p), nil
+}
+
+func TestAccessLogWriteFailures(t *testing.T) {
+	l, err := NewAccessLogger(AccessLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &flakyWriter{fail: true}
+	l.out = out
+
+	entry := AccessLogEntry{Start: time.Now(), Request: httptest.NewRequest("GET", "/app", nil), Status: 200}
+	l.Log(entry)
+	l.Log(entry)
+	if !l.failing {
+		t.Fatal("failed writes not noticed")
+	}
+
+	out.fail = false
+	l.Log(entry)
+	if l.failing || out.lines != 1 {
+		t.Fatalf("failing = %v, lines = %d after the writer recovered", l.failing, out.lines)
+	}
+}
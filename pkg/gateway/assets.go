@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// routeCookie remembers which route served the last page a browser opened, so
+// asset requests like /assets/x.js can be sent to the same app
+const routeCookie = "neploy_route"
+
+// maxRewriteBytes caps the HTML pages rewriteHTML holds in memory, bigger
+// ones are passed through as they are
+const maxRewriteBytes = 5 << 20
+
+var rootRelativeAttr = regexp.MustCompile(`((?:src|href|action)=["'])(/[^"']*)`)
+
+// isAssetRequest checks if the request is for a static asset
+func isAssetRequest(path string) bool {
+	return strings.Contains(path, "/assets/") ||
+		strings.HasSuffix(path, ".css") ||
+		strings.HasSuffix(path, ".js") ||
+		strings.HasSuffix(path, ".png") ||
+		strings.HasSuffix(path, ".jpg") ||
+		strings.HasSuffix(path, ".jpeg") ||
+		strings.HasSuffix(path, ".svg") ||
+		strings.HasSuffix(path, ".ico") ||
+		strings.HasSuffix(path, ".webp") ||
+		strings.HasSuffix(path, ".gif")
+}
+
+// isDocumentRequest reports whether the browser is navigating to a page, as
+// opposed to fetching an asset or calling an API from a script.
+func isDocumentRequest(req *http.Request) bool {
+	if dest := req.Header.Get("Sec-Fetch-Dest"); dest != "" {
+		return dest == "document"
+	}
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// setRouteCookie scopes the browser to the route that served the current
+// page. The cookie goes to the whole domain, the unprefixed asset requests
+// it is for are outside of the route prefix.
+func setRouteCookie(w http.ResponseWriter, route Route) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     routeCookie,
+		Value:    url.PathEscape(route.Key()),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// routeFromCookie returns the route key stored in the routing cookie
+func routeFromCookie(req *http.Request) string {
+	cookie, err := req.Cookie(routeCookie)
+	if err != nil {
+		return ""
+	}
+
+	path, err := url.PathUnescape(cookie.Value)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// rewriteHTML prefixes root-relative src, href and action attributes with the
+// route path so the browser requests assets under the app's own prefix.
+// Compressed bodies and those over maxRewriteBytes are left untouched, the
+// routing cookie covers them.
+func rewriteHTML(resp *http.Response, prefix string) error {
+	if prefix == "" || prefix == "/" {
+		return nil
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRewriteBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxRewriteBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	rewritten := rootRelativeAttr.ReplaceAllFunc(body, func(match []byte) []byte {
+		groups := rootRelativeAttr.FindSubmatch(match)
+		attr, value := groups[1], string(groups[2])
+		// Protocol-relative URLs and paths already inside the app stay as they are
+		if strings.HasPrefix(value, "//") || value == prefix || strings.HasPrefix(value, prefix+"/") {
+			return match
+		}
+		return append(append([]byte{}, attr...), prefix+value...)
+	})
+
+	resp.Body = io.NopCloser(bytes.NewReader(rewritten))
+	resp.ContentLength = int64(len(rewritten))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+	return nil
+}
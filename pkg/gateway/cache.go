@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/attribute"
+	neploymetrics "neploy.dev/pkg/metrics"
 )
 
 var memoryCache = cache.New(5*time.Minute, 10*time.Minute)
@@ -28,12 +30,20 @@ func CacheMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		key := r.Method + ":" + r.URL.String()
 
-		if val, found := GetCache(key); found {
+		_, span := startSpan(r.Context(), "gateway.cache")
+		val, found := GetCache(key)
+		span.SetAttributes(attribute.Bool("neploy.cache.hit", found))
+		span.End()
+
+		if found {
+			neploymetrics.CacheHit()
 			w.Header().Set("X-Cache", "HIT")
 			w.Write(val.([]byte))
 			return
 		}
 
+		neploymetrics.CacheMiss()
+
 		buf := new(bytes.Buffer)
 		cw := &captureWriter{ResponseWriter: w, buf: buf, status: http.StatusOK}
 
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	ForwardedForHeader = "X-Forwarded-For"
+	RealIPHeader       = "X-Real-IP"
+)
+
+type clientIPKey struct{}
+
+// TrustedProxies are the load balancers and proxies in front of neploy that
+// are believed when they name the client in X-Forwarded-For or X-Real-IP.
+// Everyone else is identified by the address of the connection. See
+// ParseCIDRs for reading them.
+type TrustedProxies []netip.Prefix
+
+func (t TrustedProxies) Contains(addr netip.Addr) bool {
+	return containsAddr(t, addr)
+}
+
+// ClientIP resolves the client that sent r. Forwarding headers only count
+// when the connection comes from a trusted proxy: X-Forwarded-For is walked
+// from the right past the trusted hops, X-Real-IP is used without it.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	peer := peerIP(r)
+	addr, err := netip.ParseAddr(peer)
+	if err != nil || !t.Contains(addr) {
+		return peer
+	}
+
+	if values := r.Header.Values(ForwardedForHeader); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			client = hop.Unmap().String()
+			if !t.Contains(hop) {
+				break
+			}
+		}
+		return client
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(RealIPHeader))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return peer
+}
+
+// ClientIPMiddleware resolves the client IP of every request once, for
+// ClientIP. Forwarding headers from untrusted peers are dropped, so neither
+// the gateway nor the apps behind it take a spoofed address for the client.
+func ClientIPMiddleware(trusted TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if addr, err := netip.ParseAddr(peerIP(r)); err != nil || !trusted.Contains(addr) {
+				r.Header.Del(ForwardedForHeader)
+				r.Header.Del(RealIPHeader)
+			}
+
+			ctx := context.WithValue(r.Context(), clientIPKey{}, trusted.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the IP of the client that sent r, as ClientIPMiddleware
+// resolved it, or the address of the connection outside of it
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// peerIP is the IP of the connection r came on, without the port
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	prefixes, err := ParseCIDRs("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := TrustedProxies(prefixes)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:4000", map[string]string{ForwardedForHeader: "1.2.3.4"}, "203.0.113.7"},
+		{"forwarded by trusted proxy", "10.0.0.5:4000", map[string]string{ForwardedForHeader: "198.51.100.2"}, "198.51.100.2"},
+		{"chain of trusted proxies", "10.0.0.5:4000", map[string]string{ForwardedForHeader: "198.51.100.2, 192.168.1.1, 10.1.1.1"}, "198.51.100.2"},
+		{"client prepends a fake hop", "10.0.0.5:4000", map[string]string{ForwardedForHeader: "1.2.3.4, 198.51.100.2"}, "198.51.100.2"},
+		{"only trusted hops", "10.0.0.5:4000", map[string]string{ForwardedForHeader: "10.1.1.1"}, "10.1.1.1"},
+		{"garbage hop stops the walk", "10.0.0.5:4000", map[string]string{ForwardedForHeader: "198.51.100.2, bogus"}, "10.0.0.5"},
+		{"real ip header", "192.168.1.1:4000", map[string]string{RealIPHeader: "198.51.100.9"}, "198.51.100.9"},
+		{"invalid real ip header", "192.168.1.1:4000", map[string]string{RealIPHeader: "nope"}, "192.168.1.1"},
+		{"ipv6 peer", "[2001:db8::1]:4000", nil, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			if got := trusted.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	prefixes, err := ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotIP, gotHeader string
+	handler := ClientIPMiddleware(TrustedProxies(prefixes))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIP = ClientIP(r)
+		gotHeader = r.Header.Get(ForwardedForHeader)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	req.Header.Set(ForwardedForHeader, "1.2.3.4")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if gotIP != "203.0.113.7" || gotHeader != "" {
+		t.Errorf("untrusted peer: ip %q, X-Forwarded-For %q, want the peer and no header", gotIP, gotHeader)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:4000"
+	req.Header.Set(ForwardedForHeader, "198.51.100.2")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if gotIP != "198.51.100.2" || gotHeader != "198.51.100.2" {
+		t.Errorf("trusted peer: ip %q, X-Forwarded-For %q, want the forwarded client and the header kept", gotIP, gotHeader)
+	}
+}
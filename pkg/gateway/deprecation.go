@@ -0,0 +1,252 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+// OtherConsumers counts the requests of the consumers over
+// maxUsageConsumers between two flushes
+const OtherConsumers = "(other)"
+
+const (
+	usageFlushInterval = 30 * time.Second
+	// maxUsageConsumers caps the counters kept between two flushes, so a
+	// client making up consumer ids can't grow them without bound
+	maxUsageConsumers   = 10000
+	maxConsumerIDLength = 128
+)
+
+// versionLifecycle is the deprecation of a version as the gateway applies it
+type versionLifecycle struct {
+	deprecatedAt time.Time
+	sunsetAt     time.Time // zero when never sunset
+	migrationURL string
+	redirect     bool
+}
+
+// newVersionLifecycle returns the lifecycle of version, false when it is
+// not deprecated
+func newVersionLifecycle(version model.ApplicationVersion) (versionLifecycle, bool) {
+	if version.DeprecatedAt == nil || version.DeprecatedAt.IsZero() {
+		return versionLifecycle{}, false
+	}
+
+	lifecycle := versionLifecycle{
+		deprecatedAt: version.DeprecatedAt.Time,
+		migrationURL: version.MigrationURL,
+		redirect:     version.SunsetAction == model.SunsetRedirect,
+	}
+	if version.SunsetAt != nil {
+		lifecycle.sunsetAt = version.SunsetAt.Time
+	}
+	return lifecycle, true
+}
+
+func (l versionLifecycle) deprecated(now time.Time) bool {
+	return !now.Before(l.deprecatedAt)
+}
+
+func (l versionLifecycle) sunset(now time.Time) bool {
+	return !l.sunsetAt.IsZero() && !now.Before(l.sunsetAt)
+}
+
+// setHeaders sets the Deprecation (RFC 9745) and Sunset (RFC 8594) headers,
+// and links the migration guide and the successor version when known
+func (l versionLifecycle) setHeaders(header http.Header, successor string) {
+	header.Set("Deprecation", "@"+strconv.FormatInt(l.deprecatedAt.Unix(), 10))
+	if !l.sunsetAt.IsZero() {
+		header.Set("Sunset", l.sunsetAt.UTC().Format(http.TimeFormat))
+	}
+	if l.migrationURL != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, l.migrationURL))
+	}
+	if successor != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+	}
+}
+
+// successorPath is path under the newest version of the app on host, empty when
+// the version didn't come from the path, the newest one is the same or it
+// is sunset too
+func successorPath(snapshot *Snapshot, host, appID string, resolution versionResolution, now time.Time) string {
+	if resolution.Source != VersionFromPath {
+		return ""
+	}
+	latest, ok := snapshot.LatestVersion(host, ExtractAppName(resolution.Path))
+	if !ok || latest == resolution.Version {
+		return ""
+	}
+	if lifecycle, ok := snapshot.lifecycles[appID][latest]; ok && lifecycle.sunset(now) {
+		return ""
+	}
+	return "/" + latest + strings.TrimPrefix(resolution.Path, "/"+resolution.Version)
+}
+
+// serveLifecycle sets the deprecation headers of the version r resolved to
+// and counts the request. After the sunset it answers r itself, with a
+// redirect to the newest version or 410, and returns true.
+func serveLifecycle(w http.ResponseWriter, r *http.Request, snapshot *Snapshot, usage *DeprecationUsage, routing routing) bool {
+	lifecycle, resolution := *routing.Lifecycle, routing.Resolution
+	lifecycle.setHeaders(w.Header(), routing.Successor)
+
+	if lifecycle.deprecated(routing.Now) {
+		usage.Record(r, routing.AppID, resolution.Version, routing.Now)
+	}
+
+	switch routing.Status {
+	case http.StatusPermanentRedirect:
+		successor := routing.Successor
+		if r.URL.RawQuery != "" {
+			successor += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, successor, http.StatusPermanentRedirect)
+		return true
+	case http.StatusGone:
+		snapshot.writeError(w, r, routing.AppID, http.StatusGone,
+			fmt.Sprintf("API version %s was sunset on %s", resolution.Version, lifecycle.sunsetAt.UTC().Format(time.DateOnly)))
+		return true
+	}
+	return false
+}
+
+type usageKey struct {
+	appID    string
+	version  string
+	consumer string
+	day      string
+}
+
+// DeprecationUsage counts the requests to deprecated versions per consumer
+// and day in memory, and adds them to deprecated_version_usage every
+// usageFlushInterval. A request only costs a map update.
+type DeprecationUsage struct {
+	repo   *repository.DeprecatedVersionUsage
+	header string
+
+	mu     sync.Mutex
+	counts map[usageKey]*model.DeprecatedVersionUsage
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewDeprecationUsage counts the consumers by the value of header, or by
+// client IP when a request doesn't carry it
+func NewDeprecationUsage(repo *repository.DeprecatedVersionUsage, header string) *DeprecationUsage {
+	u := &DeprecationUsage{
+		repo:     repo,
+		header:   header,
+		counts:   make(map[usageKey]*model.DeprecatedVersionUsage),
+		stopChan: make(chan struct{}),
+	}
+
+	u.wg.Add(1)
+	go u.run()
+
+	return u
+}
+
+// consumer identifies who sent r
+func (u *DeprecationUsage) consumer(r *http.Request) string {
+	if u.header != "" {
+		if id := strings.TrimSpace(r.Header.Get(u.header)); id != "" {
+			if len(id) > maxConsumerIDLength {
+				id = id[:maxConsumerIDLength]
+			}
+			return id
+		}
+	}
+
+	return ClientIP(r)
+}
+
+// Record counts a request of r to version of appID
+func (u *DeprecationUsage) Record(r *http.Request, appID, version string, now time.Time) {
+	if u == nil {
+		return
+	}
+
+	now = now.UTC()
+	key := usageKey{appID: appID, version: version, consumer: u.consumer(r), day: now.Format(time.DateOnly)}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	usage, ok := u.counts[key]
+	if !ok && len(u.counts) >= maxUsageConsumers {
+		key.consumer = OtherConsumers
+		usage, ok = u.counts[key]
+	}
+	if !ok {
+		day, _ := time.Parse(time.DateOnly, key.day)
+		usage = &model.DeprecatedVersionUsage{
+			ApplicationID: appID,
+			Version:       version,
+			Consumer:      key.consumer,
+			Day:           model.NewDate(day),
+		}
+		u.counts[key] = usage
+	}
+	usage.Requests++
+	usage.LastSeenAt = model.NewDate(now)
+}
+
+// Close stops counting and writes the requests counted since the last flush
+func (u *DeprecationUsage) Close() {
+	if u == nil {
+		return
+	}
+
+	close(u.stopChan)
+	u.wg.Wait()
+}
+
+func (u *DeprecationUsage) run() {
+	defer u.wg.Done()
+
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.stopChan:
+			u.flush()
+			return
+		case <-ticker.C:
+			u.flush()
+		}
+	}
+}
+
+func (u *DeprecationUsage) flush() {
+	u.mu.Lock()
+	counts := u.counts
+	u.counts = make(map[usageKey]*model.DeprecatedVersionUsage)
+	u.mu.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+
+	usages := make([]model.DeprecatedVersionUsage, 0, len(counts))
+	for _, usage := range counts {
+		usages = append(usages, *usage)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceWriteTimeout)
+	defer cancel()
+
+	if err := u.repo.UpsertBatch(ctx, usages); err != nil {
+		log.Printf("ERROR: Failed to write the usage of %d deprecated version consumers: %v", len(usages), err)
+	}
+}
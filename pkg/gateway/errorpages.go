@@ -0,0 +1,267 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	texttemplate "text/template"
+
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+)
+
+// ErrorPageStatuses are the statuses an application can replace the page of
+var ErrorPageStatuses = []int{
+	http.StatusNotFound,
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// MaintenanceBypassHeader lets a request through the maintenance of an
+// application when it carries its bypass token
+const MaintenanceBypassHeader = "X-Maintenance-Bypass"
+
+const defaultMaintenanceMessage = "The application is under maintenance, please try again later"
+
+// ErrorPageData is what error page templates are executed with
+type ErrorPageData struct {
+	Status      int
+	StatusText  string
+	Message     string
+	RequestID   string
+	Path        string
+	Maintenance bool
+	RetryAfter  int // seconds, 0 when unknown
+}
+
+const defaultErrorHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Status}} {{.StatusText}}</title>
+<style>body{font-family:system-ui,sans-serif;max-width:36rem;margin:4rem auto;padding:0 1rem;color:#222}small{color:#777}</style>
+</head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+{{if .RequestID}}<p><small>Request ID: {{.RequestID}}</small></p>{{end}}
+</body>
+</html>
+`
+
+const defaultErrorJSON = `{"status":{{.Status}},"error":{{json .Message}}` +
+	`{{if .RequestID}},"request_id":{{json .RequestID}}{{end}}` +
+	`{{if .RetryAfter}},"retry_after":{{.RetryAfter}}{{end}}}`
+
+var defaultErrorPage = mustParseErrorPage(defaultErrorHTML, defaultErrorJSON)
+
+// jsonFuncs let JSON templates quote values, {{json .Message}}
+var jsonFuncs = texttemplate.FuncMap{
+	"json": func(v any) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// errorPage holds the compiled templates of a page, a nil one leaves its
+// format to the default page
+type errorPage struct {
+	html *htmltemplate.Template
+	json *texttemplate.Template
+}
+
+func parseErrorPage(html, jsonTemplate string) (*errorPage, error) {
+	page := &errorPage{}
+	if html != "" {
+		tmpl, err := htmltemplate.New("html").Parse(html)
+		if err != nil {
+			return nil, fmt.Errorf("html template: %v", err)
+		}
+		page.html = tmpl
+	}
+	if jsonTemplate != "" {
+		tmpl, err := texttemplate.New("json").Funcs(jsonFuncs).Parse(jsonTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("json template: %v", err)
+		}
+		page.json = tmpl
+	}
+	return page, nil
+}
+
+func mustParseErrorPage(html, jsonTemplate string) *errorPage {
+	page, err := parseErrorPage(html, jsonTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return page
+}
+
+// ValidateErrorPage parses the templates of a page and runs them once, the
+// JSON one must render valid JSON
+func ValidateErrorPage(status int, html, jsonTemplate string) error {
+	if !slices.Contains(ErrorPageStatuses, status) {
+		return errors.New("error pages can be set for 404, 429, 502, 503 and 504")
+	}
+	if html == "" && jsonTemplate == "" {
+		return errors.New("an error page needs an HTML or a JSON template")
+	}
+
+	page, err := parseErrorPage(html, jsonTemplate)
+	if err != nil {
+		return err
+	}
+
+	data := ErrorPageData{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Message:    "Sample \"message\"",
+		RequestID:  "0123456789abcdef",
+		Path:       "/app/path",
+		RetryAfter: 60,
+	}
+	var buf bytes.Buffer
+	if page.html != nil {
+		if err := page.html.Execute(&buf, data); err != nil {
+			return fmt.Errorf("html template: %v", err)
+		}
+	}
+	if page.json != nil {
+		buf.Reset()
+		if err := page.json.Execute(&buf, data); err != nil {
+			return fmt.Errorf("json template: %v", err)
+		}
+		if !json.Valid(buf.Bytes()) {
+			return errors.New("json template does not render valid JSON, quote values with {{json .Message}}")
+		}
+	}
+	return nil
+}
+
+func (p *errorPage) execute(w io.Writer, html bool, data ErrorPageData) error {
+	if p == nil {
+		return errNoTemplate
+	}
+	if html {
+		if p.html == nil {
+			return errNoTemplate
+		}
+		return p.html.Execute(w, data)
+	}
+	if p.json == nil {
+		return errNoTemplate
+	}
+	return p.json.Execute(w, data)
+}
+
+var errNoTemplate = errors.New("no template")
+
+// renderError answers r with page in HTML for browsers and JSON for
+// everyone else. The default page stands in when page has no template for
+// the format or it fails to run.
+func renderError(w http.ResponseWriter, r *http.Request, page *errorPage, data ErrorPageData) {
+	data.StatusText = http.StatusText(data.Status)
+	data.RequestID = RequestID(r.Context())
+	data.Path = r.URL.Path
+
+	html := isDocumentRequest(r)
+	var buf bytes.Buffer
+	if err := page.execute(&buf, html, data); err != nil {
+		if !errors.Is(err, errNoTemplate) {
+			logger.Warn("error rendering the %d page of %s, using the default one: %v", data.Status, r.URL.Path, err)
+		}
+		buf.Reset()
+		defaultErrorPage.execute(&buf, html, data)
+	}
+
+	header := w.Header()
+	if html {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		header.Set("Content-Type", "application/json")
+	}
+	header.Del("Content-Length")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "no-store")
+	w.WriteHeader(data.Status)
+	w.Write(buf.Bytes())
+}
+
+// maintenanceMode is the maintenance of an application as the gateway
+// applies it
+type maintenanceMode struct {
+	message     string
+	retryAfter  int
+	allow       []netip.Prefix
+	bypassToken string
+}
+
+// newMaintenanceMode returns the mode of maintenance, without allow list
+// when it doesn't parse
+func newMaintenanceMode(maintenance model.Maintenance) (maintenanceMode, error) {
+	mode := maintenanceMode{
+		message:     maintenance.Message,
+		retryAfter:  maintenance.RetryAfter,
+		bypassToken: maintenance.BypassToken,
+	}
+	if mode.message == "" {
+		mode.message = defaultMaintenanceMessage
+	}
+
+	allow, err := ParseCIDRs(maintenance.AllowIPs)
+	mode.allow = allow
+	return mode, err
+}
+
+// bypassed reports whether r comes from an allowed address or carries the
+// bypass token
+func (m maintenanceMode) bypassed(r *http.Request) bool {
+	if token := r.Header.Get(MaintenanceBypassHeader); m.bypassToken != "" && token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(m.bypassToken)) == 1 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(ClientIP(r))
+	return err == nil && containsAddr(m.allow, addr)
+}
+
+// MaintenanceMiddleware answers the requests of an application under
+// maintenance with 503 and its 503 page. Requests let through lose the
+// bypass header, the token is not the application's business.
+func MaintenanceMiddleware(snapshot *Snapshot, appID string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		mode, ok := snapshot.maintenance[appID]
+		if !ok {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !mode.bypassed(r) {
+				if mode.retryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(mode.retryAfter))
+				}
+				renderError(w, r, snapshot.pages[appID][http.StatusServiceUnavailable], ErrorPageData{
+					Status:      http.StatusServiceUnavailable,
+					Message:     mode.message,
+					Maintenance: true,
+					RetryAfter:  mode.retryAfter,
+				})
+				return
+			}
+
+			r.Header.Del(MaintenanceBypassHeader)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
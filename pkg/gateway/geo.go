@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"neploy.dev/pkg/geoip"
+)
+
+const (
+	GeoModeAllow = "allow"
+	GeoModeBlock = "block"
+)
+
+// ParseCountries splits a comma separated list of ISO country codes
+func ParseCountries(list string) []string {
+	countries := make([]string, 0)
+	for _, country := range strings.Split(list, ",") {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if country != "" {
+			countries = append(countries, country)
+		}
+	}
+	return countries
+}
+
+// GeoAccessMiddleware applies the country rule of a route. With GeoModeAllow
+// only the listed countries get through, with GeoModeBlock the listed ones are
+// rejected. Loopback and private addresses are never restricted, and nothing
+// is when no GeoIP database is loaded.
+func GeoAccessMiddleware(geo *geoip.DB, route Route) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if route.GeoMode == "" || !geo.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !geoAllowed(geo, route, ClientIP(r)) {
+				writeError(w, r, http.StatusForbidden, "Access from your country is not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func geoAllowed(geo *geoip.DB, route Route, addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() {
+		return true
+	}
+
+	loc, _ := geo.Lookup(ip)
+	listed := loc.Country != "" && slices.Contains(route.GeoCountries, loc.Country)
+
+	if route.GeoMode == GeoModeBlock {
+		return !listed
+	}
+	// Unknown locations are rejected when only some countries are allowed
+	return listed
+}
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc/codes"
+)
+
+// Route protocols, an empty one proxies HTTP/1.1
+const (
+	// ProtocolH2C proxies HTTP/2 without TLS to the container
+	ProtocolH2C = "h2c"
+	// ProtocolGRPC proxies over h2c too, and matches the full method path
+	// (/package.Service/Method) without version resolution
+	ProtocolGRPC = "grpc"
+)
+
+// h2cTransport is shared by the h2c and gRPC routes so connections to a
+// container are reused across routes
+var h2cTransport = NewH2CTransport()
+
+// NewH2CTransport returns a transport speaking HTTP/2 over plain TCP, with
+// prior knowledge, to http:// URLs
+func NewH2CTransport() *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// H2CHandler lets clients talk HTTP/2 without TLS to next, both with prior
+// knowledge, as gRPC clients do, and by upgrading from HTTP/1.1
+func H2CHandler(next http.Handler, server *http.Server) http.Handler {
+	return h2c.NewHandler(next, &http2.Server{IdleTimeout: server.IdleTimeout})
+}
+
+// isHTTP2Route reports whether route proxies HTTP/2 end to end. Those skip
+// the response cache, a replay from it would lose the trailers.
+func isHTTP2Route(route Route) bool {
+	return route.Protocol == ProtocolH2C || route.Protocol == ProtocolGRPC
+}
+
+// grpcStatus returns the grpc-status of a response once it was written. It
+// is a trailer, or a header on trailers-only responses.
+func grpcStatus(header http.Header) (codes.Code, bool) {
+	value := header.Get(http.TrailerPrefix + "Grpc-Status")
+	if value == "" {
+		value = header.Get("Grpc-Status")
+	}
+	if value == "" {
+		return codes.OK, false
+	}
+
+	code, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return codes.Unknown, true
+	}
+	return codes.Code(code), true
+}
+
+// GRPCHTTPStatus maps a gRPC code to the HTTP status counted in the metrics,
+// gRPC answers 200 even when the call failed
+func GRPCHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
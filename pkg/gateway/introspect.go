@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"neploy.dev/pkg/model"
+)
+
+// LiveRoutes returns the route table as the router serves it, sorted by path
+func (r *Router) LiveRoutes() []model.LiveRoute {
+	config := r.snapshots.Current().Config
+	routes := r.Routes()
+
+	live := make([]model.LiveRoute, 0, len(routes))
+	for _, route := range routes {
+		live = append(live, liveRoute(route, config))
+	}
+	return live
+}
+
+func liveRoute(route Route, config model.GatewayConfig) model.LiveRoute {
+	live := model.LiveRoute{
+		Host:          route.Domain,
+		Path:          route.Path,
+		ApplicationID: route.AppID,
+		Version:       RouteVersion(route.Path),
+		Backend:       backendURL(route),
+		MaxBodyBytes:  bodyLimit(route, config),
+		GeoMode:       route.GeoMode,
+		GeoCountries:  route.GeoCountries,
+		Protocol:      route.Protocol,
+	}
+	if route.Mirror.enabled() && route.Protocol != ProtocolGRPC {
+		live.MirrorVersion, live.MirrorPercent = route.Mirror.Version, route.Mirror.Percent
+	}
+	return live
+}
+
+func backendURL(route Route) string {
+	return fmt.Sprintf("http://localhost:%s", route.Port)
+}
+
+// RouteVersion returns the version a /{version}/app route serves, empty for
+// unversioned routes
+func RouteVersion(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 1 && IsVersionSegment(segments[0]) {
+		return segments[0]
+	}
+	return ""
+}
+
+// Explain runs req through the routing of ServeHTTP without proxying it and
+// tells which route and version it ends on and why. req is not modified.
+func (r *Router) Explain(req *http.Request) model.RouteMatch {
+	match := model.RouteMatch{Method: req.Method, URL: req.URL.String(), Steps: make([]string, 0)}
+	step := func(format string, args ...any) {
+		match.Steps = append(match.Steps, fmt.Sprintf(format, args...))
+	}
+
+	snapshot := r.snapshots.Current()
+	routing := r.route(snapshot, req)
+	path, resolution := routing.Path, routing.Resolution
+	match.Path = routing.MatchPath
+
+	if routing.GRPC {
+		step("%s is a gRPC route, matched on the full method path without version resolution", routing.Route.Path)
+		r.explainRoute(&match, step, routing.Route, snapshot, req)
+		return match
+	}
+
+	switch routing.Asset {
+	case assetScoped:
+		step("%s is an asset without an app prefix, scoped to %s by the routing cookie or the Referer", req.URL.Path, routing.AssetRoute.Path)
+	case assetUnscoped:
+		step("%s is an asset without an app prefix and neither the routing cookie nor the Referer lead to a route", path)
+		match.Status = routing.Status
+		return match
+	case assetCatchAll:
+		step("%s is an asset without an app prefix, neither the routing cookie nor the Referer lead to a route and it falls to the catch-all", path)
+	case assetPrefixed:
+		step("%s is an asset under a route prefix", path)
+	}
+
+	if resolution.Skipped {
+		step(".well-known requests skip version resolution")
+		if routing.MatchPath != path {
+			step("the X-Original-Path header %s is matched instead of the path", routing.MatchPath)
+		}
+	} else {
+		match.Version, match.VersionSource = resolution.Version, resolution.Source
+		asked := resolution.Version
+		if resolution.Range != "" {
+			asked = resolution.Range
+		}
+		switch resolution.Source {
+		case VersionFromPath:
+			step("version %s is the first path segment", asked)
+		case VersionFromHeader:
+			step("version %s comes from the X-API-Version header", asked)
+		case VersionFromLatest:
+			step("no version asked, %s is the latest of %s", resolution.Version, ExtractAppName(path))
+		default:
+			step("no version asked and none known for the app, %s is assumed", resolution.Version)
+		}
+		if resolution.Range != "" {
+			step("%s is not a version of %s, it resolves as a range to its highest active version %s", resolution.Range, ExtractAppName(path), resolution.Version)
+		}
+		if resolution.Path != path {
+			step("the path is rewritten to %s", resolution.Path)
+		}
+		if !resolution.Found {
+			step("%s has no version %s", ExtractAppName(resolution.Path), resolution.Version)
+			match.Status = routing.Status
+			return match
+		}
+
+		if routing.Lifecycle != nil {
+			switch routing.Status {
+			case http.StatusPermanentRedirect:
+				step("version %s was sunset, redirected with 308 to %s", resolution.Version, routing.Successor)
+				match.Status = routing.Status
+				return match
+			case http.StatusGone:
+				step("version %s was sunset, answered with 410", resolution.Version)
+				match.Status = routing.Status
+				return match
+			default:
+				step("version %s is deprecated, the response gets Deprecation and Sunset headers", resolution.Version)
+			}
+		}
+	}
+
+	if !routing.Matched {
+		if routing.Status == http.StatusContinue {
+			step("no route matches %s, .well-known requests are answered with 100", routing.MatchPath)
+		} else {
+			step("no route matches %s", routing.MatchPath)
+		}
+		match.Status = routing.Status
+		return match
+	}
+
+	if routing.Route.Path == "" {
+		step("only the catch-all route matches %s", routing.MatchPath)
+	} else {
+		step("%s is the longest route prefix matching %s", routing.Route.Path, routing.MatchPath)
+	}
+	r.explainRoute(&match, step, routing.Route, snapshot, req)
+	return match
+}
+
+// explainRoute fills match with the route it ends on and the policies the
+// request goes through there
+func (r *Router) explainRoute(match *model.RouteMatch, step func(format string, args ...any), route Route, snapshot *Snapshot, req *http.Request) {
+	match.Matched = true
+	live := liveRoute(route, snapshot.Config)
+	match.Route = &live
+	remoteAddr := ClientIP(req)
+
+	if route.GeoMode != "" {
+		switch {
+		case !r.geo.Enabled():
+			step("the %s country rule is ignored, no GeoIP database is loaded", route.GeoMode)
+		case remoteAddr == "":
+			step("the %s country rule applies to %s, no client address given to check it", route.GeoMode, strings.Join(route.GeoCountries, ", "))
+		case !geoAllowed(r.geo, route, remoteAddr):
+			step("%s is rejected by the %s country rule", remoteAddr, route.GeoMode)
+			match.Status = http.StatusForbidden
+			return
+		default:
+			step("%s passes the %s country rule", remoteAddr, route.GeoMode)
+		}
+	}
+
+	if _, ok := snapshot.maintenance[route.AppID]; ok {
+		if snapshot.UnderMaintenance(route.AppID, req) {
+			step("the application is under maintenance, answered with 503")
+			match.Status = http.StatusServiceUnavailable
+			return
+		}
+		step("the application is under maintenance, the request is let through by the allow list or the bypass header")
+	}
+
+	switch route.Protocol {
+	case ProtocolGRPC:
+		step("proxied over h2c to %s", live.Backend)
+	case ProtocolH2C:
+		step("proxied over h2c to %s, bodies up to %d bytes", live.Backend, live.MaxBodyBytes)
+	default:
+		step("proxied to %s, bodies up to %d bytes", live.Backend, live.MaxBodyBytes)
+	}
+	if live.MirrorVersion != "" {
+		step("%g%% of the requests are mirrored to version %s, its answers discarded", live.MirrorPercent, live.MirrorVersion)
+	}
+}
@@ -0,0 +1,708 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"neploy.dev/pkg/logger"
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
+)
+
+// L4 route protocols
+const (
+	L4TCP = "tcp"
+	L4UDP = "udp"
+)
+
+const (
+	// DefaultL4IdleTimeout closes connections and UDP sessions without
+	// traffic either way for this long
+	DefaultL4IdleTimeout = 5 * time.Minute
+	l4DialTimeout        = 5 * time.Second
+	// sniPeekTimeout is how long a client of the SNI listener has to send
+	// its ClientHello
+	sniPeekTimeout = 10 * time.Second
+	l4BufferSize   = 32 * 1024
+)
+
+// L4Route forwards raw TCP or UDP to a container port. It listens on
+// ListenPort, or takes the TLS connections of the shared SNI listener whose
+// ClientHello asks for SNIHost. TLS is passed through, never terminated.
+type L4Route struct {
+	ID         string
+	AppID      string
+	Protocol   string // L4TCP or L4UDP
+	ListenPort int    // 0 when routed by SNIHost
+	SNIHost    string
+	TargetPort string
+	// MaxConns caps the open connections, or UDP client sessions, 0 is
+	// unlimited
+	MaxConns    int
+	IdleTimeout time.Duration // 0 uses DefaultL4IdleTimeout
+	// Deny is checked first, then an address must be in Allow unless it is
+	// empty
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// Listen names where the route takes connections, like tcp/5432 or
+// sni/db.example.com
+func (r L4Route) Listen() string {
+	if r.SNIHost != "" {
+		return "sni/" + r.SNIHost
+	}
+	return fmt.Sprintf("%s/%d", r.Protocol, r.ListenPort)
+}
+
+// Allowed reports whether the access lists let addr in
+func (r L4Route) Allowed(addr netip.Addr) bool {
+	if containsAddr(r.Deny, addr) {
+		return false
+	}
+	return len(r.Allow) == 0 || containsAddr(r.Allow, addr)
+}
+
+// containsAddr reports whether one of prefixes contains addr
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r L4Route) backend() string {
+	return net.JoinHostPort("localhost", r.TargetPort)
+}
+
+func (r L4Route) idleTimeout() time.Duration {
+	if r.IdleTimeout <= 0 {
+		return DefaultL4IdleTimeout
+	}
+	return r.IdleTimeout
+}
+
+func ValidateL4Route(route L4Route) error {
+	switch route.Protocol {
+	case L4TCP, L4UDP:
+	default:
+		return errors.New("protocol must be tcp or udp")
+	}
+
+	if route.SNIHost != "" {
+		if route.Protocol != L4TCP {
+			return errors.New("SNI routing needs TCP")
+		}
+		if route.ListenPort != 0 {
+			return errors.New("a route either listens on a port or is routed by SNI")
+		}
+	} else if route.ListenPort < 1 || route.ListenPort > 65535 {
+		return errors.New("listen port must be between 1 and 65535")
+	}
+
+	if port, err := strconv.Atoi(route.TargetPort); err != nil || port < 1 || port > 65535 {
+		return errors.New("target port must be between 1 and 65535")
+	}
+	if route.MaxConns < 0 || route.IdleTimeout < 0 {
+		return errors.New("connection limit and idle timeout must not be negative")
+	}
+
+	return nil
+}
+
+// ParseCIDRs parses a comma separated list of CIDRs, a bare address is a
+// single host
+func ParseCIDRs(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// l4Counters outlive updates of their route. They are kept apart from the
+// HTTP stats of the app: a connection is no request, and counting refused
+// ones as errors would set off the error rate alerts.
+type l4Counters struct {
+	active   atomic.Int64
+	total    atomic.Int64
+	rejected atomic.Int64
+	failed   atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+type activeL4Route struct {
+	L4Route
+	counters *l4Counters
+}
+
+type l4Listener struct {
+	// route is nil on the SNI listener, its connections are routed one by one
+	route  atomic.Pointer[activeL4Route]
+	stream net.Listener
+	packet net.PacketConn
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+}
+
+func (l *l4Listener) close() {
+	if l.stream != nil {
+		l.stream.Close()
+		return
+	}
+
+	l.packet.Close()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, session := range l.sessions {
+		session.backend.Close()
+	}
+}
+
+// Forwarder serves the L4 routes, with a listener per port and one shared
+// by the SNI routes. Like the Router it is filled by the reconciler.
+// Connections already open when a route changes or goes away are served
+// until they close or go idle.
+type Forwarder struct {
+	sniAddr string
+
+	mu        sync.Mutex
+	routes    map[string]*activeL4Route // by route id
+	listeners map[string]*l4Listener    // by L4Route.Listen, SNI routes excepted
+	sniRoutes map[string]*activeL4Route // by SNI host
+	sni       *l4Listener
+}
+
+// NewForwarder returns a Forwarder, SNI routes are refused while sniAddr is
+// empty
+func NewForwarder(sniAddr string) *Forwarder {
+	return &Forwarder{
+		sniAddr:   sniAddr,
+		routes:    make(map[string]*activeL4Route),
+		listeners: make(map[string]*l4Listener),
+		sniRoutes: make(map[string]*activeL4Route),
+	}
+}
+
+func (f *Forwarder) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for listen, ln := range f.listeners {
+		ln.close()
+		delete(f.listeners, listen)
+	}
+	if f.sni != nil {
+		f.sni.close()
+		f.sni = nil
+	}
+}
+
+// AddRoute adds route or replaces the one with its id. The listener it
+// needs is opened first, on error the route served so far is kept.
+func (f *Forwarder) AddRoute(route L4Route) error {
+	route.SNIHost = strings.ToLower(route.SNIHost)
+	if err := ValidateL4Route(route); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	active := &activeL4Route{L4Route: route, counters: &l4Counters{}}
+	old, exists := f.routes[route.ID]
+	if exists {
+		active.counters = old.counters
+	}
+
+	if route.SNIHost != "" {
+		if owner, ok := f.sniRoutes[route.SNIHost]; ok && owner.ID != route.ID {
+			return fmt.Errorf("%s is taken by another route", route.Listen())
+		}
+		if err := f.openSNI(); err != nil {
+			return err
+		}
+		f.sniRoutes[route.SNIHost] = active
+	} else {
+		ln, ok := f.listeners[route.Listen()]
+		if ok && ln.route.Load().ID != route.ID {
+			return fmt.Errorf("%s is taken by another route", route.Listen())
+		}
+		if ok {
+			ln.route.Store(active)
+		} else {
+			ln, err := f.listen(active)
+			if err != nil {
+				return err
+			}
+			f.listeners[route.Listen()] = ln
+		}
+	}
+
+	if exists && old.Listen() != route.Listen() {
+		f.release(old)
+	}
+	f.routes[route.ID] = active
+	return nil
+}
+
+func (f *Forwarder) RemoveRoute(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if route, ok := f.routes[id]; ok {
+		f.release(route)
+		delete(f.routes, id)
+	}
+}
+
+// Routes returns a copy of the route table sorted by where they listen
+func (f *Forwarder) Routes() []L4Route {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	routes := make([]L4Route, 0, len(f.routes))
+	for _, route := range f.routes {
+		routes = append(routes, route.L4Route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Listen() < routes[j].Listen() })
+	return routes
+}
+
+// Stats returns the counters of the routes being served by route id, they
+// start over when the gateway restarts
+func (f *Forwarder) Stats() map[string]model.L4RouteStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make(map[string]model.L4RouteStats, len(f.routes))
+	for id, route := range f.routes {
+		stats[id] = model.L4RouteStats{
+			Listening:     true,
+			ActiveConns:   route.counters.active.Load(),
+			TotalConns:    route.counters.total.Load(),
+			RejectedConns: route.counters.rejected.Load(),
+			FailedConns:   route.counters.failed.Load(),
+			BytesIn:       route.counters.bytesIn.Load(),
+			BytesOut:      route.counters.bytesOut.Load(),
+		}
+	}
+	return stats
+}
+
+// release closes what only route listened on, callers hold f.mu
+func (f *Forwarder) release(route *activeL4Route) {
+	if route.SNIHost != "" {
+		if owner, ok := f.sniRoutes[route.SNIHost]; ok && owner.ID == route.ID {
+			delete(f.sniRoutes, route.SNIHost)
+		}
+		if len(f.sniRoutes) == 0 && f.sni != nil {
+			f.sni.close()
+			f.sni = nil
+		}
+		return
+	}
+
+	if ln, ok := f.listeners[route.Listen()]; ok && ln.route.Load().ID == route.ID {
+		ln.close()
+		delete(f.listeners, route.Listen())
+	}
+}
+
+func (f *Forwarder) listen(route *activeL4Route) (*l4Listener, error) {
+	addr := fmt.Sprintf(":%d", route.ListenPort)
+	ln := &l4Listener{}
+	ln.route.Store(route)
+
+	if route.Protocol == L4UDP {
+		packet, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on udp %s: %v", addr, err)
+		}
+		ln.packet = packet
+		ln.sessions = make(map[string]*udpSession)
+		go f.serveUDP(ln)
+		return ln, nil
+	}
+
+	stream, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on tcp %s: %v", addr, err)
+	}
+	ln.stream = stream
+	go f.acceptTCP(ln, func(conn net.Conn) {
+		f.serveTCP(conn, ln.route.Load(), nil)
+	})
+	return ln, nil
+}
+
+// openSNI opens the SNI listener for the first SNI route, callers hold f.mu
+func (f *Forwarder) openSNI() error {
+	if f.sni != nil {
+		return nil
+	}
+	if f.sniAddr == "" {
+		return errors.New("SNI routing is disabled, no SNI listen address is configured")
+	}
+
+	stream, err := net.Listen("tcp", f.sniAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on tcp %s: %v", f.sniAddr, err)
+	}
+	f.sni = &l4Listener{stream: stream}
+	go f.acceptTCP(f.sni, f.serveSNI)
+	return nil
+}
+
+func (f *Forwarder) acceptTCP(ln *l4Listener, serve func(net.Conn)) {
+	for {
+		conn, err := ln.stream.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Warn("error accepting L4 connection on %s: %v", ln.stream.Addr(), err)
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		go serve(conn)
+	}
+}
+
+// serveSNI routes a connection of the SNI listener by the server name of
+// its ClientHello, which is replayed to the backend
+func (f *Forwarder) serveSNI(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(sniPeekTimeout))
+	serverName, hello, err := peekClientHello(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		logger.Debug("dropping SNI connection from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	f.mu.Lock()
+	route, ok := f.sniRoutes[strings.ToLower(serverName)]
+	f.mu.Unlock()
+	if !ok {
+		logger.Debug("dropping SNI connection from %s, no route for %q", conn.RemoteAddr(), serverName)
+		conn.Close()
+		return
+	}
+
+	f.serveTCP(conn, route, hello)
+}
+
+// admit applies the access lists and the connection limit of route to a
+// new client, counting the ones refused
+func (f *Forwarder) admit(route *activeL4Route, addr net.Addr) bool {
+	ip, err := netip.ParseAddrPort(addr.String())
+	if err != nil || !route.Allowed(ip.Addr()) {
+		route.counters.rejected.Add(1)
+		neploymetrics.L4Connection(route.AppID, route.Protocol, "denied")
+		return false
+	}
+
+	if active := route.counters.active.Add(1); route.MaxConns > 0 && active > int64(route.MaxConns) {
+		route.counters.active.Add(-1)
+		route.counters.rejected.Add(1)
+		neploymetrics.L4Connection(route.AppID, route.Protocol, "over_limit")
+		return false
+	}
+
+	route.counters.total.Add(1)
+	neploymetrics.L4Connection(route.AppID, route.Protocol, "accepted")
+	return true
+}
+
+// unreachable counts a client whose backend could not be reached
+func (f *Forwarder) unreachable(route *activeL4Route, err error) {
+	logger.Warn("error reaching %s for %s: %v", route.backend(), route.Listen(), err)
+	route.counters.failed.Add(1)
+	neploymetrics.L4Connection(route.AppID, route.Protocol, "upstream_error")
+}
+
+func (f *Forwarder) serveTCP(client net.Conn, route *activeL4Route, hello []byte) {
+	defer client.Close()
+
+	if !f.admit(route, client.RemoteAddr()) {
+		return
+	}
+	defer route.counters.active.Add(-1)
+	defer neploymetrics.TrackL4Active(route.AppID, route.Protocol)()
+
+	backend, err := net.DialTimeout("tcp", route.backend(), l4DialTimeout)
+	if err != nil {
+		f.unreachable(route, err)
+		return
+	}
+	defer backend.Close()
+
+	pipe := &l4Pipe{idle: route.idleTimeout()}
+	pipe.touch()
+	countIn, countOut := f.counter(route, "in"), f.counter(route, "out")
+	in := func(n int) {
+		pipe.in.Add(int64(n))
+		countIn(n)
+	}
+	out := func(n int) {
+		pipe.out.Add(int64(n))
+		countOut(n)
+	}
+
+	if len(hello) > 0 {
+		if _, err := backend.Write(hello); err != nil {
+			return
+		}
+		in(len(hello))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		closeWrite(backend, pipe.copy(backend, client, in))
+	}()
+	go func() {
+		defer wg.Done()
+		closeWrite(client, pipe.copy(client, backend, out))
+	}()
+	wg.Wait()
+}
+
+// counter returns a func adding to the bytes route forwarded in direction
+func (f *Forwarder) counter(route *activeL4Route, direction string) func(n int) {
+	total := &route.counters.bytesIn
+	if direction == "out" {
+		total = &route.counters.bytesOut
+	}
+	return func(n int) {
+		total.Add(int64(n))
+		neploymetrics.L4Bytes(route.AppID, route.Protocol, direction, n)
+	}
+}
+
+// l4Pipe copies both ways between a client and its backend until neither
+// has sent anything for idle
+type l4Pipe struct {
+	idle       time.Duration
+	lastActive atomic.Int64 // unix nanoseconds
+	in, out    atomic.Int64
+}
+
+func (p *l4Pipe) touch() {
+	p.lastActive.Store(time.Now().UnixNano())
+}
+
+func (p *l4Pipe) idled() bool {
+	return time.Since(time.Unix(0, p.lastActive.Load())) >= p.idle
+}
+
+// copy returns io.EOF once src finished sending
+func (p *l4Pipe) copy(dst, src net.Conn, count func(n int)) error {
+	buf := make([]byte, l4BufferSize)
+	for {
+		src.SetReadDeadline(time.Now().Add(p.idle))
+		n, err := src.Read(buf)
+		if n > 0 {
+			p.touch()
+			dst.SetWriteDeadline(time.Now().Add(p.idle))
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+			count(n)
+		}
+		if err != nil {
+			// The read timed out but the other way is still talking
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !p.idled() {
+				continue
+			}
+			return err
+		}
+	}
+}
+
+// closeWrite half closes conn once its peer finished sending, so a client
+// can still read the answer to what it sent last. Errors and idle timeouts
+// close it for good.
+func closeWrite(conn net.Conn, err error) {
+	if errors.Is(err, io.EOF) {
+		if half, ok := conn.(interface{ CloseWrite() error }); ok {
+			half.CloseWrite()
+			return
+		}
+	}
+	conn.Close()
+}
+
+type udpSession struct {
+	client  net.Addr
+	backend net.Conn
+	route   *activeL4Route
+	pipe    l4Pipe
+}
+
+// serveUDP gives every client address a session with its own socket to the
+// backend, so the answers can be told apart
+func (f *Forwarder) serveUDP(ln *l4Listener) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := ln.packet.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Warn("error reading L4 datagram on %s: %v", ln.packet.LocalAddr(), err)
+			continue
+		}
+
+		ln.mu.Lock()
+		session, ok := ln.sessions[addr.String()]
+		ln.mu.Unlock()
+		if !ok {
+			if session = f.openSession(ln, addr); session == nil {
+				continue
+			}
+		}
+
+		session.pipe.touch()
+		if _, err := session.backend.Write(buf[:n]); err != nil {
+			continue
+		}
+		session.pipe.in.Add(int64(n))
+		f.counter(session.route, "in")(n)
+	}
+}
+
+// openSession admits a new UDP client. Rejected clients get no session, so
+// every datagram they send is dropped and counted as a rejection.
+func (f *Forwarder) openSession(ln *l4Listener, client net.Addr) *udpSession {
+	route := ln.route.Load()
+	if !f.admit(route, client) {
+		return nil
+	}
+
+	backend, err := net.DialTimeout("udp", route.backend(), l4DialTimeout)
+	if err != nil {
+		route.counters.active.Add(-1)
+		f.unreachable(route, err)
+		return nil
+	}
+
+	session := &udpSession{client: client, backend: backend, route: route}
+	session.pipe.idle = route.idleTimeout()
+	session.pipe.touch()
+
+	ln.mu.Lock()
+	ln.sessions[client.String()] = session
+	ln.mu.Unlock()
+
+	go f.serveSession(ln, session)
+	return session
+}
+
+// serveSession sends the answers of the backend to the client until the
+// session goes idle or the listener closes
+func (f *Forwarder) serveSession(ln *l4Listener, session *udpSession) {
+	route := session.route
+	untrack := neploymetrics.TrackL4Active(route.AppID, route.Protocol)
+	defer func() {
+		ln.mu.Lock()
+		delete(ln.sessions, session.client.String())
+		ln.mu.Unlock()
+		session.backend.Close()
+		untrack()
+		route.counters.active.Add(-1)
+	}()
+
+	out := f.counter(route, "out")
+	buf := make([]byte, 64*1024)
+	for {
+		session.backend.SetReadDeadline(time.Now().Add(session.pipe.idle))
+		n, err := session.backend.Read(buf)
+		if n > 0 {
+			session.pipe.touch()
+			if _, err := ln.packet.WriteTo(buf[:n], session.client); err == nil {
+				session.pipe.out.Add(int64(n))
+				out(n)
+			}
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !session.pipe.idled() {
+				continue
+			}
+			return
+		}
+	}
+}
+
+// errHelloPeeked stops the handshake once the ClientHello was read
+var errHelloPeeked = errors.New("client hello peeked")
+
+// peekClientHello reads the ClientHello of a TLS client and returns the
+// server name it asks for, with the bytes read so they can be replayed
+func peekClientHello(conn net.Conn) (string, []byte, error) {
+	var read bytes.Buffer
+	var serverName string
+	err := tls.Server(helloConn{Reader: io.TeeReader(conn, &read)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errHelloPeeked
+		},
+	}).Handshake()
+	if !errors.Is(err, errHelloPeeked) {
+		return "", nil, fmt.Errorf("no TLS client hello: %v", err)
+	}
+	return serverName, read.Bytes(), nil
+}
+
+// helloConn lets the TLS server read what the client sent without writing
+// anything back to it
+type helloConn struct {
+	io.Reader
+}
+
+func (helloConn) Write([]byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (helloConn) Close() error                     { return nil }
+func (helloConn) LocalAddr() net.Addr              { return nil }
+func (helloConn) RemoteAddr() net.Addr             { return nil }
+func (helloConn) SetDeadline(time.Time) error      { return nil }
+func (helloConn) SetReadDeadline(time.Time) error  { return nil }
+func (helloConn) SetWriteDeadline(time.Time) error { return nil }
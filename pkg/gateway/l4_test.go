@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a port nothing listens on for network
+func freePort(t *testing.T, network string) int {
+	t.Helper()
+
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// waitStats polls the stats of route id until ok accepts them
+func waitStats(t *testing.T, f *Forwarder, id string, ok func(rejected, failed int64) bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := f.Stats()[id]
+		if ok(stats.RejectedConns, stats.FailedConns) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats of %s: %d rejected, %d failed", id, stats.RejectedConns, stats.FailedConns)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestForwarderCountsUDPRejections(t *testing.T) {
+	deny, err := ParseCIDRs("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewForwarder("")
+	defer f.Close()
+	port := freePort(t, "udp")
+	err = f.AddRoute(L4Route{
+		ID:         "udp",
+		AppID:      "app",
+		Protocol:   L4UDP,
+		ListenPort: port,
+		TargetPort: strconv.Itoa(freePort(t, "udp")),
+		Deny:       deny,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for range 2 {
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitStats(t, f, "udp", func(rejected, failed int64) bool { return rejected == 2 })
+	if stats := f.Stats()["udp"]; stats.TotalConns != 0 || stats.BytesIn != 0 {
+		t.Errorf("a rejected client was forwarded: %+v", stats)
+	}
+}
+
+func TestForwarderCountsUnreachableBackends(t *testing.T) {
+	f := NewForwarder("")
+	defer f.Close()
+	port := freePort(t, "tcp")
+	err := f.AddRoute(L4Route{
+		ID:         "tcp",
+		AppID:      "app",
+		Protocol:   L4TCP,
+		ListenPort: port,
+		TargetPort: strconv.Itoa(freePort(t, "tcp")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	waitStats(t, f, "tcp", func(rejected, failed int64) bool { return failed == 1 })
+	if stats := f.Stats()["tcp"]; stats.TotalConns != 1 || stats.RejectedConns != 0 {
+		t.Errorf("stats = %+v, want one accepted connection", stats)
+	}
+}
@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+)
+
+// NewServer builds the http.Server used by the platform with the timeouts and
+// header limits from the gateway config. ReadHeaderTimeout is what cuts off
+// slowloris style clients that trickle their headers. The read and write
+// timeouts are left to WriteTimeoutHandler: server wide ones would stay on
+// hijacked WebSocket connections and, through h2c, apply to every HTTP/2
+// stream, cutting gRPC and h2c calls.
+func NewServer(addr string, conf model.GatewayConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: seconds(conf.ReadHeaderTimeout, model.DefaultReadHeaderTimeout),
+		IdleTimeout:       seconds(conf.IdleTimeout, model.DefaultIdleTimeout),
+		MaxHeaderBytes:    orDefault(conf.MaxHeaderBytes, model.DefaultMaxHeaderBytes),
+	}
+}
+
+// WriteTimeoutHandler gives every request the read timeout of the gateway
+// config to send its body in and the write timeout to send its response in.
+// Upgrades, h2c connections, gRPC calls and event streams get neither, and
+// the h2c routes drop the write one, see Router.serveRoute.
+func WriteTimeoutHandler(next http.Handler, conf model.GatewayConfig) http.Handler {
+	readTimeout := seconds(conf.ReadTimeout, model.DefaultReadTimeout)
+	writeTimeout := seconds(conf.WriteTimeout, model.DefaultWriteTimeout)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Set for streams too, a keep-alive connection would carry the
+		// deadlines of its previous request. Writers that can't take a
+		// deadline are served without one.
+		var readDeadline, writeDeadline time.Time
+		if !isStreamingRequest(r) {
+			now := time.Now()
+			readDeadline, writeDeadline = now.Add(readTimeout), now.Add(writeTimeout)
+		}
+		controller := http.NewResponseController(w)
+		controller.SetReadDeadline(readDeadline)
+		controller.SetWriteDeadline(writeDeadline)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isStreamingRequest reports whether r may keep its response open for as
+// long as the client wants. PRI is the preface of an h2c connection with
+// prior knowledge.
+func isStreamingRequest(r *http.Request) bool {
+	return r.Method == "PRI" || r.Header.Get("Upgrade") != "" ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// clearWriteDeadline lifts the deadline WriteTimeoutHandler set on w
+func clearWriteDeadline(w http.ResponseWriter) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
+// BodyLimitMiddleware rejects request bodies bigger than limit with a 413.
+// A limit of 0 or less disables the check.
+func BodyLimitMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				writeError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsBodyTooLarge reports whether err comes from reading past a body limit
+func IsBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// isTimeout reports whether err is the backend running out of time rather
+// than failing
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ConnLimitListener caps the number of concurrent connections a single
+// remote IP can keep open. Connections over the cap are closed right after
+// accept, before any byte is read. Trusted proxies are not capped, they
+// carry the connections of many clients.
+type ConnLimitListener struct {
+	net.Listener
+	maxPerIP int
+	trusted  TrustedProxies
+	mu       sync.Mutex
+	conns    map[string]int
+}
+
+func NewConnLimitListener(l net.Listener, maxPerIP int, trusted TrustedProxies) net.Listener {
+	if maxPerIP <= 0 {
+		return l
+	}
+
+	return &ConnLimitListener{
+		Listener: l,
+		maxPerIP: maxPerIP,
+		trusted:  trusted,
+		conns:    make(map[string]int),
+	}
+}
+
+func (l *ConnLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := remoteIP(conn.RemoteAddr())
+		if addr, err := netip.ParseAddr(ip); err == nil && l.trusted.Contains(addr) {
+			return conn, nil
+		}
+		if !l.acquire(ip) {
+			logger.Warn("connection limit reached for %s, closing connection", ip)
+			conn.Close()
+			continue
+		}
+
+		return &limitedConn{Conn: conn, release: func() { l.release(ip) }}, nil
+	}
+}
+
+func (l *ConnLimitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip] >= l.maxPerIP {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *ConnLimitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func seconds(value, fallback int) time.Duration {
+	return time.Duration(orDefault(value, fallback)) * time.Second
+}
+
+func orDefault(value, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,203 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"neploy.dev/pkg/model"
+)
+
+// newLimitedServer starts handler behind the limits of conf the way the
+// platform serves it
+func newLimitedServer(t *testing.T, conf model.GatewayConfig, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	ts := httptest.NewUnstartedServer(WriteTimeoutHandler(handler, conf))
+	limits := NewServer("", conf)
+	ts.Config.ReadHeaderTimeout = limits.ReadHeaderTimeout
+	ts.Config.IdleTimeout = limits.IdleTimeout
+	ts.Config.MaxHeaderBytes = limits.MaxHeaderBytes
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSlowlorisHeadersAreCutOff(t *testing.T) {
+	conf := model.GatewayConfig{ReadHeaderTimeout: 1, ReadTimeout: 30}
+	ts := newLimitedServer(t, conf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called for a request whose headers never finished")
+	}))
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Trickle the headers without ever sending the blank line
+	start := time.Now()
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(300 * time.Millisecond)
+		if _, err := io.WriteString(conn, "X-Slow: 1\r\n"); err != nil {
+			break
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("connection still open after the read header timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("connection closed after %s, want about 1s", elapsed)
+	}
+}
+
+func TestSlowBodyIsCutOff(t *testing.T) {
+	conf := model.GatewayConfig{ReadHeaderTimeout: 1, ReadTimeout: 1}
+	readErr := make(chan error, 1)
+	ts := newLimitedServer(t, conf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		readErr <- err
+	}))
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: example\r\nContent-Length: 100\r\n\r\nslow"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Fatal("reading a body that never finished succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("body read still blocked after the read timeout")
+	}
+}
+
+func TestH2CStreamOutlivesReadTimeout(t *testing.T) {
+	conf := model.GatewayConfig{ReadHeaderTimeout: 1, ReadTimeout: 1, WriteTimeout: 1}
+	ts := newLimitedServer(t, conf, H2CHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	}), &http.Server{}))
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+
+	// A client stream quiet for longer than the read timeout
+	body, stream := io.Pipe()
+	go func() {
+		io.WriteString(stream, "first ")
+		time.Sleep(1500 * time.Millisecond)
+		io.WriteString(stream, "second")
+		stream.Close()
+	}()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, body)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK || string(got) != "first second" {
+		t.Fatalf("stream = %d %q, %v, want it read whole", resp.StatusCode, got, err)
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+	conf := model.GatewayConfig{WriteTimeout: 1}
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(1500 * time.Millisecond)
+		}
+		io.WriteString(w, "done")
+	})
+	ts := newLimitedServer(t, conf, slow)
+
+	get := func(path, accept string) (string, error) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	t.Run("cuts slow responses", func(t *testing.T) {
+		if _, err := get("/slow", ""); err == nil {
+			t.Fatal("response written after the write timeout")
+		}
+	})
+
+	t.Run("exempts streams", func(t *testing.T) {
+		// A quick request first, so the stream reuses a connection that
+		// had a deadline
+		if _, err := get("/", ""); err != nil {
+			t.Fatal(err)
+		}
+		body, err := get("/slow", "text/event-stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "done" {
+			t.Fatalf("body = %q, want done", body)
+		}
+	})
+}
+
+func TestIsStreamingRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    bool
+	}{
+		{"plain", "GET / HTTP/1.1\r\nHost: x\r\n\r\n", false},
+		{"websocket", "GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n", true},
+		{"grpc", "POST /svc/Method HTTP/1.1\r\nHost: x\r\nContent-Type: application/grpc+proto\r\n\r\n", true},
+		{"event stream", "GET / HTTP/1.1\r\nHost: x\r\nAccept: text/event-stream\r\n\r\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(tt.request)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := isStreamingRequest(r); got != tt.want {
+				t.Fatalf("isStreamingRequest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,146 +1,403 @@
 package gateway
 
 import (
+	"bufio"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
+	neploymetrics "neploy.dev/pkg/metrics"
 )
 
-type MetricsCollector struct {
-	mu            sync.Mutex
-	metricsFile   string
-	hourlyMetrics map[string]struct {
-		requests int
-		errors   int
+const (
+	metricsShards = 16
+	walName       = "requests.wal"
+	// walShardBuffer is how much WAL a shard buffers before writing it to
+	// the file
+	walShardBuffer = 16 * 1024
+)
+
+type statKey struct {
+	appID   string
+	version string
+	hour    int64 // unix seconds, truncated to the hour
+}
+
+type statCounts struct {
+	requests int
+	errors   int
+	bytesIn  int64
+	bytesOut int64
+	latency  map[int]int64
+	statuses map[StatusKey]int64
+}
+
+func newStatCounts() *statCounts {
+	return &statCounts{
+		latency:  make(map[int]int64),
+		statuses: make(map[StatusKey]int64),
+	}
+}
+
+func (c *statCounts) add(sample RequestSample, bucket int) {
+	c.requests++
+	if sample.Status >= 400 {
+		c.errors++
 	}
-	applicationID string
+	c.bytesIn += sample.BytesIn
+	c.bytesOut += sample.BytesOut
+	c.latency[bucket]++
+	c.statuses[StatusKey{Method: sample.Method, Status: sample.Status}]++
 }
 
-func NewMetricsCollector(dataDir string, applicationID string) (*MetricsCollector, error) {
+func (c *statCounts) merge(h HourlyCount) {
+	c.requests += h.Requests
+	c.errors += h.Errors
+	c.bytesIn += h.BytesIn
+	c.bytesOut += h.BytesOut
+	for bucket, n := range h.Latency {
+		c.latency[bucket] += n
+	}
+	for key, n := range h.StatusCodes {
+		c.statuses[key] += n
+	}
+}
+
+type metricsShard struct {
+	mu     sync.Mutex
+	counts map[statKey]*statCounts
+	// wal holds the WAL entries of the requests in counts not yet written
+	// to the file
+	wal []byte
+}
+
+// MetricsCollector counts gateway requests, bytes, latencies and status codes
+// per app, version and hour in memory. Counters are split in shards so concurrent requests rarely contend,
+// and every request is appended to a write-ahead file first so counts not yet
+// flushed to the database survive a crash. Each shard buffers its own WAL
+// entries, the file is only locked when a buffer is written to it.
+type MetricsCollector struct {
+	// rotation is held for reading while recording and for writing while a
+	// flush swaps the counters and the WAL segment, so each request ends up
+	// in exactly one segment and one snapshot.
+	rotation sync.RWMutex
+	shards   [metricsShards]metricsShard
+
+	dataDir string
+	walMu   sync.Mutex
+	wal     *os.File
+
+	recent *recentMetrics
+}
+
+func NewMetricsCollector(dataDir string) (*MetricsCollector, error) {
 	// Ensure data directory exists
 	if err := os.MkdirAll(dataDir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create metrics directory: %v", err)
 	}
 
-	metricsFile := filepath.Join(dataDir, "gateway_metrics.log")
+	m := &MetricsCollector{dataDir: dataDir, recent: newRecentMetrics()}
+	for i := range m.shards {
+		m.shards[i].counts = make(map[statKey]*statCounts)
+	}
 
-	return &MetricsCollector{
-		metricsFile: metricsFile,
-		hourlyMetrics: make(map[string]struct {
-			requests int
-			errors   int
-		}),
-		applicationID: applicationID,
-	}, nil
+	// A WAL left by a previous run holds requests that never reached the
+	// database, turn it into a pending segment so it is replayed
+	if info, err := os.Stat(m.walPath()); err == nil && info.Size() > 0 {
+		if err := os.Rename(m.walPath(), m.newSegmentPath()); err != nil {
+			return nil, fmt.Errorf("failed to recover metrics WAL: %v", err)
+		}
+	}
+
+	if err := m.openWAL(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
 }
 
-func (m *MetricsCollector) RecordRequest(timestamp time.Time, isError bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// RecentStats sums the requests of appID over the last window, at most RecentWindow
+func (m *MetricsCollector) RecentStats(appID string, window time.Duration) RecentStats {
+	if m == nil {
+		return RecentStats{Latency: neploymetrics.NewLatencySketch()}
+	}
+	return m.recent.stats(appID, window, time.Now())
+}
+
+func (m *MetricsCollector) RecordRequest(sample RequestSample) {
+	if m == nil {
+		return
+	}
+
+	key := statKey{appID: sample.ApplicationID, version: sample.Version, hour: sample.Start.Truncate(time.Hour).Unix()}
+	bucket := neploymetrics.SketchBucket(sample.Duration)
+	m.recent.record(sample, bucket)
 
-	hourKey := timestamp.Format("2006-01-02 15:00")
+	m.rotation.RLock()
+	defer m.rotation.RUnlock()
 
-	metrics := m.hourlyMetrics[hourKey]
-	metrics.requests++
-	if isError {
-		metrics.errors++
+	shard := m.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.wal = appendWALEntry(shard.wal, key, sample, bucket)
+	if len(shard.wal) >= walShardBuffer {
+		if err := m.writeWAL(shard); err != nil {
+			log.Printf("ERROR: writing metrics WAL: %v", err)
+		}
 	}
 
-	m.hourlyMetrics[hourKey] = metrics
-	m.writeMetrics(hourKey, metrics.requests, metrics.errors)
+	counts, ok := shard.counts[key]
+	if !ok {
+		counts = newStatCounts()
+		shard.counts[key] = counts
+	}
+	counts.add(sample, bucket)
 }
 
-func (m *MetricsCollector) writeMetrics(hourKey string, requests, errors int) {
-	lineToWrite := fmt.Sprintf("%s - %d, %d = %s", hourKey, requests, errors, m.applicationID)
+// SyncWAL flushes buffered WAL entries to disk
+func (m *MetricsCollector) SyncWAL() {
+	m.rotation.RLock()
+	defer m.rotation.RUnlock()
 
-	mu := &sync.Mutex{}
-	mu.Lock()
-	defer mu.Unlock()
-
-	// Leer el archivo actual
-	content, err := os.ReadFile(m.metricsFile)
-	if err != nil && !os.IsNotExist(err) {
-		log.Printf("ERROR: reading metrics file: %v", err)
+	if err := m.writeShardWALs(); err != nil {
+		log.Printf("ERROR: flushing metrics WAL: %v", err)
 		return
 	}
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	m.wal.Sync()
+}
 
-	lines := strings.Split(string(content), "\n")
-	updated := false
-
-	for i, line := range lines {
-		if strings.HasPrefix(line, hourKey+" - ") && strings.HasSuffix(line, m.applicationID) {
-			lines[i] = lineToWrite
-			updated = true
-			break
+// writeShardWALs writes the WAL buffered by every shard to the file
+func (m *MetricsCollector) writeShardWALs() error {
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.Lock()
+		err := m.writeWAL(shard)
+		shard.mu.Unlock()
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	if !updated {
-		lines = append(lines, lineToWrite)
+// writeWAL writes the WAL buffered by shard to the file, callers hold
+// shard.mu. On error the entries stay buffered for the next write.
+func (m *MetricsCollector) writeWAL(shard *metricsShard) error {
+	if len(shard.wal) == 0 {
+		return nil
 	}
 
-	finalContent := strings.Join(lines, "\n")
-	err = os.WriteFile(m.metricsFile, []byte(finalContent), 0644)
-	if err != nil {
-		log.Printf("ERROR: writing metrics file: %v", err)
-	}
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	n, err := m.wal.Write(shard.wal)
+	shard.wal = shard.wal[:copy(shard.wal, shard.wal[n:])]
+	return err
 }
 
-func (m *MetricsCollector) GetMetrics(days int) ([]LastHourMetrics, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Rotate takes the counters recorded since the last rotation, resetting them,
+// and closes the WAL segment holding the same requests. The segment must be
+// removed with CommitSegments once the counts are stored. Without a segment
+// the WAL was not rotated, its requests go on into the next one and the
+// counts must be put back with Restore.
+func (m *MetricsCollector) Rotate() ([]HourlyCount, string, error) {
+	m.rotation.Lock()
+	defer m.rotation.Unlock()
 
-	// Read the entire file
-	content, err := os.ReadFile(m.metricsFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read metrics file: %v", err)
+	counts := make([]HourlyCount, 0)
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.Lock()
+		for key, c := range shard.counts {
+			counts = append(counts, key.hourly(c))
+		}
+		shard.counts = make(map[statKey]*statCounts)
+		shard.mu.Unlock()
 	}
 
-	// Parse lines and aggregate data
-	lines := strings.Split(string(content), "\n")
-	metrics := make([]LastHourMetrics, 0)
+	if err := m.writeShardWALs(); err != nil {
+		return counts, "", fmt.Errorf("failed to flush metrics WAL: %v", err)
+	}
 
-	cutoff := time.Now().AddDate(0, 0, -days)
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	m.wal.Close()
 
-	for _, line := range lines {
-		if line == "" {
-			continue
+	segment := m.newSegmentPath()
+	if err := os.Rename(m.walPath(), segment); err != nil {
+		// Keep appending to the same file, its entries are still pending
+		if openErr := m.openWAL(); openErr != nil {
+			log.Printf("ERROR: reopening metrics WAL: %v", openErr)
 		}
+		return counts, "", fmt.Errorf("failed to rotate metrics WAL: %v", err)
+	}
 
-		// Parse line: "2024-12-26 11:00 - 100, 5"
-		parts := strings.Split(line, " - ")
-		if len(parts) != 2 {
-			continue
+	return counts, segment, m.openWAL()
+}
+
+// Restore puts the counts of a rotation that kept its WAL back into the
+// counters, so they are taken again along with the segment holding them.
+func (m *MetricsCollector) Restore(counts []HourlyCount) {
+	m.rotation.RLock()
+	defer m.rotation.RUnlock()
+
+	for _, c := range counts {
+		key := statKey{appID: c.ApplicationID, version: c.Version, hour: c.Hour.Unix()}
+		shard := m.shard(key)
+		shard.mu.Lock()
+		existing, ok := shard.counts[key]
+		if !ok {
+			existing = newStatCounts()
+			shard.counts[key] = existing
+		}
+		existing.merge(c)
+		shard.mu.Unlock()
+	}
+}
+
+// PendingSegments lists WAL segments left by flushes that never committed,
+// for example because the process crashed.
+func (m *MetricsCollector) PendingSegments() ([]string, error) {
+	return filepath.Glob(filepath.Join(m.dataDir, walName+".*"))
+}
+
+// CommitSegments removes WAL segments whose counts are stored
+func (m *MetricsCollector) CommitSegments(segments ...string) {
+	for _, segment := range segments {
+		if err := os.Remove(segment); err != nil && !os.IsNotExist(err) {
+			log.Printf("ERROR: removing metrics WAL segment %s: %v", segment, err)
 		}
+	}
+}
 
-		hourPart := parts[0]
-		var requests, errors int
-		var applicationID string
-		_, err := fmt.Sscanf(parts[1], "%d, %d = %s", &requests, &errors, &applicationID)
+// ReadSegment aggregates the requests logged in a WAL segment
+func ReadSegment(path string) ([]HourlyCount, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	totals := make(map[statKey]*statCounts)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// hour \t app \t version \t method \t status \t latency bucket \t bytes in \t bytes out
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 8 {
+			continue // torn write at crash time
+		}
+		hour, err := strconv.ParseInt(parts[0], 10, 64)
 		if err != nil {
 			continue
 		}
-
-		// Parse the timestamp
-		timestamp, err := time.Parse("2006-01-02 15:00", hourPart)
+		for i := 1; i <= 3 && err == nil; i++ {
+			parts[i], err = unquoteWAL(parts[i])
+		}
 		if err != nil {
 			continue
 		}
+		status, _ := strconv.Atoi(parts[4])
+		bucket, _ := strconv.Atoi(parts[5])
+		bytesIn, _ := strconv.ParseInt(parts[6], 10, 64)
+		bytesOut, _ := strconv.ParseInt(parts[7], 10, 64)
 
-		// Only include data after cutoff
-		if timestamp.After(cutoff) {
-			metrics = append(metrics, LastHourMetrics{
-				Hour:          hourPart,
-				Requests:      requests,
-				Errors:        errors,
-				ApplicationID: applicationID,
-			})
+		key := statKey{hour: hour, appID: parts[1], version: parts[2]}
+		c, ok := totals[key]
+		if !ok {
+			c = newStatCounts()
+			totals[key] = c
 		}
+		c.add(RequestSample{Method: parts[3], Status: status, BytesIn: bytesIn, BytesOut: bytesOut}, bucket)
 	}
 
-	return metrics, nil
+	counts := make([]HourlyCount, 0, len(totals))
+	for key, c := range totals {
+		counts = append(counts, key.hourly(c))
+	}
+	return counts, scanner.Err()
+}
+
+// appendWALEntry appends the WAL line of a request to buf. The strings are
+// quoted, a tab or a new line in them can't break the line apart.
+func appendWALEntry(buf []byte, key statKey, sample RequestSample, bucket int) []byte {
+	buf = strconv.AppendInt(buf, key.hour, 10)
+	buf = append(buf, '\t')
+	buf = strconv.AppendQuote(buf, key.appID)
+	buf = append(buf, '\t')
+	buf = strconv.AppendQuote(buf, key.version)
+	buf = append(buf, '\t')
+	buf = strconv.AppendQuote(buf, sample.Method)
+	buf = append(buf, '\t')
+	buf = strconv.AppendInt(buf, int64(sample.Status), 10)
+	buf = append(buf, '\t')
+	buf = strconv.AppendInt(buf, int64(bucket), 10)
+	buf = append(buf, '\t')
+	buf = strconv.AppendInt(buf, sample.BytesIn, 10)
+	buf = append(buf, '\t')
+	buf = strconv.AppendInt(buf, sample.BytesOut, 10)
+	return append(buf, '\n')
+}
+
+// unquoteWAL unquotes a string field of a WAL line, lines written before
+// they were quoted hold them as they are
+func unquoteWAL(field string) (string, error) {
+	if !strings.HasPrefix(field, `"`) {
+		return field, nil
+	}
+	return strconv.Unquote(field)
+}
+
+func (m *MetricsCollector) openWAL() error {
+	wal, err := os.OpenFile(m.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open metrics WAL: %v", err)
+	}
+
+	m.wal = wal
+	return nil
+}
+
+func (m *MetricsCollector) walPath() string {
+	return filepath.Join(m.dataDir, walName)
+}
+
+// newSegmentPath names a WAL segment. The name is its id in the database,
+// unique across the instances sharing it.
+func (m *MetricsCollector) newSegmentPath() string {
+	return filepath.Join(m.dataDir, fmt.Sprintf("%s.%d.%s", walName, time.Now().UnixNano(), uuid.New().String()))
+}
+
+// SegmentID is the id a WAL segment is recorded under once stored
+func SegmentID(segment string) string {
+	return filepath.Base(segment)
+}
+
+func (m *MetricsCollector) shard(key statKey) *metricsShard {
+	h := fnv.New32a()
+	h.Write([]byte(key.appID))
+	h.Write([]byte(key.version))
+	return &m.shards[(h.Sum32()^uint32(key.hour))%metricsShards]
+}
+
+func (k statKey) hourly(c *statCounts) HourlyCount {
+	return HourlyCount{
+		ApplicationID: k.appID,
+		Version:       k.version,
+		Hour:          time.Unix(k.hour, 0),
+		Requests:      c.requests,
+		Errors:        c.errors,
+		BytesIn:       c.bytesIn,
+		BytesOut:      c.bytesOut,
+		Latency:       c.latency,
+		StatusCodes:   c.statuses,
+	}
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -12,145 +11,179 @@ import (
 	"neploy.dev/pkg/repository"
 )
 
-type MetricsAggregator struct {
-	collectors  map[string]*MetricsCollector // Map of appID to collector
-	mu          sync.RWMutex
-	appStatRepo *repository.ApplicationStat
-	stopChan    chan struct{}
-	wg          sync.WaitGroup
+const (
+	metricsFlushInterval = 10 * time.Second
+	walSyncInterval      = time.Second
+)
+
+// hourlyStatStore adds the counts of a WAL segment to the hourly stats once,
+// see repository.ApplicationStat.UpsertHourly
+type hourlyStatStore interface {
+	UpsertHourly(ctx context.Context, segment string, stats []model.ApplicationStat) (bool, error)
 }
 
-func NewMetricsAggregator(metricsCollector *MetricsCollector, appStatRepo *repository.ApplicationStat) *MetricsAggregator {
-	collectors := make(map[string]*MetricsCollector)
-	if metricsCollector != nil {
-		collectors[metricsCollector.applicationID] = metricsCollector
-	}
+// MetricsAggregator periodically moves the collector counters into
+// application_stats, one row per app, version and hour. Each WAL segment is
+// stored along with its id, so one replayed after a crash or a failed
+// removal is not counted twice.
+type MetricsAggregator struct {
+	collector   *MetricsCollector
+	appStatRepo hourlyStatStore
+	// WAL segments a failed flush left, retried from disk
+	pending  []string
+	mu       sync.Mutex
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
 
+func NewMetricsAggregator(collector *MetricsCollector, appStatRepo *repository.ApplicationStat) *MetricsAggregator {
 	return &MetricsAggregator{
-		collectors:  collectors,
+		collector:   collector,
 		appStatRepo: appStatRepo,
 		stopChan:    make(chan struct{}),
 	}
 }
 
-func (m *MetricsAggregator) AddCollector(collector *MetricsCollector) {
-	if collector == nil {
+func (m *MetricsAggregator) Start() {
+	if m.collector == nil {
 		return
 	}
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.collectors[collector.applicationID] = collector
-}
 
-func (m *MetricsAggregator) RemoveCollector(appID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.collectors, appID)
-}
+	m.replayPending()
 
-func (m *MetricsAggregator) Start() {
 	m.wg.Add(1)
 	go m.run()
 }
 
+// Stop flushes what is left and waits for the aggregator to finish
 func (m *MetricsAggregator) Stop() {
+	if m.collector == nil {
+		return
+	}
+
 	close(m.stopChan)
 	m.wg.Wait()
+	m.Flush(context.Background())
 }
 
 func (m *MetricsAggregator) run() {
 	defer m.wg.Done()
 
-	// Calculate time until next hour
-	now := time.Now()
-	nextHour := now.Truncate(time.Hour).Add(time.Hour)
-	initialDelay := nextHour.Sub(now)
-
-	// Wait until the next hour before starting
-	timer := time.NewTimer(initialDelay)
-	defer timer.Stop()
+	flush := time.NewTicker(metricsFlushInterval)
+	defer flush.Stop()
+	sync := time.NewTicker(walSyncInterval)
+	defer sync.Stop()
 
 	for {
 		select {
 		case <-m.stopChan:
 			return
-		case <-timer.C:
-			// Aggregate and save metrics for the previous hour
-			m.aggregateAndSaveMetrics()
-
-			// Reset timer for the next hour
-			timer.Reset(time.Hour)
+		case <-sync.C:
+			m.collector.SyncWAL()
+		case <-flush.C:
+			m.Flush(context.Background())
 		}
 	}
 }
 
-func (m *MetricsAggregator) aggregateAndSaveMetrics() {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// Flush stores the counters recorded since the last flush
+func (m *MetricsAggregator) Flush(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	for appID, collector := range m.collectors {
-		metrics, err := collector.GetMetrics(30) // últimos 30 días
-		if err != nil {
-			log.Printf("ERROR: Failed to get metrics for app %s: %v", appID, err)
-			continue
+	pending := m.pending
+	m.pending = nil
+	for _, segment := range pending {
+		if err := m.replaySegment(ctx, segment); err != nil {
+			log.Printf("ERROR: Failed to save metrics WAL segment %s, retrying on next flush: %v", segment, err)
+			m.pending = append(m.pending, segment)
 		}
+	}
 
-		processedHours := make(map[string]bool)
-
-		for _, metric := range metrics {
-			timestamp, err := time.Parse("2006-01-02 15:00", metric.Hour)
-			if err != nil {
-				log.Printf("WARN: Invalid time format in metrics: %s", metric.Hour)
-				continue
-			}
-
-			stat := model.ApplicationStat{
-				ApplicationID: metric.ApplicationID,
-				Requests:      metric.Requests,
-				Errors:        metric.Errors,
-				Date:          model.Date{Time: timestamp},
-			}
-
-			if err := m.appStatRepo.Insert(context.Background(), stat); err != nil {
-				log.Printf("ERROR: Failed to save metrics for app %s: %v", appID, err)
-				continue
-			}
-
-			// Marca la hora como procesada
-			processedHours[metric.Hour] = true
-		}
+	counts, segment, err := m.collector.Rotate()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	if segment == "" {
+		m.collector.Restore(counts)
+		return
+	}
 
-		// 🔥 Limpiar del log solo las horas procesadas
-		removeProcessedLines(collector.metricsFile, processedHours)
+	if err := m.store(ctx, segment, counts); err != nil {
+		log.Printf("ERROR: Failed to save gateway metrics, retrying on next flush: %v", err)
+		m.pending = append(m.pending, segment)
+		return
 	}
+	m.collector.CommitSegments(segment)
 }
 
-func removeProcessedLines(filePath string, processedHours map[string]bool) {
-	content, err := os.ReadFile(filePath)
+// replayPending stores the counts of WAL segments left by a previous run
+func (m *MetricsAggregator) replayPending() {
+	segments, err := m.collector.PendingSegments()
 	if err != nil {
-		log.Printf("ERROR: reading metrics file to clean: %v", err)
+		log.Printf("ERROR: Failed to list metrics WAL segments: %v", err)
 		return
 	}
 
-	lines := strings.Split(string(content), "\n")
-	filtered := make([]string, 0)
-
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, " - ")
-		if len(parts) < 1 {
-			continue
-		}
-		hourPart := parts[0]
-		if !processedHours[hourPart] {
-			filtered = append(filtered, line)
+	for _, segment := range segments {
+		if err := m.replaySegment(context.Background(), segment); err != nil {
+			log.Printf("ERROR: Failed to replay metrics WAL segment %s: %v", segment, err)
 		}
 	}
+}
 
-	err = os.WriteFile(filePath, []byte(strings.Join(filtered, "\n")), 0644)
+// replaySegment stores the counts logged in segment and removes it
+func (m *MetricsAggregator) replaySegment(ctx context.Context, segment string) error {
+	counts, err := ReadSegment(segment)
+	if os.IsNotExist(err) {
+		return nil // removed after it was stored
+	}
 	if err != nil {
-		log.Printf("ERROR: writing cleaned metrics file: %v", err)
+		return err
+	}
+	if err := m.store(ctx, segment, counts); err != nil {
+		return err
+	}
+	m.collector.CommitSegments(segment)
+	return nil
+}
+
+// store adds counts, those of segment, to the hourly stats unless segment
+// was stored before
+func (m *MetricsAggregator) store(ctx context.Context, segment string, counts []HourlyCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	applied, err := m.appStatRepo.UpsertHourly(ctx, SegmentID(segment), toStats(counts))
+	if err != nil {
+		return err
+	}
+	if !applied {
+		log.Printf("WARN: Metrics WAL segment %s was already stored, skipping it", segment)
+	}
+	return nil
+}
+
+func toStats(counts []HourlyCount) []model.ApplicationStat {
+	stats := make([]model.ApplicationStat, 0, len(counts))
+	for _, c := range counts {
+		statusCodes := make([]model.StatusCodeCount, 0, len(c.StatusCodes))
+		for key, n := range c.StatusCodes {
+			statusCodes = append(statusCodes, model.StatusCodeCount{Method: key.Method, Status: key.Status, Count: n})
+		}
+
+		stats = append(stats, model.ApplicationStat{
+			ApplicationID: c.ApplicationID,
+			Version:       c.Version,
+			Requests:      c.Requests,
+			Errors:        c.Errors,
+			BytesIn:       c.BytesIn,
+			BytesOut:      c.BytesOut,
+			Date:          model.Date{Time: c.Hour},
+			Latency:       c.Latency,
+			StatusCodes:   statusCodes,
+		})
 	}
+	return stats
 }
@@ -0,0 +1,248 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"neploy.dev/pkg/model"
+)
+
+// fakeStatStore keeps stats in memory and, like application_stat_segments,
+// remembers which segments it already added
+type fakeStatStore struct {
+	mu       sync.Mutex
+	segments map[string]bool
+	requests int
+	fail     bool
+}
+
+func newFakeStatStore() *fakeStatStore {
+	return &fakeStatStore{segments: make(map[string]bool)}
+}
+
+func (s *fakeStatStore) UpsertHourly(ctx context.Context, segment string, stats []model.ApplicationStat) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		return false, errors.New("database unavailable")
+	}
+	if s.segments[segment] {
+		return false, nil
+	}
+	s.segments[segment] = true
+	for _, stat := range stats {
+		s.requests += stat.Requests
+	}
+	return true, nil
+}
+
+func (s *fakeStatStore) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func newTestCollector(t *testing.T, dir string) *MetricsCollector {
+	t.Helper()
+	collector, err := NewMetricsCollector(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector
+}
+
+func sample(app string) RequestSample {
+	return RequestSample{ApplicationID: app, Version: "v1", Method: "GET", Status: 200, Start: time.Now(), Duration: time.Millisecond}
+}
+
+func countRequests(counts []HourlyCount) int {
+	total := 0
+	for _, c := range counts {
+		total += c.Requests
+	}
+	return total
+}
+
+func TestConcurrentRecordAndRotate(t *testing.T) {
+	collector := newTestCollector(t, t.TempDir())
+
+	const workers, perWorker = 8, 2000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				collector.RecordRequest(sample("app-1"))
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	counted, logged := 0, 0
+	rotate := func() {
+		counts, segment, err := collector.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromDisk, err := ReadSegment(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each request is in exactly the segment of the counters it was taken with
+		if countRequests(counts) != countRequests(fromDisk) {
+			t.Fatalf("counters hold %d requests, their segment %d", countRequests(counts), countRequests(fromDisk))
+		}
+		counted += countRequests(counts)
+		logged += countRequests(fromDisk)
+		collector.CommitSegments(segment)
+	}
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			rotate()
+		}
+	}
+	rotate()
+
+	if counted != workers*perWorker || logged != workers*perWorker {
+		t.Fatalf("counted %d and logged %d requests, want %d", counted, logged, workers*perWorker)
+	}
+}
+
+func TestFlushRetriesFailedSegmentOnce(t *testing.T) {
+	store := newFakeStatStore()
+	aggregator := &MetricsAggregator{collector: newTestCollector(t, t.TempDir()), appStatRepo: store}
+
+	for i := 0; i < 5; i++ {
+		aggregator.collector.RecordRequest(sample("app-1"))
+	}
+	store.fail = true
+	aggregator.Flush(context.Background())
+	if len(aggregator.pending) != 1 {
+		t.Fatalf("%d pending segments after a failed flush, want 1", len(aggregator.pending))
+	}
+
+	for i := 0; i < 3; i++ {
+		aggregator.collector.RecordRequest(sample("app-1"))
+	}
+	store.fail = false
+	aggregator.Flush(context.Background())
+	aggregator.Flush(context.Background())
+
+	if got := store.total(); got != 8 {
+		t.Fatalf("stored %d requests, want 8", got)
+	}
+	if segments, _ := aggregator.collector.PendingSegments(); len(segments) != 0 || len(aggregator.pending) != 0 {
+		t.Fatalf("segments left after the retry: %v, %v", segments, aggregator.pending)
+	}
+}
+
+func TestReplayIsIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	store := newFakeStatStore()
+
+	collector := newTestCollector(t, dir)
+	for i := 0; i < 10; i++ {
+		collector.RecordRequest(sample("app-1"))
+	}
+	counts, segment, err := collector.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stored, then the process dies before the segment is removed
+	aggregator := &MetricsAggregator{collector: collector, appStatRepo: store}
+	if err := aggregator.store(context.Background(), segment, counts); err != nil {
+		t.Fatal(err)
+	}
+	// and before the requests still in the WAL are flushed
+	for i := 0; i < 4; i++ {
+		collector.RecordRequest(sample("app-2"))
+	}
+	collector.SyncWAL()
+
+	// Twice, as if the first restart crashed again before removing them
+	for run := 0; run < 2; run++ {
+		restarted := &MetricsAggregator{collector: newTestCollector(t, dir), appStatRepo: store}
+		segments, err := restarted.collector.PendingSegments()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, segment := range segments {
+			counts, err := ReadSegment(segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := restarted.store(context.Background(), segment, counts); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if got := store.total(); got != 14 {
+		t.Fatalf("stored %d requests, want 14", got)
+	}
+
+	restarted := &MetricsAggregator{collector: newTestCollector(t, dir), appStatRepo: store}
+	restarted.replayPending()
+	if got := store.total(); got != 14 {
+		t.Fatalf("stored %d requests after replaying, want 14", got)
+	}
+	if segments, _ := restarted.collector.PendingSegments(); len(segments) != 0 {
+		t.Fatalf("segments left after the replay: %v", segments)
+	}
+	if _, err := os.Stat(segment); !os.IsNotExist(err) {
+		t.Fatalf("stored segment %s not removed", segment)
+	}
+}
+
+func TestWALEscapesClientStrings(t *testing.T) {
+	dir := t.TempDir()
+	collector := newTestCollector(t, dir)
+
+	forged := sample("app-1")
+	forged.Version = "v1\t9999\tevil\n1\tapp-2"
+	collector.RecordRequest(forged)
+	collector.SyncWAL()
+
+	// A line from before the strings were quoted
+	old := filepath.Join(dir, walName+".0.old")
+	if err := os.WriteFile(old, []byte("0\tapp-3\tv2\tGET\t200\t1\t10\t20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, segment, err := collector.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromDisk, err := ReadSegment(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || len(fromDisk) != 1 || fromDisk[0].ApplicationID != "app-1" || fromDisk[0].Version != forged.Version {
+		t.Fatalf("segment = %+v, want the request of app-1 with its version as sent", fromDisk)
+	}
+
+	fromOld, err := ReadSegment(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromOld) != 1 || fromOld[0].ApplicationID != "app-3" || fromOld[0].Version != "v2" || fromOld[0].BytesOut != 20 {
+		t.Fatalf("old segment = %+v", fromOld)
+	}
+}
@@ -1,18 +1,16 @@
 package gateway
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/mssola/user_agent"
 	"io"
-	"log"
+	neploymetrics "neploy.dev/pkg/metrics"
 	"neploy.dev/pkg/model"
-	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/semver"
 	"net/http"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,7 +18,6 @@ type responseWriter struct {
 	http.ResponseWriter
 	status    int
 	size      int64
-	buf       *bytes.Buffer
 	tee       io.Writer
 	committed bool
 }
@@ -40,185 +37,211 @@ func (w *responseWriter) WriteHeader(status int) {
 	w.committed = true
 }
 
-// LoggingMiddleware wraps an http.Handler and logs request/response details
-func LoggingMiddleware(next http.Handler, metrics *MetricsCollector) http.Handler {
+// Flush lets streamed responses, gRPC ones among them, through as they come
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingReader counts the request body bytes read by the proxy. The
+// transport may still be sending the body when the response is done, hence
+// the atomic.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// LoggingMiddleware records request metrics and writes the request to the
+// access log. Bodies are only captured, up to the access log limit, when body
+// capture is enabled.
+func LoggingMiddleware(next http.Handler, metrics *MetricsCollector, accessLog *AccessLogger, appID string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		done := neploymetrics.TrackInFlight(appID)
+		defer done()
 
-		// Create a buffer to store the response
-		buf := &bytes.Buffer{}
-
-		// Create a response writer that captures the response
 		rw := &responseWriter{
 			ResponseWriter: w,
-			buf:            buf,
-			tee:            io.MultiWriter(w, buf),
+			tee:            w,
 			status:         http.StatusOK, // Default status
 		}
 
-		// Read and store the request body
-		var reqBody []byte
-		if r.Body != nil {
-			reqBody, _ = io.ReadAll(r.Body)
-			r.Body = io.NopCloser(bytes.NewBuffer(reqBody))
+		var reqBody, respBody *limitedBuffer
+		if accessLog.CaptureBody() {
+			respBody = &limitedBuffer{max: accessLog.MaxBodyBytes()}
+			rw.tee = io.MultiWriter(w, respBody)
+
+			// Keep a copy of the first bytes while the proxy streams the body
+			if r.Body != nil && r.Body != http.NoBody {
+				reqBody = &limitedBuffer{max: accessLog.MaxBodyBytes()}
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.TeeReader(r.Body, reqBody), r.Body}
+			}
+		}
+
+		var bytesIn *countingReader
+		if r.Body != nil && r.Body != http.NoBody {
+			bytesIn = &countingReader{ReadCloser: r.Body}
+			r.Body = bytesIn
 		}
 
 		// Process the request
 		next.ServeHTTP(rw, r)
 
-		// Calculate duration
 		duration := time.Since(start)
 
-		// Record metrics
-		isError := rw.status >= 400
-		metrics.RecordRequest(start, isError)
-
-		// Format request headers
-		headers := make(map[string]string)
-		for k, v := range r.Header {
-			if len(v) > 0 {
-				headers[k] = v[0]
-			}
+		// A failed gRPC call still answers 200, count it by its grpc-status
+		status := rw.status
+		if code, ok := grpcStatus(rw.Header()); ok {
+			neploymetrics.GRPCResponse(appID, code.String())
+			status = GRPCHTTPStatus(code)
 		}
 
-		// Create log entry
-		logEntry := struct {
-			Timestamp  string            `json:"timestamp"`
-			Method     string            `json:"method"`
-			Path       string            `json:"path"`
-			Query      string            `json:"query"`
-			Status     int               `json:"status"`
-			Size       int64             `json:"size"`
-			Duration   string            `json:"duration"`
-			RemoteAddr string            `json:"remote_addr"`
-			UserAgent  string            `json:"user_agent"`
-			Headers    map[string]string `json:"headers"`
-			ReqBody    string            `json:"request_body,omitempty"`
-			RespBody   string            `json:"response_body,omitempty"`
-		}{
-			Timestamp:  time.Now().Format(time.RFC3339),
-			Method:     r.Method,
-			Path:       r.URL.Path,
-			Query:      r.URL.RawQuery,
-			Status:     rw.status,
-			Size:       rw.size,
-			Duration:   duration.String(),
-			RemoteAddr: r.RemoteAddr,
-			UserAgent:  r.UserAgent(),
-			Headers:    headers,
+		// Record metrics
+		sample := RequestSample{
+			ApplicationID: appID,
+			Version:       r.Header.Get("Resolved-Version"),
+			Method:        neploymetrics.Method(r.Method),
+			Status:        status,
+			Start:         start,
+			Duration:      duration,
+			BytesOut:      rw.size,
 		}
-
-		// Add request body if present and not too large
-		if len(reqBody) > 0 && len(reqBody) < 10000 { // Limit to 10KB
-			var prettyJSON bytes.Buffer
-			if err := json.Indent(&prettyJSON, reqBody, "", "  "); err == nil {
-				logEntry.ReqBody = prettyJSON.String()
-			} else {
-				logEntry.ReqBody = string(reqBody)
-			}
+		if bytesIn != nil {
+			sample.BytesIn = bytesIn.n.Load()
 		}
-
-		// Add response body if present and not too large
-		if rw.buf.Len() > 0 && rw.buf.Len() < 10000 { // Limit to 10KB
-			var prettyJSON bytes.Buffer
-			if err := json.Indent(&prettyJSON, rw.buf.Bytes(), "", "  "); err == nil {
-				logEntry.RespBody = prettyJSON.String()
-			} else {
-				logEntry.RespBody = rw.buf.String()
-			}
+		metrics.RecordRequest(sample)
+		neploymetrics.ObserveRequest(appID, r.Header.Get("Resolved-Version"), r.Method, status, duration)
+
+		entry := AccessLogEntry{
+			Start:     start,
+			AppID:     appID,
+			RequestID: RequestID(r.Context()),
+			TraceID:   TraceID(r.Context()),
+			Request:   r,
+			Status:    rw.status,
+			Size:      rw.size,
+			Duration:  duration,
 		}
-
-		// Convert log entry to JSON
-		logJSON, err := json.Marshal(logEntry)
-		if err != nil {
-			log.Printf("Error marshaling log entry: %v", err)
-			return
+		if reqBody != nil {
+			entry.RequestBody = reqBody.Bytes()
 		}
-
-		// Log based on status code
-		switch {
-		case rw.status >= 500:
-			log.Printf("ERROR: %s", string(logJSON))
-		case rw.status >= 400:
-			log.Printf("WARN: %s", string(logJSON))
-		default:
-			log.Printf("INFO: %s", string(logJSON))
+		if respBody != nil {
+			entry.ResponseBody = respBody.Bytes()
 		}
+		accessLog.Log(entry)
 	})
 }
 
-// VersionRoutingMiddleware enruta a la versión correcta según el header o la ruta
-func VersionRoutingMiddleware(config model.GatewayConfig, appVersionRepo *repository.ApplicationVersion) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			pathSegments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-			var resolvedVersion string
+// Where a request's version came from
+const (
+	VersionFromPath    = "path"
+	VersionFromHeader  = "header"
+	VersionFromLatest  = "latest"
+	VersionFromDefault = "default"
+)
 
-			if slices.Contains(pathSegments, ".well-known") {
-				w.Header().Set("Content-Type", "application/json")
-				next.ServeHTTP(w, r)
-				return
-			}
+// versionResolution is the version the router picks for a request
+type versionResolution struct {
+	Version string
+	Source  string
+	// Range is what was asked for when it was a range rather than a tag
+	Range string
+	// Path is the request path after header versioning rewrote it
+	Path string
+	// Found is false when the app has no such version
+	Found bool
+	// Skipped is true for .well-known requests, they are not versioned
+	Skipped bool
+}
 
-			// First check if version is in the path
-			if len(pathSegments) > 0 && strings.HasPrefix(pathSegments[0], "v") {
-				resolvedVersion = pathSegments[0]
-			} else if config.DefaultVersioningType == model.VersioningTypeHeader {
-				// Then check if version is in the header
-				headerVersion := r.Header.Get("X-API-Version")
-				if headerVersion != "" {
-					resolvedVersion = headerVersion
-				}
-			}
+// resolveVersion picks the version of the app host serves at path from the
+// path, then from X-API-Version with header versioning, then the latest of
+// the app.
+// A version asked for that is not a tag of the app is taken as a range, like
+// v1 in the path or ^2 in the header, and resolves to its highest active
+// version.
+func resolveVersion(snapshot *Snapshot, host, path string, header http.Header) versionResolution {
+	config := snapshot.Config
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	resolution := versionResolution{Path: path, Found: true}
 
-			// If no version found yet, try to get the latest version
-			if resolvedVersion == "" {
-				appName := ExtractAppName(r.URL.Path)
-				if appName != "" {
-					latestVersion, err := appVersionRepo.GetLatestVersionByName(r.Context(), appName)
-					if err == nil && latestVersion != "" {
-						resolvedVersion = latestVersion
-					} else {
-						resolvedVersion = "v1.0.0"
-					}
-				} else {
-					resolvedVersion = "v1.0.0"
-				}
-			}
+	if slices.Contains(pathSegments, ".well-known") {
+		resolution.Skipped = true
+		return resolution
+	}
 
-			// Set the resolved version in the header
-			if r.Header == nil {
-				r.Header = make(http.Header)
-			}
-			r.Header.Set("Resolved-Version", resolvedVersion)
-			r.Header.Set("X-Original-Path", r.URL.Path)
+	// First check if version is in the path
+	if len(pathSegments) > 0 && IsVersionSegment(pathSegments[0]) {
+		resolution.Version, resolution.Source = pathSegments[0], VersionFromPath
+	} else if config.DefaultVersioningType == model.VersioningTypeHeader {
+		// Then check if version is in the header
+		if headerVersion := strings.TrimSpace(header.Get("X-API-Version")); headerVersion != "" {
+			resolution.Version, resolution.Source = headerVersion, VersionFromHeader
+		}
+	}
 
-			// For header-based versioning, modify the URL path
-			if config.DefaultVersioningType == model.VersioningTypeHeader && len(pathSegments) > 0 {
-				url := pathSegments[0]
-				r.URL.Path = fmt.Sprintf("/%s/%s/", resolvedVersion, url)
+	if appName := ExtractAppName(path); resolution.Version != "" && appName != "" &&
+		!snapshot.HasVersion(host, appName, resolution.Version) {
+		if rng, err := semver.ParseRange(resolution.Version); err == nil {
+			if tag, ok := snapshot.MatchVersion(host, appName, rng); ok {
+				resolution.Range, resolution.Version = resolution.Version, tag
+				if resolution.Source == VersionFromPath {
+					resolution.Path = strings.Replace(path, "/"+resolution.Range, "/"+tag, 1)
+				}
 			}
+		}
+	}
 
-			// Validate that the version exists for the app
-			appName := ExtractAppName(r.URL.Path)
-			if appName != "" {
-				exists, err := appVersionRepo.ExistsByName(r.Context(), appName, resolvedVersion)
-				if err != nil || !exists {
-					http.Error(w, "API version not found", http.StatusNotFound)
-					return
-				}
+	// If no version found yet, try to get the latest version
+	if resolution.Version == "" {
+		resolution.Version, resolution.Source = "v1.0.0", VersionFromDefault
+		if appName := ExtractAppName(path); appName != "" {
+			if latestVersion, ok := snapshot.LatestVersion(host, appName); ok && latestVersion != "" {
+				resolution.Version, resolution.Source = latestVersion, VersionFromLatest
 			}
+		}
+	}
 
-			r.Header.Set("Resolved-Version", resolvedVersion)
-			next.ServeHTTP(w, r)
-		})
+	// For header-based versioning, modify the URL path, a version in the
+	// path already is where it belongs
+	if config.DefaultVersioningType == model.VersioningTypeHeader && resolution.Source != VersionFromPath && len(pathSegments) > 0 {
+		resolution.Path = fmt.Sprintf("/%s/%s/", resolution.Version, pathSegments[0])
+	}
+
+	// Validate that the version exists for the app
+	if appName := ExtractAppName(resolution.Path); appName != "" {
+		resolution.Found = snapshot.HasVersion(host, appName, resolution.Version)
 	}
+
+	return resolution
 }
 
-func VisitorTraceMiddleware(visitorTrace *repository.VisitorTrace) func(http.Handler) http.Handler {
+// VisitorTraceMiddleware queues a visitor trace for every page or API
+// request to the route's app, assets are not traced
+func VisitorTraceMiddleware(traces *TraceIngester, route Route) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isAssetRequest(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			start := time.Now()
+			visitor := visitorID(w, r)
 
 			// Parsear datos del user-agent
 			ua := user_agent.New(r.UserAgent())
@@ -226,36 +249,40 @@ func VisitorTraceMiddleware(visitorTrace *repository.VisitorTrace) func(http.Han
 
 			// Continuar con la traza después de la respuesta
 			next.ServeHTTP(w, r)
-			duration := int(time.Since(start).Milliseconds())
-
-			resolvedVersion := r.Header.Get("Resolved-Version")
-			appName := ExtractAppName(r.URL.Path)
-			if appName == "" {
-				return
-			}
+			latency := int(time.Since(start).Milliseconds())
 
 			trace := model.VisitorTrace{
-				ApplicationID:    appName,
-				IpAddress:        r.RemoteAddr,
+				ApplicationID:    route.AppID,
+				Version:          r.Header.Get("Resolved-Version"),
+				IpAddress:        ClientIP(r),
 				Device:           ua.Platform(),
 				Os:               ua.OS(),
 				Browser:          fmt.Sprintf("%s v%s", browser, version),
 				PageVisited:      r.URL.Path,
-				VisitDuration:    duration,
-				VisitedTimestamp: model.NewDateNow(),
+				Latency:          latency,
+				VisitedTimestamp: model.Date{Time: start},
+				RequestID:        RequestID(r.Context()),
+				TraceID:          TraceID(r.Context()),
+				VisitorID:        visitor,
+				Referrer:         externalReferrer(r),
 			}
 
-			go func() {
-				visitorTrace.Create(context.Background(), trace, resolvedVersion)
-			}()
+			traces.Enqueue(r.Context(), trace)
 		})
 	}
 }
 
+// IsVersionSegment reports whether a first path segment names a version
+// rather than an app: v and a semantic version, like v1.2.3, v1.2 or v1, so
+// an app named videos is not taken for one
+func IsVersionSegment(segment string) bool {
+	return strings.HasPrefix(segment, "v") && semver.Valid(segment)
+}
+
 func ExtractAppName(path string) string {
 	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
 	var appName string
-	if len(pathSegments) > 1 && strings.HasPrefix(pathSegments[0], "v") {
+	if len(pathSegments) > 1 && IsVersionSegment(pathSegments[0]) {
 		appName = pathSegments[1]
 	} else if len(pathSegments) > 0 {
 		appName = pathSegments[0]
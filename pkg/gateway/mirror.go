@@ -0,0 +1,346 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+// MirrorHeader is set on mirrored requests so a candidate can tell them
+// apart, and skip side effects it should not repeat
+const MirrorHeader = "X-Neploy-Mirror"
+
+// mirrorDiscardBytes is how much of a candidate's response body is read
+// before the connection is given up rather than reused
+const mirrorDiscardBytes = 1 << 20
+
+// RouteMirror copies Percent of the requests of a route to Port, where the
+// candidate Version of the app runs. The zero value mirrors nothing.
+type RouteMirror struct {
+	Version string
+	Port    string
+	Percent float64 // 0 to 100
+}
+
+func (m RouteMirror) enabled() bool {
+	return m.Port != "" && m.Percent > 0
+}
+
+type MirrorConfig struct {
+	// MaxInFlight caps the mirrored requests waiting on candidates, requests
+	// over it are served but not mirrored
+	MaxInFlight int
+	// Timeout of a mirrored request, a slow candidate never holds a slot longer
+	Timeout time.Duration
+	// MaxBodyBytes is the largest request body buffered to be replayed,
+	// requests with larger ones are not mirrored
+	MaxBodyBytes int64
+	QueueSize    int
+	BatchSize    int
+	// FlushInterval is how often queued samples are written
+	FlushInterval time.Duration
+}
+
+// Mirrorer replays sampled requests to candidate versions and writes what
+// both sides answered in batches from a single worker. Mirroring never adds
+// to the latency of the primary request beyond buffering its body.
+type Mirrorer struct {
+	repo  *repository.MirrorSample
+	conf  MirrorConfig
+	slots chan struct{}
+	queue chan model.MirrorSample
+
+	// mu is held for reading while a mirror starts and for writing while
+	// closing, so none starts once Close waits for them
+	mu       sync.RWMutex
+	closed   bool
+	inFlight sync.WaitGroup
+	wg       sync.WaitGroup
+}
+
+func NewMirrorer(repo *repository.MirrorSample, conf MirrorConfig) *Mirrorer {
+	if conf.MaxInFlight <= 0 {
+		conf.MaxInFlight = 100
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	if conf.MaxBodyBytes <= 0 {
+		conf.MaxBodyBytes = 1 << 20
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 10000
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 500
+	}
+	if conf.BatchSize > maxTraceBatchSize {
+		conf.BatchSize = maxTraceBatchSize
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 2 * time.Second
+	}
+
+	m := &Mirrorer{
+		repo:  repo,
+		conf:  conf,
+		slots: make(chan struct{}, conf.MaxInFlight),
+		queue: make(chan model.MirrorSample, conf.QueueSize),
+	}
+
+	m.wg.Add(1)
+	go m.run()
+
+	return m
+}
+
+// acquire takes a slot for a mirrored request, false when all are taken or
+// the mirrorer is closed
+func (m *Mirrorer) acquire() (release func(), ok bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, false
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return nil, false
+	}
+	m.inFlight.Add(1)
+	return func() {
+		<-m.slots
+		m.inFlight.Done()
+	}, true
+}
+
+func (m *Mirrorer) enqueue(sample model.MirrorSample) {
+	select {
+	case m.queue <- sample:
+	default:
+		neploymetrics.MirrorRequest(sample.ApplicationID, "dropped")
+	}
+}
+
+// Close stops mirroring, waits for the mirrored requests in flight and
+// writes the samples left
+func (m *Mirrorer) Close() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	m.inFlight.Wait()
+	close(m.queue)
+	m.wg.Wait()
+}
+
+func (m *Mirrorer) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.conf.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.MirrorSample, 0, m.conf.BatchSize)
+	for {
+		select {
+		case sample, ok := <-m.queue:
+			if !ok {
+				m.write(batch)
+				return
+			}
+			batch = append(batch, sample)
+			if len(batch) >= m.conf.BatchSize {
+				m.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			m.write(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (m *Mirrorer) write(batch []model.MirrorSample) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceWriteTimeout)
+	defer cancel()
+
+	if err := m.repo.InsertBatch(ctx, batch); err != nil {
+		log.Printf("ERROR: Failed to write %d mirror samples: %v", len(batch), err)
+	}
+}
+
+// mirrorResult is what one side answered, status 0 when it failed
+type mirrorResult struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+// mirrorTransport sends a sampled share of the requests of a route to its
+// candidate version as well. Both sides are timed to their response
+// headers, the candidate's response is read and discarded.
+type mirrorTransport struct {
+	primary   http.RoundTripper
+	candidate http.RoundTripper
+	mirrors   *Mirrorer
+	route     Route
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Upgraded connections can't be replayed, and requests already served by
+	// the candidate have nothing to compare against
+	if rand.Float64()*100 >= t.route.Mirror.Percent || req.Header.Get("Upgrade") != "" ||
+		req.Header.Get("Resolved-Version") == t.route.Mirror.Version {
+		return t.primary.RoundTrip(req)
+	}
+
+	release, ok := t.mirrors.acquire()
+	if !ok {
+		neploymetrics.MirrorRequest(t.route.AppID, "busy")
+		return t.primary.RoundTrip(req)
+	}
+
+	body, ok, err := bufferBody(req, t.mirrors.conf.MaxBodyBytes)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if !ok {
+		release()
+		neploymetrics.MirrorRequest(t.route.AppID, "body_too_large")
+		return t.primary.RoundTrip(req)
+	}
+
+	sample := model.MirrorSample{
+		ApplicationID:  t.route.AppID,
+		Version:        t.route.Mirror.Version,
+		PrimaryVersion: req.Header.Get("Resolved-Version"),
+		Method:         neploymetrics.Method(req.Method),
+		Path:           req.URL.Path,
+		SampledAt:      model.NewDate(time.Now().UTC()),
+	}
+	mirrored, cancel := t.mirrorRequest(req, body)
+	primaryDone := make(chan mirrorResult, 1)
+	go func() {
+		defer release()
+
+		candidate := t.send(mirrored, cancel)
+		primary := <-primaryDone
+
+		sample.PrimaryStatus = primary.status
+		sample.PrimaryLatencyMs = float64(primary.latency.Microseconds()) / 1000
+		sample.MirrorStatus = candidate.status
+		sample.MirrorLatencyMs = float64(candidate.latency.Microseconds()) / 1000
+		if candidate.err != nil {
+			sample.MirrorError = candidate.err.Error()
+			neploymetrics.MirrorRequest(t.route.AppID, "failed")
+		} else {
+			neploymetrics.MirrorRequest(t.route.AppID, "mirrored")
+		}
+		t.mirrors.enqueue(sample)
+	}()
+
+	start := time.Now()
+	resp, err := t.primary.RoundTrip(req)
+	result := mirrorResult{latency: time.Since(start)}
+	switch {
+	case err == nil:
+		result.status = resp.StatusCode
+	case isTimeout(err):
+		result.status = http.StatusGatewayTimeout
+	default:
+		result.status = http.StatusBadGateway
+	}
+	primaryDone <- result
+
+	return resp, err
+}
+
+// mirrorRequest copies req to the candidate, detached from the client so a
+// client going away doesn't cut the candidate short. cancel is called once
+// the candidate answered.
+func (t *mirrorTransport) mirrorRequest(req *http.Request, body []byte) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), t.mirrors.conf.Timeout)
+	mirrored := req.Clone(ctx)
+	mirrored.URL.Host = fmt.Sprintf("localhost:%s", t.route.Mirror.Port)
+	mirrored.Host = mirrored.URL.Host
+	mirrored.Header.Set(MirrorHeader, "1")
+	mirrored.ContentLength = int64(len(body))
+	mirrored.Body = http.NoBody
+	if len(body) > 0 {
+		mirrored.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	mirrored.GetBody = nil
+	return mirrored, cancel
+}
+
+func (t *mirrorTransport) send(req *http.Request, cancel context.CancelFunc) mirrorResult {
+	defer cancel()
+
+	start := time.Now()
+	resp, err := t.candidate.RoundTrip(req)
+	if err != nil {
+		return mirrorResult{latency: time.Since(start), err: err}
+	}
+	result := mirrorResult{status: resp.StatusCode, latency: time.Since(start)}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, mirrorDiscardBytes))
+	resp.Body.Close()
+	return result
+}
+
+// bufferBody reads the body of req up to max bytes so it can be sent twice,
+// req gets a body reading from the copy. ok is false when the body is
+// larger, req then still reads it whole.
+func bufferBody(req *http.Request, max int64) (body []byte, ok bool, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	original := req.Body
+	body, err = io.ReadAll(io.LimitReader(original, max+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(body)) > max {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), original), original}
+		return nil, false, nil
+	}
+
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(body), original}
+	return body, true, nil
+}
@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	neploymetrics "neploy.dev/pkg/metrics"
+)
+
+// RecentWindow is how far back recent request stats are kept
+const RecentWindow = time.Hour
+
+const recentSlots = int(RecentWindow / time.Minute)
+
+// RecentStats sums the requests of an app over a recent window
+type RecentStats struct {
+	Requests     int64
+	ServerErrors int64 // 5xx responses
+	Latency      *neploymetrics.LatencySketch
+}
+
+// ErrorRate is the percentage of requests answered with a 5xx
+func (s RecentStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.ServerErrors) / float64(s.Requests) * 100
+}
+
+type minuteCounts struct {
+	minute       int64 // unix minutes
+	requests     int64
+	serverErrors int64
+	latency      map[int]int64
+}
+
+type recentApp struct {
+	mu    sync.Mutex
+	slots [recentSlots]minuteCounts
+}
+
+// recentMetrics keeps per minute counts of the last RecentWindow for each
+// app in a ring, so alert rules can look at the last few minutes without
+// waiting for hourly stats to be flushed
+type recentMetrics struct {
+	mu   sync.RWMutex
+	apps map[string]*recentApp
+}
+
+func newRecentMetrics() *recentMetrics {
+	return &recentMetrics{apps: make(map[string]*recentApp)}
+}
+
+func (r *recentMetrics) record(sample RequestSample, bucket int) {
+	r.mu.RLock()
+	app, ok := r.apps[sample.ApplicationID]
+	r.mu.RUnlock()
+	if !ok {
+		r.mu.Lock()
+		if app, ok = r.apps[sample.ApplicationID]; !ok {
+			app = &recentApp{}
+			r.apps[sample.ApplicationID] = app
+		}
+		r.mu.Unlock()
+	}
+
+	minute := sample.Start.Unix() / 60
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	slot := &app.slots[minute%int64(recentSlots)]
+	if slot.minute > minute {
+		// Older than the window, the slot already moved on
+		return
+	}
+	if slot.minute != minute {
+		*slot = minuteCounts{minute: minute, latency: make(map[int]int64)}
+	}
+	slot.requests++
+	if sample.Status >= 500 {
+		slot.serverErrors++
+	}
+	slot.latency[bucket]++
+}
+
+func (r *recentMetrics) stats(appID string, window time.Duration, now time.Time) RecentStats {
+	stats := RecentStats{Latency: neploymetrics.NewLatencySketch()}
+
+	r.mu.RLock()
+	app, ok := r.apps[appID]
+	r.mu.RUnlock()
+	if !ok {
+		return stats
+	}
+
+	if window > RecentWindow {
+		window = RecentWindow
+	}
+	current := now.Unix() / 60
+	oldest := current - int64(window/time.Minute) + 1
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	for _, slot := range app.slots {
+		if slot.minute < oldest || slot.minute > current {
+			continue
+		}
+		stats.Requests += slot.requests
+		stats.ServerErrors += slot.serverErrors
+		for bucket, n := range slot.latency {
+			stats.Latency.AddBucket(bucket, n)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFile is an io.WriteCloser that rotates the underlying file once it
+// grows past maxSize bytes or once interval has elapsed, keeping at most
+// maxBackups rotated files next to it.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	rotateAt   time.Time
+}
+
+func NewRotatingFile(path string, maxSize int64, interval time.Duration, maxBackups int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) shouldRotate(incoming int64) bool {
+	if f.maxSize > 0 && f.size > 0 && f.size+incoming > f.maxSize {
+		return true
+	}
+	return f.interval > 0 && !time.Now().Before(f.rotateAt)
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	if f.interval > 0 {
+		f.rotateAt = time.Now().Truncate(f.interval).Add(f.interval)
+	}
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return fmt.Errorf("failed to close log file: %v", err)
+		}
+	}
+
+	backup := fmt.Sprintf("%s.%s", f.path, time.Now().Format("20060102-150405.000"))
+	if err := os.Rename(f.path, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate log file: %v", err)
+	}
+
+	f.pruneBackups()
+	return f.open()
+}
+
+func (f *RotatingFile) pruneBackups() {
+	if f.maxBackups <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	if len(backups) <= f.maxBackups {
+		return
+	}
+
+	// Timestamps in the name sort chronologically
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(old)
+	}
+}
@@ -3,51 +3,77 @@ package gateway
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"neploy.dev/pkg/geoip"
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository"
 )
 
 type Route struct {
-	AppID  string
-	Port   string
-	Domain string
-	Path   string
+	AppID        string
+	Port         string
+	Domain       string
+	Path         string
+	MaxBodyBytes int64 // 0 uses the gateway config limit
+	// Country access rule, GeoModeAllow or GeoModeBlock with ISO codes
+	GeoMode      string
+	GeoCountries []string
+	// Protocol to the container, "" for HTTP/1.1, ProtocolH2C or ProtocolGRPC
+	Protocol string
+	// Mirror copies a share of the requests to a candidate version, gRPC
+	// routes are not mirrored
+	Mirror RouteMirror
+}
+
+// Key identifies route in the route table, routes on different domains may
+// share a path
+func (r Route) Key() string {
+	return strings.ToLower(r.Domain) + r.Path
 }
 
 type Router struct {
 	routes            map[string]*httputil.ReverseProxy
 	routeInfo         map[string]Route
 	mu                sync.RWMutex
-	metrics           map[string]*MetricsCollector
+	metrics           *MetricsCollector
 	metricsAggregator *MetricsAggregator
-	version           *repository.ApplicationVersion
-	conf              *repository.GatewayConfig
-	vtrace            *repository.VisitorTrace
-	// Track user sessions to app context for asset requests
-	userAppContext    map[string]string // maps IP -> current app
-	contextMu         sync.RWMutex
+	snapshots         *Snapshots
+	traces            *TraceIngester
+	geo               *geoip.DB
+	accessLog         *AccessLogger
+	mirrors           *Mirrorer
+	usage             *DeprecationUsage
 }
 
-func NewRouter(appStatRepo *repository.ApplicationStat, version *repository.ApplicationVersion, conf *repository.GatewayConfig, vtrace *repository.VisitorTrace) *Router {
+func NewRouter(appStatRepo *repository.ApplicationStat, snapshots *Snapshots, traces *TraceIngester, accessLog *AccessLogger, geo *geoip.DB, mirrors *Mirrorer, usage *DeprecationUsage) *Router {
 	router := &Router{
-		routes:         make(map[string]*httputil.ReverseProxy),
-		routeInfo:      make(map[string]Route),
-		metrics:        make(map[string]*MetricsCollector),
-		mu:             sync.RWMutex{},
-		version:        version,
-		conf:           conf,
-		vtrace:         vtrace,
-		userAppContext: make(map[string]string),
-		contextMu:      sync.RWMutex{},
-	}
-
-	// Create metrics aggregator without a specific collector
-	router.metricsAggregator = NewMetricsAggregator(nil, appStatRepo)
+		routes:    make(map[string]*httputil.ReverseProxy),
+		routeInfo: make(map[string]Route),
+		mu:        sync.RWMutex{},
+		snapshots: snapshots,
+		traces:    traces,
+		geo:       geo,
+		accessLog: accessLog,
+		mirrors:   mirrors,
+		usage:     usage,
+	}
+
+	metrics, err := NewMetricsCollector("./data/metrics")
+	if err != nil {
+		log.Printf("ERROR: Failed to create metrics collector: %v", err)
+	}
+	router.metrics = metrics
+	router.metricsAggregator = NewMetricsAggregator(metrics, appStatRepo)
 	router.metricsAggregator.Start()
 
 	return router
@@ -57,6 +83,23 @@ func (r *Router) Close() {
 	if r.metricsAggregator != nil {
 		r.metricsAggregator.Stop()
 	}
+	r.mirrors.Close()
+	r.usage.Close()
+	r.traces.Close()
+	if err := r.accessLog.Close(); err != nil {
+		log.Printf("ERROR: Failed to close access log: %v", err)
+	}
+}
+
+// Refresh reloads the gateway config and versions in the background, after
+// they were written
+func (r *Router) Refresh() {
+	r.snapshots.Invalidate()
+}
+
+// RecentStats sums the requests the gateway served for appID over the last window
+func (r *Router) RecentStats(appID string, window time.Duration) RecentStats {
+	return r.metrics.RecentStats(appID, window)
 }
 
 func (r *Router) AddRoute(route Route) error {
@@ -64,28 +107,21 @@ func (r *Router) AddRoute(route Route) error {
 		return err
 	}
 
-	target, err := url.Parse(fmt.Sprintf("http://localhost:%s", route.Port))
+	target, err := url.Parse(backendURL(route))
 	if err != nil {
 		return fmt.Errorf("invalid target URL: %v", err)
 	}
 
-	r.mu.Lock()
-	if _, exists := r.metrics[route.AppID]; !exists {
-		metrics, err := NewMetricsCollector("./data/metrics", route.AppID)
-		if err != nil {
-			log.Printf("ERROR: Failed to create metrics collector for app %s: %v", route.AppID, err)
-		} else {
-			r.metrics[route.AppID] = metrics
-			if r.metricsAggregator != nil {
-				r.metricsAggregator.AddCollector(metrics)
-				r.metricsAggregator.aggregateAndSaveMetrics()
-
-			}
-		}
-	}
-	r.mu.Unlock()
-
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	var base http.RoundTripper = http.DefaultTransport
+	if isHTTP2Route(route) {
+		base = h2cTransport
+	}
+	var transport http.RoundTripper = &tracingTransport{base: base, appID: route.AppID}
+	if route.Mirror.enabled() && route.Protocol != ProtocolGRPC {
+		transport = &mirrorTransport{primary: transport, candidate: base, mirrors: r.mirrors, route: route}
+	}
+	proxy.Transport = transport
 	originalDirector := proxy.Director
 	proxy.Director = func(req *http.Request) {
 		// Save the original path before any modifications
@@ -100,27 +136,18 @@ func (r *Router) AddRoute(route Route) error {
 		}
 		req.Header.Set("X-Original-Path", originalPath)
 
-		// Check if this is a static asset request
-		isStaticAsset := strings.Contains(originalPath, "/assets/") ||
-			strings.HasSuffix(originalPath, ".css") ||
-			strings.HasSuffix(originalPath, ".js") ||
-			strings.HasSuffix(originalPath, ".png") ||
-			strings.HasSuffix(originalPath, ".jpg") ||
-			strings.HasSuffix(originalPath, ".jpeg") ||
-			strings.HasSuffix(originalPath, ".svg") ||
-			strings.HasSuffix(originalPath, ".ico")
-
-		if route.Path != "" {
+		isStaticAsset := isAssetRequest(originalPath)
+
+		// The path of a gRPC call is its method, the container expects it whole
+		if route.Path != "" && route.Protocol != ProtocolGRPC {
 			versionPrefix := req.Header.Get("Resolved-Version")
 			basePath := "/" + versionPrefix + route.Path
 
-			if isStaticAsset && strings.HasPrefix(originalPath, "/v") {
-				parts := strings.Split(originalPath, "/")
-				if len(parts) >= 3 {
-					assetPath := "/" + strings.Join(parts[3:], "/")
-					req.URL.Path = assetPath
-					return
-				}
+			// An app named videos is no version, its assets keep their path
+			if parts := strings.Split(originalPath, "/"); isStaticAsset && len(parts) >= 3 && IsVersionSegment(parts[1]) {
+				assetPath := "/" + strings.Join(parts[3:], "/")
+				req.URL.Path = assetPath
+				return
 			}
 
 			// Standard path handling for non-static assets
@@ -144,157 +171,383 @@ func (r *Router) AddRoute(route Route) error {
 		}
 	}
 
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		return rewriteHTML(resp, route.Path)
+	}
+
+	snapshots := r.snapshots
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("ERROR: Proxy error for route %s to %s: %v", route.Path, target.String(), err)
-		w.WriteHeader(http.StatusBadGateway)
-		fmt.Fprintf(w, "Error: %v", err)
+		if IsBodyTooLarge(err) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+		neploymetrics.UpstreamError(route.AppID)
+		log.Printf("ERROR: Proxy error for route %s to %s (request id %s): %v", route.Path, target.String(), RequestID(r.Context()), err)
+		if isTimeout(err) {
+			snapshots.Current().writeError(w, r, route.AppID, http.StatusGatewayTimeout, "The application took too long to respond")
+			return
+		}
+		snapshots.Current().writeError(w, r, route.AppID, http.StatusBadGateway, "The application could not be reached")
 	}
 
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	routeKey := route.Path
+	routeKey := route.Key()
 	r.routes[routeKey] = proxy
 	r.routeInfo[routeKey] = route
+	r.mu.Unlock()
 
+	// Routes change along with the gateways and versions behind them
+	r.Refresh()
 	return nil
 }
 
 func (r *Router) RemoveRoute(routeKey string) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	delete(r.routes, routeKey)
 	delete(r.routeInfo, routeKey)
+	r.mu.Unlock()
+
+	r.Refresh()
 }
 
-func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	config, err := r.conf.Get(req.Context())
-	if err != nil {
-		log.Printf("ERROR: Failed to get gateway config: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error: %v", err)
-		return
+// Routes returns a copy of the route table sorted by path and domain
+func (r *Router) Routes() []Route {
+	r.mu.RLock()
+	routes := make([]Route, 0, len(r.routeInfo))
+	for _, route := range r.routeInfo {
+		routes = append(routes, route)
 	}
+	r.mu.RUnlock()
 
-	resolver := VersionRoutingMiddleware(config, r.version)
-	resolver(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		r.mu.RLock()
-		defer r.mu.RUnlock()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Domain < routes[j].Domain
+	})
+	return routes
+}
 
-		for routeKey, proxy := range r.routes {
-			route := r.routeInfo[routeKey]
-			if r.matchesRoute(req, route) {
-				var handler http.Handler = proxy
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	snapshot := r.snapshots.Current()
+	// Only the version resolved below is passed on, never one the client sent
+	req.Header.Del("Resolved-Version")
 
-				if r.metrics != nil {
-					handler = LoggingMiddleware(handler, r.metrics[route.AppID])
-				} else {
-					log.Printf("WARN: Metrics collector not available")
-				}
+	_, matchSpan := startSpan(req.Context(), "gateway.route_match", attribute.String("url.path", req.URL.Path))
+	routing := r.route(snapshot, req)
+	matchSpan.SetAttributes(attribute.Bool("neploy.route.matched", routing.Matched), attribute.String("neploy.route.path", routing.Route.Path))
+	matchSpan.End()
 
-				handler = CacheMiddleware(handler)
-				handler = VisitorTraceMiddleware(r.vtrace)(handler)
+	if routing.GRPC {
+		r.serveRoute(w, req, routing.Route, routing.MatchPath, snapshot)
+		return
+	}
+	if routing.Asset == assetUnscoped {
+		log.Printf("WARN: Could not resolve application for asset: %s", req.URL.Path)
+		writeError(w, req, http.StatusNotFound, "Asset not found: unable to determine which application it belongs to")
+		return
+	}
 
-				handler.ServeHTTP(w, req)
-				return
-			}
+	resolution := routing.Resolution
+	if resolution.Skipped {
+		w.Header().Set("Content-Type", "application/json")
+		req.URL.Path = routing.Path
+	} else {
+		if req.Header == nil {
+			req.Header = make(http.Header)
 		}
+		req.Header.Set("Resolved-Version", resolution.Version)
+		req.Header.Set("X-Original-Path", routing.MatchPath)
+		req.URL.Path = resolution.Path
 
-		if strings.Contains(req.URL.Path, ".well-known") {
-			w.WriteHeader(http.StatusContinue)
+		if !resolution.Found {
+			snapshot.writeError(w, req, routing.AppID, http.StatusNotFound, "API version not found")
 			return
 		}
+		if routing.Lifecycle != nil && serveLifecycle(w, req, snapshot, r.usage, routing) {
+			return
+		}
+	}
+
+	if routing.Matched {
+		r.serveRoute(w, req, routing.Route, routing.MatchPath, snapshot)
+		return
+	}
+	if routing.Status == http.StatusContinue {
+		w.WriteHeader(http.StatusContinue)
+		return
+	}
 
-		log.Printf("WARN: No matching route found for path: %s, host: %s", req.URL.Path, req.Host)
+	log.Printf("WARN: No matching route found for path: %s, host: %s", req.URL.Path, req.Host)
 
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "404 Not Found")
-	})).ServeHTTP(w, req)
+	snapshot.writeError(w, req, snapshot.AppForPath(req.Host, routing.MatchPath), http.StatusNotFound, "No application is served at this path")
 }
 
-func (r *Router) matchesRoute(req *http.Request, route Route) bool {
-	// Use the original path stored in the header if available
-	path := req.URL.Path
-	if originalPath := req.Header.Get("X-Original-Path"); originalPath != "" {
-		path = originalPath
-	}
-
-	// Extract user IP for context tracking
-	userIP := req.RemoteAddr
-	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
-		userIP = strings.Split(forwarded, ",")[0]
-	}
-
-	// Handle asset requests without version prefix
-	if isAssetRequest(path) && !strings.HasPrefix(path, "/v") {
-		log.Printf("DEBUG: Asset request detected - path: %s, route.Path: %s, route.AppID: %s", path, route.Path, route.AppID)
-		
-		// Try to get app context from user's previous requests
-		contextApp := r.getUserAppContext(userIP)
-		log.Printf("DEBUG: User %s context app: %s", userIP, contextApp)
-		
-		if contextApp != "" {
-			// Check if this route belongs to the user's current app context
-			appName := ExtractAppName(route.Path)
-			log.Printf("DEBUG: Extracted app name from route.Path '%s': '%s'", route.Path, appName)
-			
-			if appName == "" {
-				// If we can't extract from path, try using a mapping or default logic
-				// For now, let's assume the contextApp matches any route if it's the only one
-				log.Printf("DEBUG: No app name extracted, allowing asset request")
-				return true
-			}
-			if appName == contextApp {
-				log.Printf("DEBUG: App name matches context, allowing asset request")
-				return true
+// assetScope is how the router scoped a request for an asset
+type assetScope int
+
+const (
+	assetNone     assetScope = iota // not an asset
+	assetPrefixed                   // under a route prefix already
+	assetScoped                     // to the route of the routing cookie or the Referer
+	assetCatchAll                   // to no route, the catch-all serves it
+	assetUnscoped                   // to no route and there is no catch-all
+)
+
+// routing is where the router takes a request, ServeHTTP serves it and
+// Explain tells it
+type routing struct {
+	// GRPC routes are matched on the full method path, without version
+	// resolution or asset scoping
+	GRPC bool
+	// Asset tells how an asset request was scoped, AssetRoute is the route
+	// of the page it was scoped to
+	Asset      assetScope
+	AssetRoute Route
+	// Path is the request path, with the prefix of a scoped asset
+	Path       string
+	Resolution versionResolution
+	AppID      string
+	// Lifecycle is set when the version is deprecated, Successor is where
+	// a sunset one redirects
+	Lifecycle *versionLifecycle
+	Successor string
+	Now       time.Time
+	// MatchPath is what the routes are matched against
+	MatchPath string
+	Route     Route
+	Matched   bool
+	// Status is set when the router answers the request itself
+	Status int
+}
+
+// route runs req through asset scoping, version resolution and the route
+// table without modifying it
+func (r *Router) route(snapshot *Snapshot, req *http.Request) routing {
+	routing := routing{Path: req.URL.Path, MatchPath: req.URL.Path, Now: time.Now()}
+
+	// gRPC calls name their service in the path, they are neither versioned
+	// nor scoped like assets
+	if route, ok := r.lookupRoute(req.Host, req.URL.Path); ok && route.Protocol == ProtocolGRPC {
+		routing.GRPC, routing.Route, routing.Matched = true, route, true
+		return routing
+	}
+
+	// Root-relative assets (/assets/x.js) carry no app prefix, scope them to
+	// the app the browser is on before any version resolution happens. Only
+	// the catch-all matching them doesn't make them its own, the page may
+	// belong to another app.
+	if isAssetRequest(req.URL.Path) {
+		routing.Asset = assetPrefixed
+		if prefixed, ok := r.lookupRoute(req.Host, req.URL.Path); !ok || prefixed.Path == "" {
+			route, found := r.assetRoute(req)
+			switch {
+			case found:
+				routing.Asset, routing.AssetRoute = assetScoped, route
+				routing.Path = strings.TrimSuffix(route.Path, "/") + req.URL.Path
+				routing.MatchPath = routing.Path
+			case !ok:
+				routing.Asset, routing.Status = assetUnscoped, http.StatusNotFound
+				return routing
+			default:
+				routing.Asset = assetCatchAll
 			}
 		}
-		
-		// Fallback: check referrer header
-		if referrer := req.Header.Get("Referer"); referrer != "" {
-			log.Printf("DEBUG: Checking referrer: %s", referrer)
-			if referrerURL, err := url.Parse(referrer); err == nil {
-				referrerApp := ExtractAppName(referrerURL.Path)
-				appName := ExtractAppName(route.Path)
-				log.Printf("DEBUG: Referrer app: %s, Route app: %s", referrerApp, appName)
-				
-				if referrerApp != "" && (appName == referrerApp || appName == "") {
-					// Update user context with the referrer app
-					if referrerApp != "" {
-						r.setUserAppContext(userIP, referrerApp)
-					}
-					log.Printf("DEBUG: Referrer matches, allowing asset request")
-					return true
+	}
+
+	resolution := resolveVersion(snapshot, req.Host, routing.Path, req.Header)
+	routing.Resolution = resolution
+	if resolution.Skipped {
+		// Use the original path stored in the header if available
+		if originalPath := req.Header.Get("X-Original-Path"); originalPath != "" {
+			routing.MatchPath = originalPath
+		}
+	} else {
+		// A range in the path is routed as the version it resolved to
+		if resolution.Source == VersionFromPath && resolution.Range != "" {
+			routing.MatchPath = resolution.Path
+		}
+
+		routing.AppID = snapshot.AppForPath(req.Host, resolution.Path)
+		if !resolution.Found {
+			routing.Status = http.StatusNotFound
+			return routing
+		}
+
+		if lifecycle, ok := snapshot.lifecycles[routing.AppID][resolution.Version]; ok {
+			routing.Lifecycle = &lifecycle
+			routing.Successor = successorPath(snapshot, req.Host, routing.AppID, resolution, routing.Now)
+			if lifecycle.sunset(routing.Now) {
+				routing.Status = http.StatusGone
+				if lifecycle.redirect && routing.Successor != "" {
+					routing.Status = http.StatusPermanentRedirect
 				}
+				return routing
 			}
 		}
-		
-		// Last resort: if this is the only route or first route, allow it
-		// This helps with initial asset loading
-		if len(r.routes) == 1 {
-			log.Printf("DEBUG: Only one route available, allowing asset request")
-			return true
+	}
+
+	route, ok := r.lookupRoute(req.Host, routing.MatchPath)
+	if !ok {
+		routing.Status = http.StatusNotFound
+		if strings.Contains(resolution.Path, ".well-known") {
+			routing.Status = http.StatusContinue
+		}
+		return routing
+	}
+	routing.Route, routing.Matched = route, true
+	return routing
+}
+
+// serveRoute proxies req through the middleware of route. HTTP/2 routes skip
+// the response cache and visitor traces, and gRPC ones the body limit too:
+// a client stream may well send more than a request body would.
+func (r *Router) serveRoute(w http.ResponseWriter, req *http.Request, route Route, path string, snapshot *Snapshot) {
+	r.mu.RLock()
+	proxy, ok := r.routes[route.Key()]
+	r.mu.RUnlock()
+	if !ok {
+		// Removed since it was matched
+		snapshot.writeError(w, req, route.AppID, http.StatusNotFound, "No application is served at this path")
+		return
+	}
+
+	// HTTP/2 routes stream, a write deadline would cut them
+	if isHTTP2Route(route) {
+		clearWriteDeadline(w)
+	}
+
+	var handler http.Handler = proxySpanHandler(proxy, route)
+
+	handler = LoggingMiddleware(handler, r.metrics, r.accessLog, route.AppID)
+
+	if !isHTTP2Route(route) {
+		handler = CacheMiddleware(handler)
+		handler = VisitorTraceMiddleware(r.traces, route)(handler)
+	}
+	if route.Protocol != ProtocolGRPC {
+		handler = BodyLimitMiddleware(bodyLimit(route, snapshot.Config))(handler)
+	}
+	handler = MaintenanceMiddleware(snapshot, route.AppID)(handler)
+	handler = GeoAccessMiddleware(r.geo, route)(handler)
+
+	if !isAssetRequest(path) && isDocumentRequest(req) {
+		setRouteCookie(w, route)
+	}
+
+	handler.ServeHTTP(w, req)
+}
+
+// proxySpanHandler wraps the reverse proxy of route in a gateway.proxy span
+func proxySpanHandler(proxy http.Handler, route Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, span := startSpan(req.Context(), "gateway.proxy",
+			attribute.String("neploy.app_id", route.AppID),
+			attribute.String("neploy.route.path", route.Path),
+			attribute.String("neploy.version", req.Header.Get("Resolved-Version")),
+		)
+		defer span.End()
+
+		proxy.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// lookupRoute finds the route serving path on host, locking the route table
+func (r *Router) lookupRoute(host, path string) (Route, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.matchRoute(host, path)
+}
+
+// matchRoute returns the route of host with the longest path prefix matching
+// path on a segment boundary, so /app never captures /app2. A host no route
+// is on, like the bare IP of the server, is matched against the routes of
+// every domain. A route without path is a catch-all and only wins when
+// nothing else matches. Callers hold r.mu.
+func (r *Router) matchRoute(host, path string) (Route, bool) {
+	host = hostname(host)
+
+	var (
+		best, onHost    Route
+		found, hostSeen bool
+		foundOnHost     bool
+	)
+	longer := func(route, than Route) bool {
+		if len(route.Path) != len(than.Path) {
+			return len(route.Path) > len(than.Path)
+		}
+		// Same path on two domains, keep the pick stable
+		return route.Key() < than.Key()
+	}
+
+	for _, route := range r.routeInfo {
+		sameHost := strings.EqualFold(route.Domain, host)
+		hostSeen = hostSeen || sameHost
+		if !matchesPrefix(path, route.Path) {
+			continue
+		}
+		if !found || longer(route, best) {
+			best, found = route, true
 		}
-		
-		log.Printf("DEBUG: Asset request denied for path: %s", path)
-	}
-
-	if route.Path != "" {
-		// Standard path matching
-		matches := strings.HasPrefix(path, route.Path)
-		
-		// Track user app context for non-asset requests
-		if matches && !isAssetRequest(path) {
-			appName := ExtractAppName(route.Path)
-			if appName != "" {
-				r.setUserAppContext(userIP, appName)
+		if sameHost && (!foundOnHost || longer(route, onHost)) {
+			onHost, foundOnHost = route, true
+		}
+	}
+
+	if hostSeen {
+		return onHost, foundOnHost
+	}
+	return best, found
+}
+
+// hostname is host without its port, lowercased
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// assetRoute resolves which route an unprefixed asset belongs to, first from
+// the routing cookie set on the page load and then from the Referer.
+func (r *Router) assetRoute(req *http.Request) (Route, bool) {
+	if key := routeFromCookie(req); key != "" {
+		r.mu.RLock()
+		route, ok := r.routeInfo[key]
+		r.mu.RUnlock()
+		if ok && route.Path != "" {
+			return route, true
+		}
+	}
+
+	if referrer := req.Header.Get("Referer"); referrer != "" {
+		if referrerURL, err := url.Parse(referrer); err == nil {
+			if route, ok := r.lookupRoute(req.Host, referrerURL.Path); ok && route.Path != "" {
+				return route, true
 			}
 		}
-		
-		return matches
 	}
-	return true
+
+	return Route{}, false
+}
+
+func matchesPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// bodyLimit returns the route's own body limit, falling back to the gateway config
+func bodyLimit(route Route, config model.GatewayConfig) int64 {
+	if route.MaxBodyBytes > 0 {
+		return route.MaxBodyBytes
+	}
+	if config.MaxBodyBytes > 0 {
+		return config.MaxBodyBytes
+	}
+	return model.DefaultMaxBodyBytes
 }
 
 func ValidateRoute(route Route) error {
@@ -307,33 +560,16 @@ func ValidateRoute(route Route) error {
 	if route.Domain == "" {
 		return fmt.Errorf("domain is required")
 	}
+	switch route.Protocol {
+	case "", ProtocolH2C, ProtocolGRPC:
+	default:
+		return fmt.Errorf("protocol must be h2c or grpc")
+	}
+	if route.Mirror.Percent < 0 || route.Mirror.Percent > 100 {
+		return fmt.Errorf("mirror percent must be between 0 and 100")
+	}
+	if route.Mirror.enabled() && route.Mirror.Port == route.Port {
+		return fmt.Errorf("mirror must target another port than the route")
+	}
 	return nil
 }
-
-// setUserAppContext tracks which app a user is currently viewing
-func (r *Router) setUserAppContext(userIP, appName string) {
-	r.contextMu.Lock()
-	defer r.contextMu.Unlock()
-	r.userAppContext[userIP] = appName
-}
-
-// getUserAppContext retrieves the current app for a user
-func (r *Router) getUserAppContext(userIP string) string {
-	r.contextMu.RLock()
-	defer r.contextMu.RUnlock()
-	return r.userAppContext[userIP]
-}
-
-// isAssetRequest checks if the request is for a static asset
-func isAssetRequest(path string) bool {
-	return strings.Contains(path, "/assets/") ||
-		strings.HasSuffix(path, ".css") ||
-		strings.HasSuffix(path, ".js") ||
-		strings.HasSuffix(path, ".png") ||
-		strings.HasSuffix(path, ".jpg") ||
-		strings.HasSuffix(path, ".jpeg") ||
-		strings.HasSuffix(path, ".svg") ||
-		strings.HasSuffix(path, ".ico") ||
-		strings.HasSuffix(path, ".webp") ||
-		strings.HasSuffix(path, ".gif")
-}
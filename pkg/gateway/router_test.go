@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newTestRouter(routes ...Route) *Router {
+	r := &Router{routeInfo: make(map[string]Route)}
+	for _, route := range routes {
+		r.routeInfo[route.Key()] = route
+	}
+	return r
+}
+
+func TestMatchRoute(t *testing.T) {
+	r := newTestRouter(
+		Route{AppID: "shop", Domain: "shop.example.com", Path: "/api"},
+		Route{AppID: "blog", Domain: "blog.example.com", Path: "/api"},
+		Route{AppID: "blog-site", Domain: "blog.example.com", Path: ""},
+		Route{AppID: "app", Domain: "localhost", Path: "/app"},
+		Route{AppID: "app2", Domain: "localhost", Path: "/app2"},
+	)
+
+	tests := []struct {
+		host, path string
+		want       string
+	}{
+		{"shop.example.com", "/api/items", "shop"},
+		{"blog.example.com:8080", "/api/posts", "blog"},
+		{"BLOG.example.com", "/about", "blog-site"},
+		{"shop.example.com", "/app", ""},
+		{"localhost", "/app2/x", "app2"},
+		{"localhost", "/app/x", "app"},
+		// No route is on the bare IP, every domain is matched
+		{"10.0.0.1", "/app/x", "app"},
+		{"10.0.0.1", "/api/x", "blog"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			route, ok := r.lookupRoute(tt.host, tt.path)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("matched %s, want no route", route.AppID)
+				}
+				return
+			}
+			if !ok || route.AppID != tt.want {
+				t.Fatalf("matched %q (%v), want %s", route.AppID, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssetRouteBehindCatchAll(t *testing.T) {
+	r := newTestRouter(
+		Route{AppID: "site", Domain: "localhost", Path: ""},
+		Route{AppID: "app", Domain: "localhost", Path: "/app"},
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/assets/x.js", nil)
+	req.Header.Set("Referer", "http://localhost/app/page")
+	if route, ok := r.assetRoute(req); !ok || route.AppID != "app" {
+		t.Fatalf("asset routed to %q (%v), want app", route.AppID, ok)
+	}
+
+	// Without a hint the asset stays with the catch-all
+	req.Header.Del("Referer")
+	if _, ok := r.assetRoute(req); ok {
+		t.Fatal("asset without cookie or Referer resolved to a route")
+	}
+}
+
+func TestAssetRouteByCookie(t *testing.T) {
+	r := newTestRouter(
+		Route{AppID: "site", Domain: "localhost", Path: ""},
+		Route{AppID: "app", Domain: "localhost", Path: "/app"},
+	)
+
+	// The browser keeps the cookie of the page and sends it with the assets
+	w := httptest.NewRecorder()
+	setRouteCookie(w, Route{Domain: "localhost", Path: "/app"})
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := url.Parse("http://localhost/app/page")
+	jar.SetCookies(page, w.Result().Cookies())
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/assets/x.js", nil)
+	for _, cookie := range jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+	if route, ok := r.assetRoute(req); !ok || route.AppID != "app" {
+		t.Fatalf("asset routed to %q (%v) by the cookie alone, want app", route.AppID, ok)
+	}
+}
+
+func TestRewriteHTML(t *testing.T) {
+	response := func(body string) *http.Response {
+		return &http.Response{
+			Header:        http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}
+	}
+	read := func(resp *http.Response) string {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	resp := response(`<script src="/assets/x.js"></script><a href="/app/page">`)
+	if err := rewriteHTML(resp, "/app"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(resp), `<script src="/app/assets/x.js"></script><a href="/app/page">`; got != want {
+		t.Errorf("rewritten = %q, want %q", got, want)
+	}
+
+	big := `<script src="/assets/x.js"></script>` + strings.Repeat("x", maxRewriteBytes)
+	resp = response(big)
+	if err := rewriteHTML(resp, "/app"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(resp); got != big {
+		t.Errorf("page over the cap was changed, %d bytes, want %d untouched", len(got), len(big))
+	}
+	if resp.ContentLength != int64(len(big)) {
+		t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len(big))
+	}
+}
+
+// roundTripFunc answers the proxied requests of a test route
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGRPCDropsForgedResolvedVersion(t *testing.T) {
+	route := Route{AppID: "app", Domain: "localhost", Path: "/pkg.Service", Port: "50051", Protocol: ProtocolGRPC}
+	r := newTestRouter(route)
+	r.snapshots = NewSnapshots(nil, nil, nil, nil, nil)
+
+	var forwarded http.Header
+	r.routes = map[string]*httputil.ReverseProxy{route.Key(): {
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme, pr.Out.URL.Host = "http", "localhost:"+route.Port
+		},
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			forwarded = req.Header.Clone()
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+		}),
+	}}
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/pkg.Service/Call", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Resolved-Version", "v9.9.9")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if forwarded == nil {
+		t.Fatalf("the call was not proxied, status %d", w.Code)
+	}
+	if got := forwarded.Get("Resolved-Version"); got != "" {
+		t.Errorf("the backend got Resolved-Version %q from the client", got)
+	}
+}
+
+func TestRouteVersion(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1.2.3/app", "v1.2.3"},
+		{"/v1/app/", "v1"},
+		{"/v2.0.0-rc.1/app", "v2.0.0-rc.1"},
+		{"/app", ""},
+		{"/videos/player", ""},
+		{"/vault/api", ""},
+		{"/v1", ""},
+	}
+
+	for _, tt := range tests {
+		if got := RouteVersion(tt.path); got != tt.want {
+			t.Errorf("RouteVersion(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	visitorCookie         = "neploy_vid"
+	visitorCookieMaxAge   = 365 * 24 * 60 * 60
+	DefaultSessionTimeout = 30 * time.Minute
+)
+
+type sessionKey struct {
+	visitorID string
+	appID     string
+}
+
+type session struct {
+	id       string
+	lastSeen time.Time
+}
+
+// SessionTracker groups the requests of a visitor to an app into sessions,
+// a new session starts after timeout without requests.
+//
+// Sessions live in the memory of the gateway process, which assumes a single
+// neploy instance serves the traffic of an app. Behind several instances, or
+// across a restart, the requests of one visit get different session ids and
+// the session, entry, exit and bounce figures count it more than once.
+type SessionTracker struct {
+	timeout  time.Duration
+	mu       sync.Mutex
+	sessions map[sessionKey]*session
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewSessionTracker(timeout time.Duration) *SessionTracker {
+	if timeout <= 0 {
+		timeout = DefaultSessionTimeout
+	}
+
+	s := &SessionTracker{
+		timeout:  timeout,
+		sessions: make(map[sessionKey]*session),
+		stopChan: make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.sweep()
+
+	return s
+}
+
+// Touch returns the session of a visitor to an app at the given time
+func (s *SessionTracker) Touch(visitorID, appID string, at time.Time) string {
+	key := sessionKey{visitorID: visitorID, appID: appID}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.sessions[key]
+	if !ok || at.Sub(current.lastSeen) > s.timeout {
+		current = &session{id: uuid.New().String()}
+		s.sessions[key] = current
+	}
+	if at.After(current.lastSeen) {
+		current.lastSeen = at
+	}
+
+	return current.id
+}
+
+func (s *SessionTracker) Close() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// sweep forgets sessions that already timed out
+func (s *SessionTracker) sweep() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.timeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, current := range s.sessions {
+				if now.Sub(current.lastSeen) > s.timeout {
+					delete(s.sessions, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// visitorID identifies the visitor by its first-party cookie. Visitors
+// without one get an id hashed from their IP and user agent, which is also
+// stored in the cookie so it survives IP changes from then on.
+func visitorID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(visitorCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	sum := sha256.Sum256([]byte(ClientIP(r) + "|" + r.UserAgent()))
+	id := hex.EncodeToString(sum[:16])
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   visitorCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return id
+}
+
+// externalReferrer returns the host of the referring site, or an empty
+// string when there is none or it is the gateway itself
+func externalReferrer(r *http.Request) string {
+	referer := r.Referer()
+	if referer == "" {
+		return ""
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" || u.Host == r.Host {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,369 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/semver"
+)
+
+// SnapshotChannel is the Postgres channel the gateway tables notify on,
+// see migration 00029
+const SnapshotChannel = "neploy_gateway"
+
+// snapshotDebounce groups the notifications of a burst of writes into a
+// single reload
+const snapshotDebounce = 200 * time.Millisecond
+
+// Snapshot is what the gateway reads on every request: the gateway config,
+// the versions behind each gateway path with their deprecations and the
+// error pages and maintenance of the applications. It is never modified
+// once published, a reload builds a new one and swaps it in.
+type Snapshot struct {
+	Config model.GatewayConfig
+	// versions holds the versions served under each gateway domain and
+	// path, keyed like Route.Key, highest semantic version first
+	versions map[string][]snapshotVersion
+	// apps holds the application behind each gateway domain and path
+	apps map[string]string
+	// hosts holds the domains gateways are on
+	hosts map[string]bool
+	// anyHost holds the key of each gateway path for hosts no gateway is
+	// on, the lowest when the path is on several domains
+	anyHost map[string]string
+	// pages holds the error pages by application and status
+	pages map[string]map[int]*errorPage
+	// maintenance holds the applications under maintenance
+	maintenance map[string]maintenanceMode
+	// lifecycles holds the deprecated versions by application and tag
+	lifecycles map[string]map[string]versionLifecycle
+	LoadedAt   time.Time
+}
+
+// snapshotVersion is a version tag as the gateway orders and picks it
+type snapshotVersion struct {
+	tag    string
+	semver semver.Version
+	valid  bool // the tag is a semantic version
+	active bool // its container is expected to run
+}
+
+// key returns the key of the gateway serving /name to host. Like the
+// router, a host no gateway is on is served the path of any domain.
+func (s *Snapshot) key(host, name string) string {
+	host = hostname(host)
+	if s.hosts[host] {
+		return host + "/" + name
+	}
+	return s.anyHost["/"+name]
+}
+
+// LatestVersion returns the highest active release of the app served at
+// /name on host, then its highest active pre-release, then its newest active tag
+// that is not a semantic version. Apps without active versions get their
+// highest one.
+func (s *Snapshot) LatestVersion(host, name string) (string, bool) {
+	versions := s.versions[s.key(host, name)]
+	if len(versions) == 0 {
+		return "", false
+	}
+
+	var prerelease, other string
+	for _, version := range versions {
+		switch {
+		case !version.active:
+		case version.valid && !version.semver.IsPrerelease():
+			return version.tag, true
+		case version.valid && prerelease == "":
+			prerelease = version.tag
+		case !version.valid && other == "":
+			other = version.tag
+		}
+	}
+	switch {
+	case prerelease != "":
+		return prerelease, true
+	case other != "":
+		return other, true
+	}
+	return versions[0].tag, true
+}
+
+// MatchVersion returns the highest active version of the app served at
+// /name on host in rng, sunset versions left out
+func (s *Snapshot) MatchVersion(host, name string, rng semver.Range) (string, bool) {
+	now := time.Now()
+	key := s.key(host, name)
+	appID := s.apps[key]
+	for _, version := range s.versions[key] {
+		if !version.active || !version.valid || !rng.Contains(version.semver) {
+			continue
+		}
+		if lifecycle, ok := s.lifecycles[appID][version.tag]; ok && lifecycle.sunset(now) {
+			continue
+		}
+		return version.tag, true
+	}
+	return "", false
+}
+
+// HasVersion reports whether the app served at /name on host has version
+// tag
+func (s *Snapshot) HasVersion(host, name, tag string) bool {
+	for _, version := range s.versions[s.key(host, name)] {
+		if version.tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AppForPath returns the application the gateway path falls under on
+// host, by its first segment after the version, empty when there is none
+func (s *Snapshot) AppForPath(host, path string) string {
+	return s.apps[s.key(host, ExtractAppName(path))]
+}
+
+// add puts the versions of gateway under its domain and path
+func (s *Snapshot) add(gateway model.Gateway, versions []snapshotVersion) {
+	host := strings.ToLower(gateway.Domain)
+	key := host + gateway.Path
+	s.versions[key] = append(s.versions[key], versions...)
+	s.apps[key] = gateway.ApplicationID
+	s.hosts[host] = true
+	if other, ok := s.anyHost[gateway.Path]; !ok || key < other {
+		s.anyHost[gateway.Path] = key
+	}
+}
+
+// UnderMaintenance reports whether appID answers r with its maintenance page
+func (s *Snapshot) UnderMaintenance(appID string, r *http.Request) bool {
+	mode, ok := s.maintenance[appID]
+	return ok && !mode.bypassed(r)
+}
+
+// writeError answers with the page appID has for status, or the default one
+func (s *Snapshot) writeError(w http.ResponseWriter, r *http.Request, appID string, status int, message string) {
+	renderError(w, r, s.pages[appID][status], ErrorPageData{Status: status, Message: message})
+}
+
+// Snapshots keeps the current Snapshot. It reloads when Invalidate is
+// called after a local write, when another instance writes and Postgres
+// notifies SnapshotChannel, and every refreshEach in case a notification
+// was missed.
+type Snapshots struct {
+	current     atomic.Pointer[Snapshot]
+	conf        *repository.GatewayConfig
+	gateways    *repository.Gateway
+	versions    *repository.ApplicationVersion
+	pages       *repository.ErrorPage
+	maintenance *repository.Maintenance
+
+	reload   chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewSnapshots(conf *repository.GatewayConfig, gateways *repository.Gateway, versions *repository.ApplicationVersion, pages *repository.ErrorPage, maintenance *repository.Maintenance) *Snapshots {
+	s := &Snapshots{
+		conf:        conf,
+		gateways:    gateways,
+		versions:    versions,
+		pages:       pages,
+		maintenance: maintenance,
+		reload:      make(chan struct{}, 1),
+		stopChan:    make(chan struct{}),
+	}
+	s.current.Store(&Snapshot{versions: map[string][]snapshotVersion{}})
+	return s
+}
+
+// Current returns the snapshot in use, it must not be modified
+func (s *Snapshots) Current() *Snapshot {
+	return s.current.Load()
+}
+
+// Load builds a snapshot from the database and swaps it in. On error the
+// previous one stays in use.
+func (s *Snapshots) Load(ctx context.Context) error {
+	conf, err := s.conf.Get(ctx)
+	if err != nil {
+		return err
+	}
+	gateways, err := s.gateways.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	versions, err := s.versions.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	pages, err := s.pages.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	maintenance, err := s.maintenance.GetAll(ctx, filters.IsSelectFilter("enabled", true))
+	if err != nil {
+		return err
+	}
+
+	// Semantic versions highest first, the tags that aren't after them
+	// newest first
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].CreatedAt.After(versions[j].CreatedAt.Time)
+	})
+	semver.SortFunc(versions, func(version model.ApplicationVersion) string { return version.VersionTag })
+	byApp := make(map[string][]snapshotVersion)
+	lifecycles := make(map[string]map[string]versionLifecycle)
+	for _, version := range versions {
+		parsed, err := semver.Parse(version.VersionTag)
+		byApp[version.ApplicationID] = append(byApp[version.ApplicationID], snapshotVersion{
+			tag:    version.VersionTag,
+			semver: parsed,
+			valid:  err == nil,
+			active: version.Status != "inactive",
+		})
+		if lifecycle, ok := newVersionLifecycle(version); ok {
+			if lifecycles[version.ApplicationID] == nil {
+				lifecycles[version.ApplicationID] = make(map[string]versionLifecycle)
+			}
+			lifecycles[version.ApplicationID][version.VersionTag] = lifecycle
+		}
+	}
+
+	snapshot := &Snapshot{
+		Config:      conf,
+		versions:    make(map[string][]snapshotVersion, len(gateways)),
+		apps:        make(map[string]string, len(gateways)),
+		hosts:       make(map[string]bool),
+		anyHost:     make(map[string]string, len(gateways)),
+		pages:       make(map[string]map[int]*errorPage),
+		maintenance: make(map[string]maintenanceMode, len(maintenance)),
+		lifecycles:  lifecycles,
+		LoadedAt:    time.Now(),
+	}
+	for _, gateway := range gateways {
+		snapshot.add(gateway, byApp[gateway.ApplicationID])
+	}
+
+	// Templates were checked when saved, one that no longer parses is left
+	// out rather than failing the whole snapshot
+	for _, page := range pages {
+		compiled, err := parseErrorPage(page.HTML, page.JSON)
+		if err != nil {
+			log.Printf("ERROR: Skipping the %d page of application %s: %v", page.Status, page.ApplicationID, err)
+			continue
+		}
+		if snapshot.pages[page.ApplicationID] == nil {
+			snapshot.pages[page.ApplicationID] = make(map[int]*errorPage)
+		}
+		snapshot.pages[page.ApplicationID][page.Status] = compiled
+	}
+	for _, m := range maintenance {
+		mode, err := newMaintenanceMode(m)
+		if err != nil {
+			log.Printf("ERROR: Skipping the allow list of application %s under maintenance: %v", m.ApplicationID, err)
+		}
+		snapshot.maintenance[m.ApplicationID] = mode
+	}
+
+	s.current.Store(snapshot)
+	return nil
+}
+
+// Invalidate schedules a reload without waiting for it
+func (s *Snapshots) Invalidate() {
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Start reloads in the background. With dsn set it listens on
+// SnapshotChannel, without it only local writes and refreshEach reload.
+func (s *Snapshots) Start(ctx context.Context, dsn string, refreshEach time.Duration) {
+	var notify <-chan *pq.Notification
+	var listener *pq.Listener
+	if dsn != "" {
+		listener = pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("ERROR: Gateway snapshot listener: %v", err)
+			}
+		})
+		if err := listener.Listen(SnapshotChannel); err != nil {
+			log.Printf("ERROR: Failed to listen on %s, gateway changes of other instances wait for the next refresh: %v", SnapshotChannel, err)
+		}
+		notify = listener.Notify
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if listener != nil {
+			defer listener.Close()
+		}
+		var tick <-chan time.Time
+		if refreshEach > 0 {
+			ticker := time.NewTicker(refreshEach)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-s.stopChan:
+				return
+			case <-tick:
+			case <-s.reload:
+			// A nil notification follows a reconnect, anything may have
+			// changed in between
+			case <-notify:
+			}
+
+			// Let the rest of a burst of writes arrive first
+			select {
+			case <-s.stopChan:
+				return
+			case <-time.After(snapshotDebounce):
+			}
+			drain(s.reload)
+			drainNotify(notify)
+
+			if err := s.Load(ctx); err != nil {
+				log.Printf("ERROR: Failed to reload gateway snapshot: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *Snapshots) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+func drain(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+	}
+}
+
+func drainNotify(ch <-chan *pq.Notification) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/semver"
+)
+
+// newTestSnapshot builds a snapshot serving tags under each gateway
+func newTestSnapshot(gateways map[model.Gateway][]string) *Snapshot {
+	s := &Snapshot{
+		versions: make(map[string][]snapshotVersion),
+		apps:     make(map[string]string),
+		hosts:    make(map[string]bool),
+		anyHost:  make(map[string]string),
+	}
+	for gateway, tags := range gateways {
+		var versions []snapshotVersion
+		for _, tag := range tags {
+			parsed, err := semver.Parse(tag)
+			versions = append(versions, snapshotVersion{tag: tag, semver: parsed, valid: err == nil, active: true})
+		}
+		s.add(gateway, versions)
+	}
+	return s
+}
+
+func TestSnapshotSamePathOnTwoDomains(t *testing.T) {
+	s := newTestSnapshot(map[model.Gateway][]string{
+		{Domain: "a.example.com", Path: "/api", ApplicationID: "app-a"}: {"v1.0.0"},
+		{Domain: "B.example.com", Path: "/api", ApplicationID: "app-b"}: {"v2.1.0", "v2.0.0"},
+	})
+
+	tests := []struct {
+		host    string
+		app     string
+		latest  string
+		matched string
+	}{
+		{"a.example.com", "app-a", "v1.0.0", ""},
+		{"b.example.com:8080", "app-b", "v2.1.0", "v2.1.0"},
+		{"B.EXAMPLE.COM", "app-b", "v2.1.0", "v2.1.0"},
+		// A host no gateway is on gets the lowest domain, like the router
+		{"other.example.com", "app-a", "v1.0.0", ""},
+	}
+
+	v2, _ := semver.ParseRange("v2")
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := s.AppForPath(tt.host, "/v1.0.0/api/users"); got != tt.app {
+				t.Errorf("AppForPath = %q, want %q", got, tt.app)
+			}
+			if got, _ := s.LatestVersion(tt.host, "api"); got != tt.latest {
+				t.Errorf("LatestVersion = %q, want %q", got, tt.latest)
+			}
+			if got, _ := s.MatchVersion(tt.host, "api", v2); got != tt.matched {
+				t.Errorf("MatchVersion(v2) = %q, want %q", got, tt.matched)
+			}
+			if !s.HasVersion(tt.host, "api", tt.latest) {
+				t.Errorf("HasVersion(%s) = false", tt.latest)
+			}
+		})
+	}
+
+	resolution := resolveVersion(s, "a.example.com", "/v2.0.0/api", http.Header{})
+	if resolution.Found {
+		t.Errorf("v2.0.0 of b.example.com resolved on a.example.com")
+	}
+	resolution = resolveVersion(s, "b.example.com", "/v2/api", http.Header{})
+	if !resolution.Found || resolution.Version != "v2.1.0" {
+		t.Errorf("resolution on b.example.com = %+v, want v2.1.0", resolution)
+	}
+}
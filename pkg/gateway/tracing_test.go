@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps every span in memory
+// for the length of the test
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no %s span in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingSpans(t *testing.T) {
+	exporter := recordSpans(t)
+
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: &tracingTransport{base: http.DefaultTransport, appID: "app-1"}}
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL+"/items", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "http://shop.example.com/shop/items", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "req-42" {
+		t.Fatalf("response request id = %q, want req-42", got)
+	}
+
+	spans := exporter.GetSpans()
+	request := spanNamed(t, spans, "gateway.request")
+	upstreamSpan := spanNamed(t, spans, "gateway.upstream")
+
+	if request.SpanKind != trace.SpanKindServer || upstreamSpan.SpanKind != trace.SpanKindClient {
+		t.Fatalf("span kinds = %v, %v, want server and client", request.SpanKind, upstreamSpan.SpanKind)
+	}
+	for key, want := range map[attribute.Key]string{
+		"http.request.method": http.MethodGet,
+		"url.path":            "/shop/items",
+		"server.address":      "shop.example.com",
+		"neploy.request_id":   "req-42",
+	} {
+		if got := attr(request, key).AsString(); got != want {
+			t.Errorf("request span %s = %q, want %q", key, got, want)
+		}
+	}
+	if got := attr(request, "http.response.status_code").AsInt64(); got != http.StatusBadGateway {
+		t.Errorf("request span status code = %d, want 502", got)
+	}
+	if request.Status.Code != codes.Error {
+		t.Errorf("request span status = %v, want error for a 502", request.Status.Code)
+	}
+
+	if got := attr(upstreamSpan, "neploy.app_id").AsString(); got != "app-1" {
+		t.Errorf("upstream span app id = %q, want app-1", got)
+	}
+	if got := attr(upstreamSpan, "url.path").AsString(); got != "/items" {
+		t.Errorf("upstream span path = %q, want /items", got)
+	}
+	if upstreamSpan.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Error("upstream span is not a child of the request span")
+	}
+
+	// The container gets the upstream span as its parent
+	sc := upstreamSpan.SpanContext
+	want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"
+	if upstreamTraceparent != want {
+		t.Errorf("upstream traceparent = %q, want %q", upstreamTraceparent, want)
+	}
+}
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	exporter := recordSpans(t)
+
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/app", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	// An invalid request id is replaced
+	req.Header.Set(RequestIDHeader, "bad id with spaces")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	request := spanNamed(t, exporter.GetSpans(), "gateway.request")
+	if got := request.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace id = %s, want the incoming one", got)
+	}
+	if request.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("parent span = %s, want the incoming one", request.Parent.SpanID())
+	}
+	if id := w.Header().Get(RequestIDHeader); id == "" || id == "bad id with spaces" {
+		t.Fatalf("request id = %q, want a generated one", id)
+	}
+}
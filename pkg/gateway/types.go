@@ -1,8 +1,33 @@
 package gateway
 
-type LastHourMetrics struct {
-	Hour          string
+import "time"
+
+// RequestSample describes a finished gateway request
+type RequestSample struct {
+	ApplicationID string
+	Version       string
+	Method        string
+	Status        int
+	Start         time.Time
+	Duration      time.Duration
+	BytesIn       int64
+	BytesOut      int64
+}
+
+type StatusKey struct {
+	Method string
+	Status int
+}
+
+type HourlyCount struct {
+	ApplicationID string
+	Version       string
+	Hour          time.Time
 	Requests      int
 	Errors        int
-	ApplicationID string
+	BytesIn       int64
+	BytesOut      int64
+	// Latency sketch bucket counts, see metrics.LatencySketch
+	Latency     map[int]int64
+	StatusCodes map[StatusKey]int64
 }
@@ -0,0 +1,226 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"neploy.dev/pkg/geoip"
+	"neploy.dev/pkg/logger"
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+const (
+	OverflowDrop  = "drop"
+	OverflowBlock = "block"
+
+	// A visitor trace row takes around a dozen parameters, keep batches well
+	// under the postgres limit of 65535 per statement
+	maxTraceBatchSize  = 4000
+	traceWriteTimeout  = 30 * time.Second
+	traceWriteAttempts = 4
+)
+
+// traceRetryDelay is the wait before the first retry of a failed batch, it
+// doubles on every further attempt
+var traceRetryDelay = time.Second
+
+// traceStore writes a batch of visitor traces, see
+// repository.VisitorTrace.InsertBatch
+type traceStore interface {
+	InsertBatch(ctx context.Context, visitorTraces []model.VisitorTrace) error
+}
+
+type TraceIngesterConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	// OnOverflow is OverflowDrop or OverflowBlock
+	OnOverflow string
+	// SessionTimeout is the inactivity after which a visitor starts a new session
+	SessionTimeout time.Duration
+	// GeoIP locates visitors by IP when set
+	GeoIP *geoip.DB
+}
+
+// TraceIngester assigns visitor traces to sessions, queues them and writes
+// them in batches from a single worker, so the number of goroutines and
+// connections used for traces stays fixed however busy the gateway is.
+// A batch that fails to write is retried with backoff while new traces wait
+// in the queue, and counted as failed once the attempts run out.
+type TraceIngester struct {
+	repo     traceStore
+	conf     TraceIngesterConfig
+	queue    chan model.VisitorTrace
+	sessions *SessionTracker
+
+	// mu is held for reading while enqueuing and for writing while closing,
+	// so nothing is sent on the queue after it is closed
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewTraceIngester(repo *repository.VisitorTrace, conf TraceIngesterConfig) *TraceIngester {
+	return newTraceIngester(repo, conf)
+}
+
+func newTraceIngester(repo traceStore, conf TraceIngesterConfig) *TraceIngester {
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 10000
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 500
+	}
+	if conf.BatchSize > maxTraceBatchSize {
+		conf.BatchSize = maxTraceBatchSize
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 2 * time.Second
+	}
+	if conf.OnOverflow != OverflowBlock {
+		conf.OnOverflow = OverflowDrop
+	}
+
+	t := &TraceIngester{
+		repo:     repo,
+		conf:     conf,
+		queue:    make(chan model.VisitorTrace, conf.QueueSize),
+		sessions: NewSessionTracker(conf.SessionTimeout),
+	}
+
+	t.wg.Add(1)
+	go t.run()
+
+	return t
+}
+
+// Enqueue queues a trace. When the queue is full the trace is dropped, or
+// with OverflowBlock the caller waits for room until ctx is done.
+func (t *TraceIngester) Enqueue(ctx context.Context, trace model.VisitorTrace) {
+	if t == nil {
+		return
+	}
+
+	if trace.VisitorID != "" {
+		trace.SessionID = t.sessions.Touch(trace.VisitorID, trace.ApplicationID, trace.VisitedTimestamp.Time)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		neploymetrics.VisitorTraces("dropped", 1)
+		return
+	}
+
+	if t.conf.OnOverflow == OverflowBlock {
+		select {
+		case t.queue <- trace:
+			neploymetrics.VisitorTraces("queued", 1)
+		case <-ctx.Done():
+			neploymetrics.VisitorTraces("dropped", 1)
+		}
+		return
+	}
+
+	select {
+	case t.queue <- trace:
+		neploymetrics.VisitorTraces("queued", 1)
+	default:
+		neploymetrics.VisitorTraces("dropped", 1)
+	}
+}
+
+// Close stops accepting traces and waits until the queued ones are written
+func (t *TraceIngester) Close() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	t.sessions.Close()
+}
+
+func (t *TraceIngester) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.conf.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.VisitorTrace, 0, t.conf.BatchSize)
+	for {
+		select {
+		case item, ok := <-t.queue:
+			if !ok {
+				t.write(batch)
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) >= t.conf.BatchSize {
+				t.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			t.write(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (t *TraceIngester) write(batch []model.VisitorTrace) {
+	neploymetrics.SetVisitorTraceQueue(len(t.queue))
+	if len(batch) == 0 {
+		return
+	}
+
+	// Located here rather than in the request path to keep lookups off the
+	// response latency
+	for i := range batch {
+		if loc, ok := t.conf.GeoIP.LookupAddr(batch[i].IpAddress); ok {
+			batch[i].Country = loc.Country
+			batch[i].Region = loc.Region
+			batch[i].City = loc.City
+			batch[i].ASN = loc.ASN
+			batch[i].ASOrg = loc.ASOrg
+		}
+	}
+
+	delay := traceRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := t.insert(batch)
+		if err == nil {
+			neploymetrics.VisitorTraces("written", len(batch))
+			return
+		}
+		if attempt == traceWriteAttempts {
+			log.Printf("ERROR: Failed to write %d visitor traces after %d attempts, dropping them: %v", len(batch), attempt, err)
+			neploymetrics.VisitorTraces("failed", len(batch))
+			return
+		}
+
+		logger.Warn("error writing %d visitor traces, retrying in %s: %v", len(batch), delay, err)
+		neploymetrics.VisitorTraces("retried", len(batch))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (t *TraceIngester) insert(batch []model.VisitorTrace) error {
+	ctx, cancel := context.WithTimeout(context.Background(), traceWriteTimeout)
+	defer cancel()
+
+	return t.repo.InsertBatch(ctx, batch)
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"neploy.dev/pkg/model"
+)
+
+// fakeTraceStore fails the first failures inserts and keeps the rest
+type fakeTraceStore struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	written  int
+}
+
+func (s *fakeTraceStore) InsertBatch(ctx context.Context, visitorTraces []model.VisitorTrace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("database unavailable")
+	}
+	s.written += len(visitorTraces)
+	return nil
+}
+
+func withTraceRetryDelay(t *testing.T, delay time.Duration) {
+	previous := traceRetryDelay
+	traceRetryDelay = delay
+	t.Cleanup(func() { traceRetryDelay = previous })
+}
+
+func TestTraceIngesterRetriesFailedBatch(t *testing.T) {
+	withTraceRetryDelay(t, time.Millisecond)
+
+	store := &fakeTraceStore{failures: traceWriteAttempts - 1}
+	ingester := newTraceIngester(store, TraceIngesterConfig{BatchSize: 10, FlushInterval: time.Hour})
+	for i := 0; i < 3; i++ {
+		ingester.Enqueue(context.Background(), model.VisitorTrace{ApplicationID: "app"})
+	}
+	ingester.Close()
+
+	if store.attempts != traceWriteAttempts {
+		t.Errorf("attempts = %d, want %d", store.attempts, traceWriteAttempts)
+	}
+	if store.written != 3 {
+		t.Errorf("written = %d, want 3", store.written)
+	}
+}
+
+func TestTraceIngesterGivesUpAfterLastAttempt(t *testing.T) {
+	withTraceRetryDelay(t, time.Millisecond)
+
+	store := &fakeTraceStore{failures: traceWriteAttempts + 1}
+	ingester := newTraceIngester(store, TraceIngesterConfig{BatchSize: 10, FlushInterval: time.Hour})
+	ingester.Enqueue(context.Background(), model.VisitorTrace{ApplicationID: "app"})
+	ingester.Close()
+
+	if store.attempts != traceWriteAttempts {
+		t.Errorf("attempts = %d, want %d", store.attempts, traceWriteAttempts)
+	}
+	if store.written != 0 {
+		t.Errorf("written = %d, want 0", store.written)
+	}
+}
@@ -0,0 +1,215 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"neploy.dev/pkg/logger"
+)
+
+// reloadCheckInterval is how often the database files are checked for changes
+const reloadCheckInterval = 30 * time.Second
+
+// Location is what the databases know about an IP, fields are empty when
+// the IP or the database does not carry them
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code
+	Region  string
+	City    string
+	ASN     uint
+	ASOrg   string
+}
+
+// record holds the fields read from City, Country and ASN databases, so one
+// type decodes any of them or a database combining them
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+type database struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// DB looks up IPs in local MaxMind format (.mmdb) databases and reopens them
+// when their files change. Files are memory mapped, so updates must replace
+// them atomically, as geoipupdate does. A nil or empty DB finds nothing.
+type DB struct {
+	mu        sync.RWMutex
+	databases []*database
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Open loads the databases at paths, empty paths are skipped. Usually a City
+// or Country database plus an optional ASN one.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{stopChan: make(chan struct{})}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		d := &database{path: path}
+		if err := d.open(); err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.databases = append(db.databases, d)
+	}
+
+	if len(db.databases) > 0 {
+		db.wg.Add(1)
+		go db.watch()
+	}
+
+	return db, nil
+}
+
+// Lookup returns the location of ip, ok is false when nothing is known
+func (db *DB) Lookup(ip net.IP) (Location, bool) {
+	if db == nil || ip == nil {
+		return Location{}, false
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var loc Location
+	for _, d := range db.databases {
+		var r record
+		if err := d.reader.Lookup(ip, &r); err != nil {
+			continue
+		}
+
+		if loc.Country == "" {
+			loc.Country = r.Country.ISOCode
+		}
+		if loc.Region == "" && len(r.Subdivisions) > 0 {
+			loc.Region = r.Subdivisions[0].Names["en"]
+		}
+		if loc.City == "" {
+			loc.City = r.City.Names["en"]
+		}
+		if loc.ASN == 0 {
+			loc.ASN = r.ASN
+			loc.ASOrg = r.ASOrg
+		}
+	}
+
+	return loc, loc != (Location{})
+}
+
+// LookupAddr is Lookup for a host or host:port string
+func (db *DB) LookupAddr(addr string) (Location, bool) {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	return db.Lookup(net.ParseIP(strings.Trim(host, "[]")))
+}
+
+// Enabled reports whether any database is loaded
+func (db *DB) Enabled() bool {
+	return db != nil && len(db.databases) > 0
+}
+
+func (db *DB) Close() {
+	if db == nil {
+		return
+	}
+
+	select {
+	case <-db.stopChan:
+		return
+	default:
+		close(db.stopChan)
+	}
+	db.wg.Wait()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, d := range db.databases {
+		d.reader.Close()
+	}
+}
+
+func (db *DB) watch() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(reloadCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.stopChan:
+			return
+		case <-ticker.C:
+			for _, d := range db.databases {
+				db.reloadIfChanged(d)
+			}
+		}
+	}
+}
+
+func (db *DB) reloadIfChanged(d *database) {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		logger.Error("error checking GeoIP database %s: %v", d.path, err)
+		return
+	}
+	if info.ModTime().Equal(d.modTime) && info.Size() == d.size {
+		return
+	}
+
+	reader, err := maxminddb.Open(d.path)
+	if err != nil {
+		// Likely still being written, try again on the next check
+		logger.Error("error reloading GeoIP database %s: %v", d.path, err)
+		return
+	}
+
+	db.mu.Lock()
+	old := d.reader
+	d.reader = reader
+	d.modTime = info.ModTime()
+	d.size = info.Size()
+	db.mu.Unlock()
+
+	old.Close()
+	logger.Info("Reloaded GeoIP database %s", d.path)
+}
+
+func (d *database) open() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+
+	reader, err := maxminddb.Open(d.path)
+	if err != nil {
+		return err
+	}
+
+	d.reader = reader
+	d.modTime = info.ModTime()
+	d.size = info.Size()
+	return nil
+}
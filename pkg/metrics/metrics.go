@@ -0,0 +1,318 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "neploy"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "requests_total",
+		Help:      "Requests proxied by the gateway.",
+	}, []string{"app", "version", "method", "status_class"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "request_duration_seconds",
+		Help:      "Time spent serving gateway requests, upstream included.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"app", "version", "method"})
+
+	requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "requests_in_flight",
+		Help:      "Requests currently being served by the gateway.",
+	}, []string{"app"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "cache_requests_total",
+		Help:      "Gateway response cache lookups by result.",
+	}, []string{"result"})
+
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "upstream_errors_total",
+		Help:      "Requests that failed to reach the application container.",
+	}, []string{"app"})
+
+	containerCPU = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "container",
+		Name:      "cpu_percent",
+		Help:      "CPU usage of the application container.",
+	}, []string{"app", "version"})
+
+	containerMemory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "container",
+		Name:      "memory_percent",
+		Help:      "Memory usage of the application container relative to its limit.",
+	}, []string{"app", "version"})
+
+	deployDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "deploy",
+		Name:      "duration_seconds",
+		Help:      "Time taken by deployments.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1200},
+	}, []string{"source", "outcome"})
+
+	visitorTraces = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "visitor_traces",
+		Name:      "total",
+		Help:      "Visitor traces by outcome: queued, dropped, written, retried or failed.",
+	}, []string{"result"})
+
+	visitorTraceQueue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "visitor_traces",
+		Name:      "queue_length",
+		Help:      "Visitor traces waiting to be written.",
+	})
+
+	deploysTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "deploy",
+		Name:      "total",
+		Help:      "Deployments by source and outcome.",
+	}, []string{"source", "outcome"})
+
+	retentionRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "retention",
+		Name:      "rows_total",
+		Help:      "Rows taken out of a table by the retention jobs, rolled up or deleted.",
+	}, []string{"table", "action"})
+
+	grpcResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "grpc_responses_total",
+		Help:      "gRPC calls proxied by the gateway, by grpc-status code.",
+	}, []string{"app", "code"})
+
+	reconcileDrift = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconcile",
+		Name:      "drift_total",
+		Help:      "Differences the reconciler found between the database and the router table or the containers.",
+	}, []string{"kind"})
+
+	l4Bytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "l4",
+		Name:      "bytes_total",
+		Help:      "Bytes forwarded by the TCP and UDP routes, in from clients and out to them.",
+	}, []string{"app", "protocol", "direction"})
+
+	l4Connections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "l4",
+		Name:      "connections_total",
+		Help:      "Connections and UDP sessions taken by the TCP and UDP routes, by result: accepted, denied, over_limit or upstream_error. Every datagram of a rejected UDP client counts as denied or over_limit.",
+	}, []string{"app", "protocol", "result"})
+
+	l4Active = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "l4",
+		Name:      "connections_active",
+		Help:      "Open connections and UDP sessions of the TCP and UDP routes.",
+	}, []string{"app", "protocol"})
+
+	mirrorRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "mirror_requests_total",
+		Help:      "Requests sampled for mirroring to a candidate version, by result: mirrored, failed, busy, body_too_large or dropped.",
+	}, []string{"app", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		requestsInFlight,
+		cacheRequests,
+		upstreamErrors,
+		containerCPU,
+		containerMemory,
+		deployDuration,
+		deploysTotal,
+		visitorTraces,
+		visitorTraceQueue,
+		retentionRows,
+		grpcResponses,
+		reconcileDrift,
+		l4Bytes,
+		l4Connections,
+		l4Active,
+		mirrorRequests,
+	)
+}
+
+// Handler serves the metrics in Prometheus exposition format. When token is
+// not empty requests must carry it as a bearer token.
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// NewServer serves Handler under /metrics on addr. Scrapes are small and
+// quick, the timeouts keep a stalled client from holding a connection.
+func NewServer(addr, token string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(token))
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+}
+
+// ObserveRequest records a finished gateway request
+func ObserveRequest(app, version, method string, status int, duration time.Duration) {
+	method = Method(method)
+	requestsTotal.WithLabelValues(app, version, method, StatusClass(status)).Inc()
+	requestDuration.WithLabelValues(app, version, method).Observe(duration.Seconds())
+}
+
+// TrackInFlight marks a request for app as in flight until the returned func is called
+func TrackInFlight(app string) func() {
+	gauge := requestsInFlight.WithLabelValues(app)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// GRPCResponse counts a gRPC call to app that ended with code
+func GRPCResponse(app, code string) {
+	grpcResponses.WithLabelValues(app, code).Inc()
+}
+
+func CacheHit() {
+	cacheRequests.WithLabelValues("hit").Inc()
+}
+
+func CacheMiss() {
+	cacheRequests.WithLabelValues("miss").Inc()
+}
+
+func UpstreamError(app string) {
+	upstreamErrors.WithLabelValues(app).Inc()
+}
+
+func SetContainerUsage(app, version string, cpu, memory float64) {
+	containerCPU.WithLabelValues(app, version).Set(cpu)
+	containerMemory.WithLabelValues(app, version).Set(memory)
+}
+
+// DeleteContainerUsage drops the series of a container that no longer runs
+func DeleteContainerUsage(app, version string) {
+	containerCPU.DeleteLabelValues(app, version)
+	containerMemory.DeleteLabelValues(app, version)
+}
+
+// VisitorTraces counts n visitor traces with the given result
+func VisitorTraces(result string, n int) {
+	visitorTraces.WithLabelValues(result).Add(float64(n))
+}
+
+func SetVisitorTraceQueue(length int) {
+	visitorTraceQueue.Set(float64(length))
+}
+
+// ObserveDeploy records how long a deploy from source took and whether it failed
+func ObserveDeploy(source string, err error, duration time.Duration) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	deploysTotal.WithLabelValues(source, outcome).Inc()
+	deployDuration.WithLabelValues(source, outcome).Observe(duration.Seconds())
+}
+
+// RetentionRows counts n rows of table rolled up or deleted by a retention job
+func RetentionRows(table, action string, n int64) {
+	retentionRows.WithLabelValues(table, action).Add(float64(n))
+}
+
+// ReconcileDrift counts a drift of kind found by the reconciler
+func ReconcileDrift(kind string) {
+	reconcileDrift.WithLabelValues(kind).Inc()
+}
+
+// L4Bytes counts n bytes forwarded by an L4 route, direction is in or out
+func L4Bytes(app, protocol, direction string, n int) {
+	l4Bytes.WithLabelValues(app, protocol, direction).Add(float64(n))
+}
+
+func L4Connection(app, protocol, result string) {
+	l4Connections.WithLabelValues(app, protocol, result).Inc()
+}
+
+// TrackL4Active marks a connection of app as open until the returned func is called
+func TrackL4Active(app, protocol string) func() {
+	gauge := l4Active.WithLabelValues(app, protocol)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// MirrorRequest counts a request of app sampled for mirroring by result
+func MirrorRequest(app, result string) {
+	mirrorRequests.WithLabelValues(app, result).Inc()
+}
+
+// Method returns method when it is a standard HTTP method and "other"
+// otherwise, clients may send any verb and every one would be a new series
+func Method(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// StatusClass groups a status code as 1xx, 2xx, 3xx, 4xx or 5xx
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// sketchAccuracy is the relative error of the quantiles read from a sketch
+const sketchAccuracy = 0.01
+
+var (
+	sketchGamma    = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// LatencySketch keeps latencies in logarithmic buckets, so quantiles are
+// accurate to 1% and two sketches merge by adding their bucket counts. That
+// makes them safe to store per hour and combine over any range.
+type LatencySketch struct {
+	Buckets map[int]int64
+}
+
+func NewLatencySketch() *LatencySketch {
+	return &LatencySketch{Buckets: make(map[int]int64)}
+}
+
+// SketchBucket returns the bucket a latency falls in, latencies are measured
+// in microseconds and anything under one lands in bucket 0
+func SketchBucket(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log(us) / sketchLogGamma))
+}
+
+func (s *LatencySketch) Add(d time.Duration) {
+	s.Buckets[SketchBucket(d)]++
+}
+
+func (s *LatencySketch) AddBucket(bucket int, count int64) {
+	s.Buckets[bucket] += count
+}
+
+func (s *LatencySketch) Merge(other *LatencySketch) {
+	for bucket, count := range other.Buckets {
+		s.Buckets[bucket] += count
+	}
+}
+
+func (s *LatencySketch) Count() int64 {
+	var total int64
+	for _, count := range s.Buckets {
+		total += count
+	}
+	return total
+}
+
+// Quantile returns the latency below which a q fraction of the samples fall
+func (s *LatencySketch) Quantile(q float64) time.Duration {
+	total := s.Count()
+	if total == 0 {
+		return 0
+	}
+
+	buckets := make([]int, 0, len(s.Buckets))
+	for bucket := range s.Buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+
+	rank := int64(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for _, bucket := range buckets {
+		seen += s.Buckets[bucket]
+		if seen >= rank {
+			return bucketValue(bucket)
+		}
+	}
+	return bucketValue(buckets[len(buckets)-1])
+}
+
+// bucketValue is the latency in the middle of a bucket, which keeps the error
+// within sketchAccuracy on both sides
+func bucketValue(bucket int) time.Duration {
+	if bucket <= 0 {
+		return time.Microsecond
+	}
+	us := 2 * math.Pow(sketchGamma, float64(bucket)) / (sketchGamma + 1)
+	return time.Duration(us * float64(time.Microsecond))
+}
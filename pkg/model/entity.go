@@ -71,6 +71,7 @@ type Trace struct {
 	Action          string `json:"action" db:"action"`
 	ActionTimestamp Date   `json:"actionTimestamp" db:"action_timestamp"`
 	SqlStatement    string `json:"sqlStatement" db:"sql_statement"`
+	RequestID       string `json:"requestId" db:"request_id"`
 	Email           string `json:"email" db:"-"`
 }
 
@@ -80,16 +81,98 @@ type Gateway struct {
 	Path          string `json:"path" db:"path"`
 	Port          string `json:"port" db:"port"`
 	ApplicationID string `json:"applicationId" db:"application_id"`
-	Status        string `json:"status" db:"status"` // "active", "inactive", "error"
+	Status        string `json:"status" db:"status"`               // "active", "inactive", "error"
+	MaxBodyBytes  int64  `json:"maxBodyBytes" db:"max_body_bytes"` // 0 uses the gateway config limit
+	GeoMode       string `json:"geoMode" db:"geo_mode"`            // "", "allow" or "block"
+	GeoCountries  string `json:"geoCountries" db:"geo_countries"`  // comma separated ISO country codes
+	Protocol      string `json:"protocol" db:"protocol"`           // "" for HTTP/1.1, "h2c" or "grpc"
+	// Share of the requests copied to a candidate version, its answers are
+	// compared and discarded
+	MirrorVersion string  `json:"mirrorVersion" db:"mirror_version"` // version tag, "" mirrors nothing
+	MirrorPercent float64 `json:"mirrorPercent" db:"mirror_percent"` // 0 to 100
+	// Health check of the container port, zero values use the defaults
+	HealthPath           string `json:"healthPath" db:"health_path"`                      // "" probes /health, the service name on gRPC gateways
+	HealthMethod         string `json:"healthMethod" db:"health_method"`                  // "" is GET
+	HealthExpectedStatus int    `json:"healthExpectedStatus" db:"health_expected_status"` // 0 takes any 2xx
+	HealthExpectedBody   string `json:"healthExpectedBody" db:"health_expected_body"`     // substring, "" skips the check
+	HealthInterval       int    `json:"healthInterval" db:"health_interval"`              // seconds, 0 uses HEALTH_CHECK_INTERVAL
+	HealthTimeout        int    `json:"healthTimeout" db:"health_timeout"`                // seconds, 0 is 5
+	HealthyThreshold     int    `json:"healthyThreshold" db:"healthy_threshold"`          // passes in a row, 0 is 2
+	UnhealthyThreshold   int    `json:"unhealthyThreshold" db:"unhealthy_threshold"`      // failures in a row, 0 is 3
+	HealthStatus         string `json:"healthStatus" db:"health_status" goqu:"skipinsert,skipupdate"`
+}
+
+// ErrorPage replaces the default page the gateway answers Status with for
+// an application. HTML and JSON are Go templates, HTML goes to browsers and
+// JSON to everyone else, an empty one keeps the default for its format.
+type ErrorPage struct {
+	BaseEntity
+	ApplicationID string `json:"applicationId" db:"application_id"`
+	Status        int    `json:"status" db:"status"` // 404, 429, 502, 503 or 504
+	HTML          string `json:"html" db:"html"`
+	JSON          string `json:"json" db:"json"`
+}
+
+// Maintenance of an application, while enabled the gateway answers 503
+// with the 503 page to everyone but AllowIPs and requests carrying
+// BypassToken in the X-Maintenance-Bypass header. The token is only shown
+// when it is created or rotated, see MaintenanceResponse.
+type Maintenance struct {
+	BaseEntity
+	ApplicationID string `json:"applicationId" db:"application_id"`
+	Enabled       bool   `json:"enabled" db:"enabled"`
+	Message       string `json:"message" db:"message"`
+	RetryAfter    int    `json:"retryAfter" db:"retry_after"` // seconds, 0 sends no Retry-After
+	AllowIPs      string `json:"allowIps" db:"allow_ips"`     // comma separated CIDRs
+	BypassToken   string `json:"-" db:"bypass_token"`
+}
+
+// L4Route forwards raw TCP or UDP from ListenPort of the host to
+// TargetPort of an application container, or TLS connections of the shared
+// SNI listener asking for SNIHost
+type L4Route struct {
+	BaseEntity
+	ApplicationID string `json:"applicationId" db:"application_id"`
+	Protocol      string `json:"protocol" db:"protocol"`        // "tcp" or "udp"
+	ListenPort    int    `json:"listenPort" db:"listen_port"`   // 0 when routed by SNI host
+	SNIHost       string `json:"sniHost" db:"sni_host"`         // TCP only, TLS is passed through
+	TargetPort    string `json:"targetPort" db:"target_port"`   // host port of the container
+	MaxConns      int    `json:"maxConns" db:"max_conns"`       // 0 is unlimited, UDP counts client sessions
+	IdleTimeout   int    `json:"idleTimeout" db:"idle_timeout"` // seconds, 0 is 300
+	AllowCIDRs    string `json:"allowCidrs" db:"allow_cidrs"`   // comma separated, empty allows all
+	DenyCIDRs     string `json:"denyCidrs" db:"deny_cidrs"`     // comma separated, checked first
+	Enabled       bool   `json:"enabled" db:"enabled"`
 }
 
 type ApplicationStat struct {
 	BaseEntity
 	ApplicationID string `json:"application_id" db:"application_id"`
+	Version       string `json:"version" db:"version"`
 	Date          Date   `json:"date" db:"date"`
 	Requests      int    `json:"requests" db:"requests"`
 	Errors        int    `json:"errors" db:"errors"`
+	BytesIn       int64  `json:"bytes_in" db:"bytes_in"`
+	BytesOut      int64  `json:"bytes_out" db:"bytes_out"`
 	AppName       string `json:"name,omitempty" db:"-"`
+	// Latency sketch bucket counts and per method and status counts of the
+	// hour, stored in their own tables
+	Latency     map[int]int64     `json:"-" db:"-"`
+	StatusCodes []StatusCodeCount `json:"-" db:"-"`
+}
+
+type LatencyBucket struct {
+	ApplicationID string `json:"application_id" db:"application_id"`
+	Version       string `json:"version" db:"version"`
+	Bucket        int    `json:"bucket" db:"bucket"`
+	Count         int64  `json:"count" db:"count"`
+}
+
+type StatusCodeCount struct {
+	ApplicationID string `json:"-" db:"application_id"`
+	Version       string `json:"-" db:"version"`
+	Method        string `json:"method" db:"method"`
+	Status        int    `json:"status" db:"status"`
+	Count         int64  `json:"count" db:"count"`
 }
 
 type VisitorTrace struct {
@@ -100,8 +183,21 @@ type VisitorTrace struct {
 	Browser          string `json:"browser" db:"browser"`
 	Os               string `json:"os" db:"os"`
 	PageVisited      string `json:"page_visited" db:"page_visited"`
-	VisitDuration    int    `json:"visit_duration" db:"visit_duration"`
+	Latency          int    `json:"latency_ms" db:"latency_ms"`
 	VisitedTimestamp Date   `json:"visit_timestamp" db:"visit_timestamp"`
+	RequestID        string `json:"request_id" db:"request_id"`
+	TraceID          string `json:"trace_id" db:"trace_id"`
+	Version          string `json:"version" db:"version"`
+	VisitorID        string `json:"visitor_id" db:"visitor_id"`
+	SessionID        string `json:"session_id" db:"session_id"`
+	// Host of the referring site, empty for navigation within the app
+	Referrer string `json:"referrer" db:"referrer"`
+	// Location from the GeoIP databases, empty when not configured
+	Country string `json:"country" db:"country"`
+	Region  string `json:"region" db:"region"`
+	City    string `json:"city" db:"city"`
+	ASN     uint   `json:"asn" db:"asn"`
+	ASOrg   string `json:"as_org" db:"as_org"`
 }
 
 // UserOAuth struct has been removed as part of OAuth refactoring
@@ -125,6 +221,13 @@ type Invitation struct {
 type GatewayConfig struct {
 	BaseEntity
 	DefaultVersioningType VersioningType `json:"defaultVersioningType,omitempty" db:"default_versioning_type"`
+	ReadTimeout           int            `json:"readTimeout" db:"read_timeout"`              // seconds
+	ReadHeaderTimeout     int            `json:"readHeaderTimeout" db:"read_header_timeout"` // seconds
+	WriteTimeout          int            `json:"writeTimeout" db:"write_timeout"`            // seconds
+	IdleTimeout           int            `json:"idleTimeout" db:"idle_timeout"`              // seconds
+	MaxHeaderBytes        int            `json:"maxHeaderBytes" db:"max_header_bytes"`
+	MaxBodyBytes          int64          `json:"maxBodyBytes" db:"max_body_bytes"`
+	MaxConnsPerIP         int            `json:"maxConnsPerIp" db:"max_conns_per_ip"`
 }
 
 type ApplicationVersion struct {
@@ -134,4 +237,154 @@ type ApplicationVersion struct {
 	Status          string `json:"status" db:"status"`                    // Running, Stopped, etc.
 	StorageLocation string `json:"StorageLocation" db:"storage_location"` // Aquí va la ruta final al binario/despliegue
 	ApplicationID   string `json:"applicationId" db:"application_id"`
+	// Deprecation lifecycle, see migration 00034
+	DeprecatedAt *Date  `json:"deprecatedAt" db:"deprecated_at"`
+	SunsetAt     *Date  `json:"sunsetAt" db:"sunset_at"`
+	MigrationURL string `json:"migrationUrl" db:"migration_url"`
+	SunsetAction string `json:"sunsetAction" db:"sunset_action"` // "" answers 410 after the sunset, "redirect" sends to the newest version
+}
+
+// AlertRule fires when Metric of an application stays above Threshold for
+// For seconds. Window is how many seconds of requests rate and latency rules
+// look at.
+type AlertRule struct {
+	BaseEntity
+	ApplicationID string      `json:"applicationId" db:"application_id"`
+	Name          string      `json:"name" db:"name"`
+	Metric        AlertMetric `json:"metric" db:"metric"`
+	Threshold     float64     `json:"threshold" db:"threshold"`
+	Window        int         `json:"window" db:"window_seconds"` // seconds
+	For           int         `json:"for" db:"for_seconds"`       // seconds
+	Severity      string      `json:"severity" db:"severity"`
+	Targets       string      `json:"targets" db:"targets"` // comma separated
+	Enabled       bool        `json:"enabled" db:"enabled"`
+}
+
+type Alert struct {
+	BaseEntity
+	RuleID          string      `json:"ruleId" db:"rule_id"`
+	ApplicationID   string      `json:"applicationId" db:"application_id"`
+	Status          AlertStatus `json:"status" db:"status"`
+	Severity        string      `json:"severity" db:"severity"`
+	Value           float64     `json:"value" db:"value"`
+	Message         string      `json:"message" db:"message"`
+	StartedAt       Date        `json:"startedAt" db:"started_at"`
+	FiredAt         *Date       `json:"firedAt" db:"fired_at"`
+	ResolvedAt      *Date       `json:"resolvedAt" db:"resolved_at"`
+	LastEvaluatedAt Date        `json:"lastEvaluatedAt" db:"last_evaluated_at"`
+}
+
+// NotificationChannel is where events are sent. Webhook and Slack channels
+// post to URL, email channels mail Recipients. Events lists the event types
+// routed to the channel, all of them when empty.
+type NotificationChannel struct {
+	BaseEntity
+	Name       string                  `json:"name" db:"name"`
+	Type       NotificationChannelType `json:"type" db:"type"`
+	URL        string                  `json:"url" db:"url"`
+	Secret     string                  `json:"-" db:"secret"`              // signs webhook bodies
+	Recipients string                  `json:"recipients" db:"recipients"` // comma separated
+	Events     string                  `json:"events" db:"events"`         // comma separated
+	Enabled    bool                    `json:"enabled" db:"enabled"`
+}
+
+type NotificationDelivery struct {
+	BaseEntity
+	ChannelID      string                     `json:"channelId" db:"channel_id"`
+	Event          NotificationEventType      `json:"event" db:"event"`
+	Payload        string                     `json:"payload" db:"payload"` // the NotificationEvent as JSON
+	Status         NotificationDeliveryStatus `json:"status" db:"status"`
+	Attempts       int                        `json:"attempts" db:"attempts"`
+	ResponseStatus int                        `json:"responseStatus" db:"response_status"`
+	LastError      string                     `json:"lastError" db:"last_error"`
+	NextAttemptAt  *Date                      `json:"nextAttemptAt" db:"next_attempt_at"`
+	DeliveredAt    *Date                      `json:"deliveredAt" db:"delivered_at"`
+	LockedUntil    *Date                      `json:"-" db:"locked_until"` // claimed by a sender until then
+}
+
+// OutboxEmail is an email queued to be sent. HTML is stored sealed, see
+// email.SealBody, and cleared once it is sent or given up on.
+type OutboxEmail struct {
+	BaseEntity
+	From          string      `json:"from" db:"from_address"`
+	Recipients    string      `json:"recipients" db:"recipients"` // comma separated
+	Subject       string      `json:"subject" db:"subject"`
+	HTML          string      `json:"-" db:"html"`
+	Status        EmailStatus `json:"status" db:"status"`
+	Attempts      int         `json:"attempts" db:"attempts"`
+	LastError     string      `json:"lastError" db:"last_error"`
+	NextAttemptAt *Date       `json:"nextAttemptAt" db:"next_attempt_at"`
+	SentAt        *Date       `json:"sentAt" db:"sent_at"`
+	LockedUntil   *Date       `json:"-" db:"locked_until"` // claimed by a sender until then
+}
+
+// HealthCheck is the result of one probe of a gateway's container
+type HealthCheck struct {
+	BaseEntity
+	GatewayID     string `json:"gatewayId" db:"gateway_id"`
+	ApplicationID string `json:"applicationId" db:"application_id"`
+	Healthy       bool   `json:"healthy" db:"healthy"`
+	StatusCode    int    `json:"statusCode" db:"status_code"`
+	LatencyMs     int64  `json:"latencyMs" db:"latency_ms"`
+	Error         string `json:"error" db:"error"`
+	CheckedAt     Date   `json:"checkedAt" db:"checked_at"`
+}
+
+// StatusPageApplication is an application listed on the public status page
+type StatusPageApplication struct {
+	BaseEntity
+	ApplicationID string `json:"applicationId" db:"application_id"`
+	DisplayName   string `json:"displayName" db:"display_name"` // the application name when empty
+	Position      int    `json:"position" db:"position"`
+}
+
+// Incident is posted by an admin, of an application or of the whole
+// platform when ApplicationID is nil
+type Incident struct {
+	BaseEntity
+	ApplicationID *string          `json:"applicationId" db:"application_id"`
+	Title         string           `json:"title" db:"title"`
+	Impact        string           `json:"impact" db:"impact"`
+	Status        IncidentStatus   `json:"status" db:"status"`
+	StartedAt     Date             `json:"startedAt" db:"started_at"`
+	ResolvedAt    *Date            `json:"resolvedAt" db:"resolved_at"`
+	Updates       []IncidentUpdate `json:"updates" db:"-"` // newest first
+}
+
+// IncidentUpdate is a note posted on an incident
+type IncidentUpdate struct {
+	BaseEntity
+	IncidentID string         `json:"incidentId" db:"incident_id"`
+	Status     IncidentStatus `json:"status" db:"status"`
+	Message    string         `json:"message" db:"message"`
+}
+
+// MirrorSample is a request mirrored to a candidate version, with the answer
+// of the version that served it and of the candidate side by side.
+// MirrorStatus is 0 when the candidate could not be reached.
+type MirrorSample struct {
+	BaseEntity
+	ApplicationID    string  `json:"applicationId" db:"application_id"`
+	Version          string  `json:"version" db:"version"` // the candidate
+	PrimaryVersion   string  `json:"primaryVersion" db:"primary_version"`
+	Method           string  `json:"method" db:"method"`
+	Path             string  `json:"path" db:"path"`
+	PrimaryStatus    int     `json:"primaryStatus" db:"primary_status"`
+	PrimaryLatencyMs float64 `json:"primaryLatencyMs" db:"primary_latency_ms"`
+	MirrorStatus     int     `json:"mirrorStatus" db:"mirror_status"`
+	MirrorLatencyMs  float64 `json:"mirrorLatencyMs" db:"mirror_latency_ms"`
+	MirrorError      string  `json:"mirrorError" db:"mirror_error"`
+	SampledAt        Date    `json:"sampledAt" db:"sampled_at"`
+}
+
+// DeprecatedVersionUsage counts the requests a consumer made to a deprecated
+// version in a day
+type DeprecatedVersionUsage struct {
+	BaseEntity
+	ApplicationID string `json:"applicationId" db:"application_id"`
+	Version       string `json:"version" db:"version"`
+	Consumer      string `json:"consumer" db:"consumer"`
+	Day           Date   `json:"day" db:"day"`
+	Requests      int64  `json:"requests" db:"requests"`
+	LastSeenAt    Date   `json:"lastSeenAt" db:"last_seen_at"`
 }
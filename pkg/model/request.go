@@ -77,6 +77,13 @@ type CreateTechStackRequest struct {
 
 type GatewayConfigRequest struct {
 	DefaultVersioning VersioningType `json:"defaultVersioning" validate:"required,oneof=header uri"`
+	ReadTimeout       *int           `json:"readTimeout,omitempty" validate:"omitempty,min=0"`
+	ReadHeaderTimeout *int           `json:"readHeaderTimeout,omitempty" validate:"omitempty,min=0"`
+	WriteTimeout      *int           `json:"writeTimeout,omitempty" validate:"omitempty,min=0"`
+	IdleTimeout       *int           `json:"idleTimeout,omitempty" validate:"omitempty,min=0"`
+	MaxHeaderBytes    *int           `json:"maxHeaderBytes,omitempty" validate:"omitempty,min=0"`
+	MaxBodyBytes      *int64         `json:"maxBodyBytes,omitempty" validate:"omitempty,min=0"`
+	MaxConnsPerIP     *int           `json:"maxConnsPerIp,omitempty" validate:"omitempty,min=0"`
 }
 
 type ProfileRequest struct {
@@ -104,3 +111,120 @@ type SelectUserTechStacksRequest struct {
 type UserRoleRequest struct {
 	UserIds []string `json:"userIds" validate:"required"`
 }
+
+// StatsFilter narrows application stats to a time range and an application,
+// zero values mean no restriction
+type StatsFilter struct {
+	ApplicationID string
+	From          *time.Time
+	To            *time.Time
+}
+
+type AlertRuleRequest struct {
+	ApplicationID string      `json:"applicationId" validate:"required"`
+	Name          string      `json:"name" validate:"required,min=2,max=128"`
+	Metric        AlertMetric `json:"metric" validate:"required,oneof=error_rate latency_p95 container_down cpu memory health_check"`
+	Threshold     float64     `json:"threshold" validate:"min=0"`
+	Window        int         `json:"window,omitempty" validate:"omitempty,min=60,max=3600"` // seconds, defaults to 300
+	For           int         `json:"for" validate:"min=0"`                                  // seconds
+	Severity      string      `json:"severity,omitempty" validate:"omitempty,oneof=info warning critical"`
+	Targets       []string    `json:"targets"`
+	Enabled       *bool       `json:"enabled,omitempty"`
+}
+
+type ErrorPageRequest struct {
+	HTML string `json:"html"`
+	JSON string `json:"json"`
+}
+
+type MaintenanceRequest struct {
+	Enabled    bool     `json:"enabled"`
+	Message    string   `json:"message" validate:"max=1024"`
+	RetryAfter int      `json:"retryAfter" validate:"min=0,max=604800"` // seconds
+	AllowIPs   []string `json:"allowIps" validate:"dive,cidr|ip"`
+	// RotateBypassToken replaces the bypass token, one is created on the
+	// first save
+	RotateBypassToken bool `json:"rotateBypassToken"`
+}
+
+type L4RouteRequest struct {
+	ApplicationID string   `json:"applicationId" validate:"required"`
+	Protocol      string   `json:"protocol" validate:"required,oneof=tcp udp"`
+	ListenPort    int      `json:"listenPort,omitempty" validate:"required_without=SNIHost,omitempty,min=1,max=65535"`
+	SNIHost       string   `json:"sniHost,omitempty" validate:"required_without=ListenPort,omitempty,hostname"`
+	TargetPort    string   `json:"targetPort" validate:"required,numeric"`
+	MaxConns      int      `json:"maxConns" validate:"min=0"`
+	IdleTimeout   int      `json:"idleTimeout" validate:"min=0,max=86400"` // seconds, 0 is 300
+	AllowCIDRs    []string `json:"allowCidrs" validate:"dive,cidr|ip"`
+	DenyCIDRs     []string `json:"denyCidrs" validate:"dive,cidr|ip"`
+	Enabled       *bool    `json:"enabled,omitempty"`
+}
+
+// AlertFilter narrows the alert history, zero values mean no restriction
+type AlertFilter struct {
+	ApplicationID string
+	RuleID        string
+	Status        AlertStatus
+	From          *time.Time
+	To            *time.Time
+}
+
+type NotificationChannelRequest struct {
+	Name       string                  `json:"name" validate:"required,min=2,max=128"`
+	Type       NotificationChannelType `json:"type" validate:"required,oneof=webhook slack email"`
+	URL        string                  `json:"url,omitempty" validate:"required_unless=Type email,omitempty,url"`
+	Secret     string                  `json:"secret,omitempty"` // kept as is when empty on update
+	Recipients []string                `json:"recipients,omitempty" validate:"required_if=Type email,dive,email"`
+	Events     []string                `json:"events,omitempty" validate:"dive,oneof=alert deploy gateway_health container_stopped"`
+	Enabled    *bool                   `json:"enabled,omitempty"`
+}
+
+// NotificationDeliveryFilter narrows the delivery log, zero values mean no restriction
+type NotificationDeliveryFilter struct {
+	ChannelID string
+	Status    NotificationDeliveryStatus
+	From      *time.Time
+	To        *time.Time
+}
+
+type StatusPageApplicationRequest struct {
+	ApplicationID string `json:"applicationId" validate:"required,uuid"`
+	DisplayName   string `json:"displayName,omitempty" validate:"max=128"`
+}
+
+// StatusPageRequest replaces the applications listed on the status page, in order
+type StatusPageRequest struct {
+	Applications []StatusPageApplicationRequest `json:"applications" validate:"dive"`
+}
+
+type IncidentRequest struct {
+	ApplicationID string         `json:"applicationId,omitempty" validate:"omitempty,uuid"` // the whole platform when empty
+	Title         string         `json:"title" validate:"required,min=2,max=200"`
+	Impact        string         `json:"impact" validate:"required,oneof=minor major"`
+	Status        IncidentStatus `json:"status,omitempty" validate:"omitempty,oneof=investigating identified monitoring resolved"`
+	Message       string         `json:"message" validate:"required,max=5000"`
+	StartedAt     *time.Time     `json:"startedAt,omitempty"` // now when empty
+}
+
+type IncidentUpdateRequest struct {
+	Status  IncidentStatus `json:"status" validate:"required,oneof=investigating identified monitoring resolved"`
+	Message string         `json:"message" validate:"required,max=5000"`
+}
+
+// TraceMatchRequest is a request to run through the gateway routing without
+// sending it
+type TraceMatchRequest struct {
+	URL        string            `json:"url" validate:"required,url"`
+	Method     string            `json:"method,omitempty" validate:"omitempty,max=16"` // GET when empty
+	Headers    map[string]string `json:"headers,omitempty"`
+	RemoteAddr string            `json:"remoteAddr,omitempty" validate:"omitempty,ip"` // client IP for the country rules
+}
+
+// VersionDeprecationRequest sets the deprecation of a version, without
+// DeprecatedAt it is no longer deprecated
+type VersionDeprecationRequest struct {
+	DeprecatedAt *time.Time `json:"deprecatedAt,omitempty"`
+	SunsetAt     *time.Time `json:"sunsetAt,omitempty"` // served until then, never sunset when empty
+	MigrationURL string     `json:"migrationUrl,omitempty" validate:"omitempty,url,max=2048"`
+	SunsetAction string     `json:"sunsetAction,omitempty" validate:"omitempty,oneof=redirect"` // 410 when empty
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type LoginResponse struct {
 	Token string `json:"token"`
 	User  User   `json:"user"`
@@ -81,6 +83,92 @@ type RequestStat struct {
 	ApplicationID string `db:"application_id" json:"application_id"`
 }
 
+// LatencyPercentiles are in milliseconds
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+type ApplicationReport struct {
+	ApplicationID string             `json:"application_id" db:"application_id"`
+	AppName       string             `json:"name" db:"-"`
+	Requests      int64              `json:"requests" db:"requests"`
+	Errors        int64              `json:"errors" db:"errors"`
+	BytesIn       int64              `json:"bytes_in" db:"bytes_in"`
+	BytesOut      int64              `json:"bytes_out" db:"bytes_out"`
+	Latency       LatencyPercentiles `json:"latency" db:"-"`
+	StatusCodes   []StatusCodeCount  `json:"status_codes" db:"-"`
+	Versions      []VersionReport    `json:"versions" db:"-"`
+}
+
+// VersionReport is the share of one version in an ApplicationReport
+type VersionReport struct {
+	ApplicationID string             `json:"-" db:"application_id"`
+	Version       string             `json:"version" db:"version"`
+	Requests      int64              `json:"requests" db:"requests"`
+	Errors        int64              `json:"errors" db:"errors"`
+	BytesIn       int64              `json:"bytes_in" db:"bytes_in"`
+	BytesOut      int64              `json:"bytes_out" db:"bytes_out"`
+	Latency       LatencyPercentiles `json:"latency" db:"-"`
+	StatusCodes   []StatusCodeCount  `json:"status_codes" db:"-"`
+}
+
+type DailyVisitors struct {
+	Date          Date   `json:"date" db:"date"`
+	ApplicationID string `json:"application_id" db:"application_id"`
+	Visitors      int64  `json:"visitors" db:"visitors"`
+}
+
+type SessionStats struct {
+	ApplicationID   string  `json:"application_id" db:"application_id"`
+	Sessions        int64   `json:"sessions" db:"sessions"`
+	AvgDuration     float64 `json:"avg_duration" db:"avg_duration"` // seconds
+	PagesPerSession float64 `json:"pages_per_session" db:"pages_per_session"`
+	BounceRate      float64 `json:"bounce_rate" db:"bounce_rate"`
+}
+
+type PageCount struct {
+	ApplicationID string `json:"application_id" db:"application_id"`
+	Version       string `json:"version,omitempty" db:"version"`
+	Page          string `json:"page" db:"page"`
+	Views         int64  `json:"views" db:"views"`
+	Visitors      int64  `json:"visitors,omitempty" db:"visitors"`
+}
+
+type ReferrerCount struct {
+	ApplicationID string `json:"application_id" db:"application_id"`
+	Referrer      string `json:"referrer" db:"referrer"`
+	Sessions      int64  `json:"sessions" db:"sessions"`
+}
+
+type LocationCount struct {
+	ApplicationID string `json:"application_id" db:"application_id"`
+	Country       string `json:"country" db:"country"`
+	Region        string `json:"region,omitempty" db:"region"`
+	City          string `json:"city,omitempty" db:"city"`
+	Visitors      int64  `json:"visitors" db:"visitors"`
+}
+
+type NetworkCount struct {
+	ApplicationID string `json:"application_id" db:"application_id"`
+	ASN           uint   `json:"asn" db:"asn"`
+	ASOrg         string `json:"as_org" db:"as_org"`
+	Visitors      int64  `json:"visitors" db:"visitors"`
+}
+
+type VisitorReport struct {
+	UniqueVisitors []DailyVisitors `json:"unique_visitors"`
+	Sessions       []SessionStats  `json:"sessions"`
+	TopPages       []PageCount     `json:"top_pages"`
+	EntryPages     []PageCount     `json:"entry_pages"`
+	ExitPages      []PageCount     `json:"exit_pages"`
+	Referrers      []ReferrerCount `json:"referrers"`
+	Countries      []LocationCount `json:"countries"`
+	Cities         []LocationCount `json:"cities"`
+	Networks       []NetworkCount  `json:"networks"`
+}
+
 type TechStat struct {
 	Name  string `json:"name" db:"name"`
 	Count uint   `json:"value" db:"count"`
@@ -91,3 +179,224 @@ type VisitorStat struct {
 	Date          Date   `json:"name" db:"date"`
 	ApplicationID string `json:"application_id" db:"application_id"`
 }
+
+// RetentionResult counts the rows a retention job took out of a table
+type RetentionResult struct {
+	Table  string `json:"table"`
+	Action string `json:"action"` // RetentionRolledUp or RetentionDeleted
+	Rows   int64  `json:"rows"`
+}
+
+type RetentionReport struct {
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Results    []RetentionResult `json:"results"`
+	Errors     []string          `json:"errors,omitempty"`
+}
+
+// ReconcileDrift is a difference the reconciler found and what it did about it
+type ReconcileDrift struct {
+	Kind          string `json:"kind"`
+	Target        string `json:"target"` // route domain and path, L4 listen or container name
+	ApplicationID string `json:"application_id,omitempty"`
+	Version       string `json:"version,omitempty"`
+	Action        string `json:"action,omitempty"` // empty when only reported
+	Error         string `json:"error,omitempty"`
+}
+
+type ReconcileReport struct {
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	DryRun     bool             `json:"dry_run"`
+	Routes     int              `json:"routes"`     // routes the gateways ask for
+	L4Routes   int              `json:"l4_routes"`  // enabled TCP and UDP routes
+	Containers int              `json:"containers"` // containers that should be running
+	Drift      []ReconcileDrift `json:"drift"`
+	Errors     []string         `json:"errors,omitempty"`
+}
+
+// LiveRoute is a route loaded in the gateway router and the policies it
+// applies
+type LiveRoute struct {
+	Host            string   `json:"host"`
+	Path            string   `json:"path"`
+	ApplicationID   string   `json:"application_id"`
+	ApplicationName string   `json:"application_name,omitempty"`
+	Version         string   `json:"version,omitempty"` // empty on the unversioned route
+	Backend         string   `json:"backend"`
+	MaxBodyBytes    int64    `json:"max_body_bytes"` // after the gateway config fallback
+	GeoMode         string   `json:"geo_mode,omitempty"`
+	GeoCountries    []string `json:"geo_countries,omitempty"`
+	Protocol        string   `json:"protocol,omitempty"`
+	MirrorVersion   string   `json:"mirror_version,omitempty"` // candidate a share of the requests is copied to
+	MirrorPercent   float64  `json:"mirror_percent,omitempty"`
+	GatewayID       string   `json:"gateway_id,omitempty"`    // empty when no gateway is behind it
+	HealthStatus    string   `json:"health_status,omitempty"` // of the gateway
+}
+
+// RouteMatch explains which route and version the gateway picks for a
+// request, Steps in the order the router takes them
+type RouteMatch struct {
+	Method        string     `json:"method"`
+	URL           string     `json:"url"`
+	Path          string     `json:"path"` // what the routes were matched against
+	Version       string     `json:"version,omitempty"`
+	VersionSource string     `json:"version_source,omitempty"` // path, header, latest or default
+	Matched       bool       `json:"matched"`
+	Route         *LiveRoute `json:"route,omitempty"`
+	Status        int        `json:"status,omitempty"` // the gateway answers itself with it, 0 when proxied
+	Steps         []string   `json:"steps"`
+}
+
+// ContainerUsage is the last sample taken of an application version container
+type ContainerUsage struct {
+	ApplicationID string    `json:"application_id"`
+	Version       string    `json:"version"`
+	Running       bool      `json:"running"`
+	Expected      bool      `json:"expected"` // false when the version was stopped on purpose
+	CPU           float64   `json:"cpu"`      // percent
+	Memory        float64   `json:"memory"`   // percent of the limit
+	SampledAt     time.Time `json:"sampled_at"`
+}
+
+// NotificationEvent is the body posted to webhook channels and the source of
+// the Slack and email messages
+type NotificationEvent struct {
+	Type          NotificationEventType `json:"type"`
+	Severity      string                `json:"severity"`
+	Title         string                `json:"title"`
+	Message       string                `json:"message"`
+	ApplicationID string                `json:"application_id,omitempty"`
+	Fields        map[string]string     `json:"fields,omitempty"`
+	OccurredAt    time.Time             `json:"occurred_at"`
+}
+
+// UptimeDay counts the health checks of an application on a day
+type UptimeDay struct {
+	ApplicationID string  `json:"application_id" db:"application_id"`
+	Date          Date    `json:"date" db:"date"`
+	Checks        int64   `json:"checks" db:"checks"`
+	Healthy       int64   `json:"healthy" db:"healthy"`
+	Uptime        float64 `json:"uptime" db:"-"` // percent of healthy checks
+}
+
+type UptimeReport struct {
+	ApplicationID string      `json:"application_id,omitempty"`
+	Checks        int64       `json:"checks"`
+	Healthy       int64       `json:"healthy"`
+	Uptime        float64     `json:"uptime"` // percent, 100 without checks
+	Days          []UptimeDay `json:"days"`
+}
+
+// StatusPage is what the public status page shows
+type StatusPage struct {
+	TeamName     string                `json:"team_name"`
+	LogoURL      string                `json:"logo_url"`
+	Status       string                `json:"status"` // the worst of the applications
+	Applications []StatusPageComponent `json:"applications"`
+	Incidents    []Incident            `json:"incidents"` // open ones and the recently resolved
+	GeneratedAt  time.Time             `json:"generated_at"`
+}
+
+// StatusPageComponent is an application on the status page, Days holds one
+// entry per day of the uptime window, oldest first, with no checks on the
+// days nothing was probed
+type StatusPageComponent struct {
+	ID     string      `json:"id"`
+	Name   string      `json:"name"`
+	Status string      `json:"status"`
+	Uptime float64     `json:"uptime"` // percent over the window
+	Days   []UptimeDay `json:"days"`
+}
+
+// SLAReport is the uptime of an application over a calendar month against
+// the SLA target
+type SLAReport struct {
+	ApplicationID   string      `json:"application_id"`
+	ApplicationName string      `json:"application_name"`
+	Month           string      `json:"month"` // YYYY-MM
+	From            time.Time   `json:"from"`
+	To              time.Time   `json:"to"` // now for the current month
+	Target          float64     `json:"target"`
+	Uptime          float64     `json:"uptime"`
+	Met             bool        `json:"met"`
+	Checks          int64       `json:"checks"`
+	Healthy         int64       `json:"healthy"`
+	DowntimeMinutes float64     `json:"downtime_minutes"` // failing share of the period
+	Incidents       []Incident  `json:"incidents"`
+	Days            []UptimeDay `json:"days"`
+}
+
+// L4RouteStats are the counters of an L4 route since the gateway started,
+// a route that is not listening has none
+type L4RouteStats struct {
+	Listening     bool  `json:"listening"`
+	ActiveConns   int64 `json:"active_conns"` // UDP client sessions on UDP routes
+	TotalConns    int64 `json:"total_conns"`
+	RejectedConns int64 `json:"rejected_conns"` // by the access lists or the connection limit, every datagram of a rejected UDP client
+	FailedConns   int64 `json:"failed_conns"`   // the container could not be reached
+	BytesIn       int64 `json:"bytes_in"`       // from clients
+	BytesOut      int64 `json:"bytes_out"`      // to clients
+}
+
+// MaintenanceResponse is the saved maintenance, with the bypass token when
+// it was just created or rotated. It is not shown again.
+type MaintenanceResponse struct {
+	Maintenance
+	BypassToken string `json:"bypassToken,omitempty"`
+}
+
+type L4RouteStatus struct {
+	Route L4Route      `json:"route"`
+	Stats L4RouteStats `json:"stats"`
+}
+
+// MirrorSide sums one side of the requests mirrored to a candidate version
+type MirrorSide struct {
+	Errors       int64   `json:"errors"` // 5xx, on the mirror side also the requests it failed to answer
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	P50LatencyMs float64 `json:"p50_latency_ms"`
+	P95LatencyMs float64 `json:"p95_latency_ms"`
+	P99LatencyMs float64 `json:"p99_latency_ms"`
+}
+
+// MirrorStatusPair counts the requests answered with PrimaryStatus by the
+// serving version and MirrorStatus by the candidate
+type MirrorStatusPair struct {
+	PrimaryStatus int   `json:"primary_status" db:"primary_status"`
+	MirrorStatus  int   `json:"mirror_status" db:"mirror_status"`
+	Count         int64 `json:"count" db:"count"`
+}
+
+// MirrorComparison compares the candidate version of a mirror with the
+// versions that served the mirrored requests
+type MirrorComparison struct {
+	ApplicationID    string             `json:"application_id"`
+	Version          string             `json:"version"`
+	Samples          int64              `json:"samples"`
+	StatusMismatches int64              `json:"status_mismatches"` // the candidate answered another status
+	Primary          MirrorSide         `json:"primary"`
+	Mirror           MirrorSide         `json:"mirror"` // latencies of the answered requests only
+	Statuses         []MirrorStatusPair `json:"statuses"`
+	Recent           []MirrorSample     `json:"recent"`
+}
+
+// ConsumerUsage sums the requests of a consumer to a deprecated version
+type ConsumerUsage struct {
+	Version   string `json:"-" db:"version"`
+	Consumer  string `json:"consumer" db:"consumer"`
+	Requests  int64  `json:"requests" db:"requests"`
+	FirstSeen Date   `json:"first_seen" db:"first_seen"` // day of the first request
+	LastSeen  Date   `json:"last_seen" db:"last_seen"`
+}
+
+// DeprecatedVersionReport lists who still calls a deprecated version, the
+// consumers with the most requests first
+type DeprecatedVersionReport struct {
+	VersionID    string          `json:"version_id"`
+	Version      string          `json:"version"`
+	DeprecatedAt Date            `json:"deprecated_at"`
+	SunsetAt     *Date           `json:"sunset_at"`
+	Requests     int64           `json:"requests"`
+	Consumers    []ConsumerUsage `json:"consumers"`
+}
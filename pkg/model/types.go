@@ -13,6 +13,14 @@ import (
 type (
 	Provider       string
 	VersioningType string
+	AlertMetric    string
+	AlertStatus    string
+
+	NotificationChannelType    string
+	NotificationEventType      string
+	NotificationDeliveryStatus string
+	EmailStatus                string
+	IncidentStatus             string
 )
 
 const (
@@ -109,3 +117,111 @@ var (
 	RateWindow         = 5 * time.Minute
 	LockoutDuration    = 15 * time.Minute
 )
+
+// Gateway server limits used when no gateway_config row exists yet
+const (
+	DefaultReadTimeout       = 30  // seconds
+	DefaultReadHeaderTimeout = 10  // seconds
+	DefaultWriteTimeout      = 60  // seconds
+	DefaultIdleTimeout       = 120 // seconds
+	DefaultMaxHeaderBytes    = 1 << 20
+	DefaultMaxBodyBytes      = 10 << 20
+	DefaultMaxConnsPerIP     = 100
+)
+
+// Retention job actions, rows are either summed into a coarser table or dropped
+const (
+	RetentionRolledUp = "rolled_up"
+	RetentionDeleted  = "deleted"
+)
+
+// What the gateway answers a version with after its sunset
+const (
+	SunsetGone     = "" // 410
+	SunsetRedirect = "redirect"
+)
+
+// Drift the reconciler finds between the gateways and versions in the
+// database and the router table or the containers
+const (
+	DriftRouteMissing      = "route_missing"
+	DriftRouteChanged      = "route_changed"
+	DriftRouteStale        = "route_stale"        // no gateway behind it
+	DriftContainerStopped  = "container_stopped"  // its version should be running
+	DriftContainerMissing  = "container_missing"  // never created or removed
+	DriftContainerUnwanted = "container_unwanted" // running while its version is inactive
+)
+
+// Reconciler actions, a drift without one was only reported
+const (
+	ReconcileAdded   = "added"
+	ReconcileUpdated = "updated"
+	ReconcileRemoved = "removed"
+	ReconcileStarted = "started"
+	ReconcileCreated = "created"
+	ReconcileStopped = "stopped"
+)
+
+const (
+	AlertErrorRate     AlertMetric = "error_rate"     // percent of 5xx responses
+	AlertLatencyP95    AlertMetric = "latency_p95"    // milliseconds
+	AlertContainerDown AlertMetric = "container_down" // versions not running
+	AlertCPU           AlertMetric = "cpu"            // percent, busiest container
+	AlertMemory        AlertMetric = "memory"         // percent, busiest container
+	AlertHealthCheck   AlertMetric = "health_check"   // gateways failing their check
+
+	AlertPending  AlertStatus = "pending"
+	AlertFiring   AlertStatus = "firing"
+	AlertResolved AlertStatus = "resolved"
+
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+const (
+	NotificationWebhook NotificationChannelType = "webhook" // signed JSON
+	NotificationSlack   NotificationChannelType = "slack"   // Slack or Mattermost incoming webhook
+	NotificationEmail   NotificationChannelType = "email"
+
+	EventAlert            NotificationEventType = "alert"
+	EventDeploy           NotificationEventType = "deploy"
+	EventGatewayHealth    NotificationEventType = "gateway_health"
+	EventContainerStopped NotificationEventType = "container_stopped"
+	EventTest             NotificationEventType = "test" // sent by the test endpoint only
+
+	DeliveryPending   NotificationDeliveryStatus = "pending"
+	DeliveryDelivered NotificationDeliveryStatus = "delivered"
+	DeliveryFailed    NotificationDeliveryStatus = "failed"
+
+	EmailPending EmailStatus = "pending"
+	EmailSent    EmailStatus = "sent"
+	EmailFailed  EmailStatus = "failed"
+)
+
+// Gateway health, unknown until enough checks agree
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Incidents are minor (degraded) or major (outage) and move through these
+// statuses until resolved
+const (
+	IncidentMinor = "minor"
+	IncidentMajor = "major"
+
+	IncidentInvestigating IncidentStatus = "investigating"
+	IncidentIdentified    IncidentStatus = "identified"
+	IncidentMonitoring    IncidentStatus = "monitoring"
+	IncidentResolved      IncidentStatus = "resolved"
+)
+
+// Status of an application on the status page
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusOutage      = "outage"
+	StatusUnknown     = "unknown"
+)
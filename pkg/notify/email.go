@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"neploy.dev/pkg/email"
+	"neploy.dev/pkg/model"
+)
+
+// Email mails the event to the recipients of the channel
+type Email struct {
+	mail *email.Email
+}
+
+func (e *Email) Send(ctx context.Context, channel model.NotificationChannel, event model.NotificationEvent) (int, error) {
+	var to []string
+	for _, recipient := range strings.Split(channel.Recipients, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			to = append(to, recipient)
+		}
+	}
+	if len(to) == 0 {
+		return 0, errors.New("channel has no recipients")
+	}
+
+	return 0, e.mail.SendNotification(ctx, to, email.NotificationData{
+		Title:      event.Title,
+		Message:    event.Message,
+		Severity:   event.Severity,
+		Color:      severityColor(event.Severity),
+		Fields:     event.Fields,
+		OccurredAt: event.OccurredAt,
+	})
+}
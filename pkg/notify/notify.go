@@ -0,0 +1,69 @@
+// Package notify sends notification events to the outbound channels:
+// signed JSON webhooks, Slack or Mattermost incoming webhooks and email.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"neploy.dev/pkg/email"
+	"neploy.dev/pkg/model"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Sender delivers an event to a channel. status is the HTTP status the
+// channel answered with, zero when it isn't an HTTP channel or the request
+// never got a response.
+type Sender interface {
+	Send(ctx context.Context, channel model.NotificationChannel, event model.NotificationEvent) (status int, err error)
+}
+
+// NewSenders returns a sender per channel type
+func NewSenders(mail *email.Email) map[model.NotificationChannelType]Sender {
+	client := &http.Client{Timeout: requestTimeout}
+	return map[model.NotificationChannelType]Sender{
+		model.NotificationWebhook: &Webhook{client: client},
+		model.NotificationSlack:   &Slack{client: client},
+		model.NotificationEmail:   &Email{mail: mail},
+	}
+}
+
+// post sends body to url and fails on any non 2xx answer
+func post(ctx context.Context, client *http.Client, url string, body io.Reader, headers map[string]string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Neploy-Notifications")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("channel answered with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// severityColor is the color events of severity are highlighted with
+func severityColor(severity string) string {
+	switch severity {
+	case model.AlertSeverityCritical:
+		return "#d92d20"
+	case model.AlertSeverityWarning:
+		return "#f79009"
+	}
+	return "#00b8d9"
+}
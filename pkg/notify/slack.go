@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"neploy.dev/pkg/model"
+)
+
+// Slack posts to an incoming webhook. Mattermost accepts the same payload.
+type Slack struct {
+	client *http.Client
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color    string       `json:"color"`
+	Fallback string       `json:"fallback"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Footer   string       `json:"footer"`
+	Ts       int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (s *Slack) Send(ctx context.Context, channel model.NotificationChannel, event model.NotificationEvent) (int, error) {
+	body, err := json.Marshal(slackPayload(event))
+	if err != nil {
+		return 0, err
+	}
+
+	return post(ctx, s.client, channel.URL, bytes.NewReader(body), nil)
+}
+
+func slackPayload(event model.NotificationEvent) slackMessage {
+	names := make([]string, 0, len(event.Fields))
+	for name := range event.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]slackField, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, slackField{Title: name, Value: event.Fields[name], Short: true})
+	}
+
+	return slackMessage{
+		Text: "*" + event.Title + "*",
+		Attachments: []slackAttachment{{
+			Color:    severityColor(event.Severity),
+			Fallback: event.Title + ": " + event.Message,
+			Text:     event.Message,
+			Fields:   fields,
+			Footer:   "Neploy · " + string(event.Type),
+			Ts:       event.OccurredAt.Unix(),
+		}},
+	}
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"neploy.dev/pkg/model"
+)
+
+// Webhook signing headers. The signature is the hex HMAC-SHA256, keyed with
+// the channel secret, of the timestamp, a dot and the body, so receivers
+// can reject replays by checking the timestamp.
+const (
+	EventHeader     = "X-Neploy-Event"
+	TimestampHeader = "X-Neploy-Timestamp"
+	SignatureHeader = "X-Neploy-Signature"
+)
+
+// Webhook posts the event as JSON to a generic endpoint
+type Webhook struct {
+	client *http.Client
+}
+
+func (w *Webhook) Send(ctx context.Context, channel model.NotificationChannel, event model.NotificationEvent) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		EventHeader:     string(event.Type),
+		TimestampHeader: timestamp,
+	}
+	if channel.Secret != "" {
+		headers[SignatureHeader] = "sha256=" + Sign(channel.Secret, timestamp, body)
+	}
+
+	return post(ctx, w.client, channel.URL, bytes.NewReader(body), headers)
+}
+
+// Sign returns the signature of a webhook body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/doug-martin/goqu/v9"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/store"
+)
+
+type AlertRule struct {
+	Base[model.AlertRule]
+}
+
+func NewAlertRule(db store.Queryable) *AlertRule {
+	return &AlertRule{Base[model.AlertRule]{Store: db, Table: "alert_rules"}}
+}
+
+func (a *AlertRule) Delete(ctx context.Context, id string) error {
+	query := filters.ApplyUpdateFilters(
+		a.BaseQueryUpdate().
+			Set(goqu.Record{"deleted_at": goqu.L("CURRENT_TIMESTAMP")}),
+		filters.IsUpdateFilter("id", id),
+	)
+
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return err
+	}
+
+	if _, err := a.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
+
+// GetByApplicationID returns the rules of an app, all of them when applicationID is empty
+func (a *AlertRule) GetByApplicationID(ctx context.Context, applicationID string) ([]model.AlertRule, error) {
+	query := filters.ApplyFilters(
+		a.baseQuery().Order(goqu.C("created_at").Asc()),
+		filters.GenericColumnSelectFilter("application_id", applicationID, ""),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var rules []model.AlertRule
+	if err := a.Store.SelectContext(ctx, &rules, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return rules, nil
+}
+
+type Alert struct {
+	Base[model.Alert]
+}
+
+func NewAlert(db store.Queryable) *Alert {
+	return &Alert{Base[model.Alert]{Store: db, Table: "alerts"}}
+}
+
+// GetOpen returns the pending and firing alerts, one at most per rule
+func (a *Alert) GetOpen(ctx context.Context) ([]model.Alert, error) {
+	query := a.baseQuery().Where(goqu.C("status").In(model.AlertPending, model.AlertFiring))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var alerts []model.Alert
+	if err := a.Store.SelectContext(ctx, &alerts, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return alerts, nil
+}
+
+// GetHistory returns the alerts matching filter, newest first
+func (a *Alert) GetHistory(ctx context.Context, filter model.AlertFilter, limit uint) ([]model.Alert, error) {
+	query := filters.ApplyFilters(
+		a.baseQuery().Order(goqu.C("started_at").Desc()),
+		filters.GenericColumnSelectFilter("application_id", filter.ApplicationID, ""),
+		filters.GenericColumnSelectFilter("rule_id", filter.RuleID, ""),
+		filters.GenericColumnSelectFilter("status", string(filter.Status), ""),
+		filters.TimeSelectFilter(filter.From, filter.To, "started_at"),
+		filters.LimitOffsetFilter(limit, 0),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var alerts []model.Alert
+	if err := a.Store.SelectContext(ctx, &alerts, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return alerts, nil
+}
+
+// Discard hard deletes an alert that never fired, pending alerts whose
+// condition cleared are not worth keeping in the history
+func (a *Alert) Discard(ctx context.Context, id string) error {
+	query := dialect.Delete(a.Table).Where(goqu.C("id").Eq(id), goqu.C("status").Eq(model.AlertPending))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return err
+	}
+
+	if _, err := a.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
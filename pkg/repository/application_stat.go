@@ -2,7 +2,11 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"time"
+
 	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
 	"neploy.dev/pkg/common"
 	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/model"
@@ -35,6 +39,230 @@ func (a *ApplicationStat) Insert(ctx context.Context, applicationStat model.Appl
 	return nil
 }
 
+// statSegmentsTable records the metrics WAL segments already added
+const statSegmentsTable = "application_stat_segments"
+
+// UpsertHourly adds the counts of the metrics WAL segment to the rows of
+// their app, version and hour, creating them when missing. The segment,
+// stats, latency buckets and status codes are written in one transaction,
+// so a segment is counted once however often it is replayed. It returns
+// false when the segment was already added and nothing was written.
+func (a *ApplicationStat) UpsertHourly(ctx context.Context, segment string, stats []model.ApplicationStat) (bool, error) {
+	if len(stats) == 0 {
+		return false, nil
+	}
+
+	rows := make([]goqu.Record, 0, len(stats))
+	latencies := make([]goqu.Record, 0)
+	statusCodes := make([]goqu.Record, 0)
+	for _, stat := range stats {
+		rows = append(rows, goqu.Record{
+			"application_id": stat.ApplicationID,
+			"version":        stat.Version,
+			"date":           stat.Date,
+			"requests":       stat.Requests,
+			"errors":         stat.Errors,
+			"bytes_in":       stat.BytesIn,
+			"bytes_out":      stat.BytesOut,
+		})
+		for bucket, count := range stat.Latency {
+			latencies = append(latencies, goqu.Record{
+				"application_id": stat.ApplicationID,
+				"version":        stat.Version,
+				"date":           stat.Date,
+				"bucket":         bucket,
+				"count":          count,
+			})
+		}
+		for _, code := range stat.StatusCodes {
+			statusCodes = append(statusCodes, goqu.Record{
+				"application_id": stat.ApplicationID,
+				"version":        stat.Version,
+				"date":           stat.Date,
+				"method":         code.Method,
+				"status":         code.Status,
+				"count":          code.Count,
+			})
+		}
+	}
+
+	queries := []*goqu.InsertDataset{
+		a.BaseQueryInsert().Rows(rows).OnConflict(goqu.DoUpdate("application_id, version, date", goqu.Record{
+			"requests":  goqu.L("application_stats.requests + EXCLUDED.requests"),
+			"errors":    goqu.L("application_stats.errors + EXCLUDED.errors"),
+			"bytes_in":  goqu.L("application_stats.bytes_in + EXCLUDED.bytes_in"),
+			"bytes_out": goqu.L("application_stats.bytes_out + EXCLUDED.bytes_out"),
+		})),
+	}
+	if len(latencies) > 0 {
+		queries = append(queries, dialect.Insert("application_stat_latencies").Rows(latencies).OnConflict(
+			goqu.DoUpdate("application_id, version, date, bucket", goqu.Record{
+				"count": goqu.L("application_stat_latencies.count + EXCLUDED.count"),
+			})))
+	}
+	if len(statusCodes) > 0 {
+		queries = append(queries, dialect.Insert("application_stat_status_codes").Rows(statusCodes).OnConflict(
+			goqu.DoUpdate("application_id, version, date, method, status", goqu.Record{
+				"count": goqu.L("application_stat_status_codes.count + EXCLUDED.count"),
+			})))
+	}
+
+	applied := false
+	err := inTx(ctx, a.Store, func(tx *sqlx.Tx) error {
+		claimed, err := execRows(ctx, tx, dialect.Insert(statSegmentsTable).
+			Rows(goqu.Record{"id": segment}).
+			OnConflict(goqu.DoNothing()))
+		if err != nil || claimed == 0 {
+			return err
+		}
+
+		for _, query := range queries {
+			q, args, err := query.ToSQL()
+			if err != nil {
+				logger.Error("error building upsert query: %v", err)
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+				logger.Error("error executing upsert query: %v", err)
+				return err
+			}
+			common.AttachSQLToTrace(ctx, q)
+		}
+		applied = true
+		return nil
+	})
+	return applied, err
+}
+
+// DeleteSegmentsBefore forgets the WAL segments added before before. Their
+// files are long removed, unless a flush kept failing for that long.
+func (a *ApplicationStat) DeleteSegmentsBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := dialect.Delete(statSegmentsTable).Where(goqu.C("applied_at").Lt(before))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return 0, err
+	}
+
+	result, err := a.Store.ExecContext(ctx, q, args...)
+	if err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return 0, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return result.RowsAffected()
+}
+
+// statsTables are the tables holding stats at one resolution
+type statsTables struct {
+	stats       string
+	latencies   string
+	statusCodes string
+	// unit is the date_trunc field rows of this resolution are grouped by
+	unit string
+}
+
+var (
+	hourlyStats  = statsTables{"application_stats", "application_stat_latencies", "application_stat_status_codes", "hour"}
+	dailyStats   = statsTables{"application_stats_daily", "application_stat_latencies_daily", "application_stat_status_codes_daily", "day"}
+	monthlyStats = statsTables{"application_stats_monthly", "application_stat_latencies_monthly", "application_stat_status_codes_monthly", "month"}
+
+	statsResolutions = []statsTables{hourlyStats, dailyStats, monthlyStats}
+)
+
+// RollupHourly moves the hourly stats older than before into daily rows
+func (a *ApplicationStat) RollupHourly(ctx context.Context, before time.Time) ([]model.RetentionResult, error) {
+	return a.rollup(ctx, hourlyStats, dailyStats, before)
+}
+
+// RollupDaily moves the daily stats older than before into monthly rows
+func (a *ApplicationStat) RollupDaily(ctx context.Context, before time.Time) ([]model.RetentionResult, error) {
+	return a.rollup(ctx, dailyStats, monthlyStats, before)
+}
+
+// DeleteMonthly drops the monthly stats older than before
+func (a *ApplicationStat) DeleteMonthly(ctx context.Context, before time.Time) ([]model.RetentionResult, error) {
+	results := make([]model.RetentionResult, 0, 3)
+	err := inTx(ctx, a.Store, func(tx *sqlx.Tx) error {
+		for _, table := range []string{monthlyStats.stats, monthlyStats.latencies, monthlyStats.statusCodes} {
+			rows, err := execRows(ctx, tx, dialect.Delete(table).Where(goqu.C("date").Lt(before)))
+			if err != nil {
+				return err
+			}
+			results = append(results, model.RetentionResult{Table: table, Action: model.RetentionDeleted, Rows: rows})
+		}
+		return nil
+	})
+	return results, err
+}
+
+// rollup sums the rows of from older than before into the rows of to and
+// deletes them, in one transaction so a failed run leaves both untouched.
+// before should fall on a unit boundary of to, otherwise the unit it cuts is
+// split across both resolutions.
+func (a *ApplicationStat) rollup(ctx context.Context, from, to statsTables, before time.Time) ([]model.RetentionResult, error) {
+	date := goqu.L(fmt.Sprintf("date_trunc('%s', date AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'", to.unit))
+	older := goqu.C("date").Lt(before)
+
+	type step struct {
+		source string
+		insert *goqu.InsertDataset
+	}
+	steps := []step{
+		{from.stats, dialect.Insert(to.stats).
+			Cols("application_id", "version", "date", "requests", "errors", "bytes_in", "bytes_out").
+			FromQuery(dialect.From(from.stats).
+				Select(
+					goqu.C("application_id"), goqu.C("version"), date,
+					goqu.SUM("requests"), goqu.SUM("errors"), goqu.SUM("bytes_in"), goqu.SUM("bytes_out"),
+				).
+				Where(older).
+				GroupBy(goqu.C("application_id"), goqu.C("version"), date)).
+			OnConflict(goqu.DoUpdate("application_id, version, date", goqu.Record{
+				"requests":  goqu.L(to.stats + ".requests + EXCLUDED.requests"),
+				"errors":    goqu.L(to.stats + ".errors + EXCLUDED.errors"),
+				"bytes_in":  goqu.L(to.stats + ".bytes_in + EXCLUDED.bytes_in"),
+				"bytes_out": goqu.L(to.stats + ".bytes_out + EXCLUDED.bytes_out"),
+			}))},
+		{from.latencies, dialect.Insert(to.latencies).
+			Cols("application_id", "version", "date", "bucket", "count").
+			FromQuery(dialect.From(from.latencies).
+				Select(goqu.C("application_id"), goqu.C("version"), date, goqu.C("bucket"), goqu.SUM("count")).
+				Where(older).
+				GroupBy(goqu.C("application_id"), goqu.C("version"), date, goqu.C("bucket"))).
+			OnConflict(goqu.DoUpdate("application_id, version, date, bucket", goqu.Record{
+				"count": goqu.L(to.latencies + ".count + EXCLUDED.count"),
+			}))},
+		{from.statusCodes, dialect.Insert(to.statusCodes).
+			Cols("application_id", "version", "date", "method", "status", "count").
+			FromQuery(dialect.From(from.statusCodes).
+				Select(goqu.C("application_id"), goqu.C("version"), date, goqu.C("method"), goqu.C("status"), goqu.SUM("count")).
+				Where(older).
+				GroupBy(goqu.C("application_id"), goqu.C("version"), date, goqu.C("method"), goqu.C("status"))).
+			OnConflict(goqu.DoUpdate("application_id, version, date, method, status", goqu.Record{
+				"count": goqu.L(to.statusCodes + ".count + EXCLUDED.count"),
+			}))},
+	}
+
+	results := make([]model.RetentionResult, 0, len(steps))
+	err := inTx(ctx, a.Store, func(tx *sqlx.Tx) error {
+		for _, s := range steps {
+			if _, err := execRows(ctx, tx, s.insert); err != nil {
+				return err
+			}
+			rows, err := execRows(ctx, tx, dialect.Delete(s.source).Where(older))
+			if err != nil {
+				return err
+			}
+			results = append(results, model.RetentionResult{Table: s.source, Action: model.RetentionRolledUp, Rows: rows})
+		}
+		return nil
+	})
+	return results, err
+}
+
 func (a *ApplicationStat) Update(ctx context.Context, applicationStat model.ApplicationStat) error {
 	query := filters.ApplyUpdateFilters(a.BaseQueryUpdate().Set(applicationStat), filters.IsUpdateFilter("id", applicationStat.ID))
 	q, args, err := query.ToSQL()
@@ -154,3 +382,120 @@ func (a *ApplicationStat) GetHourlyRequests(ctx context.Context) ([]model.Reques
 
 	return stats, nil
 }
+
+// GetReportTotals sums requests, errors and bytes per application and version
+func (a *ApplicationStat) GetReportTotals(ctx context.Context, filter model.StatsFilter) ([]model.VersionReport, error) {
+	source := a.statsSource(filter, func(t statsTables) string { return t.stats },
+		"application_id", "version", "requests", "errors", "bytes_in", "bytes_out")
+	query := dialect.From(source.As("s")).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("version"),
+			goqu.COALESCE(goqu.SUM("requests"), 0).As("requests"),
+			goqu.COALESCE(goqu.SUM("errors"), 0).As("errors"),
+			goqu.COALESCE(goqu.SUM("bytes_in"), 0).As("bytes_in"),
+			goqu.COALESCE(goqu.SUM("bytes_out"), 0).As("bytes_out"),
+		).GroupBy(goqu.C("application_id"), goqu.C("version")).
+		Order(goqu.C("application_id").Asc(), goqu.C("version").Asc())
+
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var reports []model.VersionReport
+	if err := a.Store.SelectContext(ctx, &reports, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return reports, nil
+}
+
+// GetLatencyBuckets merges the latency sketches per application and version
+func (a *ApplicationStat) GetLatencyBuckets(ctx context.Context, filter model.StatsFilter) ([]model.LatencyBucket, error) {
+	source := a.statsSource(filter, func(t statsTables) string { return t.latencies },
+		"application_id", "version", "bucket", "count")
+	query := dialect.From(source.As("s")).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("version"),
+			goqu.C("bucket"),
+			goqu.SUM("count").As("count"),
+		).GroupBy(goqu.C("application_id"), goqu.C("version"), goqu.C("bucket"))
+
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var buckets []model.LatencyBucket
+	if err := a.Store.SelectContext(ctx, &buckets, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return buckets, nil
+}
+
+// GetStatusCodes counts requests per application, version, method and status
+func (a *ApplicationStat) GetStatusCodes(ctx context.Context, filter model.StatsFilter) ([]model.StatusCodeCount, error) {
+	source := a.statsSource(filter, func(t statsTables) string { return t.statusCodes },
+		"application_id", "version", "method", "status", "count")
+	query := dialect.From(source.As("s")).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("version"),
+			goqu.C("method"),
+			goqu.C("status"),
+			goqu.SUM("count").As("count"),
+		).GroupBy(goqu.C("application_id"), goqu.C("version"), goqu.C("method"), goqu.C("status")).
+		Order(goqu.C("status").Asc(), goqu.C("method").Asc())
+
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var codes []model.StatusCodeCount
+	if err := a.Store.SelectContext(ctx, &codes, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return codes, nil
+}
+
+// statsSource selects columns from the table of every resolution, as rolled
+// up rows leave the finer table they are read once. Daily and monthly rows
+// match the filter by the start of their day or month.
+func (a *ApplicationStat) statsSource(filter model.StatsFilter, table func(statsTables) string, columns ...interface{}) *goqu.SelectDataset {
+	var source *goqu.SelectDataset
+	for _, resolution := range statsResolutions {
+		query := dialect.From(table(resolution)).Select(columns...)
+		if table(resolution) == a.Table {
+			query = a.baseQuery().Select(columns...)
+		}
+		query = filters.ApplyFilters(query, statsFilters(filter, "date")...)
+
+		if source == nil {
+			source = query
+		} else {
+			source = source.UnionAll(query)
+		}
+	}
+	return source
+}
+
+func statsFilters(filter model.StatsFilter, timeColumn string) []filters.SelectFilterBuilder {
+	return []filters.SelectFilterBuilder{
+		filters.GenericColumnSelectFilter("application_id", filter.ApplicationID, ""),
+		filters.TimeSelectFilter(filter.From, filter.To, timeColumn),
+	}
+}
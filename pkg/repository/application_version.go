@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"time"
+
 	"github.com/doug-martin/goqu/v9"
 	"neploy.dev/pkg/common"
 	"neploy.dev/pkg/logger"
@@ -49,55 +51,31 @@ func (a *ApplicationVersion) Exists(ctx context.Context, appID, tag string) (boo
 	return row.ID != "", err
 }
 
-func (a *ApplicationVersion) ExistsByName(ctx context.Context, name, tag string) (bool, error) {
-	query := a.baseQuery("v").
-		Select(goqu.I("v.*")).
-		LeftJoin(
-			goqu.T("gateways").As("g"),
-			goqu.On(goqu.I("g.application_id").Eq(goqu.I("v.application_id"))),
-		).Where(goqu.I("g.path").Eq("/" + name)).Where(goqu.I("v.version_tag").Eq(tag))
-
-	q, args, err := query.ToSQL()
-	if err != nil {
-		logger.Error("error building select query: %v", err)
-		return false, err
-	}
-
-	var row model.ApplicationVersion
-	if err := a.Store.GetContext(ctx, &row, q, args...); err != nil {
-		logger.Error("error executing exists by name %s: %v", name, err)
-		return false, err
-	}
-
-	common.AttachSQLToTrace(ctx, q)
-	return row.ID != "", err
-}
-
-// GetLatestVersionByName retrieves the most recently created version for an app by its path name
-func (a *ApplicationVersion) GetLatestVersionByName(ctx context.Context, name string) (string, error) {
-	query := a.baseQuery("v").
-		Select(goqu.I("v.version_tag")).
-		LeftJoin(
-			goqu.T("gateways").As("g"),
-			goqu.On(goqu.I("g.application_id").Eq(goqu.I("v.application_id"))),
-		).
-		Where(goqu.I("g.path").Eq("/" + name)).
-		Where(goqu.I("v.deleted_at").IsNull()).
-		Order(goqu.I("v.created_at").Desc()).
-		Limit(1)
+// SetDeprecation writes the deprecation columns of a version alone, a nil
+// deprecatedAt clears them
+func (a *ApplicationVersion) SetDeprecation(ctx context.Context, id string, deprecatedAt, sunsetAt *time.Time, migrationURL, sunsetAction string) (model.ApplicationVersion, error) {
+	query := filters.ApplyUpdateFilters(
+		a.BaseQueryUpdate().Set(goqu.Record{
+			"deprecated_at": deprecatedAt,
+			"sunset_at":     sunsetAt,
+			"migration_url": migrationURL,
+			"sunset_action": sunsetAction,
+		}),
+		filters.IsUpdateFilter("id", id),
+	).Returning("*")
 
 	q, args, err := query.ToSQL()
 	if err != nil {
-		logger.Error("error building latest version query: %v", err)
-		return "", err
+		logger.Error("error building update query: %v", err)
+		return model.ApplicationVersion{}, err
 	}
 
-	var versionTag string
-	if err := a.Store.GetContext(ctx, &versionTag, q, args...); err != nil {
-		logger.Error("error getting latest version for app %s: %v", name, err)
-		return "", err
+	var version model.ApplicationVersion
+	if err := a.Store.QueryRowxContext(ctx, q, args...).StructScan(&version); err != nil {
+		logger.Error("error executing update query: %v", err)
+		return model.ApplicationVersion{}, err
 	}
 
 	common.AttachSQLToTrace(ctx, q)
-	return versionTag, nil
+	return version, nil
 }
@@ -8,27 +8,43 @@ import (
 	"github.com/doug-martin/goqu/v9/exp"
 
 	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
 	"github.com/jmoiron/sqlx"
 
+	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/repository/filters"
 	"neploy.dev/pkg/store"
 )
 
 type Repositories struct {
-	Application        *Application
-	ApplicationStat    *ApplicationStat
-	ApplicationVersion *ApplicationVersion
-	Gateway            *Gateway
-	GatewayConfig      *GatewayConfig
-	Metadata           *Metadata
-	Role               *Role
-	TechStack          *TechStack
-	Trace              *Trace
-	User               *User
+	Alert                  *Alert
+	AlertRule              *AlertRule
+	Application            *Application
+	ApplicationStat        *ApplicationStat
+	ApplicationVersion     *ApplicationVersion
+	DeprecatedVersionUsage *DeprecatedVersionUsage
+	EmailOutbox            *EmailOutbox
+	ErrorPage              *ErrorPage
+	Gateway                *Gateway
+	GatewayConfig          *GatewayConfig
+	HealthCheck            *HealthCheck
+	Incident               *Incident
+	IncidentUpdate         *IncidentUpdate
+	L4Route                *L4Route
+	Maintenance            *Maintenance
+	Metadata               *Metadata
+	MirrorSample           *MirrorSample
+	NotificationChannel    *NotificationChannel
+	NotificationDelivery   *NotificationDelivery
+	Role                   *Role
+	StatusPageApplication  *StatusPageApplication
+	TechStack              *TechStack
+	Trace                  *Trace
+	User                   *User
 	// UserOauth removed as part of OAuth refactoring
-	UserRole           *UserRole
-	UserTechStack      *UserTechStack
-	VisitorTrace       *VisitorTrace
+	UserRole      *UserRole
+	UserTechStack *UserTechStack
+	VisitorTrace  *VisitorTrace
 }
 
 var (
@@ -297,3 +313,46 @@ func (b *Base[T]) InsertMany(ctx context.Context, models []T, filters ...filters
 	common.AttachSQLToTrace(ctx, q)
 	return nil, nil
 }
+
+// inTx runs fn in a transaction on db, committing when fn returns nil
+func inTx(ctx context.Context, db store.Queryable, fn func(tx *sqlx.Tx) error) error {
+	conn, ok := db.(*sqlx.DB)
+	if !ok {
+		return errors.New("transaction needs a database connection")
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Error("error starting transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("error committing transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+// execRows runs query on tx and returns the number of rows it affected
+func execRows(ctx context.Context, tx *sqlx.Tx, query exp.SQLExpression) (int64, error) {
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building query: %v", err)
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		logger.Error("error executing query: %v", err)
+		return 0, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return result.RowsAffected()
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/store"
+)
+
+type DeprecatedVersionUsage struct {
+	Base[model.DeprecatedVersionUsage]
+}
+
+func NewDeprecatedVersionUsage(db store.Queryable) *DeprecatedVersionUsage {
+	return &DeprecatedVersionUsage{Base[model.DeprecatedVersionUsage]{Store: db, Table: "deprecated_version_usage"}}
+}
+
+// UpsertBatch adds the requests of usages to those already counted for
+// the same consumer and day
+func (d *DeprecatedVersionUsage) UpsertBatch(ctx context.Context, usages []model.DeprecatedVersionUsage) error {
+	if len(usages) == 0 {
+		return nil
+	}
+
+	query := d.BaseQueryInsert().Rows(usages).OnConflict(goqu.DoUpdate("application_id, version, consumer, day", goqu.Record{
+		"requests":     goqu.L("deprecated_version_usage.requests + EXCLUDED.requests"),
+		"last_seen_at": goqu.L("GREATEST(deprecated_version_usage.last_seen_at, EXCLUDED.last_seen_at)"),
+	}))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building upsert query: %v", err)
+		return err
+	}
+
+	if _, err := d.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing upsert query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
+
+// GetByConsumer sums the requests to the deprecated versions of an
+// application per version and consumer between from and to, the busiest
+// consumers first
+func (d *DeprecatedVersionUsage) GetByConsumer(ctx context.Context, applicationID string, from, to *time.Time) ([]model.ConsumerUsage, error) {
+	query := filters.ApplyFilters(
+		d.baseQuery().
+			Select(
+				goqu.C("version"),
+				goqu.C("consumer"),
+				goqu.SUM("requests").As("requests"),
+				goqu.MIN("day").As("first_seen"),
+				goqu.MAX("last_seen_at").As("last_seen"),
+			).
+			Where(goqu.C("application_id").Eq(applicationID)).
+			GroupBy(goqu.C("version"), goqu.C("consumer")).
+			Order(goqu.C("version").Asc(), goqu.I("requests").Desc()),
+		filters.TimeSelectFilter(from, to, "day"),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	usage := make([]model.ConsumerUsage, 0)
+	if err := d.Store.SelectContext(ctx, &usage, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return usage, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/store"
+)
+
+type EmailOutbox struct {
+	Base[model.OutboxEmail]
+}
+
+func NewEmailOutbox(db store.Queryable) *EmailOutbox {
+	return &EmailOutbox{Base[model.OutboxEmail]{Store: db, Table: "email_outbox"}}
+}
+
+// ClaimDue locks the pending emails whose next attempt is due for lease and
+// returns them, oldest first. Rows another sender holds are skipped, so
+// concurrent callers never get the same email until its lease runs out.
+func (e *EmailOutbox) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit uint) ([]model.OutboxEmail, error) {
+	due := e.baseQuery().
+		Select(goqu.C("id")).
+		Where(
+			goqu.C("status").Eq(model.EmailPending),
+			goqu.C("next_attempt_at").Lte(now),
+			goqu.Or(goqu.C("locked_until").IsNull(), goqu.C("locked_until").Lte(now)),
+		).
+		Order(goqu.C("next_attempt_at").Asc()).
+		Limit(limit).
+		ForUpdate(exp.SkipLocked)
+	query := e.BaseQueryUpdate().
+		Set(goqu.Record{"locked_until": now.Add(lease)}).
+		Where(goqu.C("id").In(due)).
+		Returning("*")
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building update query: %v", err)
+		return nil, err
+	}
+
+	var emails []model.OutboxEmail
+	if err := e.Store.SelectContext(ctx, &emails, q, args...); err != nil {
+		logger.Error("error executing update query: %v", err)
+		return nil, err
+	}
+
+	// RETURNING keeps no order
+	slices.SortFunc(emails, func(a, b model.OutboxEmail) int {
+		return a.NextAttemptAt.Time.Compare(b.NextAttemptAt.Time)
+	})
+
+	common.AttachSQLToTrace(ctx, q)
+	return emails, nil
+}
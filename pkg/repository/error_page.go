@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/doug-martin/goqu/v9"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/store"
+)
+
+type ErrorPage struct {
+	Base[model.ErrorPage]
+}
+
+func NewErrorPage(db store.Queryable) *ErrorPage {
+	return &ErrorPage{Base[model.ErrorPage]{Store: db, Table: "application_error_pages"}}
+}
+
+// Upsert saves the page of its application and status, replacing the one
+// there was
+func (e *ErrorPage) Upsert(ctx context.Context, page model.ErrorPage) (model.ErrorPage, error) {
+	query := e.BaseQueryInsert().Rows(page).
+		OnConflict(goqu.DoUpdate("application_id, status", goqu.Record{
+			"html":       page.HTML,
+			"json":       page.JSON,
+			"deleted_at": nil,
+		})).
+		Returning("*")
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building upsert query: %v", err)
+		return model.ErrorPage{}, err
+	}
+
+	var saved model.ErrorPage
+	if err := e.Store.QueryRowxContext(ctx, q, args...).StructScan(&saved); err != nil {
+		logger.Error("error executing upsert query: %v", err)
+		return model.ErrorPage{}, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return saved, nil
+}
+
+// Delete removes the page, the gateway goes back to its default one
+func (e *ErrorPage) Delete(ctx context.Context, applicationID string, status int) error {
+	query := dialect.Delete(e.Table).Where(goqu.C("application_id").Eq(applicationID), goqu.C("status").Eq(status))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return err
+	}
+
+	if _, err := e.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
+
+func (e *ErrorPage) GetByApplicationID(ctx context.Context, applicationID string) ([]model.ErrorPage, error) {
+	query := e.baseQuery().Where(goqu.C("application_id").Eq(applicationID)).Order(goqu.C("status").Asc())
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var pages []model.ErrorPage
+	if err := e.Store.SelectContext(ctx, &pages, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return pages, nil
+}
+
+type Maintenance struct {
+	Base[model.Maintenance]
+}
+
+func NewMaintenance(db store.Queryable) *Maintenance {
+	return &Maintenance{Base[model.Maintenance]{Store: db, Table: "application_maintenance"}}
+}
+
+// Upsert saves the maintenance settings of an application
+func (m *Maintenance) Upsert(ctx context.Context, maintenance model.Maintenance) (model.Maintenance, error) {
+	query := m.BaseQueryInsert().Rows(maintenance).
+		OnConflict(goqu.DoUpdate("application_id", goqu.Record{
+			"enabled":      maintenance.Enabled,
+			"message":      maintenance.Message,
+			"retry_after":  maintenance.RetryAfter,
+			"allow_ips":    maintenance.AllowIPs,
+			"bypass_token": maintenance.BypassToken,
+			"deleted_at":   nil,
+		})).
+		Returning("*")
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building upsert query: %v", err)
+		return model.Maintenance{}, err
+	}
+
+	var saved model.Maintenance
+	if err := m.Store.QueryRowxContext(ctx, q, args...).StructScan(&saved); err != nil {
+		logger.Error("error executing upsert query: %v", err)
+		return model.Maintenance{}, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return saved, nil
+}
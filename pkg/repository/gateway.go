@@ -152,3 +152,25 @@ func (g *Gateway) GetByPath(ctx context.Context, path string) (model.Gateway, er
 	common.AttachSQLToTrace(ctx, q)
 	return gateway, nil
 }
+
+// SetHealthStatus only touches health_status, so a check never overwrites
+// an edit made to the gateway meanwhile
+func (g *Gateway) SetHealthStatus(ctx context.Context, id, status string) error {
+	query := filters.ApplyUpdateFilters(
+		g.BaseQueryUpdate().Set(goqu.Record{"health_status": status}),
+		filters.IsUpdateFilter("id", id),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building update query: %v", err)
+		return err
+	}
+
+	if _, err := g.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing update query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
@@ -82,6 +82,13 @@ func (g *GatewayConfig) Get(ctx context.Context) (conf model.GatewayConfig, err
 func (g *GatewayConfig) createDefault(ctx context.Context) (conf model.GatewayConfig, err error) {
 	conf, err = g.InsertOne(ctx, model.GatewayConfig{
 		DefaultVersioningType: "headers",
+		ReadTimeout:           model.DefaultReadTimeout,
+		ReadHeaderTimeout:     model.DefaultReadHeaderTimeout,
+		WriteTimeout:          model.DefaultWriteTimeout,
+		IdleTimeout:           model.DefaultIdleTimeout,
+		MaxHeaderBytes:        model.DefaultMaxHeaderBytes,
+		MaxBodyBytes:          model.DefaultMaxBodyBytes,
+		MaxConnsPerIP:         model.DefaultMaxConnsPerIP,
 	})
 
 	return
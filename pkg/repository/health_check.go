@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/store"
+)
+
+type HealthCheck struct {
+	Base[model.HealthCheck]
+}
+
+func NewHealthCheck(db store.Queryable) *HealthCheck {
+	return &HealthCheck{Base[model.HealthCheck]{Store: db, Table: "health_checks"}}
+}
+
+// GetByGatewayID returns the checks of a gateway between from and to, newest first
+func (h *HealthCheck) GetByGatewayID(ctx context.Context, gatewayID string, from, to *time.Time, limit uint) ([]model.HealthCheck, error) {
+	query := filters.ApplyFilters(
+		h.baseQuery().
+			Where(goqu.C("gateway_id").Eq(gatewayID)).
+			Order(goqu.C("checked_at").Desc()),
+		filters.TimeSelectFilter(from, to, "checked_at"),
+		filters.LimitOffsetFilter(limit, 0),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var checks []model.HealthCheck
+	if err := h.Store.SelectContext(ctx, &checks, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return checks, nil
+}
+
+// GetDailyUptime counts the checks and the healthy ones per application and
+// UTC day, of every application when filter has none
+func (h *HealthCheck) GetDailyUptime(ctx context.Context, filter model.StatsFilter) ([]model.UptimeDay, error) {
+	day := goqu.L("(date_trunc('day', checked_at AT TIME ZONE 'UTC'))::date")
+	query := filters.ApplyFilters(
+		h.baseQuery().
+			Select(
+				goqu.C("application_id"),
+				day.As("date"),
+				goqu.COUNT("*").As("checks"),
+				goqu.L("COUNT(*) FILTER (WHERE healthy)").As("healthy"),
+			).
+			GroupBy(goqu.C("application_id"), day).
+			Order(day.Asc()),
+		filters.GenericColumnSelectFilter("application_id", filter.ApplicationID, ""),
+		filters.TimeSelectFilter(filter.From, filter.To, "checked_at"),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var days []model.UptimeDay
+	if err := h.Store.SelectContext(ctx, &days, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return days, nil
+}
+
+// DeleteBefore removes up to limit checks older than before
+func (h *HealthCheck) DeleteBefore(ctx context.Context, before time.Time, limit uint) (int64, error) {
+	query := dialect.Delete(h.Table).Where(goqu.C("id").In(
+		dialect.From(h.Table).Select("id").Where(goqu.C("checked_at").Lt(before)).Limit(limit),
+	))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return 0, err
+	}
+
+	result, err := h.Store.ExecContext(ctx, q, args...)
+	if err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return 0, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return result.RowsAffected()
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/doug-martin/goqu/v9"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/store"
+)
+
+type L4Route struct {
+	Base[model.L4Route]
+}
+
+func NewL4Route(db store.Queryable) *L4Route {
+	return &L4Route{Base[model.L4Route]{Store: db, Table: "l4_routes"}}
+}
+
+func (l *L4Route) Delete(ctx context.Context, id string) error {
+	query := filters.ApplyUpdateFilters(
+		l.BaseQueryUpdate().
+			Set(goqu.Record{"deleted_at": goqu.L("CURRENT_TIMESTAMP")}),
+		filters.IsUpdateFilter("id", id),
+	)
+
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return err
+	}
+
+	if _, err := l.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
+
+// GetByApplicationID returns the routes of an app, all of them when applicationID is empty
+func (l *L4Route) GetByApplicationID(ctx context.Context, applicationID string) ([]model.L4Route, error) {
+	query := filters.ApplyFilters(
+		l.baseQuery().Order(goqu.C("created_at").Asc()),
+		filters.GenericColumnSelectFilter("application_id", applicationID, ""),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var routes []model.L4Route
+	if err := l.Store.SelectContext(ctx, &routes, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return routes, nil
+}
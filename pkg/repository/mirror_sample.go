@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/store"
+)
+
+type MirrorSample struct {
+	Base[model.MirrorSample]
+}
+
+func NewMirrorSample(db store.Queryable) *MirrorSample {
+	return &MirrorSample{Base[model.MirrorSample]{Store: db, Table: "mirror_samples"}}
+}
+
+// InsertBatch stores many samples in one insert
+func (m *MirrorSample) InsertBatch(ctx context.Context, samples []model.MirrorSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	query := m.BaseQueryInsert().Rows(samples)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building insert query: %v", err)
+		return err
+	}
+
+	if _, err := m.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing insert query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
+
+type mirrorSummary struct {
+	Samples          int64   `db:"samples"`
+	StatusMismatches int64   `db:"status_mismatches"`
+	PrimaryErrors    int64   `db:"primary_errors"`
+	PrimaryAvg       float64 `db:"primary_avg"`
+	PrimaryP50       float64 `db:"primary_p50"`
+	PrimaryP95       float64 `db:"primary_p95"`
+	PrimaryP99       float64 `db:"primary_p99"`
+	MirrorErrors     int64   `db:"mirror_errors"`
+	MirrorAvg        float64 `db:"mirror_avg"`
+	MirrorP50        float64 `db:"mirror_p50"`
+	MirrorP95        float64 `db:"mirror_p95"`
+	MirrorP99        float64 `db:"mirror_p99"`
+}
+
+// Compare sums the samples of the candidate version of an application
+// between from and to, both sides' latencies and errors and the status
+// pairs they answered with
+func (m *MirrorSample) Compare(ctx context.Context, applicationID, version string, from, to *time.Time) (model.MirrorComparison, error) {
+	comparison := model.MirrorComparison{ApplicationID: applicationID, Version: version}
+
+	// Latencies of the candidate leave out the requests it failed to answer
+	percentile := func(p float64, column, filter string) exp.LiteralExpression {
+		return goqu.L("COALESCE(percentile_cont(?) WITHIN GROUP (ORDER BY "+column+")"+filter+", 0)", p)
+	}
+	answered := " FILTER (WHERE mirror_status > 0)"
+	query := filters.ApplyFilters(
+		m.baseQuery().
+			Select(
+				goqu.COUNT("*").As("samples"),
+				goqu.L("COUNT(*) FILTER (WHERE primary_status <> mirror_status)").As("status_mismatches"),
+				goqu.L("COUNT(*) FILTER (WHERE primary_status >= 500)").As("primary_errors"),
+				goqu.L("COALESCE(AVG(primary_latency_ms), 0)").As("primary_avg"),
+				percentile(0.5, "primary_latency_ms", "").As("primary_p50"),
+				percentile(0.95, "primary_latency_ms", "").As("primary_p95"),
+				percentile(0.99, "primary_latency_ms", "").As("primary_p99"),
+				goqu.L("COUNT(*) FILTER (WHERE mirror_status = 0 OR mirror_status >= 500)").As("mirror_errors"),
+				goqu.L("COALESCE(AVG(mirror_latency_ms)"+answered+", 0)").As("mirror_avg"),
+				percentile(0.5, "mirror_latency_ms", answered).As("mirror_p50"),
+				percentile(0.95, "mirror_latency_ms", answered).As("mirror_p95"),
+				percentile(0.99, "mirror_latency_ms", answered).As("mirror_p99"),
+			).
+			Where(goqu.C("application_id").Eq(applicationID), goqu.C("version").Eq(version)),
+		filters.TimeSelectFilter(from, to, "sampled_at"),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return comparison, err
+	}
+
+	var summary mirrorSummary
+	if err := m.Store.GetContext(ctx, &summary, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return comparison, err
+	}
+	common.AttachSQLToTrace(ctx, q)
+
+	comparison.Samples = summary.Samples
+	comparison.StatusMismatches = summary.StatusMismatches
+	comparison.Primary = model.MirrorSide{
+		Errors:       summary.PrimaryErrors,
+		AvgLatencyMs: summary.PrimaryAvg,
+		P50LatencyMs: summary.PrimaryP50,
+		P95LatencyMs: summary.PrimaryP95,
+		P99LatencyMs: summary.PrimaryP99,
+	}
+	comparison.Mirror = model.MirrorSide{
+		Errors:       summary.MirrorErrors,
+		AvgLatencyMs: summary.MirrorAvg,
+		P50LatencyMs: summary.MirrorP50,
+		P95LatencyMs: summary.MirrorP95,
+		P99LatencyMs: summary.MirrorP99,
+	}
+
+	pairs := filters.ApplyFilters(
+		m.baseQuery().
+			Select(goqu.C("primary_status"), goqu.C("mirror_status"), goqu.COUNT("*").As("count")).
+			Where(goqu.C("application_id").Eq(applicationID), goqu.C("version").Eq(version)).
+			GroupBy(goqu.C("primary_status"), goqu.C("mirror_status")).
+			Order(goqu.I("count").Desc()),
+		filters.TimeSelectFilter(from, to, "sampled_at"),
+	)
+	q, args, err = pairs.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return comparison, err
+	}
+
+	comparison.Statuses = make([]model.MirrorStatusPair, 0)
+	if err := m.Store.SelectContext(ctx, &comparison.Statuses, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return comparison, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return comparison, nil
+}
+
+// GetRecent returns the last limit samples of the candidate version of an
+// application, newest first
+func (m *MirrorSample) GetRecent(ctx context.Context, applicationID, version string, limit uint) ([]model.MirrorSample, error) {
+	query := m.baseQuery().
+		Where(goqu.C("application_id").Eq(applicationID), goqu.C("version").Eq(version)).
+		Order(goqu.C("sampled_at").Desc()).
+		Limit(limit)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	samples := make([]model.MirrorSample, 0)
+	if err := m.Store.SelectContext(ctx, &samples, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return samples, nil
+}
+
+// DeleteBefore removes up to limit samples older than before
+func (m *MirrorSample) DeleteBefore(ctx context.Context, before time.Time, limit uint) (int64, error) {
+	query := dialect.Delete(m.Table).Where(goqu.C("id").In(
+		dialect.From(m.Table).Select("id").Where(goqu.C("sampled_at").Lt(before)).Limit(limit),
+	))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return 0, err
+	}
+
+	result, err := m.Store.ExecContext(ctx, q, args...)
+	if err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return 0, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return result.RowsAffected()
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/store"
+)
+
+type NotificationChannel struct {
+	Base[model.NotificationChannel]
+}
+
+func NewNotificationChannel(db store.Queryable) *NotificationChannel {
+	return &NotificationChannel{Base[model.NotificationChannel]{Store: db, Table: "notification_channels"}}
+}
+
+func (n *NotificationChannel) Delete(ctx context.Context, id string) error {
+	query := filters.ApplyUpdateFilters(
+		n.BaseQueryUpdate().
+			Set(goqu.Record{"deleted_at": goqu.L("CURRENT_TIMESTAMP")}),
+		filters.IsUpdateFilter("id", id),
+	)
+
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return err
+	}
+
+	if _, err := n.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
+
+type NotificationDelivery struct {
+	Base[model.NotificationDelivery]
+}
+
+func NewNotificationDelivery(db store.Queryable) *NotificationDelivery {
+	return &NotificationDelivery{Base[model.NotificationDelivery]{Store: db, Table: "notification_deliveries"}}
+}
+
+// ClaimDue locks the pending deliveries whose next attempt is due for lease
+// and returns them, oldest first. Rows another sender holds are skipped, so
+// concurrent callers never get the same delivery until its lease runs out.
+func (n *NotificationDelivery) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit uint) ([]model.NotificationDelivery, error) {
+	due := n.baseQuery().
+		Select(goqu.C("id")).
+		Where(
+			goqu.C("status").Eq(model.DeliveryPending),
+			goqu.C("next_attempt_at").Lte(now),
+			goqu.Or(goqu.C("locked_until").IsNull(), goqu.C("locked_until").Lte(now)),
+		).
+		Order(goqu.C("next_attempt_at").Asc()).
+		Limit(limit).
+		ForUpdate(exp.SkipLocked)
+	query := n.BaseQueryUpdate().
+		Set(goqu.Record{"locked_until": now.Add(lease)}).
+		Where(goqu.C("id").In(due)).
+		Returning("*")
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building update query: %v", err)
+		return nil, err
+	}
+
+	var deliveries []model.NotificationDelivery
+	if err := n.Store.SelectContext(ctx, &deliveries, q, args...); err != nil {
+		logger.Error("error executing update query: %v", err)
+		return nil, err
+	}
+
+	// RETURNING keeps no order
+	slices.SortFunc(deliveries, func(a, b model.NotificationDelivery) int {
+		return a.NextAttemptAt.Time.Compare(b.NextAttemptAt.Time)
+	})
+
+	common.AttachSQLToTrace(ctx, q)
+	return deliveries, nil
+}
+
+// GetLog returns the deliveries matching filter, newest first
+func (n *NotificationDelivery) GetLog(ctx context.Context, filter model.NotificationDeliveryFilter, limit uint) ([]model.NotificationDelivery, error) {
+	query := filters.ApplyFilters(
+		n.baseQuery().Order(goqu.C("created_at").Desc()),
+		filters.GenericColumnSelectFilter("channel_id", filter.ChannelID, ""),
+		filters.GenericColumnSelectFilter("status", string(filter.Status), ""),
+		filters.TimeSelectFilter(filter.From, filter.To, "created_at"),
+		filters.LimitOffsetFilter(limit, 0),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var deliveries []model.NotificationDelivery
+	if err := n.Store.SelectContext(ctx, &deliveries, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return deliveries, nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+	"neploy.dev/pkg/common"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository/filters"
+	"neploy.dev/pkg/store"
+)
+
+type StatusPageApplication struct {
+	Base[model.StatusPageApplication]
+}
+
+func NewStatusPageApplication(db store.Queryable) *StatusPageApplication {
+	return &StatusPageApplication{Base[model.StatusPageApplication]{Store: db, Table: "status_page_applications"}}
+}
+
+// GetOrdered returns the listed applications in position order
+func (s *StatusPageApplication) GetOrdered(ctx context.Context) ([]model.StatusPageApplication, error) {
+	q, args, err := s.baseQuery().Order(goqu.C("position").Asc()).ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var apps []model.StatusPageApplication
+	if err := s.Store.SelectContext(ctx, &apps, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return apps, nil
+}
+
+// Replace swaps the listed applications for apps in one transaction
+func (s *StatusPageApplication) Replace(ctx context.Context, apps []model.StatusPageApplication) error {
+	return inTx(ctx, s.Store, func(tx *sqlx.Tx) error {
+		if _, err := execRows(ctx, tx, dialect.Delete(s.Table)); err != nil {
+			return err
+		}
+		if len(apps) == 0 {
+			return nil
+		}
+		_, err := execRows(ctx, tx, s.BaseQueryInsert().Rows(apps))
+		return err
+	})
+}
+
+type Incident struct {
+	Base[model.Incident]
+}
+
+func NewIncident(db store.Queryable) *Incident {
+	return &Incident{Base[model.Incident]{Store: db, Table: "incidents"}}
+}
+
+// GetOpenOrSince returns the unresolved incidents and the ones that started
+// after since, newest first
+func (i *Incident) GetOpenOrSince(ctx context.Context, since time.Time) ([]model.Incident, error) {
+	query := i.baseQuery().
+		Where(goqu.Or(
+			goqu.C("resolved_at").IsNull(),
+			goqu.C("started_at").Gte(since),
+		)).
+		Order(goqu.C("started_at").Desc())
+	return i.selectIncidents(ctx, query)
+}
+
+// GetInRange returns the incidents that overlap from and to, newest first.
+// Platform wide incidents are included when filtering by application.
+func (i *Incident) GetInRange(ctx context.Context, applicationID string, from, to time.Time) ([]model.Incident, error) {
+	query := i.baseQuery().
+		Where(
+			goqu.C("started_at").Lt(to),
+			goqu.Or(goqu.C("resolved_at").IsNull(), goqu.C("resolved_at").Gte(from)),
+		).
+		Order(goqu.C("started_at").Desc())
+	if applicationID != "" {
+		query = query.Where(goqu.Or(
+			goqu.C("application_id").Eq(applicationID),
+			goqu.C("application_id").IsNull(),
+		))
+	}
+	return i.selectIncidents(ctx, query)
+}
+
+func (i *Incident) selectIncidents(ctx context.Context, query *goqu.SelectDataset) ([]model.Incident, error) {
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var incidents []model.Incident
+	if err := i.Store.SelectContext(ctx, &incidents, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return incidents, nil
+}
+
+func (i *Incident) Delete(ctx context.Context, id string) error {
+	query := filters.ApplyUpdateFilters(
+		i.BaseQueryUpdate().
+			Set(goqu.Record{"deleted_at": goqu.L("CURRENT_TIMESTAMP")}),
+		filters.IsUpdateFilter("id", id),
+	)
+
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return err
+	}
+
+	if _, err := i.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
+
+type IncidentUpdate struct {
+	Base[model.IncidentUpdate]
+}
+
+func NewIncidentUpdate(db store.Queryable) *IncidentUpdate {
+	return &IncidentUpdate{Base[model.IncidentUpdate]{Store: db, Table: "incident_updates"}}
+}
+
+// GetByIncidentIDs returns the updates of the given incidents, newest first
+func (i *IncidentUpdate) GetByIncidentIDs(ctx context.Context, ids []string) ([]model.IncidentUpdate, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query := filters.ApplyFilters(
+		i.baseQuery().Order(goqu.C("created_at").Desc()),
+		filters.InSelectFilter("incident_id", ids),
+	)
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var updates []model.IncidentUpdate
+	if err := i.Store.SelectContext(ctx, &updates, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return updates, nil
+}
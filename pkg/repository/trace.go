@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"time"
+
 	"neploy.dev/pkg/common"
 
 	"github.com/doug-martin/goqu/v9"
@@ -93,24 +95,63 @@ func (t *Trace) GetByID(ctx context.Context, id string) (model.Trace, error) {
 	return trace, nil
 }
 
-func (t *Trace) GetAll(ctx context.Context) ([]model.Trace, error) {
-	query := t.baseQuery()
+// GetAll returns the newest traces first with the email of their user, at
+// most limit of them unless limit is 0
+func (t *Trace) GetAll(ctx context.Context, limit uint) ([]model.Trace, error) {
+	query := filters.ApplyFilters(
+		t.baseQuery("t").
+			Select(goqu.I("t.*"), goqu.COALESCE(goqu.I("u.email"), "").As("email")).
+			LeftJoin(goqu.T("users").As("u"), goqu.On(goqu.I("u.id").Eq(goqu.I("t.user_id")))).
+			Order(goqu.I("t.created_at").Desc()),
+		filters.LimitOffsetFilter(limit, 0),
+	)
 	q, args, err := query.ToSQL()
 	if err != nil {
 		logger.Error("error building select query: %v", err)
 		return nil, err
 	}
 
-	var traces []model.Trace
-	if err := t.Store.SelectContext(ctx, &traces, q, args...); err != nil {
+	var rows []struct {
+		model.Trace
+		Email string `db:"email"`
+	}
+	if err := t.Store.SelectContext(ctx, &rows, q, args...); err != nil {
 		logger.Error("error executing select query: %v", err)
 		return nil, err
 	}
 
+	traces := make([]model.Trace, len(rows))
+	for i, row := range rows {
+		traces[i] = row.Trace
+		traces[i].Email = row.Email
+	}
+
 	common.AttachSQLToTrace(ctx, q)
 	return traces, nil
 }
 
+// DeleteBefore hard deletes up to limit traces created before before and
+// returns how many were deleted, so large purges run in short statements
+func (t *Trace) DeleteBefore(ctx context.Context, before time.Time, limit uint) (int64, error) {
+	query := dialect.Delete(t.Table).Where(goqu.C("id").In(
+		dialect.From(t.Table).Select("id").Where(goqu.C("created_at").Lt(before)).Limit(limit),
+	))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building delete query: %v", err)
+		return 0, err
+	}
+
+	result, err := t.Store.ExecContext(ctx, q, args...)
+	if err != nil {
+		logger.Error("error executing delete query: %v", err)
+		return 0, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return result.RowsAffected()
+}
+
 func (t *Trace) GetByUserID(ctx context.Context, userID string) ([]model.Trace, error) {
 	query := t.baseQuery().Where(goqu.Ex{"user_id": userID})
 	q, args, err := query.ToSQL()
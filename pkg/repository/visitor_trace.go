@@ -2,9 +2,13 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"time"
+
 	"neploy.dev/pkg/common"
 
 	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
 	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository/filters"
@@ -129,38 +133,46 @@ func (v *VisitorTrace) GetByVisitorID(ctx context.Context, visitorID string) ([]
 	return visitorTraces, nil
 }
 
-func (v *VisitorTrace) Create(ctx context.Context, visitorTrace model.VisitorTrace, resolvedVersion string) (model.VisitorTrace, error) {
-	exists, err := NewApplicationVersion(v.Store).ExistsByName(ctx, visitorTrace.ApplicationID, resolvedVersion)
-	if err != nil || !exists {
-		logger.Error("error checking application version existence %v", err)
-		return model.VisitorTrace{}, err
+// InsertBatch stores many traces in one insert
+func (v *VisitorTrace) InsertBatch(ctx context.Context, visitorTraces []model.VisitorTrace) error {
+	if len(visitorTraces) == 0 {
+		return nil
 	}
 
-	gateway, err := NewGateway(v.Store).GetByPath(ctx, visitorTrace.ApplicationID)
+	query := v.BaseQueryInsert().Rows(visitorTraces)
+	q, args, err := query.ToSQL()
 	if err != nil {
-		logger.Error("error getting application by name %v", err)
-		return model.VisitorTrace{}, err
+		logger.Error("error building insert query: %v", err)
+		return err
 	}
 
-	visitorTrace.ApplicationID = gateway.ApplicationID
-	trace, err := v.InsertOne(ctx, visitorTrace)
-	if err != nil {
-		logger.Error("error inserting visitor trace %v", err)
+	if _, err := v.Store.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("error executing insert query: %v", err)
+		return err
 	}
 
-	return trace, err
+	common.AttachSQLToTrace(ctx, q)
+	return nil
 }
 
 func (v *VisitorTrace) GetTraces(ctx context.Context) ([]model.VisitorStat, error) {
-	query := v.baseQuery()
-
-	query = query.Select(
-		goqu.COUNT(goqu.DISTINCT(goqu.C("id"))).As("amount"),
-		goqu.L("DATE(visit_timestamp)").As("date"),
-		goqu.C("application_id").As("application_id"),
-	).
-		GroupBy(goqu.L("DATE(visit_timestamp)"), goqu.C("application_id")).
-		Order(goqu.L("DATE(visit_timestamp)").Asc()).
+	raw := v.baseQuery().
+		Select(
+			goqu.COUNT(goqu.DISTINCT(goqu.C("id"))).As("amount"),
+			goqu.L("DATE(visit_timestamp)").As("date"),
+			goqu.C("application_id").As("application_id"),
+		).
+		GroupBy(goqu.L("DATE(visit_timestamp)"), goqu.C("application_id"))
+	daily := dialect.From(visitorStatsDaily).
+		Select(
+			goqu.SUM("page_views").As("amount"),
+			goqu.C("date"),
+			goqu.C("application_id"),
+		).
+		GroupBy(goqu.C("date"), goqu.C("application_id"))
+
+	query := dialect.From(raw.UnionAll(daily).As("t")).
+		Order(goqu.C("date").Asc()).
 		Limit(1000)
 
 	q, args, err := query.ToSQL()
@@ -178,3 +190,311 @@ func (v *VisitorTrace) GetTraces(ctx context.Context) ([]model.VisitorStat, erro
 	common.AttachSQLToTrace(ctx, q)
 	return visitorTraces, nil
 }
+
+// Tables keeping daily visitor aggregates once raw traces are purged
+const (
+	visitorStatsDaily = "visitor_stats_daily"
+	visitorPagesDaily = "visitor_pages_daily"
+)
+
+// Oldest returns the timestamp of the oldest trace, nil when there is none
+func (v *VisitorTrace) Oldest(ctx context.Context) (*time.Time, error) {
+	query := dialect.From(v.Table).Select(goqu.MIN("visit_timestamp"))
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return nil, err
+	}
+
+	var oldest sql.NullTime
+	if err := v.Store.GetContext(ctx, &oldest, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return nil, err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	if !oldest.Valid {
+		return nil, nil
+	}
+	return &oldest.Time, nil
+}
+
+// RollupDay aggregates the traces of the UTC day starting at day into the
+// daily visitor tables and deletes them, in one transaction
+func (v *VisitorTrace) RollupDay(ctx context.Context, day time.Time) (model.RetentionResult, error) {
+	date := goqu.L("DATE(visit_timestamp AT TIME ZONE 'UTC')")
+	inDay := []goqu.Expression{
+		goqu.C("visit_timestamp").Gte(day),
+		goqu.C("visit_timestamp").Lt(day.AddDate(0, 0, 1)),
+	}
+	traces := v.baseQuery().Where(inDay...).Where(goqu.C("application_id").IsNotNull())
+
+	stats := dialect.Insert(visitorStatsDaily).
+		Cols("application_id", "version", "date", "page_views", "visitors", "sessions").
+		FromQuery(traces.
+			Select(
+				goqu.C("application_id"), goqu.C("version"), date,
+				goqu.COUNT(goqu.Star()),
+				goqu.COUNT(goqu.DISTINCT(goqu.L("NULLIF(visitor_id, '')"))),
+				goqu.COUNT(goqu.DISTINCT(goqu.L("NULLIF(session_id, '')"))),
+			).
+			GroupBy(goqu.C("application_id"), goqu.C("version"), date)).
+		OnConflict(goqu.DoUpdate("application_id, version, date", goqu.Record{
+			"page_views": goqu.L(visitorStatsDaily + ".page_views + EXCLUDED.page_views"),
+			"visitors":   goqu.L(visitorStatsDaily + ".visitors + EXCLUDED.visitors"),
+			"sessions":   goqu.L(visitorStatsDaily + ".sessions + EXCLUDED.sessions"),
+		}))
+
+	pages := dialect.Insert(visitorPagesDaily).
+		Cols("application_id", "version", "date", "page", "views", "visitors").
+		FromQuery(traces.
+			Select(
+				goqu.C("application_id"), goqu.C("version"), date, goqu.C("page_visited"),
+				goqu.COUNT(goqu.Star()),
+				goqu.COUNT(goqu.DISTINCT(goqu.L("NULLIF(visitor_id, '')"))),
+			).
+			GroupBy(goqu.C("application_id"), goqu.C("version"), date, goqu.C("page_visited"))).
+		OnConflict(goqu.DoUpdate("application_id, version, date, page", goqu.Record{
+			"views":    goqu.L(visitorPagesDaily + ".views + EXCLUDED.views"),
+			"visitors": goqu.L(visitorPagesDaily + ".visitors + EXCLUDED.visitors"),
+		}))
+
+	result := model.RetentionResult{Table: v.Table, Action: model.RetentionRolledUp}
+	err := inTx(ctx, v.Store, func(tx *sqlx.Tx) error {
+		for _, insert := range []*goqu.InsertDataset{stats, pages} {
+			if _, err := execRows(ctx, tx, insert); err != nil {
+				return err
+			}
+		}
+
+		rows, err := execRows(ctx, tx, dialect.Delete(v.Table).Where(inDay...))
+		result.Rows = rows
+		return err
+	})
+	return result, err
+}
+
+// reportTopN is how many pages or referrers the reports keep per group
+const reportTopN = 10
+
+func (v *VisitorTrace) reportQuery(filter model.StatsFilter) *goqu.SelectDataset {
+	return filters.ApplyFilters(v.baseQuery(), statsFilters(filter, "visit_timestamp")...)
+}
+
+// GetUniqueVisitors counts distinct visitors per app and day. Days already
+// rolled up sum the visitors of each version, so someone who saw two
+// versions that day counts twice.
+func (v *VisitorTrace) GetUniqueVisitors(ctx context.Context, filter model.StatsFilter) ([]model.DailyVisitors, error) {
+	raw := v.reportQuery(filter).
+		Select(
+			goqu.L("DATE(visit_timestamp)").As("date"),
+			goqu.C("application_id"),
+			goqu.COUNT(goqu.DISTINCT("visitor_id")).As("visitors"),
+		).
+		Where(goqu.C("visitor_id").Neq("")).
+		GroupBy(goqu.L("DATE(visit_timestamp)"), goqu.C("application_id"))
+	daily := filters.ApplyFilters(dialect.From(visitorStatsDaily), statsFilters(filter, "date")...).
+		Select(
+			goqu.C("date"),
+			goqu.C("application_id"),
+			goqu.SUM("visitors").As("visitors"),
+		).
+		GroupBy(goqu.C("date"), goqu.C("application_id"))
+
+	query := dialect.From(raw.UnionAll(daily).As("v")).
+		Order(goqu.C("date").Asc())
+
+	var visitors []model.DailyVisitors
+	return visitors, v.selectReport(ctx, query, &visitors)
+}
+
+// GetSessionStats summarizes the sessions of each app
+func (v *VisitorTrace) GetSessionStats(ctx context.Context, filter model.StatsFilter) ([]model.SessionStats, error) {
+	sessions := v.reportQuery(filter).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("session_id"),
+			goqu.MIN("visit_timestamp").As("started"),
+			goqu.MAX("visit_timestamp").As("ended"),
+			goqu.COUNT(goqu.Star()).As("pages"),
+		).
+		Where(goqu.C("session_id").Neq("")).
+		GroupBy(goqu.C("application_id"), goqu.C("session_id"))
+
+	query := dialect.From(sessions.As("s")).
+		Select(
+			goqu.C("application_id"),
+			goqu.COUNT(goqu.Star()).As("sessions"),
+			goqu.L("COALESCE(AVG(EXTRACT(EPOCH FROM ended - started)), 0)").As("avg_duration"),
+			goqu.L("COALESCE(AVG(pages), 0)").As("pages_per_session"),
+			goqu.L("COALESCE(AVG(CASE WHEN pages = 1 THEN 1.0 ELSE 0 END), 0)").As("bounce_rate"),
+		).
+		GroupBy(goqu.C("application_id"))
+
+	var stats []model.SessionStats
+	return stats, v.selectReport(ctx, query, &stats)
+}
+
+// GetTopPages returns the most visited pages of each app and version. For
+// rolled up days visitors are summed per day rather than counted once.
+func (v *VisitorTrace) GetTopPages(ctx context.Context, filter model.StatsFilter) ([]model.PageCount, error) {
+	raw := v.reportQuery(filter).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("version"),
+			goqu.C("page_visited").As("page"),
+			goqu.COUNT(goqu.Star()).As("views"),
+			goqu.COUNT(goqu.DISTINCT("visitor_id")).As("visitors"),
+		).
+		GroupBy(goqu.C("application_id"), goqu.C("version"), goqu.C("page_visited"))
+	daily := filters.ApplyFilters(dialect.From(visitorPagesDaily), statsFilters(filter, "date")...).
+		Select("application_id", "version", "page", "views", "visitors")
+
+	ranked := dialect.From(raw.UnionAll(daily).As("u")).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("version"),
+			goqu.C("page"),
+			goqu.SUM("views").As("views"),
+			goqu.SUM("visitors").As("visitors"),
+			goqu.ROW_NUMBER().Over(goqu.W().
+				PartitionBy("application_id", "version").
+				OrderBy(goqu.SUM("views").Desc())).As("rank"),
+		).
+		GroupBy(goqu.C("application_id"), goqu.C("version"), goqu.C("page"))
+
+	query := dialect.From(ranked.As("p")).
+		Select("application_id", "version", "page", "views", "visitors").
+		Where(goqu.C("rank").Lte(reportTopN)).
+		Order(goqu.C("application_id").Asc(), goqu.C("version").Asc(), goqu.C("views").Desc())
+
+	var pages []model.PageCount
+	return pages, v.selectReport(ctx, query, &pages)
+}
+
+// GetEntryPages returns the pages sessions start on most often
+func (v *VisitorTrace) GetEntryPages(ctx context.Context, filter model.StatsFilter) ([]model.PageCount, error) {
+	return v.getSessionEdgePages(ctx, filter, true)
+}
+
+// GetExitPages returns the pages sessions end on most often
+func (v *VisitorTrace) GetExitPages(ctx context.Context, filter model.StatsFilter) ([]model.PageCount, error) {
+	return v.getSessionEdgePages(ctx, filter, false)
+}
+
+func (v *VisitorTrace) getSessionEdgePages(ctx context.Context, filter model.StatsFilter, first bool) ([]model.PageCount, error) {
+	order := goqu.C("visit_timestamp").Desc()
+	if first {
+		order = goqu.C("visit_timestamp").Asc()
+	}
+
+	positioned := v.reportQuery(filter).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("page_visited"),
+			goqu.ROW_NUMBER().Over(goqu.W().PartitionBy("session_id").OrderBy(order)).As("position"),
+		).
+		Where(goqu.C("session_id").Neq(""))
+
+	ranked := dialect.From(positioned.As("s")).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("page_visited").As("page"),
+			goqu.COUNT(goqu.Star()).As("views"),
+			goqu.ROW_NUMBER().Over(goqu.W().
+				PartitionBy("application_id").
+				OrderBy(goqu.COUNT(goqu.Star()).Desc())).As("rank"),
+		).
+		Where(goqu.C("position").Eq(1)).
+		GroupBy(goqu.C("application_id"), goqu.C("page_visited"))
+
+	query := dialect.From(ranked.As("p")).
+		Select("application_id", "page", "views").
+		Where(goqu.C("rank").Lte(reportTopN)).
+		Order(goqu.C("application_id").Asc(), goqu.C("views").Desc())
+
+	var pages []model.PageCount
+	return pages, v.selectReport(ctx, query, &pages)
+}
+
+// GetReferrers returns the external sites that bring most sessions to each app
+func (v *VisitorTrace) GetReferrers(ctx context.Context, filter model.StatsFilter) ([]model.ReferrerCount, error) {
+	ranked := v.reportQuery(filter).
+		Select(
+			goqu.C("application_id"),
+			goqu.C("referrer"),
+			goqu.COUNT(goqu.DISTINCT("session_id")).As("sessions"),
+			goqu.ROW_NUMBER().Over(goqu.W().
+				PartitionBy("application_id").
+				OrderBy(goqu.COUNT(goqu.DISTINCT("session_id")).Desc())).As("rank"),
+		).
+		Where(goqu.C("referrer").Neq("")).
+		GroupBy(goqu.C("application_id"), goqu.C("referrer"))
+
+	query := dialect.From(ranked.As("r")).
+		Select("application_id", "referrer", "sessions").
+		Where(goqu.C("rank").Lte(reportTopN)).
+		Order(goqu.C("application_id").Asc(), goqu.C("sessions").Desc())
+
+	var referrers []model.ReferrerCount
+	return referrers, v.selectReport(ctx, query, &referrers)
+}
+
+// GetCountries returns the countries most visitors of each app come from
+func (v *VisitorTrace) GetCountries(ctx context.Context, filter model.StatsFilter) ([]model.LocationCount, error) {
+	var countries []model.LocationCount
+	return countries, v.selectTopByVisitors(ctx, filter, goqu.C("country").Neq(""), &countries, "country")
+}
+
+// GetCities returns the cities most visitors of each app come from
+func (v *VisitorTrace) GetCities(ctx context.Context, filter model.StatsFilter) ([]model.LocationCount, error) {
+	var cities []model.LocationCount
+	return cities, v.selectTopByVisitors(ctx, filter, goqu.C("city").Neq(""), &cities, "country", "region", "city")
+}
+
+// GetNetworks returns the autonomous systems most visitors of each app come from
+func (v *VisitorTrace) GetNetworks(ctx context.Context, filter model.StatsFilter) ([]model.NetworkCount, error) {
+	var networks []model.NetworkCount
+	return networks, v.selectTopByVisitors(ctx, filter, goqu.C("asn").Neq(0), &networks, "asn", "as_org")
+}
+
+// selectTopByVisitors groups traces by columns and keeps the groups with the
+// most distinct visitors per app
+func (v *VisitorTrace) selectTopByVisitors(ctx context.Context, filter model.StatsFilter, known goqu.Expression, dest interface{}, columns ...string) error {
+	grouping := []interface{}{goqu.C("application_id")}
+	for _, column := range columns {
+		grouping = append(grouping, goqu.C(column))
+	}
+	visitors := goqu.COUNT(goqu.DISTINCT("visitor_id"))
+
+	ranked := v.reportQuery(filter).
+		Select(append(grouping,
+			visitors.As("visitors"),
+			goqu.ROW_NUMBER().Over(goqu.W().PartitionBy("application_id").OrderBy(visitors.Desc())).As("rank"),
+		)...).
+		Where(known).
+		GroupBy(grouping...)
+
+	query := dialect.From(ranked.As("l")).
+		Select(append(grouping, goqu.C("visitors"))...).
+		Where(goqu.C("rank").Lte(reportTopN)).
+		Order(goqu.C("application_id").Asc(), goqu.C("visitors").Desc())
+
+	return v.selectReport(ctx, query, dest)
+}
+
+func (v *VisitorTrace) selectReport(ctx context.Context, query *goqu.SelectDataset, dest interface{}) error {
+	q, args, err := query.ToSQL()
+	if err != nil {
+		logger.Error("error building select query: %v", err)
+		return err
+	}
+
+	if err := v.Store.SelectContext(ctx, dest, q, args...); err != nil {
+		logger.Error("error executing select query: %v", err)
+		return err
+	}
+
+	common.AttachSQLToTrace(ctx, q)
+	return nil
+}
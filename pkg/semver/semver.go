@@ -0,0 +1,296 @@
+// Package semver parses and orders version tags as semantic versions and
+// matches them against ranges. Tags may carry a leading v and leave out
+// the minor and patch, v1 is v1.0.0.
+package semver
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string // dot separated identifiers, empty for a release
+	Build      string   // ignored when ordering
+
+	// parts is how many of major, minor and patch the tag spelled out
+	parts int
+}
+
+var errInvalid = errors.New("not a semantic version")
+
+// Parse parses tag, like v1.2.3, 1.2.3-rc.1+build.5, v1.2 or v1
+func Parse(tag string) (Version, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+
+	var v Version
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		v.Build = s[i+1:]
+		if !validIdentifiers(v.Build, false) {
+			return Version{}, errInvalid
+		}
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if !validIdentifiers(s[i+1:], true) {
+			return Version{}, errInvalid
+		}
+		v.Prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+
+	core := strings.Split(s, ".")
+	if len(core) > 3 {
+		return Version{}, errInvalid
+	}
+	numbers := [3]*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range core {
+		n, ok := parseNumber(part)
+		if !ok {
+			return Version{}, errInvalid
+		}
+		*numbers[i] = n
+	}
+	v.parts = len(core)
+	return v, nil
+}
+
+// Valid reports whether tag parses
+func Valid(tag string) bool {
+	_, err := Parse(tag)
+	return err == nil
+}
+
+func parseNumber(s string) (uint64, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	return n, err == nil
+}
+
+// validIdentifiers checks dot separated pre-release or build identifiers,
+// numeric pre-release ones can't have leading zeros
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		numeric := true
+		for _, c := range id {
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+		if prerelease && numeric && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPrerelease reports whether v is a pre-release, like 2.0.0-rc.1
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+func (v Version) String() string {
+	s := strconv.FormatUint(v.Major, 10) + "." + strconv.FormatUint(v.Minor, 10) + "." + strconv.FormatUint(v.Patch, 10)
+	if v.IsPrerelease() {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v orders before, with or after o. A
+// pre-release orders before its release, build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	if c := compareNumber(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareNumber(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareNumber(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	switch {
+	case !v.IsPrerelease() && !o.IsPrerelease():
+		return 0
+	case !v.IsPrerelease():
+		return 1
+	case !o.IsPrerelease():
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := compareIdentifier(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareNumber(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+func compareNumber(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifier orders numeric identifiers numerically and before
+// alphanumeric ones, which order by ASCII
+func compareIdentifier(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareNumber(an, bn)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Sort orders tags highest first. Tags that don't parse go last and keep
+// their order.
+func Sort(tags []string) {
+	SortFunc(tags, func(tag string) string { return tag })
+}
+
+// SortFunc orders items by their tag like Sort
+func SortFunc[T any](items []T, tag func(T) string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, aErr := Parse(tag(items[i]))
+		b, bErr := Parse(tag(items[j]))
+		if aErr != nil || bErr != nil {
+			return aErr == nil && bErr != nil
+		}
+		return a.Compare(b) > 0
+	})
+}
+
+// Latest returns the highest release in tags, or the highest pre-release
+// when there are only pre-releases. false when no tag parses.
+func Latest(tags []string) (string, bool) {
+	var latest string
+	var best Version
+	found := false
+	for _, tag := range tags {
+		v, err := Parse(tag)
+		if err != nil {
+			continue
+		}
+		if !found || betterLatest(v, best) {
+			latest, best, found = tag, v, true
+		}
+	}
+	return latest, found
+}
+
+// betterLatest reports whether v is a better latest than best: releases
+// win over pre-releases, then the highest wins
+func betterLatest(v, best Version) bool {
+	if v.IsPrerelease() != best.IsPrerelease() {
+		return !v.IsPrerelease()
+	}
+	return v.Compare(best) > 0
+}
+
+// Range is a set of versions asked for by a partial version, a tilde or a
+// caret range:
+//
+//	1, 1.x, ~1  >=1.0.0 <2.0.0
+//	1.2, ~1.2   >=1.2.0 <1.3.0
+//	1.2.3       exactly 1.2.3
+//	~1.2.3      >=1.2.3 <1.3.0
+//	^2          >=2.0.0 <3.0.0
+//	^1.2.3      >=1.2.3 <2.0.0
+//	^0.2.3      >=0.2.3 <0.3.0
+//
+// Pre-releases are only in a range whose lower bound is a pre-release of
+// the same major, minor and patch, like ^2.0.0-rc.1.
+type Range struct {
+	min   Version // inclusive
+	max   Version // exclusive
+	exact bool
+}
+
+// ParseRange parses s as a Range, the versions in it may carry a leading v
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	op := ""
+	if strings.HasPrefix(s, "~") || strings.HasPrefix(s, "^") {
+		op, s = s[:1], strings.TrimSpace(s[1:])
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, ".x"), ".*")
+
+	v, err := Parse(s)
+	if err != nil {
+		return Range{}, err
+	}
+	if v.IsPrerelease() && v.parts < 3 {
+		return Range{}, errors.New("a pre-release range needs a full version")
+	}
+	v.Build = ""
+
+	r := Range{min: v}
+	switch {
+	case op == "" && v.parts == 3:
+		r.exact = true
+	case op == "^" && v.Major == 0 && v.parts == 3 && v.Minor == 0:
+		r.max = Version{Patch: v.Patch + 1}
+	case op == "^" && v.Major == 0 && v.parts >= 2:
+		r.max = Version{Minor: v.Minor + 1}
+	case op == "^" || v.parts == 1:
+		r.max = Version{Major: v.Major + 1}
+	default:
+		r.max = Version{Major: v.Major, Minor: v.Minor + 1}
+	}
+	return r, nil
+}
+
+// Contains reports whether v is in r
+func (r Range) Contains(v Version) bool {
+	if v.IsPrerelease() && !(r.min.IsPrerelease() &&
+		v.Major == r.min.Major && v.Minor == r.min.Minor && v.Patch == r.min.Patch) {
+		return false
+	}
+	if r.exact {
+		return v.Compare(r.min) == 0
+	}
+	return v.Compare(r.min) >= 0 && v.Compare(r.max) < 0
+}
+
+// Highest returns the highest tag in r, false when none is
+func (r Range) Highest(tags []string) (string, bool) {
+	var highest string
+	var best Version
+	found := false
+	for _, tag := range tags {
+		v, err := Parse(tag)
+		if err != nil || !r.Contains(v) {
+			continue
+		}
+		if !found || v.Compare(best) > 0 {
+			highest, best, found = tag, v, true
+		}
+	}
+	return highest, found
+}
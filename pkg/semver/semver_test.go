@@ -0,0 +1,202 @@
+package semver
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag   string
+		want  string
+		valid bool
+	}{
+		{"v1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.3", true},
+		{"V1.2.3", "1.2.3", true},
+		{"v1.2", "1.2.0", true},
+		{"v1", "1.0.0", true},
+		{"1.2.3-rc.1+build.5", "1.2.3-rc.1+build.5", true},
+		{"v2.0.0-alpha-1", "2.0.0-alpha-1", true},
+		{"", "", false},
+		{"v", "", false},
+		{"videos", "", false},
+		{"v1.2.3.4", "", false},
+		{"v01.2.3", "", false},
+		{"v1..3", "", false},
+		{"v1.2.3-", "", false},
+		{"v1.2.3-01", "", false},
+		{"v1.2.3-rc..1", "", false},
+		{"v1.2.3+", "", false},
+		{"v1.2.3-rc_1", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			v, err := Parse(tt.tag)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Parse(%q) error = %v, want valid %v", tt.tag, err, tt.valid)
+			}
+			if tt.valid && v.String() != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.tag, v, tt.want)
+			}
+			if Valid(tt.tag) != tt.valid {
+				t.Errorf("Valid(%q) = %v", tt.tag, !tt.valid)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"v1", "1.0.0", 0},
+		{"1.0.0+build.1", "1.0.0+build.2", 0},
+		{"1.0.0", "2.0.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.0.10", "1.0.9", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+	}
+
+	for _, tt := range tests {
+		a, _ := Parse(tt.a)
+		b, _ := Parse(tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Compare(a); got != -tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	tags := []string{"v1.9.0", "latest", "v1.10.0", "v2.0.0-rc.1", "v1.2", "v2.0.0", "v1.10.0-beta", "stable", "v0.9.9"}
+	Sort(tags)
+
+	want := []string{"v2.0.0", "v2.0.0-rc.1", "v1.10.0", "v1.10.0-beta", "v1.9.0", "v1.2", "v0.9.9", "latest", "stable"}
+	if !slices.Equal(tags, want) {
+		t.Errorf("Sort = %v, want %v", tags, want)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	tests := []struct {
+		tags  []string
+		want  string
+		found bool
+	}{
+		{[]string{"v1.9.0", "v1.10.0", "v1.2.0"}, "v1.10.0", true},
+		{[]string{"v1.0.0", "v2.0.0-rc.1"}, "v1.0.0", true},
+		{[]string{"v2.0.0-rc.1", "v2.0.0-rc.2"}, "v2.0.0-rc.2", true},
+		{[]string{"latest", "v1"}, "v1", true},
+		{[]string{"latest"}, "", false},
+		{nil, "", false},
+	}
+
+	for _, tt := range tests {
+		got, found := Latest(tt.tags)
+		if got != tt.want || found != tt.found {
+			t.Errorf("Latest(%v) = %q, %v, want %q, %v", tt.tags, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		rng string
+		in  []string
+		out []string
+	}{
+		// Partial versions
+		{"1", []string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0", "1.5.0-rc.1"}},
+		{"v1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"1.2", []string{"1.2.0", "1.2.9"}, []string{"1.1.9", "1.3.0"}},
+		{"1.2.3", []string{"1.2.3", "1.2.3+build"}, []string{"1.2.4", "1.2.2"}},
+
+		// .x and .* wildcards
+		{"1.x", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"1.2.x", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"1.*", []string{"1.4.0"}, []string{"2.0.0"}},
+
+		// Tilde
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+		{"~v1.2.3", []string{"1.2.5"}, []string{"1.3.0"}},
+
+		// Caret
+		{"^2", []string{"2.0.0", "2.9.9"}, []string{"1.9.9", "3.0.0"}},
+		{"^1.2", []string{"1.2.0", "1.9.0"}, []string{"1.1.0", "2.0.0"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+		{"^0.2", []string{"0.2.0", "0.2.9"}, []string{"0.3.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.2.2", "0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"^ 1.2", []string{"1.5.0"}, []string{"2.0.0"}},
+
+		// Pre-releases only when the lower bound is one of the same version
+		{"^2.0.0-rc.1", []string{"2.0.0-rc.1", "2.0.0-rc.2", "2.0.0", "2.5.0"}, []string{"2.0.0-beta", "2.1.0-rc.1", "3.0.0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rng, func(t *testing.T) {
+			r, err := ParseRange(tt.rng)
+			if err != nil {
+				t.Fatalf("ParseRange(%q): %v", tt.rng, err)
+			}
+			for _, tag := range tt.in {
+				if v, _ := Parse(tag); !r.Contains(v) {
+					t.Errorf("%s is not in %s", tag, tt.rng)
+				}
+			}
+			for _, tag := range tt.out {
+				if v, _ := Parse(tag); r.Contains(v) {
+					t.Errorf("%s is in %s", tag, tt.rng)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRangeInvalid(t *testing.T) {
+	for _, rng := range []string{"", "x", "^", "~videos", "1.2-rc.1", ">=1.0.0", "1.2.3.4"} {
+		if _, err := ParseRange(rng); err == nil {
+			t.Errorf("ParseRange(%q) succeeded", rng)
+		}
+	}
+}
+
+func TestRangeHighest(t *testing.T) {
+	tags := []string{"v1.2.0", "v1.10.0", "v1.9.3", "v2.0.0-rc.1", "v2.0.0", "v2.1.0", "stable"}
+
+	tests := []struct {
+		rng   string
+		want  string
+		found bool
+	}{
+		{"v1", "v1.10.0", true},
+		{"~1.9", "v1.9.3", true},
+		{"^1.2", "v1.10.0", true},
+		{"2.x", "v2.1.0", true},
+		{"2.0", "v2.0.0", true},
+		{"v3", "", false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, found := r.Highest(tags); got != tt.want || found != tt.found {
+			t.Errorf("Highest(%s) = %q, %v, want %q, %v", tt.rng, got, found, tt.want, tt.found)
+		}
+	}
+}
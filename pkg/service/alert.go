@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	neployway "neploy.dev/pkg/gateway"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/repository/filters"
+)
+
+const (
+	defaultAlertWindow = 5 * time.Minute
+	alertHistoryLimit  = 500
+)
+
+// AlertNotifier delivers an alert that fired or resolved to the targets of its rule
+type AlertNotifier interface {
+	Notify(ctx context.Context, rule model.AlertRule, alert model.Alert) error
+}
+
+// Alert manages alert rules and evaluates them on an interval against the
+// gateway request window, the container samples and the gateway health.
+// A rule has at most one open alert: it is pending while the condition
+// holds for less than the rule's for-duration, then firing until the
+// condition clears and it is resolved. Only firing and resolving notify.
+type Alert interface {
+	Start(ctx context.Context)
+	Stop()
+	Evaluate(ctx context.Context)
+	GetRules(ctx context.Context, applicationID string) ([]model.AlertRule, error)
+	CreateRule(ctx context.Context, req model.AlertRuleRequest) (model.AlertRule, error)
+	UpdateRule(ctx context.Context, id string, req model.AlertRuleRequest) (model.AlertRule, error)
+	DeleteRule(ctx context.Context, id string) error
+	GetHistory(ctx context.Context, filter model.AlertFilter) ([]model.Alert, error)
+}
+
+type alert struct {
+	repos      repository.Repositories
+	router     *neployway.Router
+	containers ContainerMetrics
+	notifier   AlertNotifier
+	interval   time.Duration
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	// mu keeps evaluations from overlapping with each other
+	mu sync.Mutex
+}
+
+func NewAlert(repos repository.Repositories, router *neployway.Router, containers ContainerMetrics, notifier AlertNotifier, interval time.Duration) Alert {
+	if notifier == nil {
+		notifier = logNotifier{}
+	}
+
+	return &alert{
+		repos:      repos,
+		router:     router,
+		containers: containers,
+		notifier:   notifier,
+		interval:   interval,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+func (a *alert) Start(ctx context.Context) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.stopChan:
+				return
+			case <-ticker.C:
+				a.Evaluate(ctx)
+			}
+		}
+	}()
+}
+
+func (a *alert) Stop() {
+	close(a.stopChan)
+	a.wg.Wait()
+}
+
+func (a *alert) GetRules(ctx context.Context, applicationID string) ([]model.AlertRule, error) {
+	return a.repos.AlertRule.GetByApplicationID(ctx, applicationID)
+}
+
+func (a *alert) CreateRule(ctx context.Context, req model.AlertRuleRequest) (model.AlertRule, error) {
+	rule, err := a.ruleFromRequest(ctx, model.AlertRule{Enabled: true}, req)
+	if err != nil {
+		return model.AlertRule{}, err
+	}
+
+	rule, err = a.repos.AlertRule.InsertOne(ctx, rule)
+	if err != nil {
+		logger.Error("error creating alert rule: %v", err)
+		return model.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+func (a *alert) UpdateRule(ctx context.Context, id string, req model.AlertRuleRequest) (model.AlertRule, error) {
+	rule, err := a.repos.AlertRule.GetOneById(ctx, id)
+	if err != nil {
+		return model.AlertRule{}, errors.Wrap(err, "alert rule not found")
+	}
+
+	rule, err = a.ruleFromRequest(ctx, rule, req)
+	if err != nil {
+		return model.AlertRule{}, err
+	}
+
+	rule, err = a.repos.AlertRule.UpdateOneById(ctx, id, rule)
+	if err != nil {
+		logger.Error("error updating alert rule: %v", err)
+		return model.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+func (a *alert) DeleteRule(ctx context.Context, id string) error {
+	return a.repos.AlertRule.Delete(ctx, id)
+}
+
+func (a *alert) GetHistory(ctx context.Context, filter model.AlertFilter) ([]model.Alert, error) {
+	return a.repos.Alert.GetHistory(ctx, filter, alertHistoryLimit)
+}
+
+func (a *alert) ruleFromRequest(ctx context.Context, rule model.AlertRule, req model.AlertRuleRequest) (model.AlertRule, error) {
+	if _, err := a.repos.Application.GetByID(ctx, req.ApplicationID); err != nil {
+		return model.AlertRule{}, errors.Wrap(err, "application not found")
+	}
+
+	rule.ApplicationID = req.ApplicationID
+	rule.Name = req.Name
+	rule.Metric = req.Metric
+	rule.Threshold = req.Threshold
+	rule.Window = req.Window
+	if rule.Window <= 0 {
+		rule.Window = int(defaultAlertWindow / time.Second)
+	}
+	rule.For = req.For
+	rule.Severity = req.Severity
+	if rule.Severity == "" {
+		rule.Severity = model.AlertSeverityWarning
+	}
+	rule.Targets = strings.Join(req.Targets, ",")
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+
+	return rule, nil
+}
+
+// Evaluate checks every enabled rule once and moves its alert along
+func (a *alert) Evaluate(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rules, err := a.repos.AlertRule.GetAll(ctx, filters.IsSelectFilter("enabled", true))
+	if err != nil {
+		logger.Error("error getting alert rules: %v", err)
+		return
+	}
+
+	open, err := a.repos.Alert.GetOpen(ctx)
+	if err != nil {
+		logger.Error("error getting open alerts: %v", err)
+		return
+	}
+	openByRule := make(map[string]model.Alert, len(open))
+	for _, al := range open {
+		openByRule[al.RuleID] = al
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		current, isOpen := openByRule[rule.ID]
+		delete(openByRule, rule.ID)
+
+		value, err := a.measure(ctx, rule)
+		if err != nil {
+			// Keep the alert as it is rather than resolving on missing data
+			logger.Error("error measuring alert rule %s: %v", rule.ID, err)
+			continue
+		}
+
+		var openAlert *model.Alert
+		if isOpen {
+			openAlert = &current
+		}
+		a.advance(ctx, rule, openAlert, value, now)
+	}
+
+	// Alerts left belong to rules deleted or disabled since they opened
+	for _, al := range openByRule {
+		rule, err := a.repos.AlertRule.GetOneById(ctx, al.RuleID)
+		if err != nil {
+			rule = model.AlertRule{BaseEntity: model.BaseEntity{ID: al.RuleID}, ApplicationID: al.ApplicationID}
+		}
+		a.close(ctx, rule, al, now)
+	}
+}
+
+// advance applies one evaluation of rule to its open alert, if any
+func (a *alert) advance(ctx context.Context, rule model.AlertRule, open *model.Alert, value float64, now time.Time) {
+	matching := value > rule.Threshold
+
+	if open == nil {
+		if !matching {
+			return
+		}
+
+		al := model.Alert{
+			RuleID:          rule.ID,
+			ApplicationID:   rule.ApplicationID,
+			Status:          model.AlertPending,
+			Severity:        rule.Severity,
+			Value:           value,
+			Message:         alertMessage(rule, value),
+			StartedAt:       model.NewDate(now),
+			LastEvaluatedAt: model.NewDate(now),
+		}
+		if rule.For == 0 {
+			fired := model.NewDate(now)
+			al.Status = model.AlertFiring
+			al.FiredAt = &fired
+		}
+
+		al, err := a.repos.Alert.InsertOne(ctx, al)
+		if err != nil {
+			logger.Error("error opening alert for rule %s: %v", rule.ID, err)
+			return
+		}
+		if al.Status == model.AlertFiring {
+			a.notify(ctx, rule, al)
+		}
+		return
+	}
+
+	if !matching {
+		a.close(ctx, rule, *open, now)
+		return
+	}
+
+	al := *open
+	al.Value = value
+	al.Message = alertMessage(rule, value)
+	al.LastEvaluatedAt = model.NewDate(now)
+
+	fires := al.Status == model.AlertPending && now.Sub(al.StartedAt.Time) >= time.Duration(rule.For)*time.Second
+	if fires {
+		fired := model.NewDate(now)
+		al.Status = model.AlertFiring
+		al.FiredAt = &fired
+	}
+
+	if _, err := a.repos.Alert.UpdateOneById(ctx, al.ID, al); err != nil {
+		logger.Error("error updating alert %s: %v", al.ID, err)
+		return
+	}
+	if fires {
+		a.notify(ctx, rule, al)
+	}
+}
+
+// close resolves a firing alert and drops a pending one that never fired
+func (a *alert) close(ctx context.Context, rule model.AlertRule, al model.Alert, now time.Time) {
+	if al.Status == model.AlertPending {
+		if err := a.repos.Alert.Discard(ctx, al.ID); err != nil {
+			logger.Error("error discarding alert %s: %v", al.ID, err)
+		}
+		return
+	}
+
+	resolved := model.NewDate(now)
+	al.Status = model.AlertResolved
+	al.ResolvedAt = &resolved
+	al.LastEvaluatedAt = model.NewDate(now)
+
+	if _, err := a.repos.Alert.UpdateOneById(ctx, al.ID, al); err != nil {
+		logger.Error("error resolving alert %s: %v", al.ID, err)
+		return
+	}
+	a.notify(ctx, rule, al)
+}
+
+func (a *alert) notify(ctx context.Context, rule model.AlertRule, al model.Alert) {
+	if err := a.notifier.Notify(ctx, rule, al); err != nil {
+		logger.Error("error notifying alert %s: %v", al.ID, err)
+	}
+}
+
+// measure returns the current value of the metric of rule
+func (a *alert) measure(ctx context.Context, rule model.AlertRule) (float64, error) {
+	window := time.Duration(rule.Window) * time.Second
+
+	switch rule.Metric {
+	case model.AlertErrorRate:
+		return a.router.RecentStats(rule.ApplicationID, window).ErrorRate(), nil
+	case model.AlertLatencyP95:
+		latency := a.router.RecentStats(rule.ApplicationID, window).Latency.Quantile(0.95)
+		return float64(latency) / float64(time.Millisecond), nil
+	case model.AlertContainerDown:
+		var down float64
+		for _, usage := range a.containers.Usage(rule.ApplicationID) {
+			if usage.Expected && !usage.Running {
+				down++
+			}
+		}
+		return down, nil
+	case model.AlertCPU, model.AlertMemory:
+		var busiest float64
+		for _, usage := range a.containers.Usage(rule.ApplicationID) {
+			value := usage.CPU
+			if rule.Metric == model.AlertMemory {
+				value = usage.Memory
+			}
+			busiest = max(busiest, value)
+		}
+		return busiest, nil
+	case model.AlertHealthCheck:
+		gateways, err := a.repos.Gateway.GetByApplicationID(ctx, rule.ApplicationID)
+		if err != nil {
+			return 0, err
+		}
+		var failing float64
+		for _, gateway := range gateways {
+			if gateway.HealthStatus == model.HealthUnhealthy || gateway.Status == "error" {
+				failing++
+			}
+		}
+		return failing, nil
+	}
+
+	return 0, fmt.Errorf("unknown alert metric %q", rule.Metric)
+}
+
+func alertMessage(rule model.AlertRule, value float64) string {
+	unit := ""
+	switch rule.Metric {
+	case model.AlertErrorRate, model.AlertCPU, model.AlertMemory:
+		unit = "%"
+	case model.AlertLatencyP95:
+		unit = "ms"
+	}
+	return fmt.Sprintf("%s: %s is %.2f%s, above %.2f%s", rule.Name, rule.Metric, value, unit, rule.Threshold, unit)
+}
+
+// logNotifier only logs alerts, used when no notifier is configured
+type logNotifier struct{}
+
+func (logNotifier) Notify(_ context.Context, rule model.AlertRule, al model.Alert) error {
+	logger.Warn("Alert %s [%s] %s (targets: %s)", al.Status, al.Severity, al.Message, rule.Targets)
+	return nil
+}
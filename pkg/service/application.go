@@ -10,20 +10,17 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/sync/semaphore"
 	"neploy.dev/config"
 	neploker "neploy.dev/pkg/docker"
 	"neploy.dev/pkg/filesystem"
-	neployway "neploy.dev/pkg/gateway"
 	"neploy.dev/pkg/logger"
+	neploymetrics "neploy.dev/pkg/metrics"
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository"
 	"neploy.dev/pkg/repository/filters"
 	"neploy.dev/pkg/websocket"
 )
 
-var globalSemaphore = semaphore.NewWeighted(4)
-
 type Application interface {
 	Create(ctx context.Context, app model.Application) (string, error)
 	Get(ctx context.Context, id string) (model.ApplicationDockered, error)
@@ -42,6 +39,7 @@ type Application interface {
 	GetHealthy(ctx context.Context) (uint, uint, error)
 	GetHourlyRequests(ctx context.Context) ([]model.RequestStat, error)
 	GetStats(ctx context.Context) ([]model.ApplicationStat, error)
+	GetReport(ctx context.Context, filter model.StatsFilter) ([]model.ApplicationReport, error)
 	EnsureDefaultGateways(ctx context.Context) error
 	GetVersionLogs(ctx context.Context, appID, versionID string) ([]string, error)
 }
@@ -50,21 +48,23 @@ type application struct {
 	repos             repository.Repositories
 	hub               *websocket.Hub
 	docker            *neploker.Docker
-	router            *neployway.Router
+	reconciler        Reconciler
 	versioningService Versioning
 	dockerService     Docker
+	notifications     Notification
 }
 
-func NewApplication(repos repository.Repositories, router *neployway.Router) Application {
+func NewApplication(repos repository.Repositories, reconciler Reconciler, notifications Notification) Application {
 	hub := websocket.GetHub()
 	dockerClient := neploker.NewDocker()
 	return &application{
 		repos:             repos,
 		hub:               hub,
 		docker:            dockerClient,
-		router:            router,
+		reconciler:        reconciler,
 		versioningService: NewVersioning(repos, hub, dockerClient),
-		dockerService:     NewDocker(repos, hub, dockerClient, router),
+		dockerService:     NewDocker(repos, hub, dockerClient, reconciler, notifications),
+		notifications:     notifications,
 	}
 }
 
@@ -102,49 +102,41 @@ func (a *application) GetRepoBranches(ctx context.Context, repoURL string) ([]st
 }
 
 func (a *application) Deploy(ctx context.Context, id string, repoURL string, branch string) error {
-	return a.versioningService.Deploy(ctx, id, repoURL, branch)
+	start := time.Now()
+	err := a.versioningService.Deploy(ctx, id, repoURL, branch)
+	neploymetrics.ObserveDeploy("git", err, time.Since(start))
+	a.notifyDeploy(ctx, id, map[string]string{"source": "git", "repository": repoURL, "branch": branch}, err)
+	return err
 }
 
 func (a *application) Upload(ctx context.Context, id string, file *multipart.FileHeader) (string, error) {
-	return a.versioningService.Upload(ctx, id, file)
+	start := time.Now()
+	versionID, err := a.versioningService.Upload(ctx, id, file)
+	neploymetrics.ObserveDeploy("upload", err, time.Since(start))
+	a.notifyDeploy(ctx, id, map[string]string{"source": "upload", "file": file.Filename}, err)
+	return versionID, err
 }
 
-func (a *application) ensureContainerRunning(ctx context.Context, app model.Application, version model.ApplicationVersion) error {
-	if version.Status == "paused" {
-		return nil
+// notifyDeploy publishes the result of a deploy of app id
+func (a *application) notifyDeploy(ctx context.Context, id string, fields map[string]string, err error) {
+	if a.notifications == nil {
+		return
 	}
 
-	if err := globalSemaphore.Acquire(ctx, 1); err != nil {
-		logger.Error("semaphore timeout for version %s: %v", version.VersionTag, err)
-		return err
+	event := model.NotificationEvent{
+		Type:          model.EventDeploy,
+		Severity:      model.AlertSeverityInfo,
+		Title:         "Deploy succeeded",
+		Message:       "The new version was deployed.",
+		ApplicationID: id,
+		Fields:        fields,
 	}
-	defer globalSemaphore.Release(1)
-
-	containerName := getContainerName(app.AppName, version.VersionTag)
-	status, err := a.docker.GetContainerStatus(ctx, containerName)
 	if err != nil {
-		logger.Error("error getting container status: %v", err)
-		return err
-	}
-	if status == "Not created" {
-		dockerfilePath := filepath.Join(version.StorageLocation, "Dockerfile")
-		port, err := a.dockerService.ConfigurePort(dockerfilePath, false)
-		if err != nil {
-			logger.Error("error configuring port: %v", err)
-			return err
-		}
-		if err := a.dockerService.CreateAndStartContainer(ctx, app, version, port); err != nil {
-			logger.Error("error creating and starting container: %v", err)
-			return err
-		}
-	} else {
-		if err := a.dockerService.StartContainer(ctx, app.ID, version.ID); err != nil {
-			logger.Error("error starting container: %v", err)
-			return err
-		}
+		event.Severity = model.AlertSeverityCritical
+		event.Title = "Deploy failed"
+		event.Message = err.Error()
 	}
-
-	return nil
+	a.notifications.Publish(ctx, event)
 }
 
 func (a *application) Get(ctx context.Context, id string) (model.ApplicationDockered, error) {
@@ -181,12 +173,6 @@ func (a *application) Get(ctx context.Context, id string) (model.ApplicationDock
 	globalCpu, globalRam := 0.0, 0.0
 	latestContainerID := ""
 	for _, version := range versions {
-		go func() {
-			if err := a.ensureContainerRunning(ctx, app, version); err != nil {
-				logger.Error("error ensuring container for version %s: %v", version.VersionTag, err)
-			}
-		}()
-
 		containerID, err := a.docker.GetContainerID(ctx, getContainerName(app.AppName, version.VersionTag))
 		if err != nil {
 			logger.Error("error getting container ID: %v", err)
@@ -330,16 +316,6 @@ func (a *application) GetAll(ctx context.Context, userId string) ([]model.FullAp
 			return nil, err
 		}
 
-		// Start container ensuring in background (truly async, don't wait)
-		for _, version := range versions {
-			v := version
-			go func() {
-				if err := a.ensureContainerRunning(context.Background(), app, v); err != nil {
-					logger.Error("error ensuring container for version %s: %v", v.VersionTag, err)
-				}
-			}()
-		}
-
 		// Get status from first active version (limit Docker API calls)
 		appStatus := "unknown"
 		for _, v := range versions {
@@ -408,9 +384,11 @@ func (a *application) Delete(ctx context.Context, id string) error {
 		}
 	}
 
-	a.router.RemoveRoute("/" + containerName)
-
-	return a.repos.Application.Delete(ctx, id)
+	if err := a.repos.Application.Delete(ctx, id); err != nil {
+		return err
+	}
+	a.reconciler.Trigger()
+	return nil
 }
 
 func (a *application) DeleteVersion(ctx context.Context, appID string, versionID string) error {
@@ -475,6 +453,121 @@ func (a *application) GetStats(ctx context.Context) ([]model.ApplicationStat, er
 	return stats, nil
 }
 
+// GetReport sums the stats of each application and of each of its versions
+// in the filter range, latency percentiles come from merging the hourly
+// sketches
+func (a *application) GetReport(ctx context.Context, filter model.StatsFilter) ([]model.ApplicationReport, error) {
+	versions, err := a.repos.ApplicationStat.GetReportTotals(ctx, filter)
+	if err != nil {
+		logger.Error("error getting report totals: %v", err)
+		return nil, err
+	}
+
+	buckets, err := a.repos.ApplicationStat.GetLatencyBuckets(ctx, filter)
+	if err != nil {
+		logger.Error("error getting latency buckets: %v", err)
+		return nil, err
+	}
+
+	codes, err := a.repos.ApplicationStat.GetStatusCodes(ctx, filter)
+	if err != nil {
+		logger.Error("error getting status codes: %v", err)
+		return nil, err
+	}
+
+	type versionKey struct{ appID, version string }
+	appSketches := make(map[string]*neploymetrics.LatencySketch)
+	versionSketches := make(map[versionKey]*neploymetrics.LatencySketch)
+	for _, bucket := range buckets {
+		sketchFor(appSketches, bucket.ApplicationID).AddBucket(bucket.Bucket, bucket.Count)
+		sketchFor(versionSketches, versionKey{bucket.ApplicationID, bucket.Version}).AddBucket(bucket.Bucket, bucket.Count)
+	}
+
+	reports := make([]model.ApplicationReport, 0)
+	byApp := make(map[string]int)
+	for _, version := range versions {
+		i, ok := byApp[version.ApplicationID]
+		if !ok {
+			i = len(reports)
+			byApp[version.ApplicationID] = i
+			reports = append(reports, model.ApplicationReport{
+				ApplicationID: version.ApplicationID,
+				Versions:      make([]model.VersionReport, 0),
+			})
+			if app, err := a.repos.Application.GetByID(ctx, version.ApplicationID); err == nil {
+				reports[i].AppName = app.AppName
+			}
+		}
+
+		version.Latency = percentiles(versionSketches[versionKey{version.ApplicationID, version.Version}])
+		version.StatusCodes = make([]model.StatusCodeCount, 0)
+		for _, code := range codes {
+			if code.ApplicationID == version.ApplicationID && code.Version == version.Version {
+				version.StatusCodes = append(version.StatusCodes, code)
+			}
+		}
+
+		reports[i].Requests += version.Requests
+		reports[i].Errors += version.Errors
+		reports[i].BytesIn += version.BytesIn
+		reports[i].BytesOut += version.BytesOut
+		reports[i].Versions = append(reports[i].Versions, version)
+	}
+
+	for i, report := range reports {
+		reports[i].Latency = percentiles(appSketches[report.ApplicationID])
+		reports[i].StatusCodes = sumStatusCodes(codes, report.ApplicationID)
+	}
+
+	return reports, nil
+}
+
+// sketchFor returns the sketch of key in sketches, adding it when missing
+func sketchFor[K comparable](sketches map[K]*neploymetrics.LatencySketch, key K) *neploymetrics.LatencySketch {
+	sketch, ok := sketches[key]
+	if !ok {
+		sketch = neploymetrics.NewLatencySketch()
+		sketches[key] = sketch
+	}
+	return sketch
+}
+
+func percentiles(sketch *neploymetrics.LatencySketch) model.LatencyPercentiles {
+	if sketch == nil {
+		return model.LatencyPercentiles{}
+	}
+	return model.LatencyPercentiles{
+		P50: milliseconds(sketch.Quantile(0.50)),
+		P90: milliseconds(sketch.Quantile(0.90)),
+		P99: milliseconds(sketch.Quantile(0.99)),
+	}
+}
+
+// sumStatusCodes adds up the per version counts of appID by method and
+// status, in the order GetStatusCodes returned them
+func sumStatusCodes(codes []model.StatusCodeCount, appID string) []model.StatusCodeCount {
+	summed := make([]model.StatusCodeCount, 0)
+	index := make(map[model.StatusCodeCount]int)
+	for _, code := range codes {
+		if code.ApplicationID != appID {
+			continue
+		}
+		key := model.StatusCodeCount{Method: code.Method, Status: code.Status}
+		if i, ok := index[key]; ok {
+			summed[i].Count += code.Count
+			continue
+		}
+		index[key] = len(summed)
+		code.Version = ""
+		summed = append(summed, code)
+	}
+	return summed
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func (a *application) EnsureDefaultGateways(ctx context.Context) error {
 	apps, err := a.repos.Application.GetAll(ctx)
 	if err != nil {
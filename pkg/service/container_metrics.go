@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	neploker "neploy.dev/pkg/docker"
+	"neploy.dev/pkg/logger"
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/repository/filters"
+)
+
+// ContainerMetrics samples CPU and memory of every application container on
+// an interval and publishes them as Prometheus gauges. Sampling happens in
+// the background because a docker stats call takes around a second.
+type ContainerMetrics interface {
+	Start(ctx context.Context)
+	Stop()
+	// Usage returns the last sample of each version of appID
+	Usage(appID string) []model.ContainerUsage
+}
+
+type containerMetrics struct {
+	repos         repository.Repositories
+	docker        *neploker.Docker
+	notifications Notification
+	interval      time.Duration
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+	// app/version pairs published on the last pass, to drop stale series
+	seen map[[2]string]bool
+
+	mu    sync.RWMutex
+	usage map[string][]model.ContainerUsage
+}
+
+func NewContainerMetrics(repos repository.Repositories, notifications Notification, interval time.Duration) ContainerMetrics {
+	return &containerMetrics{
+		repos:         repos,
+		docker:        neploker.NewDocker(),
+		notifications: notifications,
+		interval:      interval,
+		stopChan:      make(chan struct{}),
+		seen:          make(map[[2]string]bool),
+		usage:         make(map[string][]model.ContainerUsage),
+	}
+}
+
+func (c *containerMetrics) Start(ctx context.Context) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		c.sample(ctx)
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+				c.sample(ctx)
+			}
+		}
+	}()
+}
+
+func (c *containerMetrics) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+func (c *containerMetrics) Usage(appID string) []model.ContainerUsage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.usage[appID]
+}
+
+func (c *containerMetrics) sample(ctx context.Context) {
+	apps, err := c.repos.Application.GetAll(ctx)
+	if err != nil {
+		logger.Error("error getting applications for container metrics: %v", err)
+		return
+	}
+
+	containers, err := c.docker.ListContainers(ctx)
+	if err != nil {
+		logger.Error("error listing containers for container metrics: %v", err)
+		return
+	}
+	byName := make(map[string]types.Container, len(containers))
+	for _, ctnr := range containers {
+		for _, name := range ctnr.Names {
+			byName[strings.TrimPrefix(name, "/")] = ctnr
+		}
+	}
+
+	current := make(map[[2]string]bool)
+	usage := make(map[string][]model.ContainerUsage, len(apps))
+	for _, app := range apps {
+		versions, err := c.repos.ApplicationVersion.GetAll(ctx, filters.IsSelectFilter("application_id", app.ID))
+		if err != nil {
+			logger.Error("error getting versions of %s for container metrics: %v", app.AppName, err)
+			continue
+		}
+
+		for _, version := range versions {
+			sample := model.ContainerUsage{
+				ApplicationID: app.ID,
+				Version:       version.VersionTag,
+				Expected:      version.Status != "inactive",
+				SampledAt:     time.Now(),
+			}
+			ctnr, ok := byName[getContainerName(app.AppName, version.VersionTag)]
+			sample.Running = ok && ctnr.State == "running"
+			if !sample.Running {
+				usage[app.ID] = append(usage[app.ID], sample)
+				continue
+			}
+
+			cpu, mem, err := c.docker.GetUsage(ctx, ctnr.ID)
+			if err != nil {
+				usage[app.ID] = append(usage[app.ID], sample)
+				continue
+			}
+			sample.CPU, sample.Memory = cpu, mem
+			usage[app.ID] = append(usage[app.ID], sample)
+
+			neploymetrics.SetContainerUsage(app.ID, version.VersionTag, cpu, mem)
+			current[[2]string{app.ID, version.VersionTag}] = true
+		}
+	}
+
+	c.mu.Lock()
+	previous := c.usage
+	c.usage = usage
+	c.mu.Unlock()
+	c.notifyStopped(ctx, previous, usage)
+
+	for key := range c.seen {
+		if !current[key] {
+			neploymetrics.DeleteContainerUsage(key[0], key[1])
+		}
+	}
+	c.seen = current
+}
+
+// notifyStopped publishes the versions that were running on the previous
+// sample and stopped since without anyone stopping them
+func (c *containerMetrics) notifyStopped(ctx context.Context, previous, current map[string][]model.ContainerUsage) {
+	if c.notifications == nil {
+		return
+	}
+
+	for appID, samples := range current {
+		for _, sample := range samples {
+			if sample.Running || !sample.Expected {
+				continue
+			}
+			wasRunning := slices.ContainsFunc(previous[appID], func(prev model.ContainerUsage) bool {
+				return prev.Version == sample.Version && prev.Running
+			})
+			if !wasRunning {
+				continue
+			}
+
+			c.notifications.Publish(ctx, model.NotificationEvent{
+				Type:          model.EventContainerStopped,
+				Severity:      model.AlertSeverityCritical,
+				Title:         fmt.Sprintf("Container of version %s stopped", sample.Version),
+				Message:       "The container stopped without being stopped from Neploy.",
+				ApplicationID: appID,
+				Fields:        map[string]string{"version": sample.Version},
+			})
+		}
+	}
+}
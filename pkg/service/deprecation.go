@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	neployway "neploy.dev/pkg/gateway"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/repository/filters"
+)
+
+// Deprecation sets the deprecation lifecycle of versions and reports who
+// still calls the deprecated ones. The gateway applies it.
+type Deprecation interface {
+	SaveDeprecation(ctx context.Context, applicationID, versionID string, req model.VersionDeprecationRequest) (model.ApplicationVersion, error)
+	Usage(ctx context.Context, applicationID string, filter model.StatsFilter) ([]model.DeprecatedVersionReport, error)
+}
+
+type deprecation struct {
+	repos  repository.Repositories
+	router *neployway.Router
+}
+
+func NewDeprecation(repos repository.Repositories, router *neployway.Router) Deprecation {
+	return &deprecation{repos: repos, router: router}
+}
+
+func (s *deprecation) SaveDeprecation(ctx context.Context, applicationID, versionID string, req model.VersionDeprecationRequest) (model.ApplicationVersion, error) {
+	version, err := s.repos.ApplicationVersion.GetOneById(ctx, versionID)
+	if err != nil || version.ApplicationID != applicationID {
+		return model.ApplicationVersion{}, errors.New("version not found")
+	}
+
+	if req.DeprecatedAt == nil && (req.SunsetAt != nil || req.MigrationURL != "" || req.SunsetAction != "") {
+		return model.ApplicationVersion{}, errors.New("a sunset, migration link or sunset action needs a deprecation date")
+	}
+	if req.SunsetAt != nil && req.SunsetAt.Before(*req.DeprecatedAt) {
+		return model.ApplicationVersion{}, errors.New("the sunset can't be before the deprecation")
+	}
+
+	version, err = s.repos.ApplicationVersion.SetDeprecation(ctx, versionID, req.DeprecatedAt, req.SunsetAt, req.MigrationURL, req.SunsetAction)
+	if err != nil {
+		logger.Error("error saving version deprecation: %v", err)
+		return model.ApplicationVersion{}, err
+	}
+	s.router.Refresh()
+
+	return version, nil
+}
+
+func (s *deprecation) Usage(ctx context.Context, applicationID string, filter model.StatsFilter) ([]model.DeprecatedVersionReport, error) {
+	versions, err := s.repos.ApplicationVersion.GetAll(ctx,
+		filters.IsSelectFilter("application_id", applicationID),
+		filters.IsSelectFilter("deprecated_at", "NOT NULL"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get deprecated versions")
+	}
+
+	usage, err := s.repos.DeprecatedVersionUsage.GetByConsumer(ctx, applicationID, filter.From, filter.To)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get deprecated version usage")
+	}
+	byVersion := make(map[string][]model.ConsumerUsage)
+	for _, consumer := range usage {
+		byVersion[consumer.Version] = append(byVersion[consumer.Version], consumer)
+	}
+
+	reports := make([]model.DeprecatedVersionReport, 0, len(versions))
+	for _, version := range versions {
+		report := model.DeprecatedVersionReport{
+			VersionID:    version.ID,
+			Version:      version.VersionTag,
+			DeprecatedAt: *version.DeprecatedAt,
+			SunsetAt:     version.SunsetAt,
+			Consumers:    byVersion[version.VersionTag],
+		}
+		if report.Consumers == nil {
+			report.Consumers = make([]model.ConsumerUsage, 0)
+		}
+		for _, consumer := range report.Consumers {
+			report.Requests += consumer.Requests
+		}
+		reports = append(reports, report)
+	}
+
+	// Versions closest to their sunset first, those without one last
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i].SunsetAt, reports[j].SunsetAt
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.Before(b.Time)
+	})
+	return reports, nil
+}
@@ -6,13 +6,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/go-connections/nat"
 	"neploy.dev/config"
 	neploker "neploy.dev/pkg/docker"
-	neployway "neploy.dev/pkg/gateway"
 	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository"
@@ -27,14 +27,15 @@ type Docker interface {
 }
 
 type docker struct {
-	repos  repository.Repositories
-	hub    *websocket.Hub
-	docker *neploker.Docker
-	router *neployway.Router
+	repos         repository.Repositories
+	hub           *websocket.Hub
+	docker        *neploker.Docker
+	reconciler    Reconciler
+	notifications Notification
 }
 
-func NewDocker(repos repository.Repositories, hub *websocket.Hub, dckr *neploker.Docker, router *neployway.Router) Docker {
-	return &docker{repos, hub, dckr, router}
+func NewDocker(repos repository.Repositories, hub *websocket.Hub, dckr *neploker.Docker, reconciler Reconciler, notifications Notification) Docker {
+	return &docker{repos, hub, dckr, reconciler, notifications}
 }
 
 func (d *docker) CreateAndStartContainer(ctx context.Context, app model.Application, version model.ApplicationVersion, port string) error {
@@ -87,18 +88,9 @@ func (d *docker) CreateAndStartContainer(ctx context.Context, app model.Applicat
 	}
 	if _, err := d.repos.Gateway.UpsertOneDoNothing(ctx, gateway, "path"); err != nil {
 		logger.Error("error creating gateway: %v", err)
-	}
-
-	route := neployway.Route{
-		AppID:  app.ID,
-		Port:   port,
-		Domain: config.Env.DefaultDomain,
-		Path:   "/" + appName,
-	}
-	if err := d.router.AddRoute(route); err != nil {
-		logger.Error("Failed to add route: %v", err)
 		return err
 	}
+	d.reconciler.Trigger()
 
 	if d.hub != nil {
 		d.hub.BroadcastProgress(100, fmt.Sprintf("Container %s started successfully!", resp.ID[:12]))
@@ -108,6 +100,10 @@ func (d *docker) CreateAndStartContainer(ctx context.Context, app model.Applicat
 }
 
 func (d *docker) StartContainer(ctx context.Context, id, versionId string) error {
+	lock := deployLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
 	app, err := d.repos.Application.GetByID(ctx, id)
 	if err != nil {
 		return err
@@ -136,6 +132,10 @@ func (d *docker) StartContainer(ctx context.Context, id, versionId string) error
 }
 
 func (d *docker) StopContainer(ctx context.Context, id, versionId string) error {
+	lock := deployLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
 	app, err := d.repos.Application.GetByID(ctx, id)
 	if err != nil {
 		return err
@@ -161,6 +161,17 @@ func (d *docker) StopContainer(ctx context.Context, id, versionId string) error
 		logger.Error("error updating application version: %v", err)
 	}
 
+	if d.notifications != nil {
+		d.notifications.Publish(ctx, model.NotificationEvent{
+			Type:          model.EventContainerStopped,
+			Severity:      model.AlertSeverityInfo,
+			Title:         fmt.Sprintf("%s %s was stopped", app.AppName, version.VersionTag),
+			Message:       "The container was stopped from Neploy.",
+			ApplicationID: app.ID,
+			Fields:        map[string]string{"version": version.VersionTag},
+		})
+	}
+
 	return nil
 }
 
@@ -235,6 +246,16 @@ func (d *docker) ConfigurePort(dockerfilePath string, interactive bool) (string,
 	return port, nil
 }
 
+// deployLocks holds a mutex per application ID. Deploys, uploads and manual
+// container starts and stops hold it while they work on the containers of
+// the app, and the reconciler leaves an app alone while someone else does.
+var deployLocks sync.Map
+
+func deployLock(appID string) *sync.Mutex {
+	lock, _ := deployLocks.LoadOrStore(appID, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
 func getContainerName(appName, versionTag string) string {
 	safeApp := sanitizeAppName(appName)
 	safeTag := strings.ReplaceAll(versionTag, ".", "-") // Opcional: evita puntos
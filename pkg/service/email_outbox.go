@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"neploy.dev/config"
+	"neploy.dev/pkg/email"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+const (
+	outboxAttempts  = 8
+	outboxRetryBase = 30 * time.Second
+	outboxPollEach  = 15 * time.Second
+	outboxBatch     = 50
+	// Long enough for a whole batch of sends to time out
+	outboxClaimLease = 30 * time.Minute
+)
+
+// EmailOutbox stores emails and sends them in the background, so an
+// invitation or password reset survives a provider outage or a restart.
+// A failed send is retried with exponential backoff, about an hour in
+// total, before the email is marked failed. Bodies are stored sealed with a
+// key derived from JWT_SECRET, the one that signs the reset links they hold.
+type EmailOutbox interface {
+	email.Outbox
+	Start(ctx context.Context)
+	Stop()
+}
+
+type emailOutbox struct {
+	repos    repository.Repositories
+	sender   email.EmailSender
+	stopChan chan struct{}
+	// wake starts a pass as soon as an email is queued
+	wake chan struct{}
+	wg   sync.WaitGroup
+	// mu keeps passes from overlapping with each other
+	mu sync.Mutex
+}
+
+func NewEmailOutbox(repos repository.Repositories, sender email.EmailSender) EmailOutbox {
+	return &emailOutbox{
+		repos:    repos,
+		sender:   sender,
+		stopChan: make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (o *emailOutbox) Start(ctx context.Context) {
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		ticker := time.NewTicker(outboxPollEach)
+		defer ticker.Stop()
+
+		// Pick up what was left pending before a restart
+		o.sendDue(ctx)
+		for {
+			select {
+			case <-o.stopChan:
+				return
+			case <-ticker.C:
+				o.sendDue(ctx)
+			case <-o.wake:
+				o.sendDue(ctx)
+			}
+		}
+	}()
+}
+
+func (o *emailOutbox) Stop() {
+	close(o.stopChan)
+	o.wg.Wait()
+}
+
+func (o *emailOutbox) Enqueue(ctx context.Context, msg email.Message) error {
+	html, err := email.SealBody(msg.HTML, config.Env.JWTSecret)
+	if err != nil {
+		logger.Error("error sealing email %q: %v", msg.Subject, err)
+		return err
+	}
+
+	now := model.NewDate(time.Now())
+	queued := model.OutboxEmail{
+		From:          msg.From,
+		Recipients:    strings.Join(msg.To, ","),
+		Subject:       msg.Subject,
+		HTML:          html,
+		Status:        model.EmailPending,
+		NextAttemptAt: &now,
+	}
+	if _, err := o.repos.EmailOutbox.InsertOne(ctx, queued); err != nil {
+		logger.Error("error queueing email %q: %v", msg.Subject, err)
+		return err
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// sendDue sends the pending emails whose next attempt is due
+func (o *emailOutbox) sendDue(ctx context.Context) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for {
+		emails, err := o.repos.EmailOutbox.ClaimDue(ctx, time.Now(), outboxClaimLease, outboxBatch)
+		if err != nil {
+			logger.Error("error getting due emails: %v", err)
+			return
+		}
+
+		for _, queued := range emails {
+			o.send(ctx, queued)
+		}
+
+		if len(emails) < outboxBatch {
+			return
+		}
+		select {
+		case <-o.stopChan:
+			return
+		default:
+		}
+	}
+}
+
+func (o *emailOutbox) send(ctx context.Context, queued model.OutboxEmail) {
+	queued.Attempts++
+	html, err := email.OpenBody(queued.HTML, config.Env.JWTSecret)
+	if err == nil {
+		err = o.sender.Send(ctx, email.Message{
+			From:    queued.From,
+			To:      strings.Split(queued.Recipients, ","),
+			Subject: queued.Subject,
+			HTML:    html,
+		})
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		sent := model.NewDate(now)
+		queued.Status = model.EmailSent
+		queued.SentAt = &sent
+		queued.LastError = ""
+		queued.HTML = ""
+		queued.NextAttemptAt = nil
+	case queued.Attempts >= outboxAttempts:
+		logger.Error("giving up on email %q to %s after %d attempts: %v", queued.Subject, queued.Recipients, queued.Attempts, err)
+		queued.Status = model.EmailFailed
+		queued.LastError = err.Error()
+		queued.HTML = ""
+		queued.NextAttemptAt = nil
+	default:
+		logger.Warn("error sending email %q to %s, attempt %d: %v", queued.Subject, queued.Recipients, queued.Attempts, err)
+		next := model.NewDate(now.Add(outboxRetryBase << (queued.Attempts - 1)))
+		queued.LastError = err.Error()
+		queued.NextAttemptAt = &next
+	}
+
+	queued.LockedUntil = nil
+	if _, err := o.repos.EmailOutbox.UpdateOneById(ctx, queued.ID, queued); err != nil {
+		logger.Error("error updating queued email %s: %v", queued.ID, err)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+	neployway "neploy.dev/pkg/gateway"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/repository/filters"
+)
+
+// ErrorPage manages the error pages and the maintenance of the
+// applications. The gateway picks changes up on its next snapshot.
+type ErrorPage interface {
+	GetPages(ctx context.Context, applicationID string) ([]model.ErrorPage, error)
+	SavePage(ctx context.Context, applicationID string, status int, req model.ErrorPageRequest) (model.ErrorPage, error)
+	DeletePage(ctx context.Context, applicationID string, status int) error
+	// GetMaintenance returns the maintenance of an application, disabled
+	// when it was never set
+	GetMaintenance(ctx context.Context, applicationID string) (model.Maintenance, error)
+	// SaveMaintenance returns the bypass token only when it creates or
+	// rotates it
+	SaveMaintenance(ctx context.Context, applicationID string, req model.MaintenanceRequest) (model.MaintenanceResponse, error)
+}
+
+type errorPage struct {
+	repos  repository.Repositories
+	router *neployway.Router
+}
+
+func NewErrorPage(repos repository.Repositories, router *neployway.Router) ErrorPage {
+	return &errorPage{repos: repos, router: router}
+}
+
+func (s *errorPage) GetPages(ctx context.Context, applicationID string) ([]model.ErrorPage, error) {
+	pages, err := s.repos.ErrorPage.GetByApplicationID(ctx, applicationID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get error pages")
+	}
+	return pages, nil
+}
+
+func (s *errorPage) SavePage(ctx context.Context, applicationID string, status int, req model.ErrorPageRequest) (model.ErrorPage, error) {
+	if _, err := s.repos.Application.GetByID(ctx, applicationID); err != nil {
+		return model.ErrorPage{}, errors.Wrap(err, "application not found")
+	}
+	if err := neployway.ValidateErrorPage(status, req.HTML, req.JSON); err != nil {
+		return model.ErrorPage{}, err
+	}
+
+	page, err := s.repos.ErrorPage.Upsert(ctx, model.ErrorPage{
+		ApplicationID: applicationID,
+		Status:        status,
+		HTML:          req.HTML,
+		JSON:          req.JSON,
+	})
+	if err != nil {
+		logger.Error("error saving error page: %v", err)
+		return model.ErrorPage{}, err
+	}
+	s.router.Refresh()
+
+	return page, nil
+}
+
+func (s *errorPage) DeletePage(ctx context.Context, applicationID string, status int) error {
+	if err := s.repos.ErrorPage.Delete(ctx, applicationID, status); err != nil {
+		return err
+	}
+	s.router.Refresh()
+
+	return nil
+}
+
+func (s *errorPage) GetMaintenance(ctx context.Context, applicationID string) (model.Maintenance, error) {
+	maintenance, err := s.repos.Maintenance.GetOne(ctx, filters.IsSelectFilter("application_id", applicationID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Maintenance{ApplicationID: applicationID}, nil
+	}
+	if err != nil {
+		logger.Error("error getting maintenance: %v", err)
+		return model.Maintenance{}, err
+	}
+	return maintenance, nil
+}
+
+func (s *errorPage) SaveMaintenance(ctx context.Context, applicationID string, req model.MaintenanceRequest) (model.MaintenanceResponse, error) {
+	if _, err := s.repos.Application.GetByID(ctx, applicationID); err != nil {
+		return model.MaintenanceResponse{}, errors.Wrap(err, "application not found")
+	}
+
+	allowIPs := strings.Join(req.AllowIPs, ",")
+	if _, err := neployway.ParseCIDRs(allowIPs); err != nil {
+		return model.MaintenanceResponse{}, errors.Wrap(err, "allow list")
+	}
+
+	current, err := s.GetMaintenance(ctx, applicationID)
+	if err != nil {
+		return model.MaintenanceResponse{}, err
+	}
+	token, created := current.BypassToken, false
+	if token == "" || req.RotateBypassToken {
+		if token, err = generateBypassToken(); err != nil {
+			logger.Error("error generating bypass token: %v", err)
+			return model.MaintenanceResponse{}, err
+		}
+		created = true
+	}
+
+	maintenance, err := s.repos.Maintenance.Upsert(ctx, model.Maintenance{
+		ApplicationID: applicationID,
+		Enabled:       req.Enabled,
+		Message:       req.Message,
+		RetryAfter:    req.RetryAfter,
+		AllowIPs:      allowIPs,
+		BypassToken:   token,
+	})
+	if err != nil {
+		logger.Error("error saving maintenance: %v", err)
+		return model.MaintenanceResponse{}, err
+	}
+	s.router.Refresh()
+
+	response := model.MaintenanceResponse{Maintenance: maintenance}
+	if created {
+		response.BypassToken = token
+	}
+	return response, nil
+}
+
+func generateBypassToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
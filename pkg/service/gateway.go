@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"database/sql"
 	"neploy.dev/pkg/logger"
+	"net/http"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -18,27 +20,28 @@ type Gateway interface {
 	Delete(ctx context.Context, id string) error
 	Get(ctx context.Context, id string) (model.Gateway, error)
 	ListByApp(ctx context.Context, appID string) ([]model.Gateway, error)
-	AddRoute(ctx context.Context, gateway model.Gateway) error
-	RemoveRoute(ctx context.Context, gateway model.Gateway) error
 	GetAll(ctx context.Context) ([]model.FullGateway, error)
 	GetConfig(ctx context.Context) (model.GatewayConfig, error)
 	SaveConfig(ctx context.Context, req model.GatewayConfigRequest) (model.GatewayConfig, error)
+	// LiveRoutes lists the routes the router serves right now
+	LiveRoutes(ctx context.Context) ([]model.LiveRoute, error)
+	// TraceMatch explains which route and version a request would get
+	TraceMatch(ctx context.Context, req model.TraceMatchRequest) (model.RouteMatch, error)
 }
 
 type gateway struct {
-	router *neployway.Router
-	repos  repository.Repositories
+	// router is the one the reconciler owns, it is only read here. Gateway
+	// writes are persisted and then served by a reconciler pass.
+	router     *neployway.Router
+	reconciler Reconciler
+	repos      repository.Repositories
 }
 
-func NewGateway(repos repository.Repositories) Gateway {
+func NewGateway(repos repository.Repositories, router *neployway.Router, reconciler Reconciler) Gateway {
 	return &gateway{
-		router: neployway.NewRouter(
-			repos.ApplicationStat,
-			repos.ApplicationVersion,
-			repos.GatewayConfig,
-			repos.VisitorTrace,
-		),
-		repos: repos,
+		router:     router,
+		reconciler: reconciler,
+		repos:      repos,
 	}
 }
 
@@ -51,12 +54,93 @@ func (s *gateway) validateGateway(ctx context.Context, gateway model.Gateway) er
 		return errors.New("domain is required")
 	}
 
+	switch gateway.GeoMode {
+	case "", neployway.GeoModeAllow, neployway.GeoModeBlock:
+	default:
+		return errors.New("geo mode must be allow or block")
+	}
+	if gateway.GeoMode != "" && len(neployway.ParseCountries(gateway.GeoCountries)) == 0 {
+		return errors.New("geo rules need at least one country")
+	}
+
+	switch gateway.Protocol {
+	case "", neployway.ProtocolH2C, neployway.ProtocolGRPC:
+	default:
+		return errors.New("protocol must be h2c or grpc")
+	}
+
+	if err := validateHealthCheck(gateway); err != nil {
+		return err
+	}
+
 	// Check if application exists
 	_, err := s.repos.Application.GetByID(ctx, gateway.ApplicationID)
 	if err != nil {
 		return errors.Wrap(err, "application not found")
 	}
 
+	return s.validateMirror(ctx, gateway)
+}
+
+// validateMirror checks the mirror targets a version of the gateway's app
+func (s *gateway) validateMirror(ctx context.Context, gateway model.Gateway) error {
+	if gateway.MirrorPercent < 0 || gateway.MirrorPercent > 100 {
+		return errors.New("mirror percent must be between 0 and 100")
+	}
+	if gateway.MirrorVersion == "" {
+		return nil
+	}
+	if gateway.Protocol == neployway.ProtocolGRPC {
+		return errors.New("gRPC gateways can't be mirrored, calls may stream")
+	}
+
+	exists, err := s.repos.ApplicationVersion.Exists(ctx, gateway.ApplicationID, gateway.MirrorVersion)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrap(err, "failed to check mirror version")
+	}
+	if !exists {
+		return errors.New("mirror version not found for the application")
+	}
+	return nil
+}
+
+// validateHealthCheck checks the health settings, zero values are defaults
+func validateHealthCheck(gateway model.Gateway) error {
+	// gRPC gateways are checked with grpc.health.v1, health path names the
+	// service and the HTTP expectations don't apply
+	if gateway.Protocol == neployway.ProtocolGRPC {
+		if strings.Contains(gateway.HealthPath, "/") {
+			return errors.New("health path of a gRPC gateway is a service name, like package.Service")
+		}
+		if gateway.HealthMethod != "" || gateway.HealthExpectedStatus != 0 || gateway.HealthExpectedBody != "" {
+			return errors.New("gRPC health checks take no method, expected status or expected body")
+		}
+	} else if gateway.HealthPath != "" && !strings.HasPrefix(gateway.HealthPath, "/") {
+		return errors.New("health path must start with /")
+	}
+
+	switch gateway.HealthMethod {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions:
+	default:
+		return errors.New("health method must be GET, HEAD, POST or OPTIONS")
+	}
+
+	if gateway.HealthExpectedStatus != 0 && (gateway.HealthExpectedStatus < 100 || gateway.HealthExpectedStatus > 599) {
+		return errors.New("health expected status must be a valid HTTP status")
+	}
+	if gateway.HealthInterval < 0 || (gateway.HealthInterval > 0 && gateway.HealthInterval < 5) || gateway.HealthInterval > 3600 {
+		return errors.New("health interval must be between 5 and 3600 seconds")
+	}
+	if gateway.HealthTimeout < 0 || gateway.HealthTimeout > 60 {
+		return errors.New("health timeout must be between 1 and 60 seconds")
+	}
+	if gateway.HealthInterval > 0 && gateway.HealthTimeout > gateway.HealthInterval {
+		return errors.New("health timeout must not exceed the interval")
+	}
+	if gateway.HealthyThreshold < 0 || gateway.HealthyThreshold > 10 || gateway.UnhealthyThreshold < 0 || gateway.UnhealthyThreshold > 10 {
+		return errors.New("health thresholds must be between 1 and 10")
+	}
+
 	return nil
 }
 
@@ -72,7 +156,8 @@ func (s *gateway) Create(ctx context.Context, gateway model.Gateway) error {
 		return err
 	}
 
-	return s.AddRoute(ctx, gateway)
+	s.reconciler.Trigger()
+	return nil
 }
 
 func (s *gateway) Update(ctx context.Context, gateway model.Gateway) error {
@@ -80,35 +165,30 @@ func (s *gateway) Update(ctx context.Context, gateway model.Gateway) error {
 		return err
 	}
 
-	oldGateway, err := s.Get(ctx, gateway.ID)
-	if err != nil {
-		return err
-	}
-
-	// Remove old route
-	if err := s.RemoveRoute(ctx, oldGateway); err != nil {
+	if _, err := s.Get(ctx, gateway.ID); err != nil {
 		return err
 	}
 
-	// Add new route
-	if err := s.AddRoute(ctx, gateway); err != nil {
+	gateway.Status = "active"
+	if err := s.repos.Gateway.Update(ctx, gateway); err != nil {
 		return err
 	}
 
-	return s.repos.Gateway.Update(ctx, gateway)
+	s.reconciler.Trigger()
+	return nil
 }
 
 func (s *gateway) Delete(ctx context.Context, id string) error {
-	gateway, err := s.Get(ctx, id)
-	if err != nil {
+	if _, err := s.Get(ctx, id); err != nil {
 		return err
 	}
 
-	if err := s.RemoveRoute(ctx, gateway); err != nil {
+	if err := s.repos.Gateway.Delete(ctx, id); err != nil {
 		return err
 	}
 
-	return s.repos.Gateway.Delete(ctx, id)
+	s.reconciler.Trigger()
+	return nil
 }
 
 func (s *gateway) Get(ctx context.Context, id string) (model.Gateway, error) {
@@ -127,35 +207,6 @@ func (s *gateway) ListByApp(ctx context.Context, appID string) ([]model.Gateway,
 	return gateways, nil
 }
 
-func (s *gateway) AddRoute(ctx context.Context, gateway model.Gateway) error {
-	route := neployway.Route{
-		AppID:  gateway.ApplicationID,
-		Port:   gateway.Port,
-		Domain: gateway.Domain,
-		Path:   gateway.Path,
-	}
-
-	if err := s.router.AddRoute(route); err != nil {
-		gateway.Status = "error"
-		s.repos.Gateway.Update(ctx, gateway)
-		return fmt.Errorf("failed to add route: %v", err)
-	}
-
-	gateway.Status = "active"
-	return s.repos.Gateway.Update(ctx, gateway)
-}
-
-func (s *gateway) RemoveRoute(ctx context.Context, gateway model.Gateway) error {
-	route := neployway.Route{
-		AppID:  gateway.ApplicationID,
-		Domain: gateway.Domain,
-		Path:   gateway.Path,
-	}
-
-	s.router.RemoveRoute(route.Path)
-	return nil
-}
-
 func (s *gateway) GetAll(ctx context.Context) ([]model.FullGateway, error) {
 	gateways, err := s.repos.Gateway.GetAll(ctx)
 	if err != nil {
@@ -190,15 +241,121 @@ func (s *gateway) GetConfig(ctx context.Context) (model.GatewayConfig, error) {
 }
 
 func (s *gateway) SaveConfig(ctx context.Context, req model.GatewayConfigRequest) (model.GatewayConfig, error) {
-	config := model.GatewayConfig{
-		DefaultVersioningType: req.DefaultVersioning,
+	config, err := s.repos.GatewayConfig.Get(ctx)
+	if err != nil {
+		logger.Error("error getting gateway config: %v", err)
+		return model.GatewayConfig{}, err
 	}
 
-	config, err := s.repos.GatewayConfig.Upsert(ctx, config)
+	config.DefaultVersioningType = req.DefaultVersioning
+	// Limits are optional in the request, only the ones sent are overwritten
+	if req.ReadTimeout != nil {
+		config.ReadTimeout = *req.ReadTimeout
+	}
+	if req.ReadHeaderTimeout != nil {
+		config.ReadHeaderTimeout = *req.ReadHeaderTimeout
+	}
+	if req.WriteTimeout != nil {
+		config.WriteTimeout = *req.WriteTimeout
+	}
+	if req.IdleTimeout != nil {
+		config.IdleTimeout = *req.IdleTimeout
+	}
+	if req.MaxHeaderBytes != nil {
+		config.MaxHeaderBytes = *req.MaxHeaderBytes
+	}
+	if req.MaxBodyBytes != nil {
+		config.MaxBodyBytes = *req.MaxBodyBytes
+	}
+	if req.MaxConnsPerIP != nil {
+		config.MaxConnsPerIP = *req.MaxConnsPerIP
+	}
+
+	config, err = s.repos.GatewayConfig.Upsert(ctx, config)
 	if err != nil {
 		logger.Error("error saving gateway config: %v", err)
 		return model.GatewayConfig{}, err
 	}
+	s.router.Refresh()
 
 	return config, nil
 }
+
+func (s *gateway) LiveRoutes(ctx context.Context) ([]model.LiveRoute, error) {
+	routes := s.router.LiveRoutes()
+	describe, err := s.routeDescriber(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range routes {
+		describe(&routes[i])
+	}
+	return routes, nil
+}
+
+func (s *gateway) TraceMatch(ctx context.Context, req model.TraceMatchRequest) (model.RouteMatch, error) {
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, req.URL, nil)
+	if err != nil {
+		return model.RouteMatch{}, errors.Wrap(err, "invalid url")
+	}
+	for name, value := range req.Headers {
+		r.Header.Set(name, value)
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		r.Host = host
+	}
+	r.RemoteAddr = req.RemoteAddr
+
+	match := s.router.Explain(r)
+	if match.Route != nil {
+		describe, err := s.routeDescriber(ctx)
+		if err != nil {
+			return model.RouteMatch{}, err
+		}
+		describe(match.Route)
+	}
+	return match, nil
+}
+
+// routeDescriber returns a func filling the gateway, health and application
+// name of a live route. Versioned routes belong to the gateway of their path
+// without the version.
+func (s *gateway) routeDescriber(ctx context.Context) (func(route *model.LiveRoute), error) {
+	gateways, err := s.repos.Gateway.GetAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get gateways")
+	}
+	apps, err := s.repos.Application.GetAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get applications")
+	}
+
+	// Keyed like the route table, the same path may be on several domains
+	byKey := make(map[string]model.Gateway, len(gateways))
+	for _, gateway := range gateways {
+		byKey[neployway.Route{Domain: gateway.Domain, Path: gateway.Path}.Key()] = gateway
+	}
+	names := make(map[string]string, len(apps))
+	for _, app := range apps {
+		names[app.ID] = app.AppName
+	}
+
+	return func(route *model.LiveRoute) {
+		route.ApplicationName = names[route.ApplicationID]
+
+		path := route.Path
+		if route.Version != "" {
+			path = strings.TrimPrefix(path, "/"+route.Version)
+		}
+		if gateway, ok := byKey[neployway.Route{Domain: route.Host, Path: path}.Key()]; ok {
+			route.GatewayID = gateway.ID
+			route.HealthStatus = gateway.HealthStatus
+		}
+	}, nil
+}
@@ -1,36 +1,91 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	neployway "neploy.dev/pkg/gateway"
+	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository"
 )
 
+const (
+	defaultHealthPath         = "/health"
+	defaultHealthTimeout      = 5 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+
+	// healthTick is how often due checks are looked for, the finest
+	// interval a gateway can be checked at
+	healthTick = time.Second
+	// healthReloadEach is how long gateway edits take to reach the checker
+	healthReloadEach = 30 * time.Second
+	// healthWorkers bounds the probes in flight
+	healthWorkers    = 16
+	healthBodyLimit  = 64 << 10
+	healthHistoryMax = 1000
+)
+
+// HealthChecker probes the container port of every gateway on its own
+// interval and keeps each result as history. A gateway turns healthy or
+// unhealthy after its threshold of passes or failures in a row, turning
+// unhealthy and recovering are published as notifications.
 type HealthChecker interface {
 	Start(ctx context.Context)
 	Stop()
-	CheckGatewayHealth(ctx context.Context, gateway model.Gateway) error
+	// CheckGatewayHealth probes gateway once, without recording the result
+	CheckGatewayHealth(ctx context.Context, gateway model.Gateway) model.HealthCheck
+	GetHistory(ctx context.Context, gatewayID string, filter model.StatsFilter) ([]model.HealthCheck, error)
+	GetUptime(ctx context.Context, filter model.StatsFilter) (model.UptimeReport, error)
+}
+
+// gatewayHealth is the schedule and streak of one gateway
+type gatewayHealth struct {
+	gateway   model.Gateway
+	next      time.Time
+	running   bool
+	successes int
+	failures  int
 }
 
 type healthChecker struct {
-	gatewayRepo *repository.Gateway
-	appRepo     *repository.Application
-	interval    time.Duration
-	stopChan    chan struct{}
-	wg          sync.WaitGroup
+	repos         repository.Repositories
+	notifications Notification
+	interval      time.Duration // of gateways without their own
+	client        *http.Client
+	h2cClient     *http.Client // for h2c gateways
+	workers       chan struct{}
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+
+	mu       sync.Mutex
+	gateways map[string]*gatewayHealth
+	loadedAt time.Time
 }
 
-func NewHealthChecker(gatewayRepo *repository.Gateway, appRepo *repository.Application, interval time.Duration) HealthChecker {
+func NewHealthChecker(repos repository.Repositories, notifications Notification, interval time.Duration) HealthChecker {
+	// A redirect is an answer of its own, the expected status decides
+	noRedirects := func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
 	return &healthChecker{
-		gatewayRepo: gatewayRepo,
-		appRepo:     appRepo,
-		interval:    interval,
-		stopChan:    make(chan struct{}),
+		repos:         repos,
+		notifications: notifications,
+		interval:      interval,
+		client:        &http.Client{CheckRedirect: noRedirects},
+		h2cClient:     &http.Client{Transport: neployway.NewH2CTransport(), CheckRedirect: noRedirects},
+		workers:       make(chan struct{}, healthWorkers),
+		stopChan:      make(chan struct{}),
+		gateways:      make(map[string]*gatewayHealth),
 	}
 }
 
@@ -38,7 +93,7 @@ func (h *healthChecker) Start(ctx context.Context) {
 	h.wg.Add(1)
 	go func() {
 		defer h.wg.Done()
-		ticker := time.NewTicker(h.interval)
+		ticker := time.NewTicker(healthTick)
 		defer ticker.Stop()
 
 		for {
@@ -46,7 +101,7 @@ func (h *healthChecker) Start(ctx context.Context) {
 			case <-h.stopChan:
 				return
 			case <-ticker.C:
-				h.checkAllGateways(ctx)
+				h.schedule(ctx)
 			}
 		}
 	}()
@@ -57,56 +112,278 @@ func (h *healthChecker) Stop() {
 	h.wg.Wait()
 }
 
-func (h *healthChecker) checkAllGateways(ctx context.Context) {
-	gateways, err := h.gatewayRepo.GetAll(ctx)
+func (h *healthChecker) GetHistory(ctx context.Context, gatewayID string, filter model.StatsFilter) ([]model.HealthCheck, error) {
+	return h.repos.HealthCheck.GetByGatewayID(ctx, gatewayID, filter.From, filter.To, healthHistoryMax)
+}
+
+func (h *healthChecker) GetUptime(ctx context.Context, filter model.StatsFilter) (model.UptimeReport, error) {
+	days, err := h.repos.HealthCheck.GetDailyUptime(ctx, filter)
 	if err != nil {
-		fmt.Printf("Error fetching gateways: %v\n", err)
+		return model.UptimeReport{}, err
+	}
+
+	report := model.UptimeReport{ApplicationID: filter.ApplicationID, Days: make([]model.UptimeDay, 0, len(days))}
+	for _, day := range days {
+		day.Uptime = uptimePercent(day.Healthy, day.Checks)
+		report.Checks += day.Checks
+		report.Healthy += day.Healthy
+		report.Days = append(report.Days, day)
+	}
+	report.Uptime = uptimePercent(report.Healthy, report.Checks)
+	return report, nil
+}
+
+// uptimePercent is 100 without checks, nothing seen down is taken as up
+func uptimePercent(healthy, checks int64) float64 {
+	if checks == 0 {
+		return 100
+	}
+	return float64(healthy) / float64(checks) * 100
+}
+
+// schedule starts the checks that are due
+func (h *healthChecker) schedule(ctx context.Context) {
+	now := time.Now()
+	if now.Sub(h.loadedAt) >= healthReloadEach {
+		h.reload(ctx, now)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, state := range h.gateways {
+		if state.running || now.Before(state.next) {
+			continue
+		}
+		state.running = true
+		state.next = now.Add(h.intervalOf(state.gateway))
+
+		h.wg.Add(1)
+		go h.run(ctx, state)
+	}
+}
+
+// reload syncs the schedule with the gateways, keeping the streaks of the
+// ones still there. New gateways are spread over their first interval so a
+// restart doesn't probe everything at once.
+func (h *healthChecker) reload(ctx context.Context, now time.Time) {
+	gateways, err := h.repos.Gateway.GetAll(ctx)
+	if err != nil {
+		logger.Error("error getting gateways for health checks: %v", err)
 		return
 	}
 
-	for _, gateway := range gateways {
-		if err := h.CheckGatewayHealth(ctx, gateway); err != nil {
-			fmt.Printf("Health check failed for gateway %s: %v\n", gateway.ID, err)
-			// Update gateway status to unhealthy
-			gateway.Status = "unhealthy"
-			if err := h.gatewayRepo.Update(ctx, gateway); err != nil {
-				fmt.Printf("Failed to update gateway status: %v\n", err)
-			}
-		} else {
-			// Update gateway status to healthy if it was unhealthy before
-			if gateway.Status != "healthy" {
-				gateway.Status = "healthy"
-				if err := h.gatewayRepo.Update(ctx, gateway); err != nil {
-					fmt.Printf("Failed to update gateway status: %v\n", err)
-				}
-			}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loadedAt = now
+
+	current := make(map[string]bool, len(gateways))
+	for i, gateway := range gateways {
+		current[gateway.ID] = true
+		if state, ok := h.gateways[gateway.ID]; ok {
+			state.gateway = gateway
+			continue
+		}
+		offset := h.intervalOf(gateway) * time.Duration(i) / time.Duration(len(gateways))
+		h.gateways[gateway.ID] = &gatewayHealth{gateway: gateway, next: now.Add(offset)}
+	}
+	for id := range h.gateways {
+		if !current[id] {
+			delete(h.gateways, id)
 		}
 	}
 }
 
-func (h *healthChecker) CheckGatewayHealth(ctx context.Context, gateway model.Gateway) error {
-	// Construct health check URL based on gateway configuration
-	var healthCheckURL string = fmt.Sprintf("http://%s%s/health", gateway.Domain, gateway.Path)
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+func (h *healthChecker) run(ctx context.Context, state *gatewayHealth) {
+	defer h.wg.Done()
+
+	select {
+	case h.workers <- struct{}{}:
+	case <-h.stopChan:
+		h.mu.Lock()
+		state.running = false
+		h.mu.Unlock()
+		return
+	}
+
+	h.mu.Lock()
+	gateway := state.gateway
+	h.mu.Unlock()
+
+	check := h.CheckGatewayHealth(ctx, gateway)
+	<-h.workers
+
+	if _, err := h.repos.HealthCheck.InsertOne(ctx, check); err != nil {
+		logger.Error("error saving health check of gateway %s: %v", gateway.ID, err)
+	}
+
+	h.mu.Lock()
+	state.running = false
+	if check.Healthy {
+		state.successes++
+		state.failures = 0
+	} else {
+		state.failures++
+		state.successes = 0
+	}
+
+	previous := state.gateway.HealthStatus
+	status := previous
+	switch {
+	case check.Healthy && state.successes >= thresholdOf(gateway.HealthyThreshold, defaultHealthyThreshold):
+		status = model.HealthHealthy
+	case !check.Healthy && state.failures >= thresholdOf(gateway.UnhealthyThreshold, defaultUnhealthyThreshold):
+		status = model.HealthUnhealthy
+	}
+	state.gateway.HealthStatus = status
+	h.mu.Unlock()
+
+	if status == previous {
+		return
+	}
+	if err := h.repos.Gateway.SetHealthStatus(ctx, gateway.ID, status); err != nil {
+		logger.Error("error updating health of gateway %s: %v", gateway.ID, err)
+	}
+	// Coming up after a restart isn't news, going down or recovering is
+	if status == model.HealthUnhealthy || previous == model.HealthUnhealthy {
+		gateway.HealthStatus = status
+		h.notifyHealth(ctx, gateway, check)
+	}
+}
+
+func (h *healthChecker) intervalOf(gateway model.Gateway) time.Duration {
+	if gateway.HealthInterval > 0 {
+		return time.Duration(gateway.HealthInterval) * time.Second
+	}
+	return h.interval
+}
+
+func thresholdOf(value, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// notifyHealth publishes a gateway going unhealthy or recovering
+func (h *healthChecker) notifyHealth(ctx context.Context, gateway model.Gateway, check model.HealthCheck) {
+	if h.notifications == nil {
+		return
+	}
+
+	event := model.NotificationEvent{
+		Type:          model.EventGatewayHealth,
+		Severity:      model.AlertSeverityInfo,
+		Title:         fmt.Sprintf("Gateway %s%s recovered", gateway.Domain, gateway.Path),
+		Message:       "The health check passes again.",
+		ApplicationID: gateway.ApplicationID,
+		Fields: map[string]string{
+			"gateway": gateway.ID,
+			"status":  gateway.HealthStatus,
+		},
 	}
+	if !check.Healthy {
+		event.Severity = model.AlertSeverityCritical
+		event.Title = fmt.Sprintf("Gateway %s%s is unhealthy", gateway.Domain, gateway.Path)
+		event.Message = check.Error
+	}
+	h.notifications.Publish(ctx, event)
+}
 
-	// Make health check request
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthCheckURL, nil)
+func (h *healthChecker) CheckGatewayHealth(ctx context.Context, gateway model.Gateway) model.HealthCheck {
+	start := time.Now()
+	check := model.HealthCheck{
+		GatewayID:     gateway.ID,
+		ApplicationID: gateway.ApplicationID,
+		CheckedAt:     model.NewDate(start),
+	}
+	if gateway.Port == "" {
+		check.Error = "gateway has no container port"
+		return check
+	}
+
+	path := gateway.HealthPath
+	if path == "" {
+		path = defaultHealthPath
+	}
+	method := gateway.HealthMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := defaultHealthTimeout
+	if gateway.HealthTimeout > 0 {
+		timeout = time.Duration(gateway.HealthTimeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if gateway.Protocol == neployway.ProtocolGRPC {
+		return h.checkGRPC(ctx, gateway, check, start)
+	}
+	client := h.client
+	if gateway.Protocol == neployway.ProtocolH2C {
+		client = h.h2cClient
+	}
+
+	// Straight to the container, the route in front of it is not under test
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://localhost:%s%s", gateway.Port, path), nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		check.Error = fmt.Sprintf("failed to create request: %v", err)
+		return check
 	}
+	req.Header.Set("User-Agent", "Neploy-HealthCheck")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("health check request failed: %v", err)
+		check.LatencyMs = time.Since(start).Milliseconds()
+		check.Error = fmt.Sprintf("health check request failed: %v", err)
+		return check
 	}
 	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, healthBodyLimit))
+	check.LatencyMs = time.Since(start).Milliseconds()
+	check.StatusCode = resp.StatusCode
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("health check returned non-200 status: %d", resp.StatusCode)
+	switch {
+	case gateway.HealthExpectedStatus != 0 && resp.StatusCode != gateway.HealthExpectedStatus:
+		check.Error = fmt.Sprintf("health check returned status %d, expected %d", resp.StatusCode, gateway.HealthExpectedStatus)
+	case gateway.HealthExpectedStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299):
+		check.Error = fmt.Sprintf("health check returned non-2xx status: %d", resp.StatusCode)
+	case gateway.HealthExpectedBody != "" && err != nil:
+		check.Error = fmt.Sprintf("failed to read health check body: %v", err)
+	case gateway.HealthExpectedBody != "" && !bytes.Contains(body, []byte(gateway.HealthExpectedBody)):
+		check.Error = fmt.Sprintf("health check body does not contain %q", gateway.HealthExpectedBody)
+	default:
+		check.Healthy = true
+	}
+	return check
+}
+
+// checkGRPC calls grpc.health.v1.Health/Check on the container. Health path
+// names the service, the whole server is checked without one.
+func (h *healthChecker) checkGRPC(ctx context.Context, gateway model.Gateway, check model.HealthCheck, start time.Time) model.HealthCheck {
+	conn, err := grpc.NewClient("localhost:"+gateway.Port,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUserAgent("Neploy-HealthCheck"),
+	)
+	if err != nil {
+		check.Error = fmt.Sprintf("failed to create gRPC client: %v", err)
+		return check
 	}
+	defer conn.Close()
 
-	return nil
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: gateway.HealthPath})
+	check.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = fmt.Sprintf("gRPC health check failed with %s: %s", status.Code(err), status.Convert(err).Message())
+		return check
+	}
+
+	check.StatusCode = http.StatusOK
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		check.Error = fmt.Sprintf("gRPC health check returned %s", resp.GetStatus())
+		return check
+	}
+	check.Healthy = true
+	return check
 }
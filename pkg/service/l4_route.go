@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	neployway "neploy.dev/pkg/gateway"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+// L4Route manages the raw TCP and UDP routes. Changes are applied to the
+// forwarder right away, the reconciler catches up with the ones that fail.
+type L4Route interface {
+	// List returns the routes of an app with their counters, all of them
+	// when applicationID is empty
+	List(ctx context.Context, applicationID string) ([]model.L4RouteStatus, error)
+	Create(ctx context.Context, req model.L4RouteRequest) (model.L4Route, error)
+	Update(ctx context.Context, id string, req model.L4RouteRequest) (model.L4Route, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type l4Route struct {
+	repos     repository.Repositories
+	forwarder *neployway.Forwarder
+}
+
+func NewL4Route(repos repository.Repositories, forwarder *neployway.Forwarder) L4Route {
+	return &l4Route{repos: repos, forwarder: forwarder}
+}
+
+func (s *l4Route) List(ctx context.Context, applicationID string) ([]model.L4RouteStatus, error) {
+	routes, err := s.repos.L4Route.GetByApplicationID(ctx, applicationID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list L4 routes")
+	}
+
+	stats := s.forwarder.Stats()
+	statuses := make([]model.L4RouteStatus, 0, len(routes))
+	for _, route := range routes {
+		statuses = append(statuses, model.L4RouteStatus{Route: route, Stats: stats[route.ID]})
+	}
+	return statuses, nil
+}
+
+func (s *l4Route) Create(ctx context.Context, req model.L4RouteRequest) (model.L4Route, error) {
+	route, err := s.routeFromRequest(ctx, model.L4Route{Enabled: true}, req)
+	if err != nil {
+		return model.L4Route{}, err
+	}
+
+	route, err = s.repos.L4Route.InsertOne(ctx, route)
+	if err != nil {
+		logger.Error("error creating L4 route: %v", err)
+		return model.L4Route{}, errors.Wrap(err, "failed to create L4 route, is the port or SNI host taken?")
+	}
+
+	// A route that can't listen is not kept, the port is likely in use
+	if err := s.apply(route); err != nil {
+		if err := s.repos.L4Route.Delete(ctx, route.ID); err != nil {
+			logger.Error("error removing L4 route %s: %v", route.ID, err)
+		}
+		return model.L4Route{}, err
+	}
+	return route, nil
+}
+
+func (s *l4Route) Update(ctx context.Context, id string, req model.L4RouteRequest) (model.L4Route, error) {
+	route, err := s.repos.L4Route.GetOneById(ctx, id)
+	if err != nil {
+		return model.L4Route{}, errors.Wrap(err, "L4 route not found")
+	}
+
+	route, err = s.routeFromRequest(ctx, route, req)
+	if err != nil {
+		return model.L4Route{}, err
+	}
+
+	// The forwarder keeps serving the old route when the new one can't listen
+	if err := s.apply(route); err != nil {
+		return model.L4Route{}, err
+	}
+
+	route, err = s.repos.L4Route.UpdateOneById(ctx, id, route)
+	if err != nil {
+		logger.Error("error updating L4 route: %v", err)
+		return model.L4Route{}, err
+	}
+	return route, nil
+}
+
+func (s *l4Route) Delete(ctx context.Context, id string) error {
+	if err := s.repos.L4Route.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.forwarder.RemoveRoute(id)
+	return nil
+}
+
+func (s *l4Route) apply(route model.L4Route) error {
+	if !route.Enabled {
+		s.forwarder.RemoveRoute(route.ID)
+		return nil
+	}
+
+	forward, err := forwarderRoute(route)
+	if err != nil {
+		return err
+	}
+	if err := s.forwarder.AddRoute(forward); err != nil {
+		return errors.Wrap(err, "failed to add L4 route")
+	}
+	return nil
+}
+
+func (s *l4Route) routeFromRequest(ctx context.Context, route model.L4Route, req model.L4RouteRequest) (model.L4Route, error) {
+	if _, err := s.repos.Application.GetByID(ctx, req.ApplicationID); err != nil {
+		return model.L4Route{}, errors.Wrap(err, "application not found")
+	}
+
+	route.ApplicationID = req.ApplicationID
+	route.Protocol = req.Protocol
+	route.ListenPort = req.ListenPort
+	route.SNIHost = strings.ToLower(req.SNIHost)
+	route.TargetPort = req.TargetPort
+	route.MaxConns = req.MaxConns
+	route.IdleTimeout = req.IdleTimeout
+	route.AllowCIDRs = strings.Join(req.AllowCIDRs, ",")
+	route.DenyCIDRs = strings.Join(req.DenyCIDRs, ",")
+	if req.Enabled != nil {
+		route.Enabled = *req.Enabled
+	}
+
+	forward, err := forwarderRoute(route)
+	if err != nil {
+		return model.L4Route{}, err
+	}
+	if err := neployway.ValidateL4Route(forward); err != nil {
+		return model.L4Route{}, err
+	}
+
+	return route, nil
+}
+
+// forwarderRoute converts a stored route to the one the forwarder serves
+func forwarderRoute(route model.L4Route) (neployway.L4Route, error) {
+	allow, err := neployway.ParseCIDRs(route.AllowCIDRs)
+	if err != nil {
+		return neployway.L4Route{}, errors.Wrap(err, "allow list")
+	}
+	deny, err := neployway.ParseCIDRs(route.DenyCIDRs)
+	if err != nil {
+		return neployway.L4Route{}, errors.Wrap(err, "deny list")
+	}
+
+	return neployway.L4Route{
+		ID:          route.ID,
+		AppID:       route.ApplicationID,
+		Protocol:    route.Protocol,
+		ListenPort:  route.ListenPort,
+		SNIHost:     strings.ToLower(route.SNIHost),
+		TargetPort:  route.TargetPort,
+		MaxConns:    route.MaxConns,
+		IdleTimeout: time.Duration(route.IdleTimeout) * time.Second,
+		Allow:       allow,
+		Deny:        deny,
+	}, nil
+}
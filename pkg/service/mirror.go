@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+// recentMirrorSamples is how many of the last mirrored requests a
+// comparison lists
+const recentMirrorSamples = 50
+
+// Mirror compares candidate versions with the versions serving the
+// requests mirrored to them. Mirrors are set on the gateways.
+type Mirror interface {
+	Compare(ctx context.Context, applicationID, versionID string, filter model.StatsFilter) (model.MirrorComparison, error)
+}
+
+type mirror struct {
+	repos repository.Repositories
+}
+
+func NewMirror(repos repository.Repositories) Mirror {
+	return &mirror{repos: repos}
+}
+
+func (s *mirror) Compare(ctx context.Context, applicationID, versionID string, filter model.StatsFilter) (model.MirrorComparison, error) {
+	version, err := s.repos.ApplicationVersion.GetOneById(ctx, versionID)
+	if err != nil || version.ApplicationID != applicationID {
+		return model.MirrorComparison{}, errors.New("version not found")
+	}
+
+	comparison, err := s.repos.MirrorSample.Compare(ctx, applicationID, version.VersionTag, filter.From, filter.To)
+	if err != nil {
+		return model.MirrorComparison{}, errors.Wrap(err, "failed to compare mirrored requests")
+	}
+
+	comparison.Recent, err = s.repos.MirrorSample.GetRecent(ctx, applicationID, version.VersionTag, recentMirrorSamples)
+	if err != nil {
+		return model.MirrorComparison{}, errors.Wrap(err, "failed to get mirrored requests")
+	}
+
+	return comparison, nil
+}
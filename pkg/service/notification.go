@@ -0,0 +1,379 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/notify"
+	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/repository/filters"
+)
+
+const (
+	notificationAttempts  = 6
+	notificationRetryBase = 30 * time.Second
+	notificationPollEach  = 10 * time.Second
+	notificationBatch     = 50
+	notificationLogLimit  = 500
+	// Long enough for a whole batch of senders to time out
+	notificationClaimLease = 15 * time.Minute
+)
+
+// Notification manages the outbound channels and routes events to them.
+// Publishing stores a pending delivery per channel the event is routed to,
+// a background loop sends them and retries failures with exponential
+// backoff until they run out of attempts. Deliveries are kept as a log.
+type Notification interface {
+	AlertNotifier
+	Start(ctx context.Context)
+	Stop()
+	// Publish routes event to the enabled channels subscribed to its type
+	Publish(ctx context.Context, event model.NotificationEvent)
+	GetChannels(ctx context.Context) ([]model.NotificationChannel, error)
+	CreateChannel(ctx context.Context, req model.NotificationChannelRequest) (model.NotificationChannel, error)
+	UpdateChannel(ctx context.Context, id string, req model.NotificationChannelRequest) (model.NotificationChannel, error)
+	DeleteChannel(ctx context.Context, id string) error
+	// TestChannel sends a test event right away, without retrying it
+	TestChannel(ctx context.Context, id string) (model.NotificationDelivery, error)
+	GetDeliveries(ctx context.Context, filter model.NotificationDeliveryFilter) ([]model.NotificationDelivery, error)
+}
+
+type notification struct {
+	repos    repository.Repositories
+	senders  map[model.NotificationChannelType]notify.Sender
+	stopChan chan struct{}
+	// wake starts a delivery pass as soon as something is published
+	wake chan struct{}
+	wg   sync.WaitGroup
+	// mu keeps delivery passes from overlapping with each other
+	mu sync.Mutex
+}
+
+func NewNotification(repos repository.Repositories, senders map[model.NotificationChannelType]notify.Sender) Notification {
+	return &notification{
+		repos:    repos,
+		senders:  senders,
+		stopChan: make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (n *notification) Start(ctx context.Context) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		ticker := time.NewTicker(notificationPollEach)
+		defer ticker.Stop()
+
+		// Pick up what was left pending before a restart
+		n.deliverDue(ctx)
+		for {
+			select {
+			case <-n.stopChan:
+				return
+			case <-ticker.C:
+				n.deliverDue(ctx)
+			case <-n.wake:
+				n.deliverDue(ctx)
+			}
+		}
+	}()
+}
+
+func (n *notification) Stop() {
+	close(n.stopChan)
+	n.wg.Wait()
+}
+
+func (n *notification) GetChannels(ctx context.Context) ([]model.NotificationChannel, error) {
+	return n.repos.NotificationChannel.GetAll(ctx)
+}
+
+func (n *notification) CreateChannel(ctx context.Context, req model.NotificationChannelRequest) (model.NotificationChannel, error) {
+	channel := channelFromRequest(model.NotificationChannel{Enabled: true}, req)
+
+	channel, err := n.repos.NotificationChannel.InsertOne(ctx, channel)
+	if err != nil {
+		logger.Error("error creating notification channel: %v", err)
+		return model.NotificationChannel{}, err
+	}
+	return channel, nil
+}
+
+func (n *notification) UpdateChannel(ctx context.Context, id string, req model.NotificationChannelRequest) (model.NotificationChannel, error) {
+	channel, err := n.repos.NotificationChannel.GetOneById(ctx, id)
+	if err != nil {
+		return model.NotificationChannel{}, errors.Wrap(err, "notification channel not found")
+	}
+
+	channel, err = n.repos.NotificationChannel.UpdateOneById(ctx, id, channelFromRequest(channel, req))
+	if err != nil {
+		logger.Error("error updating notification channel: %v", err)
+		return model.NotificationChannel{}, err
+	}
+	return channel, nil
+}
+
+func (n *notification) DeleteChannel(ctx context.Context, id string) error {
+	return n.repos.NotificationChannel.Delete(ctx, id)
+}
+
+func (n *notification) GetDeliveries(ctx context.Context, filter model.NotificationDeliveryFilter) ([]model.NotificationDelivery, error) {
+	return n.repos.NotificationDelivery.GetLog(ctx, filter, notificationLogLimit)
+}
+
+func channelFromRequest(channel model.NotificationChannel, req model.NotificationChannelRequest) model.NotificationChannel {
+	channel.Name = req.Name
+	channel.Type = req.Type
+	channel.URL = req.URL
+	if req.Secret != "" {
+		channel.Secret = req.Secret
+	}
+	channel.Recipients = strings.Join(req.Recipients, ",")
+	channel.Events = strings.Join(req.Events, ",")
+	if req.Enabled != nil {
+		channel.Enabled = *req.Enabled
+	}
+	return channel
+}
+
+func (n *notification) TestChannel(ctx context.Context, id string) (model.NotificationDelivery, error) {
+	channel, err := n.repos.NotificationChannel.GetOneById(ctx, id)
+	if err != nil {
+		return model.NotificationDelivery{}, errors.Wrap(err, "notification channel not found")
+	}
+
+	event := model.NotificationEvent{
+		Type:       model.EventTest,
+		Severity:   model.AlertSeverityInfo,
+		Title:      "Test notification",
+		Message:    fmt.Sprintf("Channel %s is set up to receive Neploy notifications.", channel.Name),
+		OccurredAt: time.Now(),
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return model.NotificationDelivery{}, err
+	}
+
+	delivery := model.NotificationDelivery{
+		ChannelID: channel.ID,
+		Event:     event.Type,
+		Payload:   string(payload),
+		Status:    model.DeliveryPending,
+	}
+	n.attempt(ctx, channel, &delivery, event, 1)
+
+	delivery, err = n.repos.NotificationDelivery.InsertOne(ctx, delivery)
+	if err != nil {
+		logger.Error("error logging test notification: %v", err)
+		return model.NotificationDelivery{}, err
+	}
+	return delivery, nil
+}
+
+func (n *notification) Publish(ctx context.Context, event model.NotificationEvent) {
+	n.publish(ctx, event, nil)
+}
+
+// Notify routes an alert to the channels named in the targets of its rule,
+// by ID or name, or to the channels subscribed to alerts when it has none
+func (n *notification) Notify(ctx context.Context, rule model.AlertRule, al model.Alert) error {
+	var targets []string
+	for _, target := range strings.Split(rule.Targets, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+
+	title := fmt.Sprintf("Alert %s: %s", al.Status, rule.Name)
+	severity := al.Severity
+	if al.Status == model.AlertResolved {
+		title = "Resolved: " + rule.Name
+		severity = model.AlertSeverityInfo
+	}
+
+	event := model.NotificationEvent{
+		Type:          model.EventAlert,
+		Severity:      severity,
+		Title:         title,
+		Message:       al.Message,
+		ApplicationID: al.ApplicationID,
+		Fields: map[string]string{
+			"alert":     al.ID,
+			"metric":    string(rule.Metric),
+			"value":     fmt.Sprintf("%.2f", al.Value),
+			"threshold": fmt.Sprintf("%.2f", rule.Threshold),
+			"status":    string(al.Status),
+		},
+	}
+	return n.publish(ctx, event, targets)
+}
+
+// publish stores a pending delivery of event per channel it is routed to.
+// With targets it goes to those channels only, whatever they subscribe to.
+func (n *notification) publish(ctx context.Context, event model.NotificationEvent, targets []string) error {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	if event.ApplicationID != "" {
+		if _, ok := event.Fields["application"]; !ok {
+			if app, err := n.repos.Application.GetByID(ctx, event.ApplicationID); err == nil {
+				if event.Fields == nil {
+					event.Fields = make(map[string]string)
+				}
+				event.Fields["application"] = app.AppName
+			}
+		}
+	}
+
+	channels, err := n.repos.NotificationChannel.GetAll(ctx, filters.IsSelectFilter("enabled", true))
+	if err != nil {
+		logger.Error("error getting notification channels: %v", err)
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := model.NewDate(time.Now())
+	for _, channel := range channels {
+		if !routes(channel, event.Type, targets) {
+			continue
+		}
+
+		delivery := model.NotificationDelivery{
+			ChannelID:     channel.ID,
+			Event:         event.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if _, err := n.repos.NotificationDelivery.InsertOne(ctx, delivery); err != nil {
+			logger.Error("error queueing %s notification for channel %s: %v", event.Type, channel.Name, err)
+		}
+	}
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// routes tells whether channel takes events of eventType
+func routes(channel model.NotificationChannel, eventType model.NotificationEventType, targets []string) bool {
+	if len(targets) > 0 {
+		return slices.Contains(targets, channel.ID) || slices.Contains(targets, channel.Name)
+	}
+	if channel.Events == "" {
+		return true
+	}
+	return slices.Contains(strings.Split(channel.Events, ","), string(eventType))
+}
+
+// deliverDue sends the pending deliveries whose next attempt is due
+func (n *notification) deliverDue(ctx context.Context) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for {
+		deliveries, err := n.repos.NotificationDelivery.ClaimDue(ctx, time.Now(), notificationClaimLease, notificationBatch)
+		if err != nil {
+			logger.Error("error getting due notifications: %v", err)
+			return
+		}
+
+		channels := make(map[string]*model.NotificationChannel)
+		for _, delivery := range deliveries {
+			channel, ok := channels[delivery.ChannelID]
+			if !ok {
+				if found, err := n.repos.NotificationChannel.GetOneById(ctx, delivery.ChannelID); err == nil {
+					channel = &found
+				}
+				channels[delivery.ChannelID] = channel
+			}
+			n.deliver(ctx, channel, delivery)
+		}
+
+		if len(deliveries) < notificationBatch {
+			return
+		}
+		select {
+		case <-n.stopChan:
+			return
+		default:
+		}
+	}
+}
+
+func (n *notification) deliver(ctx context.Context, channel *model.NotificationChannel, delivery model.NotificationDelivery) {
+	var event model.NotificationEvent
+	switch {
+	case channel == nil:
+		delivery.Status = model.DeliveryFailed
+		delivery.LastError = "channel was deleted"
+		delivery.NextAttemptAt = nil
+	case !channel.Enabled:
+		delivery.Status = model.DeliveryFailed
+		delivery.LastError = "channel was disabled"
+		delivery.NextAttemptAt = nil
+	case json.Unmarshal([]byte(delivery.Payload), &event) != nil:
+		delivery.Status = model.DeliveryFailed
+		delivery.LastError = "malformed payload"
+		delivery.NextAttemptAt = nil
+	default:
+		n.attempt(ctx, *channel, &delivery, event, notificationAttempts)
+	}
+
+	delivery.LockedUntil = nil
+	if _, err := n.repos.NotificationDelivery.UpdateOneById(ctx, delivery.ID, delivery); err != nil {
+		logger.Error("error updating notification delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// attempt sends event once and moves delivery along, a failure is retried
+// with exponential backoff until maxAttempts have been made
+func (n *notification) attempt(ctx context.Context, channel model.NotificationChannel, delivery *model.NotificationDelivery, event model.NotificationEvent, maxAttempts int) {
+	delivery.Attempts++
+
+	sender, ok := n.senders[channel.Type]
+	if !ok {
+		delivery.Status = model.DeliveryFailed
+		delivery.LastError = fmt.Sprintf("no sender for %s channels", channel.Type)
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	status, err := sender.Send(ctx, channel, event)
+	delivery.ResponseStatus = status
+	now := time.Now()
+	if err == nil {
+		delivered := model.NewDate(now)
+		delivery.Status = model.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &delivered
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= maxAttempts {
+		logger.Error("giving up on %s notification for channel %s after %d attempts: %v", event.Type, channel.Name, delivery.Attempts, err)
+		delivery.Status = model.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	next := model.NewDate(now.Add(notificationRetryBase << (delivery.Attempts - 1)))
+	delivery.NextAttemptAt = &next
+}
@@ -0,0 +1,501 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	neploker "neploy.dev/pkg/docker"
+	neployway "neploy.dev/pkg/gateway"
+	"neploy.dev/pkg/logger"
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/repository/filters"
+)
+
+// Reconciler is the single owner of the router table, the L4 forwarder and
+// the application containers. On an interval it compares the gateways, L4
+// routes and versions in the database with the routes being served and the
+// containers Docker runs, converges them and reports the drift it found.
+type Reconciler interface {
+	Start(ctx context.Context)
+	Stop()
+	// RunOnce reconciles once, with dryRun the drift is only reported
+	RunOnce(ctx context.Context, dryRun bool) model.ReconcileReport
+	LastReport() (model.ReconcileReport, bool)
+	// Trigger schedules a pass without waiting for it, for writes to the
+	// gateways or versions to be served before the next interval
+	Trigger()
+}
+
+type reconciler struct {
+	repos         repository.Repositories
+	router        *neployway.Router
+	forwarder     *neployway.Forwarder
+	docker        *neploker.Docker
+	dockerService Docker
+	interval      time.Duration
+	// containers is false to only report container drift
+	containers bool
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	// running keeps a manual run and the periodic one from overlapping
+	running sync.Mutex
+	trigger chan struct{}
+
+	mu     sync.Mutex
+	last   model.ReconcileReport
+	hasRun bool
+}
+
+func NewReconciler(repos repository.Repositories, router *neployway.Router, forwarder *neployway.Forwarder, notifications Notification, interval time.Duration, containers bool) Reconciler {
+	dockerClient := neploker.NewDocker()
+	r := &reconciler{
+		repos:      repos,
+		router:     router,
+		forwarder:  forwarder,
+		docker:     dockerClient,
+		interval:   interval,
+		containers: containers,
+		trigger:    make(chan struct{}, 1),
+	}
+	r.dockerService = NewDocker(repos, nil, dockerClient, r, notifications)
+	return r
+}
+
+// Start runs a first pass, which also loads the router table at startup,
+// and then one every interval and on every Trigger. A zero interval keeps
+// the first pass and the triggered ones.
+func (r *reconciler) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		r.RunOnce(ctx, false)
+		var tick <-chan time.Time
+		if r.interval > 0 {
+			ticker := time.NewTicker(r.interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		} else {
+			logger.Warn("Periodic reconciling disabled, set RECONCILE_EACH to enable it")
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+			case <-r.trigger:
+			}
+			r.RunOnce(ctx, false)
+		}
+	}()
+}
+
+func (r *reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *reconciler) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+}
+
+func (r *reconciler) LastReport() (model.ReconcileReport, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last, r.hasRun
+}
+
+// RunOnce converges the routes first, they are cheap and requests depend on
+// them, then the containers
+func (r *reconciler) RunOnce(ctx context.Context, dryRun bool) model.ReconcileReport {
+	r.running.Lock()
+	defer r.running.Unlock()
+
+	report := model.ReconcileReport{StartedAt: time.Now().UTC(), DryRun: dryRun, Drift: make([]model.ReconcileDrift, 0)}
+
+	apps, versions, err := r.loadVersions(ctx)
+	if err != nil {
+		logger.Error("error loading versions to reconcile: %v", err)
+		report.Errors = append(report.Errors, "versions: "+err.Error())
+	} else {
+		if err := r.reconcileRoutes(ctx, &report, apps, versions, dryRun); err != nil {
+			logger.Error("error reconciling routes: %v", err)
+			report.Errors = append(report.Errors, "routes: "+err.Error())
+		}
+		if err := r.reconcileL4Routes(ctx, &report, dryRun); err != nil {
+			logger.Error("error reconciling L4 routes: %v", err)
+			report.Errors = append(report.Errors, "l4 routes: "+err.Error())
+		}
+		if err := r.reconcileContainers(ctx, &report, apps, versions, dryRun || !r.containers); err != nil {
+			logger.Error("error reconciling containers: %v", err)
+			report.Errors = append(report.Errors, "containers: "+err.Error())
+		}
+	}
+
+	for _, drift := range report.Drift {
+		neploymetrics.ReconcileDrift(drift.Kind)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	// A dry run leaves the last report of the real runs alone
+	if !dryRun {
+		r.mu.Lock()
+		r.last = report
+		r.hasRun = true
+		r.mu.Unlock()
+	}
+
+	return report
+}
+
+// loadVersions returns the applications and their versions by application id
+func (r *reconciler) loadVersions(ctx context.Context) ([]model.Application, map[string][]model.ApplicationVersion, error) {
+	apps, err := r.repos.Application.GetAll(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	versions := make(map[string][]model.ApplicationVersion, len(apps))
+	for _, app := range apps {
+		appVersions, err := r.repos.ApplicationVersion.GetAll(ctx, filters.IsSelectFilter("application_id", app.ID))
+		if err != nil {
+			return nil, nil, err
+		}
+		versions[app.ID] = appVersions
+	}
+
+	return apps, versions, nil
+}
+
+// desiredRoutes builds the routes of every gateway: one per version under
+// /{version}{path} and the unversioned one for the default version. gRPC
+// gateways only get the unversioned one, calls are not versioned. mirrors
+// holds the mirror of the gateways that have one, by gateway id. The routes
+// are keyed like the route table, see neployway.Route.Key.
+func desiredRoutes(gateways []model.Gateway, versions map[string][]model.ApplicationVersion, mirrors map[string]neployway.RouteMirror) map[string]neployway.Route {
+	routes := make(map[string]neployway.Route)
+	for _, gateway := range gateways {
+		route := neployway.Route{
+			AppID:        gateway.ApplicationID,
+			Port:         gateway.Port,
+			Domain:       gateway.Domain,
+			Path:         gateway.Path,
+			MaxBodyBytes: gateway.MaxBodyBytes,
+			GeoMode:      gateway.GeoMode,
+			GeoCountries: neployway.ParseCountries(gateway.GeoCountries),
+			Protocol:     gateway.Protocol,
+			Mirror:       mirrors[gateway.ID],
+		}
+		routes[route.Key()] = route
+		if route.Protocol == neployway.ProtocolGRPC {
+			continue
+		}
+
+		for _, version := range versions[gateway.ApplicationID] {
+			versioned := route
+			versioned.Path = fmt.Sprintf("/%s%s", version.VersionTag, gateway.Path)
+			routes[versioned.Key()] = versioned
+		}
+	}
+	return routes
+}
+
+func sameRoute(a, b neployway.Route) bool {
+	return a.AppID == b.AppID &&
+		a.Port == b.Port &&
+		a.Domain == b.Domain &&
+		a.Path == b.Path &&
+		a.MaxBodyBytes == b.MaxBodyBytes &&
+		a.GeoMode == b.GeoMode &&
+		a.Protocol == b.Protocol &&
+		a.Mirror == b.Mirror &&
+		slices.Equal(a.GeoCountries, b.GeoCountries)
+}
+
+// mirrorTargets finds the host port of the candidate container of every
+// gateway that mirrors, by gateway id. A gateway whose candidate has no
+// container running gets no mirror.
+func (r *reconciler) mirrorTargets(ctx context.Context, apps []model.Application, gateways []model.Gateway) (map[string]neployway.RouteMirror, error) {
+	mirrors := make(map[string]neployway.RouteMirror)
+	mirroring := slices.ContainsFunc(gateways, func(gateway model.Gateway) bool {
+		return gateway.MirrorVersion != "" && gateway.MirrorPercent > 0 && gateway.Protocol != neployway.ProtocolGRPC
+	})
+	if !mirroring {
+		return mirrors, nil
+	}
+
+	containers, err := r.docker.ListContainers(ctx)
+	if err != nil {
+		return mirrors, err
+	}
+	ports := make(map[string]string, len(containers))
+	for _, ctnr := range containers {
+		if ctnr.State != "running" {
+			continue
+		}
+		for _, port := range ctnr.Ports {
+			if port.PublicPort != 0 && port.Type == "tcp" {
+				for _, name := range ctnr.Names {
+					ports[strings.TrimPrefix(name, "/")] = fmt.Sprint(port.PublicPort)
+				}
+				break
+			}
+		}
+	}
+
+	appNames := make(map[string]string, len(apps))
+	for _, app := range apps {
+		appNames[app.ID] = app.AppName
+	}
+	for _, gateway := range gateways {
+		if gateway.MirrorVersion == "" || gateway.MirrorPercent <= 0 || gateway.Protocol == neployway.ProtocolGRPC {
+			continue
+		}
+
+		name := getContainerName(appNames[gateway.ApplicationID], gateway.MirrorVersion)
+		port, ok := ports[name]
+		if !ok {
+			logger.Warn("Gateway %s mirrors to %s but container %s is not running", gateway.Path, gateway.MirrorVersion, name)
+			continue
+		}
+		mirrors[gateway.ID] = neployway.RouteMirror{Version: gateway.MirrorVersion, Port: port, Percent: gateway.MirrorPercent}
+	}
+	return mirrors, nil
+}
+
+func (r *reconciler) reconcileRoutes(ctx context.Context, report *model.ReconcileReport, apps []model.Application, versions map[string][]model.ApplicationVersion, dryRun bool) error {
+	gateways, err := r.repos.Gateway.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Routes are still served without their mirrors when Docker can't be asked
+	mirrors, err := r.mirrorTargets(ctx, apps, gateways)
+	if err != nil {
+		logger.Error("error finding mirror targets: %v", err)
+		report.Errors = append(report.Errors, "mirrors: "+err.Error())
+	}
+
+	desired := desiredRoutes(gateways, versions, mirrors)
+	report.Routes = len(desired)
+
+	actual := make(map[string]neployway.Route)
+	for _, route := range r.router.Routes() {
+		actual[route.Key()] = route
+	}
+
+	for key, route := range desired {
+		current, ok := actual[key]
+		if ok && sameRoute(current, route) {
+			continue
+		}
+
+		drift := model.ReconcileDrift{Kind: model.DriftRouteMissing, Target: key, ApplicationID: route.AppID}
+		action := model.ReconcileAdded
+		if ok {
+			drift.Kind, action = model.DriftRouteChanged, model.ReconcileUpdated
+		}
+		if !dryRun {
+			if err := r.router.AddRoute(route); err != nil {
+				drift.Error = err.Error()
+			} else {
+				drift.Action = action
+			}
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+
+	for key, route := range actual {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+
+		drift := model.ReconcileDrift{Kind: model.DriftRouteStale, Target: key, ApplicationID: route.AppID}
+		if !dryRun {
+			r.router.RemoveRoute(key)
+			drift.Action = model.ReconcileRemoved
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+
+	return nil
+}
+
+func sameL4Route(a, b neployway.L4Route) bool {
+	return a.AppID == b.AppID &&
+		a.Protocol == b.Protocol &&
+		a.ListenPort == b.ListenPort &&
+		a.SNIHost == b.SNIHost &&
+		a.TargetPort == b.TargetPort &&
+		a.MaxConns == b.MaxConns &&
+		a.IdleTimeout == b.IdleTimeout &&
+		slices.Equal(a.Allow, b.Allow) &&
+		slices.Equal(a.Deny, b.Deny)
+}
+
+// reconcileL4Routes converges the forwarder with the enabled L4 routes, by
+// route id. A route that fails to listen is retried on the next run.
+func (r *reconciler) reconcileL4Routes(ctx context.Context, report *model.ReconcileReport, dryRun bool) error {
+	stored, err := r.repos.L4Route.GetAll(ctx, filters.IsSelectFilter("enabled", true))
+	if err != nil {
+		return err
+	}
+
+	desired := make(map[string]neployway.L4Route, len(stored))
+	for _, route := range stored {
+		forward, err := forwarderRoute(route)
+		if err != nil {
+			report.Errors = append(report.Errors, "l4 route "+route.ID+": "+err.Error())
+			continue
+		}
+		desired[route.ID] = forward
+	}
+	report.L4Routes = len(desired)
+
+	actual := make(map[string]neployway.L4Route)
+	for _, route := range r.forwarder.Routes() {
+		actual[route.ID] = route
+	}
+
+	for id, route := range desired {
+		current, ok := actual[id]
+		if ok && sameL4Route(current, route) {
+			continue
+		}
+
+		drift := model.ReconcileDrift{Kind: model.DriftRouteMissing, Target: route.Listen(), ApplicationID: route.AppID}
+		action := model.ReconcileAdded
+		if ok {
+			drift.Kind, action = model.DriftRouteChanged, model.ReconcileUpdated
+		}
+		if !dryRun {
+			if err := r.forwarder.AddRoute(route); err != nil {
+				drift.Error = err.Error()
+			} else {
+				drift.Action = action
+			}
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+
+	for id, route := range actual {
+		if _, ok := desired[id]; ok {
+			continue
+		}
+
+		drift := model.ReconcileDrift{Kind: model.DriftRouteStale, Target: route.Listen(), ApplicationID: route.AppID}
+		if !dryRun {
+			r.forwarder.RemoveRoute(id)
+			drift.Action = model.ReconcileRemoved
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+
+	return nil
+}
+
+// reconcileContainers starts the containers of the versions that should run
+// and stops the ones of inactive versions. Paused versions are left alone.
+func (r *reconciler) reconcileContainers(ctx context.Context, report *model.ReconcileReport, apps []model.Application, versions map[string][]model.ApplicationVersion, reportOnly bool) error {
+	containers, err := r.docker.ListContainers(ctx)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]types.Container, len(containers))
+	for _, ctnr := range containers {
+		for _, name := range ctnr.Names {
+			byName[strings.TrimPrefix(name, "/")] = ctnr
+		}
+	}
+
+	for _, app := range apps {
+		// A deploy or upload still building the versions of the app would
+		// race the containers created here, they are left to the next pass
+		lock := deployLock(app.ID)
+		if !lock.TryLock() {
+			logger.Debug("skipping the containers of %s, a deploy is in progress", app.AppName)
+			continue
+		}
+		r.reconcileAppContainers(ctx, report, app, versions[app.ID], byName, reportOnly)
+		lock.Unlock()
+	}
+
+	return nil
+}
+
+func (r *reconciler) reconcileAppContainers(ctx context.Context, report *model.ReconcileReport, app model.Application, versions []model.ApplicationVersion, byName map[string]types.Container, reportOnly bool) {
+	for _, version := range versions {
+		if version.Status == "paused" {
+			continue
+		}
+
+		name := getContainerName(app.AppName, version.VersionTag)
+		ctnr, exists := byName[name]
+		running := exists && ctnr.State == "running"
+		expected := version.Status != "inactive"
+		if expected {
+			report.Containers++
+		}
+		if running == expected {
+			continue
+		}
+
+		drift := model.ReconcileDrift{Target: name, ApplicationID: app.ID, Version: version.VersionTag}
+		var action string
+		var err error
+		switch {
+		case !expected:
+			drift.Kind, action = model.DriftContainerUnwanted, model.ReconcileStopped
+			if !reportOnly {
+				err = r.docker.StopContainer(ctx, ctnr.ID)
+			}
+		case exists:
+			drift.Kind, action = model.DriftContainerStopped, model.ReconcileStarted
+			if !reportOnly {
+				err = r.docker.StartContainer(ctx, ctnr.ID)
+			}
+		default:
+			drift.Kind, action = model.DriftContainerMissing, model.ReconcileCreated
+			if !reportOnly {
+				err = r.createContainer(ctx, app, version)
+			}
+		}
+
+		if err != nil {
+			logger.Error("error reconciling container %s: %v", name, err)
+			drift.Error = err.Error()
+		} else if !reportOnly {
+			drift.Action = action
+		}
+		report.Drift = append(report.Drift, drift)
+	}
+}
+
+// createContainer builds and starts the container of a version that has
+// none, from the Dockerfile of its deployment
+func (r *reconciler) createContainer(ctx context.Context, app model.Application, version model.ApplicationVersion) error {
+	if version.StorageLocation == "" {
+		return fmt.Errorf("version %s has no deployment to build from", version.VersionTag)
+	}
+
+	port, err := r.dockerService.ConfigurePort(filepath.Join(version.StorageLocation, "Dockerfile"), false)
+	if err != nil {
+		return err
+	}
+	return r.dockerService.CreateAndStartContainer(ctx, app, version, port)
+}
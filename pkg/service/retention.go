@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"neploy.dev/pkg/logger"
+	neploymetrics "neploy.dev/pkg/metrics"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+// tracePurgeBatch is how many audit traces, health checks or mirror samples
+// one delete statement removes
+const tracePurgeBatch = 5000
+
+// RetentionPolicy is how long each table keeps its rows, zero keeps them forever
+type RetentionPolicy struct {
+	StatsHourly   time.Duration // then rolled up into days
+	StatsDaily    time.Duration // then rolled up into months
+	StatsMonthly  time.Duration // then deleted
+	VisitorTraces time.Duration // then aggregated per day and deleted
+	Traces        time.Duration // then deleted
+	HealthChecks  time.Duration // then deleted
+	MirrorSamples time.Duration // then deleted
+}
+
+// Retention downsamples and purges stats, visitor traces, audit traces,
+// health checks and mirror samples on an interval, so they stop growing forever. Each run
+// produces a report of the rows it processed.
+type Retention interface {
+	Start(ctx context.Context)
+	Stop()
+	RunOnce(ctx context.Context) model.RetentionReport
+	LastReport() (model.RetentionReport, bool)
+}
+
+type retention struct {
+	repos    repository.Repositories
+	policy   RetentionPolicy
+	interval time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	last   model.RetentionReport
+	hasRun bool
+}
+
+func NewRetention(repos repository.Repositories, policy RetentionPolicy, interval time.Duration) Retention {
+	return &retention{
+		repos:    repos,
+		policy:   policy,
+		interval: interval,
+	}
+}
+
+func (r *retention) Start(ctx context.Context) {
+	if r.interval <= 0 {
+		logger.Warn("Retention jobs disabled, set RETENTION_RUN_EACH to enable them")
+		return
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		r.RunOnce(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.RunOnce(ctx)
+			}
+		}
+	}()
+}
+
+// Stop cancels a run in progress, its current transaction is rolled back
+func (r *retention) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+}
+
+func (r *retention) LastReport() (model.RetentionReport, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last, r.hasRun
+}
+
+// RunOnce applies the policy once. A failing job is reported and the next
+// ones still run.
+func (r *retention) RunOnce(ctx context.Context) model.RetentionReport {
+	report := model.RetentionReport{StartedAt: time.Now().UTC(), Results: make([]model.RetentionResult, 0)}
+	now := report.StartedAt
+
+	record := func(job string, results []model.RetentionResult, err error) {
+		for _, result := range results {
+			report.Results = append(report.Results, result)
+			neploymetrics.RetentionRows(result.Table, result.Action, result.Rows)
+		}
+		if err != nil {
+			logger.Error("error running %s retention: %v", job, err)
+			report.Errors = append(report.Errors, job+": "+err.Error())
+		}
+	}
+
+	if r.policy.StatsHourly > 0 {
+		results, err := r.repos.ApplicationStat.RollupHourly(ctx, startOfDay(now.Add(-r.policy.StatsHourly)))
+		record("hourly stats", results, err)
+
+		rows, err := r.repos.ApplicationStat.DeleteSegmentsBefore(ctx, now.Add(-r.policy.StatsHourly))
+		record("stats segments", []model.RetentionResult{{Table: "application_stat_segments", Action: model.RetentionDeleted, Rows: rows}}, err)
+	}
+	if r.policy.StatsDaily > 0 {
+		results, err := r.repos.ApplicationStat.RollupDaily(ctx, startOfMonth(now.Add(-r.policy.StatsDaily)))
+		record("daily stats", results, err)
+	}
+	if r.policy.StatsMonthly > 0 {
+		results, err := r.repos.ApplicationStat.DeleteMonthly(ctx, startOfMonth(now.Add(-r.policy.StatsMonthly)))
+		record("monthly stats", results, err)
+	}
+	if r.policy.VisitorTraces > 0 {
+		result, err := r.rollupVisitorTraces(ctx, startOfDay(now.Add(-r.policy.VisitorTraces)))
+		record("visitor traces", []model.RetentionResult{result}, err)
+	}
+	if r.policy.Traces > 0 {
+		result, err := r.purgeTraces(ctx, now.Add(-r.policy.Traces))
+		record("traces", []model.RetentionResult{result}, err)
+	}
+	if r.policy.HealthChecks > 0 {
+		result, err := r.purgeHealthChecks(ctx, now.Add(-r.policy.HealthChecks))
+		record("health checks", []model.RetentionResult{result}, err)
+	}
+	if r.policy.MirrorSamples > 0 {
+		result, err := r.purgeMirrorSamples(ctx, now.Add(-r.policy.MirrorSamples))
+		record("mirror samples", []model.RetentionResult{result}, err)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+
+	var rows int64
+	for _, result := range report.Results {
+		rows += result.Rows
+	}
+	logger.Info("Retention run processed %d rows in %s with %d errors", rows, report.FinishedAt.Sub(report.StartedAt), len(report.Errors))
+
+	r.mu.Lock()
+	r.last = report
+	r.hasRun = true
+	r.mu.Unlock()
+
+	return report
+}
+
+// rollupVisitorTraces aggregates and deletes the traces before boundary one
+// day at a time, so a large backlog never runs as a single transaction
+func (r *retention) rollupVisitorTraces(ctx context.Context, boundary time.Time) (model.RetentionResult, error) {
+	total := model.RetentionResult{Table: r.repos.VisitorTrace.Table, Action: model.RetentionRolledUp}
+	for ctx.Err() == nil {
+		oldest, err := r.repos.VisitorTrace.Oldest(ctx)
+		if err != nil {
+			return total, err
+		}
+		if oldest == nil || !oldest.Before(boundary) {
+			return total, nil
+		}
+
+		result, err := r.repos.VisitorTrace.RollupDay(ctx, startOfDay(*oldest))
+		if err != nil {
+			return total, err
+		}
+		total.Rows += result.Rows
+		// Nothing left to move past the oldest trace, stop rather than spin
+		if result.Rows == 0 {
+			return total, nil
+		}
+	}
+	return total, ctx.Err()
+}
+
+func (r *retention) purgeTraces(ctx context.Context, before time.Time) (model.RetentionResult, error) {
+	total := model.RetentionResult{Table: r.repos.Trace.Table, Action: model.RetentionDeleted}
+	for ctx.Err() == nil {
+		rows, err := r.repos.Trace.DeleteBefore(ctx, before, tracePurgeBatch)
+		if err != nil {
+			return total, err
+		}
+		total.Rows += rows
+		if rows < tracePurgeBatch {
+			return total, nil
+		}
+	}
+	return total, ctx.Err()
+}
+
+func (r *retention) purgeHealthChecks(ctx context.Context, before time.Time) (model.RetentionResult, error) {
+	total := model.RetentionResult{Table: r.repos.HealthCheck.Table, Action: model.RetentionDeleted}
+	for ctx.Err() == nil {
+		rows, err := r.repos.HealthCheck.DeleteBefore(ctx, before, tracePurgeBatch)
+		if err != nil {
+			return total, err
+		}
+		total.Rows += rows
+		if rows < tracePurgeBatch {
+			return total, nil
+		}
+	}
+	return total, ctx.Err()
+}
+
+func (r *retention) purgeMirrorSamples(ctx context.Context, before time.Time) (model.RetentionResult, error) {
+	total := model.RetentionResult{Table: r.repos.MirrorSample.Table, Action: model.RetentionDeleted}
+	for ctx.Err() == nil {
+		rows, err := r.repos.MirrorSample.DeleteBefore(ctx, before, tracePurgeBatch)
+		if err != nil {
+			return total, err
+		}
+		total.Rows += rows
+		if rows < tracePurgeBatch {
+			return total, nil
+		}
+	}
+	return total, ctx.Err()
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -1,14 +1,25 @@
 package service
 
 type Services struct {
-	Application   Application
-	Gateway       Gateway
-	HealthChecker HealthChecker
-	Metadata      Metadata
-	Onboard       Onboard
-	Role          Role
-	TechStack     TechStack
-	Trace         Trace
-	User          User
-	Visitor       Visitor
+	Alert            Alert
+	Application      Application
+	ContainerMetrics ContainerMetrics
+	Deprecation      Deprecation
+	EmailOutbox      EmailOutbox
+	ErrorPage        ErrorPage
+	Gateway          Gateway
+	HealthChecker    HealthChecker
+	L4Route          L4Route
+	Metadata         Metadata
+	Mirror           Mirror
+	Notification     Notification
+	Onboard          Onboard
+	Reconciler       Reconciler
+	Retention        Retention
+	Role             Role
+	StatusPage       StatusPage
+	TechStack        TechStack
+	Trace            Trace
+	User             User
+	Visitor          Visitor
 }
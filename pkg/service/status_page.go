@@ -0,0 +1,476 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"neploy.dev/pkg/logger"
+	"neploy.dev/pkg/model"
+	"neploy.dev/pkg/repository"
+)
+
+const (
+	// statusPageDays is the uptime window of the status page bars
+	statusPageDays = 90
+	// statusPageResolvedFor is how long resolved incidents stay on the page
+	statusPageResolvedFor = 7 * 24 * time.Hour
+	// statusPageCacheFor keeps the public page from aggregating the health
+	// check history on every visit
+	statusPageCacheFor = 30 * time.Second
+)
+
+// StatusPage builds the public status page from the gateway health checks
+// and the incidents posted by admins, and the monthly SLA reports of each
+// application.
+type StatusPage interface {
+	GetPage(ctx context.Context) (model.StatusPage, error)
+	GetApplications(ctx context.Context) ([]model.StatusPageApplication, error)
+	SetApplications(ctx context.Context, req model.StatusPageRequest) ([]model.StatusPageApplication, error)
+	GetIncidents(ctx context.Context, filter model.StatsFilter) ([]model.Incident, error)
+	CreateIncident(ctx context.Context, req model.IncidentRequest) (model.Incident, error)
+	AddIncidentUpdate(ctx context.Context, id string, req model.IncidentUpdateRequest) (model.Incident, error)
+	DeleteIncident(ctx context.Context, id string) error
+	// GetSLAReport reports the calendar month of month, in UTC
+	GetSLAReport(ctx context.Context, applicationID string, month time.Time) (model.SLAReport, error)
+}
+
+type statusPage struct {
+	repos     repository.Repositories
+	slaTarget float64
+
+	mu       sync.Mutex
+	cached   model.StatusPage
+	cachedAt time.Time
+}
+
+func NewStatusPage(repos repository.Repositories, slaTarget float64) StatusPage {
+	return &statusPage{repos: repos, slaTarget: slaTarget}
+}
+
+func (s *statusPage) GetPage(ctx context.Context) (model.StatusPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.cachedAt) < statusPageCacheFor {
+		return s.cached, nil
+	}
+
+	page, err := s.buildPage(ctx)
+	if err != nil {
+		return model.StatusPage{}, err
+	}
+	s.cached, s.cachedAt = page, time.Now()
+	return page, nil
+}
+
+// invalidate makes the next visit rebuild the page, so admin changes show
+// right away
+func (s *statusPage) invalidate() {
+	s.mu.Lock()
+	s.cachedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+func (s *statusPage) buildPage(ctx context.Context) (model.StatusPage, error) {
+	now := time.Now().UTC()
+	page := model.StatusPage{
+		Status:       model.StatusOperational,
+		Applications: make([]model.StatusPageComponent, 0),
+		GeneratedAt:  now,
+	}
+
+	metadata, err := s.repos.Metadata.Get(ctx)
+	if err != nil {
+		logger.Error("error getting metadata for the status page: %v", err)
+		return model.StatusPage{}, err
+	}
+	page.TeamName, page.LogoURL = metadata.TeamName, metadata.LogoURL
+
+	listed, err := s.repos.StatusPageApplication.GetOrdered(ctx)
+	if err != nil {
+		return model.StatusPage{}, err
+	}
+	applications, err := s.repos.Application.GetAll(ctx)
+	if err != nil {
+		logger.Error("error getting applications for the status page: %v", err)
+		return model.StatusPage{}, err
+	}
+	gateways, err := s.repos.Gateway.GetAll(ctx)
+	if err != nil {
+		logger.Error("error getting gateways for the status page: %v", err)
+		return model.StatusPage{}, err
+	}
+
+	from := startOfDay(now).AddDate(0, 0, -(statusPageDays - 1))
+	days, err := s.repos.HealthCheck.GetDailyUptime(ctx, model.StatsFilter{From: &from})
+	if err != nil {
+		return model.StatusPage{}, err
+	}
+
+	incidents, err := s.repos.Incident.GetOpenOrSince(ctx, now.Add(-statusPageResolvedFor))
+	if err != nil {
+		return model.StatusPage{}, err
+	}
+	if err := s.attachUpdates(ctx, incidents); err != nil {
+		return model.StatusPage{}, err
+	}
+
+	names := make(map[string]string, len(applications))
+	for _, app := range applications {
+		names[app.ID] = app.AppName
+	}
+	health := make(map[string][]string)
+	for _, gateway := range gateways {
+		health[gateway.ApplicationID] = append(health[gateway.ApplicationID], gateway.HealthStatus)
+	}
+	daysByApp := make(map[string][]model.UptimeDay)
+	for _, day := range days {
+		daysByApp[day.ApplicationID] = append(daysByApp[day.ApplicationID], day)
+	}
+
+	shown := make(map[string]bool, len(listed))
+	for _, entry := range listed {
+		name, ok := names[entry.ApplicationID]
+		if !ok {
+			continue
+		}
+		if entry.DisplayName != "" {
+			name = entry.DisplayName
+		}
+		shown[entry.ApplicationID] = true
+
+		component := model.StatusPageComponent{
+			ID:     entry.ApplicationID,
+			Name:   name,
+			Status: applicationStatus(health[entry.ApplicationID], incidentImpact(incidents, entry.ApplicationID)),
+		}
+		var checks, healthy int64
+		component.Days = fillUptimeDays(entry.ApplicationID, daysByApp[entry.ApplicationID], from, statusPageDays)
+		for _, day := range component.Days {
+			checks += day.Checks
+			healthy += day.Healthy
+		}
+		component.Uptime = uptimePercent(healthy, checks)
+
+		page.Status = worseStatus(page.Status, component.Status)
+		page.Applications = append(page.Applications, component)
+	}
+
+	// Only the incidents of listed applications or of the whole platform
+	page.Incidents = make([]model.Incident, 0, len(incidents))
+	for _, incident := range incidents {
+		if incident.ApplicationID != nil && !shown[*incident.ApplicationID] {
+			continue
+		}
+		if incident.ApplicationID == nil && incident.ResolvedAt == nil {
+			page.Status = worseStatus(page.Status, impactStatus(incident.Impact))
+		}
+		page.Incidents = append(page.Incidents, incident)
+	}
+
+	return page, nil
+}
+
+// applicationStatus is an outage when every gateway fails its checks and
+// degraded when some do, an open incident makes it at least as bad as its
+// impact
+func applicationStatus(gateways []string, impact string) string {
+	status := model.StatusUnknown
+	if len(gateways) > 0 {
+		var healthy, unhealthy int
+		for _, health := range gateways {
+			switch health {
+			case model.HealthHealthy:
+				healthy++
+			case model.HealthUnhealthy:
+				unhealthy++
+			}
+		}
+		switch {
+		case unhealthy == len(gateways):
+			status = model.StatusOutage
+		case unhealthy > 0:
+			status = model.StatusDegraded
+		case healthy > 0:
+			status = model.StatusOperational
+		}
+	}
+
+	if impact != "" {
+		status = worseStatus(status, impactStatus(impact))
+	}
+	return status
+}
+
+// incidentImpact is the worst impact of the open incidents of an application
+func incidentImpact(incidents []model.Incident, applicationID string) string {
+	impact := ""
+	for _, incident := range incidents {
+		if incident.ResolvedAt != nil || incident.ApplicationID == nil || *incident.ApplicationID != applicationID {
+			continue
+		}
+		if incident.Impact == model.IncidentMajor || impact == "" {
+			impact = incident.Impact
+		}
+	}
+	return impact
+}
+
+func impactStatus(impact string) string {
+	if impact == model.IncidentMajor {
+		return model.StatusOutage
+	}
+	return model.StatusDegraded
+}
+
+var statusRank = map[string]int{
+	model.StatusOperational: 0,
+	model.StatusUnknown:     1,
+	model.StatusDegraded:    2,
+	model.StatusOutage:      3,
+}
+
+func worseStatus(a, b string) string {
+	if statusRank[b] > statusRank[a] {
+		return b
+	}
+	return a
+}
+
+// fillUptimeDays returns count days from from on, the ones without checks
+// included with zero counts and a 100% uptime
+func fillUptimeDays(applicationID string, days []model.UptimeDay, from time.Time, count int) []model.UptimeDay {
+	byDate := make(map[string]model.UptimeDay, len(days))
+	for _, day := range days {
+		byDate[day.Date.UTC().Format(time.DateOnly)] = day
+	}
+
+	filled := make([]model.UptimeDay, 0, count)
+	for i := 0; i < count; i++ {
+		date := from.AddDate(0, 0, i)
+		day, ok := byDate[date.Format(time.DateOnly)]
+		if !ok {
+			day = model.UptimeDay{ApplicationID: applicationID}
+		}
+		day.Date = model.NewDate(date)
+		day.Uptime = uptimePercent(day.Healthy, day.Checks)
+		filled = append(filled, day)
+	}
+	return filled
+}
+
+func (s *statusPage) attachUpdates(ctx context.Context, incidents []model.Incident) error {
+	ids := make([]string, 0, len(incidents))
+	for _, incident := range incidents {
+		ids = append(ids, incident.ID)
+	}
+	updates, err := s.repos.IncidentUpdate.GetByIncidentIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byIncident := make(map[string][]model.IncidentUpdate, len(incidents))
+	for _, update := range updates {
+		byIncident[update.IncidentID] = append(byIncident[update.IncidentID], update)
+	}
+	for i := range incidents {
+		incidents[i].Updates = byIncident[incidents[i].ID]
+		if incidents[i].Updates == nil {
+			incidents[i].Updates = make([]model.IncidentUpdate, 0)
+		}
+	}
+	return nil
+}
+
+func (s *statusPage) GetApplications(ctx context.Context) ([]model.StatusPageApplication, error) {
+	return s.repos.StatusPageApplication.GetOrdered(ctx)
+}
+
+func (s *statusPage) SetApplications(ctx context.Context, req model.StatusPageRequest) ([]model.StatusPageApplication, error) {
+	apps := make([]model.StatusPageApplication, 0, len(req.Applications))
+	seen := make(map[string]bool, len(req.Applications))
+	for i, entry := range req.Applications {
+		if seen[entry.ApplicationID] {
+			return nil, fmt.Errorf("application %s is listed twice", entry.ApplicationID)
+		}
+		seen[entry.ApplicationID] = true
+
+		if _, err := s.repos.Application.GetByID(ctx, entry.ApplicationID); err != nil {
+			return nil, errors.Wrap(err, "application not found")
+		}
+		apps = append(apps, model.StatusPageApplication{
+			ApplicationID: entry.ApplicationID,
+			DisplayName:   entry.DisplayName,
+			Position:      i,
+		})
+	}
+
+	if err := s.repos.StatusPageApplication.Replace(ctx, apps); err != nil {
+		logger.Error("error saving status page applications: %v", err)
+		return nil, err
+	}
+	s.invalidate()
+	return s.repos.StatusPageApplication.GetOrdered(ctx)
+}
+
+func (s *statusPage) GetIncidents(ctx context.Context, filter model.StatsFilter) ([]model.Incident, error) {
+	to := time.Now()
+	if filter.To != nil {
+		to = *filter.To
+	}
+	from := to.AddDate(0, 0, -statusPageDays)
+	if filter.From != nil {
+		from = *filter.From
+	}
+
+	incidents, err := s.repos.Incident.GetInRange(ctx, filter.ApplicationID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return incidents, s.attachUpdates(ctx, incidents)
+}
+
+func (s *statusPage) CreateIncident(ctx context.Context, req model.IncidentRequest) (model.Incident, error) {
+	now := time.Now()
+	incident := model.Incident{
+		Title:     req.Title,
+		Impact:    req.Impact,
+		Status:    req.Status,
+		StartedAt: model.NewDate(now),
+	}
+	if incident.Status == "" {
+		incident.Status = model.IncidentInvestigating
+	}
+	if req.StartedAt != nil {
+		incident.StartedAt = model.NewDate(*req.StartedAt)
+	}
+	if incident.Status == model.IncidentResolved {
+		resolved := model.NewDate(now)
+		incident.ResolvedAt = &resolved
+	}
+	if req.ApplicationID != "" {
+		if _, err := s.repos.Application.GetByID(ctx, req.ApplicationID); err != nil {
+			return model.Incident{}, errors.Wrap(err, "application not found")
+		}
+		incident.ApplicationID = &req.ApplicationID
+	}
+
+	incident, err := s.repos.Incident.InsertOne(ctx, incident)
+	if err != nil {
+		logger.Error("error creating incident: %v", err)
+		return model.Incident{}, err
+	}
+
+	update, err := s.repos.IncidentUpdate.InsertOne(ctx, model.IncidentUpdate{
+		IncidentID: incident.ID,
+		Status:     incident.Status,
+		Message:    req.Message,
+	})
+	if err != nil {
+		logger.Error("error creating incident update: %v", err)
+		return model.Incident{}, err
+	}
+	incident.Updates = []model.IncidentUpdate{update}
+
+	s.invalidate()
+	return incident, nil
+}
+
+// AddIncidentUpdate posts a note and moves the incident to its status,
+// resolving it or reopening it as needed
+func (s *statusPage) AddIncidentUpdate(ctx context.Context, id string, req model.IncidentUpdateRequest) (model.Incident, error) {
+	incident, err := s.repos.Incident.GetOneById(ctx, id)
+	if err != nil {
+		return model.Incident{}, errors.Wrap(err, "incident not found")
+	}
+
+	if _, err := s.repos.IncidentUpdate.InsertOne(ctx, model.IncidentUpdate{
+		IncidentID: id,
+		Status:     req.Status,
+		Message:    req.Message,
+	}); err != nil {
+		logger.Error("error creating incident update: %v", err)
+		return model.Incident{}, err
+	}
+
+	incident.Status = req.Status
+	switch {
+	case req.Status == model.IncidentResolved && incident.ResolvedAt == nil:
+		resolved := model.NewDate(time.Now())
+		incident.ResolvedAt = &resolved
+	case req.Status != model.IncidentResolved:
+		incident.ResolvedAt = nil
+	}
+	incident, err = s.repos.Incident.UpdateOneById(ctx, id, incident)
+	if err != nil {
+		logger.Error("error updating incident: %v", err)
+		return model.Incident{}, err
+	}
+
+	incidents := []model.Incident{incident}
+	if err := s.attachUpdates(ctx, incidents); err != nil {
+		return model.Incident{}, err
+	}
+	s.invalidate()
+	return incidents[0], nil
+}
+
+func (s *statusPage) DeleteIncident(ctx context.Context, id string) error {
+	if err := s.repos.Incident.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *statusPage) GetSLAReport(ctx context.Context, applicationID string, month time.Time) (model.SLAReport, error) {
+	application, err := s.repos.Application.GetByID(ctx, applicationID)
+	if err != nil {
+		return model.SLAReport{}, errors.Wrap(err, "application not found")
+	}
+
+	from := startOfMonth(month)
+	end := from.AddDate(0, 1, 0)
+	now := time.Now().UTC()
+	if from.After(now) {
+		return model.SLAReport{}, errors.New("month is in the future")
+	}
+	to := end
+	if now.Before(end) {
+		to = now
+	}
+
+	last := end.Add(-time.Nanosecond)
+	days, err := s.repos.HealthCheck.GetDailyUptime(ctx, model.StatsFilter{ApplicationID: applicationID, From: &from, To: &last})
+	if err != nil {
+		return model.SLAReport{}, err
+	}
+	incidents, err := s.repos.Incident.GetInRange(ctx, applicationID, from, to)
+	if err != nil {
+		return model.SLAReport{}, err
+	}
+	if err := s.attachUpdates(ctx, incidents); err != nil {
+		return model.SLAReport{}, err
+	}
+
+	report := model.SLAReport{
+		ApplicationID:   applicationID,
+		ApplicationName: application.AppName,
+		Month:           from.Format("2006-01"),
+		From:            from,
+		To:              to,
+		Target:          s.slaTarget,
+		Incidents:       incidents,
+		Days:            fillUptimeDays(applicationID, days, from, int(end.Sub(from).Hours()/24)),
+	}
+	for _, day := range report.Days {
+		report.Checks += day.Checks
+		report.Healthy += day.Healthy
+	}
+	report.Uptime = uptimePercent(report.Healthy, report.Checks)
+	report.Met = report.Uptime >= report.Target
+	report.DowntimeMinutes = (100 - report.Uptime) / 100 * to.Sub(from).Minutes()
+	return report, nil
+}
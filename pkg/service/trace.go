@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"slices"
 
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository"
@@ -17,35 +18,25 @@ type Trace interface {
 
 type trace struct {
 	repo *repository.Trace
-	user *repository.User
 }
 
-func NewTrace(repo *repository.Trace, user *repository.User) Trace {
-	return &trace{repo, user}
+func NewTrace(repo *repository.Trace) Trace {
+	return &trace{repo}
 }
 
+// GetAll returns the traces oldest first, only the last limit ones when given
 func (t *trace) GetAll(ctx context.Context, limit ...uint) ([]model.Trace, error) {
-	traces, err := t.repo.GetAll(ctx)
-	if err != nil {
-		return nil, err
+	var n uint
+	if len(limit) == 1 {
+		n = limit[0]
 	}
 
-	for i, trace := range traces {
-		user, err := t.user.GetOneById(ctx, trace.UserID)
-		if err != nil {
-			return nil, err
-		}
-
-		traces[i].Email = user.Email
-	}
-
-	if len(limit) == 1 && limit[0] > 0 {
-		if limit[0] > uint(len(traces)) {
-			limit[0] = uint(len(traces))
-		}
-		traces = traces[len(traces)-int(limit[0]):]
+	traces, err := t.repo.GetAll(ctx, n)
+	if err != nil {
+		return nil, err
 	}
 
+	slices.Reverse(traces)
 	return traces, nil
 }
 
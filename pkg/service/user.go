@@ -45,8 +45,8 @@ type user struct {
 	email *email.Email
 }
 
-func NewUser(repos repository.Repositories) User {
-	return &user{repos: repos, email: email.NewEmail()}
+func NewUser(repos repository.Repositories, mail *email.Email) User {
+	return &user{repos: repos, email: mail}
 }
 
 func (u *user) Create(ctx context.Context, req model.CreateUserRequest) error {
@@ -496,7 +496,7 @@ func (u *user) NewPasswordLink(ctx context.Context, userEmail, language string)
 	}
 
 	// 4. Enviar email
-	if err := u.email.SendPasswordReset(user.Email, emailData); err != nil {
+	if err := u.email.SendPasswordReset(ctx, user.Email, emailData); err != nil {
 		logger.Error("error sending password reset email %v", err)
 		return "", err
 	}
@@ -22,6 +22,7 @@ import (
 	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository"
+	"neploy.dev/pkg/semver"
 	"neploy.dev/pkg/websocket"
 )
 
@@ -43,6 +44,10 @@ func NewVersioning(repos repository.Repositories, hub *websocket.Hub, docker *ne
 }
 
 func (v *versioning) Deploy(ctx context.Context, id string, repoURL string, branch string) error {
+	lock := deployLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
 	app, err := v.repos.Application.GetByID(ctx, id)
 	if err != nil {
 		logger.Error("error getting application: %v", err)
@@ -163,6 +168,10 @@ func (v *versioning) Deploy(ctx context.Context, id string, repoURL string, bran
 }
 
 func (v *versioning) Upload(ctx context.Context, id string, file *multipart.FileHeader) (string, error) {
+	lock := deployLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
 	app, err := v.repos.Application.GetByID(ctx, id)
 	if err != nil {
 		logger.Error("error getting application: %v", err)
@@ -439,7 +448,12 @@ func getLatestGitTag(repoURL string) (string, error) {
 		return "", fmt.Errorf("no valid tags found")
 	}
 
-	return tags[len(tags)-1], nil // último tag asumido más reciente
+	// ls-remote lists tags by name, so the order says nothing about which
+	// is the newest
+	if tag, ok := semver.Latest(tags); ok {
+		return tag, nil
+	}
+	return tags[len(tags)-1], nil // ningún tag semántico, se asume el último
 }
 
 func sanitizeAppName(name string) string {
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 
+	"neploy.dev/pkg/logger"
 	"neploy.dev/pkg/model"
 	"neploy.dev/pkg/repository"
 )
@@ -13,6 +14,7 @@ type Visitor interface {
 	CreateTrace(context.Context, model.VisitorTrace) error
 	UpdateTrace(context.Context, model.VisitorTrace) error
 	DeleteTrace(context.Context, string) error
+	GetReport(context.Context, model.StatsFilter) (model.VisitorReport, error)
 }
 
 type visitor struct {
@@ -42,3 +44,51 @@ func (v *visitor) UpdateTrace(ctx context.Context, visitorTrace model.VisitorTra
 func (v *visitor) DeleteTrace(ctx context.Context, id string) error {
 	return v.trace.Delete(ctx, id)
 }
+
+// GetReport builds the visitor, session, page, referrer and location
+// analytics of the filter range
+func (v *visitor) GetReport(ctx context.Context, filter model.StatsFilter) (model.VisitorReport, error) {
+	var (
+		report model.VisitorReport
+		err    error
+	)
+
+	if report.UniqueVisitors, err = v.trace.GetUniqueVisitors(ctx, filter); err != nil {
+		logger.Error("error getting unique visitors: %v", err)
+		return report, err
+	}
+	if report.Sessions, err = v.trace.GetSessionStats(ctx, filter); err != nil {
+		logger.Error("error getting session stats: %v", err)
+		return report, err
+	}
+	if report.TopPages, err = v.trace.GetTopPages(ctx, filter); err != nil {
+		logger.Error("error getting top pages: %v", err)
+		return report, err
+	}
+	if report.EntryPages, err = v.trace.GetEntryPages(ctx, filter); err != nil {
+		logger.Error("error getting entry pages: %v", err)
+		return report, err
+	}
+	if report.ExitPages, err = v.trace.GetExitPages(ctx, filter); err != nil {
+		logger.Error("error getting exit pages: %v", err)
+		return report, err
+	}
+	if report.Referrers, err = v.trace.GetReferrers(ctx, filter); err != nil {
+		logger.Error("error getting referrers: %v", err)
+		return report, err
+	}
+	if report.Countries, err = v.trace.GetCountries(ctx, filter); err != nil {
+		logger.Error("error getting countries: %v", err)
+		return report, err
+	}
+	if report.Cities, err = v.trace.GetCities(ctx, filter); err != nil {
+		logger.Error("error getting cities: %v", err)
+		return report, err
+	}
+	if report.Networks, err = v.trace.GetNetworks(ctx, filter); err != nil {
+		logger.Error("error getting networks: %v", err)
+		return report, err
+	}
+
+	return report, nil
+}
@@ -10,9 +10,13 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// DSN is the connection string of the database in cfg
+func DSN(cfg config.EnvVar) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName, cfg.DBSSLMode)
+}
+
 func NewConnection(cfg config.EnvVar) (Queryable, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName, cfg.DBSSLMode)
-	connection, err := sqlx.Open("postgres", dsn)
+	connection, err := sqlx.Open("postgres", DSN(cfg))
 	if err != nil {
 		logger.Error("Failed to open connection: %v", err)
 	}
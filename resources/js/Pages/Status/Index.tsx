@@ -0,0 +1,147 @@
+import { useEffect } from "react";
+import { useTranslation } from "react-i18next";
+import { AlertTriangle, CheckCircle2, HelpCircle, XCircle } from "lucide-react";
+import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
+import { Badge } from "@/components/ui/badge";
+import { Tooltip, TooltipContent, TooltipProvider, TooltipTrigger } from "@/components/ui/tooltip";
+import { useTheme } from "@/hooks";
+import { cn } from "@/lib/utils";
+import { ComponentStatus, Incident, StatusPageProps, UptimeDay } from "@/types";
+
+const statusStyles: Record<ComponentStatus, { color: string; icon: typeof CheckCircle2 }> = {
+  operational: { color: "text-green-600", icon: CheckCircle2 },
+  degraded: { color: "text-yellow-500", icon: AlertTriangle },
+  outage: { color: "text-red-600", icon: XCircle },
+  unknown: { color: "text-slate-400", icon: HelpCircle },
+};
+
+// A day without checks is gray, the rest go from green to red by uptime
+function barColor(day: UptimeDay) {
+  if (day.checks === 0) return "bg-slate-300 dark:bg-slate-700";
+  if (day.uptime >= 99.9) return "bg-green-500";
+  if (day.uptime >= 99) return "bg-lime-500";
+  if (day.uptime >= 95) return "bg-yellow-500";
+  return "bg-red-500";
+}
+
+function formatDate(value: string, withTime = false) {
+  const date = new Date(value);
+  return withTime ? date.toLocaleString() : date.toLocaleDateString(undefined, { timeZone: "UTC" });
+}
+
+function UptimeBars({ days }: { days: UptimeDay[] }) {
+  const { t } = useTranslation();
+
+  return (
+    <TooltipProvider delayDuration={0}>
+      <div className="flex h-8 gap-[2px]">
+        {days.map((day) => (
+          <Tooltip key={day.date}>
+            <TooltipTrigger asChild>
+              <div className={cn("h-full flex-1 rounded-sm", barColor(day))} />
+            </TooltipTrigger>
+            <TooltipContent>
+              <p className="font-semibold">{formatDate(day.date)}</p>
+              <p>{day.checks === 0 ? t("status.noData") : t("status.uptimeValue", { uptime: day.uptime.toFixed(2) })}</p>
+            </TooltipContent>
+          </Tooltip>
+        ))}
+      </div>
+    </TooltipProvider>
+  );
+}
+
+function IncidentCard({ incident }: { incident: Incident }) {
+  const { t } = useTranslation();
+
+  return (
+    <Card>
+      <CardHeader className="pb-2">
+        <div className="flex items-center justify-between gap-2">
+          <CardTitle className="text-base">{incident.title}</CardTitle>
+          <Badge variant={incident.resolvedAt ? "secondary" : incident.impact === "major" ? "destructive" : "default"}>
+            {t(`status.incident.${incident.status}`)}
+          </Badge>
+        </div>
+        <p className="text-xs text-muted-foreground">
+          {formatDate(incident.startedAt, true)}
+          {incident.resolvedAt && ` – ${formatDate(incident.resolvedAt, true)}`}
+        </p>
+      </CardHeader>
+      <CardContent className="space-y-3">
+        {incident.updates.map((update) => (
+          <div key={update.id} className="text-sm">
+            <span className="font-semibold">{t(`status.incident.${update.status}`)}</span>
+            <span className="text-muted-foreground"> · {formatDate(update.createdAt, true)}</span>
+            <p className="whitespace-pre-line">{update.message}</p>
+          </div>
+        ))}
+      </CardContent>
+    </Card>
+  );
+}
+
+export default function StatusIndex({ page }: StatusPageProps) {
+  const { t } = useTranslation();
+  const { theme, isDark, applyTheme } = useTheme();
+
+  useEffect(() => {
+    applyTheme(theme, isDark);
+  }, [theme, isDark, applyTheme]);
+
+  const overall = statusStyles[page.status];
+  const OverallIcon = overall.icon;
+
+  return (
+    <div className="mx-auto max-w-4xl space-y-8 p-6">
+      <header className="flex items-center gap-4">
+        {page.logo_url && <img src={page.logo_url} alt={page.team_name} className="h-12 w-12 rounded-md object-contain" />}
+        <h1 className="text-2xl font-bold">{t("status.title", { name: page.team_name })}</h1>
+      </header>
+
+      <Card>
+        <CardContent className="flex items-center gap-3 p-6">
+          <OverallIcon className={cn("h-8 w-8", overall.color)} />
+          <span className="text-lg font-semibold">{t(`status.overall.${page.status}`)}</span>
+        </CardContent>
+      </Card>
+
+      <section className="space-y-4">
+        {page.applications.map((app) => {
+          const style = statusStyles[app.status];
+          const Icon = style.icon;
+          return (
+            <Card key={app.id}>
+              <CardContent className="space-y-2 p-6">
+                <div className="flex items-center justify-between">
+                  <span className="font-semibold">{app.name}</span>
+                  <span className={cn("flex items-center gap-1 text-sm", style.color)}>
+                    <Icon className="h-4 w-4" />
+                    {t(`status.component.${app.status}`)}
+                  </span>
+                </div>
+                <UptimeBars days={app.days} />
+                <div className="flex justify-between text-xs text-muted-foreground">
+                  <span>{t("status.daysAgo", { days: app.days.length })}</span>
+                  <span>{t("status.uptimeValue", { uptime: app.uptime.toFixed(2) })}</span>
+                  <span>{t("status.today")}</span>
+                </div>
+              </CardContent>
+            </Card>
+          );
+        })}
+      </section>
+
+      <section className="space-y-4">
+        <h2 className="text-xl font-semibold">{t("status.incidents")}</h2>
+        {page.incidents.length === 0 ? (
+          <p className="text-sm text-muted-foreground">{t("status.noIncidents")}</p>
+        ) : (
+          page.incidents.map((incident) => <IncidentCard key={incident.id} incident={incident} />)
+        )}
+      </section>
+
+      <footer className="text-center text-xs text-muted-foreground">{t("status.updatedAt", { date: formatDate(page.generated_at, true) })}</footer>
+    </div>
+  );
+}
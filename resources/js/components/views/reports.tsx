@@ -18,6 +18,9 @@ import {addDays, format, isValid, parseISO} from "date-fns";
 import {Button} from "../ui/button";
 import {Theme, useTheme} from "@/hooks";
 import {RequestData, VisitorData} from "@/types/props";
+import {ApplicationReport, VisitorReport} from "@/types/common";
+import {VersionReportTable} from "./version-report";
+import {VisitorReportView} from "./visitor-report";
 import {useTranslation} from "react-i18next";
 
 interface ApplicationStat {
@@ -28,10 +31,12 @@ interface ApplicationStat {
   name?: string;
 }
 
-export function Reports({stats, requests, visitors}: {
+export function Reports({stats, requests, visitors, report, visitorReport}: {
   stats: ApplicationStat[];
   requests?: RequestData[];
   visitors?: VisitorData[];
+  report?: ApplicationReport[];
+  visitorReport?: VisitorReport;
 }) {
   const {t} = useTranslation();
   const {applyTheme} = useTheme();
@@ -321,6 +326,15 @@ export function Reports({stats, requests, visitors}: {
             )}
           </div>
         </div>
+        <div className="mt-8">
+          <VersionReportTable report={report} appFilter={appFilter}/>
+        </div>
+        <div className="mt-8">
+          <VisitorReportView
+            report={visitorReport}
+            appFilter={appFilter}
+            appNames={Object.fromEntries(apps.map((app) => [app.id, app.name ?? ""]))}/>
+        </div>
       </CardContent>
     </Card>
   );
@@ -0,0 +1,101 @@
+import {Fragment} from "react";
+import {useTranslation} from "react-i18next";
+import {Card, CardContent, CardHeader, CardTitle} from "@/components/ui/card";
+import {Table, TableBody, TableCell, TableHead, TableHeader, TableRow} from "@/components/ui/table";
+import {ApplicationReport, LatencyPercentiles, StatusCodeCount} from "@/types/common";
+
+const units = ["B", "KB", "MB", "GB", "TB"];
+
+function formatBytes(bytes: number): string {
+  let value = bytes;
+  let unit = 0;
+  while (value >= 1024 && unit < units.length - 1) {
+    value /= 1024;
+    unit++;
+  }
+  return `${value.toFixed(unit === 0 ? 0 : 1)} ${units[unit]}`;
+}
+
+function formatLatency(latency: LatencyPercentiles): string {
+  return [latency.p50, latency.p90, latency.p99].map((ms) => `${Math.round(ms)}`).join(" / ") + " ms";
+}
+
+// topStatusCodes folds the per method counts into one count per status and
+// keeps the most frequent ones
+function topStatusCodes(codes: StatusCodeCount[], limit = 3): string {
+  const byStatus = new Map<number, number>();
+  codes.forEach((code) => byStatus.set(code.status, (byStatus.get(code.status) ?? 0) + code.count));
+  return Array.from(byStatus.entries())
+    .sort((a, b) => b[1] - a[1])
+    .slice(0, limit)
+    .map(([status, count]) => `${status} × ${count}`)
+    .join(", ");
+}
+
+export function VersionReportTable({report, appFilter}: {
+  report?: ApplicationReport[];
+  appFilter: string;
+}) {
+  const {t} = useTranslation();
+  const rows = (report ?? []).filter((app) => appFilter === "all" || app.application_id === appFilter);
+
+  return (
+    <Card className="print:shadow-none">
+      <CardHeader>
+        <CardTitle>{t("report.title")}</CardTitle>
+      </CardHeader>
+      <CardContent>
+        <Table>
+          <TableHeader>
+            <TableRow>
+              <TableHead>{t("report.application")}</TableHead>
+              <TableHead>{t("report.version")}</TableHead>
+              <TableHead className="text-right">{t("report.requests")}</TableHead>
+              <TableHead className="text-right">{t("report.errors")}</TableHead>
+              <TableHead className="text-right">{t("report.bytesIn")}</TableHead>
+              <TableHead className="text-right">{t("report.bytesOut")}</TableHead>
+              <TableHead className="text-right">{t("report.latency")}</TableHead>
+              <TableHead>{t("report.statusCodes")}</TableHead>
+            </TableRow>
+          </TableHeader>
+          <TableBody>
+            {rows.length ? (
+              rows.map((app) => (
+                <Fragment key={app.application_id}>
+                  <TableRow className="font-medium">
+                    <TableCell>{app.name || app.application_id}</TableCell>
+                    <TableCell/>
+                    <TableCell className="text-right">{app.requests}</TableCell>
+                    <TableCell className="text-right">{app.errors}</TableCell>
+                    <TableCell className="text-right">{formatBytes(app.bytes_in)}</TableCell>
+                    <TableCell className="text-right">{formatBytes(app.bytes_out)}</TableCell>
+                    <TableCell className="text-right">{formatLatency(app.latency)}</TableCell>
+                    <TableCell>{topStatusCodes(app.status_codes ?? [])}</TableCell>
+                  </TableRow>
+                  {(app.versions ?? []).map((version) => (
+                    <TableRow key={`${app.application_id}-${version.version}`} className="text-muted-foreground">
+                      <TableCell/>
+                      <TableCell className="font-mono">{version.version || t("report.unknownVersion")}</TableCell>
+                      <TableCell className="text-right">{version.requests}</TableCell>
+                      <TableCell className="text-right">{version.errors}</TableCell>
+                      <TableCell className="text-right">{formatBytes(version.bytes_in)}</TableCell>
+                      <TableCell className="text-right">{formatBytes(version.bytes_out)}</TableCell>
+                      <TableCell className="text-right">{formatLatency(version.latency)}</TableCell>
+                      <TableCell>{topStatusCodes(version.status_codes ?? [])}</TableCell>
+                    </TableRow>
+                  ))}
+                </Fragment>
+              ))
+            ) : (
+              <TableRow>
+                <TableCell colSpan={8} className="text-center text-muted-foreground">
+                  {t("report.empty")}
+                </TableCell>
+              </TableRow>
+            )}
+          </TableBody>
+        </Table>
+      </CardContent>
+    </Card>
+  );
+}
@@ -0,0 +1,137 @@
+import {useTranslation} from "react-i18next";
+import {Card, CardContent, CardHeader, CardTitle} from "@/components/ui/card";
+import {Table, TableBody, TableCell, TableHead, TableHeader, TableRow} from "@/components/ui/table";
+import {VisitorReport} from "@/types/common";
+
+interface Ranked {
+  label: string;
+  value: number;
+}
+
+// rank adds up the rows of the selected apps by label and keeps the largest
+function rank<T extends { application_id: string }>(
+  rows: T[] | undefined,
+  appFilter: string,
+  label: (row: T) => string,
+  value: (row: T) => number,
+  limit = 10,
+): Ranked[] {
+  const totals = new Map<string, number>();
+  (rows ?? [])
+    .filter((row) => appFilter === "all" || row.application_id === appFilter)
+    .forEach((row) => totals.set(label(row), (totals.get(label(row)) ?? 0) + value(row)));
+  return Array.from(totals.entries())
+    .map(([label, value]) => ({label, value}))
+    .sort((a, b) => b.value - a.value)
+    .slice(0, limit);
+}
+
+function RankedTable({title, column, rows}: { title: string; column: string; rows: Ranked[] }) {
+  const {t} = useTranslation();
+
+  return (
+    <div>
+      <h3 className="mb-2 text-sm font-medium">{title}</h3>
+      <Table>
+        <TableHeader>
+          <TableRow>
+            <TableHead>{column}</TableHead>
+            <TableHead className="text-right">{t("report.visitors.count")}</TableHead>
+          </TableRow>
+        </TableHeader>
+        <TableBody>
+          {rows.length ? (
+            rows.map((row) => (
+              <TableRow key={row.label}>
+                <TableCell className="max-w-[240px] truncate" title={row.label}>{row.label}</TableCell>
+                <TableCell className="text-right">{row.value}</TableCell>
+              </TableRow>
+            ))
+          ) : (
+            <TableRow>
+              <TableCell colSpan={2} className="text-center text-muted-foreground">{t("report.empty")}</TableCell>
+            </TableRow>
+          )}
+        </TableBody>
+      </Table>
+    </div>
+  );
+}
+
+export function VisitorReportView({report, appFilter, appNames}: {
+  report?: VisitorReport;
+  appFilter: string;
+  appNames: Record<string, string>;
+}) {
+  const {t} = useTranslation();
+  const sessions = (report?.sessions ?? []).filter((s) => appFilter === "all" || s.application_id === appFilter);
+  const uniqueVisitors = rank(report?.unique_visitors, appFilter, (row) => row.application_id, (row) => row.visitors);
+  const visitorsOf = (appID: string) => uniqueVisitors.find((row) => row.label === appID)?.value ?? 0;
+
+  return (
+    <Card className="print:shadow-none">
+      <CardHeader>
+        <CardTitle>{t("report.visitors.title")}</CardTitle>
+      </CardHeader>
+      <CardContent className="space-y-8">
+        <Table>
+          <TableHeader>
+            <TableRow>
+              <TableHead>{t("report.application")}</TableHead>
+              <TableHead className="text-right">{t("report.visitors.uniqueVisitors")}</TableHead>
+              <TableHead className="text-right">{t("report.visitors.sessions")}</TableHead>
+              <TableHead className="text-right">{t("report.visitors.avgDuration")}</TableHead>
+              <TableHead className="text-right">{t("report.visitors.pagesPerSession")}</TableHead>
+              <TableHead className="text-right">{t("report.visitors.bounceRate")}</TableHead>
+            </TableRow>
+          </TableHeader>
+          <TableBody>
+            {sessions.length ? (
+              sessions.map((s) => (
+                <TableRow key={s.application_id}>
+                  <TableCell>{appNames[s.application_id] || s.application_id}</TableCell>
+                  <TableCell className="text-right">{visitorsOf(s.application_id)}</TableCell>
+                  <TableCell className="text-right">{s.sessions}</TableCell>
+                  <TableCell className="text-right">{`${Math.round(s.avg_duration)} s`}</TableCell>
+                  <TableCell className="text-right">{s.pages_per_session.toFixed(1)}</TableCell>
+                  <TableCell className="text-right">{`${(s.bounce_rate * 100).toFixed(1)}%`}</TableCell>
+                </TableRow>
+              ))
+            ) : (
+              <TableRow>
+                <TableCell colSpan={6} className="text-center text-muted-foreground">{t("report.empty")}</TableCell>
+              </TableRow>
+            )}
+          </TableBody>
+        </Table>
+
+        <div className="grid gap-8 md:grid-cols-2 xl:grid-cols-3">
+          <RankedTable
+            title={t("report.visitors.topPages")}
+            column={t("report.visitors.page")}
+            rows={rank(report?.top_pages, appFilter, (row) => row.page, (row) => row.views)}/>
+          <RankedTable
+            title={t("report.visitors.entryPages")}
+            column={t("report.visitors.page")}
+            rows={rank(report?.entry_pages, appFilter, (row) => row.page, (row) => row.views)}/>
+          <RankedTable
+            title={t("report.visitors.exitPages")}
+            column={t("report.visitors.page")}
+            rows={rank(report?.exit_pages, appFilter, (row) => row.page, (row) => row.views)}/>
+          <RankedTable
+            title={t("report.visitors.referrers")}
+            column={t("report.visitors.referrer")}
+            rows={rank(report?.referrers, appFilter, (row) => row.referrer, (row) => row.sessions)}/>
+          <RankedTable
+            title={t("report.visitors.countries")}
+            column={t("report.visitors.country")}
+            rows={rank(report?.countries, appFilter, (row) => row.country, (row) => row.visitors)}/>
+          <RankedTable
+            title={t("report.visitors.networks")}
+            column={t("report.visitors.network")}
+            rows={rank(report?.networks, appFilter, (row) => `AS${row.asn} ${row.as_org}`, (row) => row.visitors)}/>
+        </div>
+      </CardContent>
+    </Card>
+  );
+}
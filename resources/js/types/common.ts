@@ -124,3 +124,140 @@ export interface Trace {
   sqlStatement: string;
   email: string;
 }
+
+export interface UptimeDay {
+  application_id: string;
+  date: string;
+  checks: number;
+  healthy: number;
+  uptime: number;
+}
+
+export interface IncidentUpdate {
+  id: string;
+  incidentId: string;
+  status: IncidentStatus;
+  message: string;
+  createdAt: string;
+}
+
+export type IncidentStatus = "investigating" | "identified" | "monitoring" | "resolved";
+
+export interface Incident {
+  id: string;
+  applicationId: string | null;
+  title: string;
+  impact: "minor" | "major";
+  status: IncidentStatus;
+  startedAt: string;
+  resolvedAt: string | null;
+  updates: IncidentUpdate[];
+}
+
+export type ComponentStatus = "operational" | "degraded" | "outage" | "unknown";
+
+export interface StatusPageComponent {
+  id: string;
+  name: string;
+  status: ComponentStatus;
+  uptime: number;
+  days: UptimeDay[];
+}
+
+export interface StatusPage {
+  team_name: string;
+  logo_url: string;
+  status: ComponentStatus;
+  applications: StatusPageComponent[];
+  incidents: Incident[];
+  generated_at: string;
+}
+
+export interface LatencyPercentiles {
+  p50: number;
+  p90: number;
+  p99: number;
+}
+
+export interface StatusCodeCount {
+  method: string;
+  status: number;
+  count: number;
+}
+
+export interface VersionReport {
+  version: string;
+  requests: number;
+  errors: number;
+  bytes_in: number;
+  bytes_out: number;
+  latency: LatencyPercentiles;
+  status_codes: StatusCodeCount[];
+}
+
+export interface ApplicationReport {
+  application_id: string;
+  name: string;
+  requests: number;
+  errors: number;
+  bytes_in: number;
+  bytes_out: number;
+  latency: LatencyPercentiles;
+  status_codes: StatusCodeCount[];
+  versions: VersionReport[];
+}
+
+export interface DailyVisitors {
+  date: string;
+  application_id: string;
+  visitors: number;
+}
+
+export interface SessionStats {
+  application_id: string;
+  sessions: number;
+  avg_duration: number;
+  pages_per_session: number;
+  bounce_rate: number;
+}
+
+export interface PageCount {
+  application_id: string;
+  version?: string;
+  page: string;
+  views: number;
+  visitors?: number;
+}
+
+export interface ReferrerCount {
+  application_id: string;
+  referrer: string;
+  sessions: number;
+}
+
+export interface LocationCount {
+  application_id: string;
+  country: string;
+  region?: string;
+  city?: string;
+  visitors: number;
+}
+
+export interface NetworkCount {
+  application_id: string;
+  asn: number;
+  as_org: string;
+  visitors: number;
+}
+
+export interface VisitorReport {
+  unique_visitors: DailyVisitors[];
+  sessions: SessionStats[];
+  top_pages: PageCount[];
+  entry_pages: PageCount[];
+  exit_pages: PageCount[];
+  referrers: ReferrerCount[];
+  countries: LocationCount[];
+  cities: LocationCount[];
+  networks: NetworkCount[];
+}
@@ -1,7 +1,7 @@
 import { LucideIcon } from "lucide-react";
 import { DateRange } from "react-day-picker";
 import { ControllerRenderProps } from "react-hook-form";
-import { ApplicationDockered, Gateway, GatewayConfig, RoleWithUsers, TeamMember, TechStackWithApplications, Trace, User } from "./common";
+import { ApplicationDockered, Gateway, GatewayConfig, RoleWithUsers, StatusPage, TeamMember, TechStackWithApplications, Trace, User } from "./common";
 
 interface CommonProps {
   user: {
@@ -152,3 +152,7 @@ export interface GatewayConfigProps {
 export interface ApplicationProps extends CommonProps {
   application: ApplicationDockered;
 }
+
+export interface StatusPageProps {
+  page: StatusPage;
+}